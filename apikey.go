@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmgo/common/auth"
+	"fmgo/common/data"
+	"fmgo/common/data/model"
+	"fmt"
+	"os"
+)
+
+const apiKeyUsage = "usage: fmgo apikey create NAME SCOPE..."
+
+// runAPIKeyCommand execute apikey sub command with its arguments, returns process exit code. It mints the first admin
+// key which is then used to manage other key through the API
+func runAPIKeyCommand(args []string) int {
+	if configuration.Database.DbType == data.MemoryDbType {
+		fmt.Fprintln(os.Stderr, "memory database does not outlive the command, mint API key through the API instead")
+		return 1
+	}
+
+	if len(args) < 3 || args[0] != "create" {
+		fmt.Fprintln(os.Stderr, apiKeyUsage)
+		return 2
+	}
+
+	name, scopes := args[1], args[2:]
+	for _, scope := range scopes {
+		if !validScope(scope) {
+			fmt.Fprintf(os.Stderr, "Unknown scope %s, should be one of %v\n", scope, model.APIKeyScopes)
+			return 2
+		}
+	}
+
+	key, secret, err := auth.MintAPIKey(name, scopes, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to generate API key: %s\n", err)
+		return 1
+	}
+
+	if err := graphStore.CreateAPIKey(key); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create API key: %s\n", err)
+		return 1
+	}
+
+	fmt.Printf("Created API key %s, it is not shown again:\n%s\n", key.ID, secret)
+	return 0
+}
+
+func validScope(scope string) bool {
+	for _, s := range model.APIKeyScopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,133 @@
+package apierror
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+)
+
+// Code machine readable reason of failed request, client should act upon it rather than upon the message
+type Code string
+
+// Error code of failed request
+const (
+	// InvalidRequest request body or query string could not be parsed at all
+	InvalidRequest Code = "INVALID_REQUEST"
+	// ValidationFailed a field of the request is missing or invalid
+	ValidationFailed Code = "VALIDATION_FAILED"
+	// Unauthenticated request carries no valid bearer token
+	Unauthenticated Code = "UNAUTHENTICATED"
+	// Forbidden authenticated caller is not allowed to act on behalf of the user in request
+	Forbidden Code = "FORBIDDEN"
+	// UserNotFound no user has the given email, neither as primary email nor as alias
+	UserNotFound Code = "USER_NOT_FOUND"
+	// NotFound requested resource other than user does not exist
+	NotFound Code = "NOT_FOUND"
+	// SelfReference request relates a user to itself
+	SelfReference Code = "SELF_REFERENCE"
+	// Blocked one of the user blocks the other
+	Blocked Code = "BLOCKED"
+	// Suspended user acting in request is suspended by support staff
+	Suspended Code = "SUSPENDED"
+	// AlreadyExists the relation or resource to create is already there
+	AlreadyExists Code = "ALREADY_EXISTS"
+	// Conflict request contradicts the current state of the graph
+	Conflict Code = "CONFLICT"
+	// Unavailable server could not serve the request right now
+	Unavailable Code = "UNAVAILABLE"
+	// Internal server failed to process a valid request
+	Internal Code = "INTERNAL_ERROR"
+)
+
+var statuses = map[Code]int{
+	InvalidRequest:   http.StatusBadRequest,
+	ValidationFailed: http.StatusBadRequest,
+	Unauthenticated:  http.StatusUnauthorized,
+	Forbidden:        http.StatusForbidden,
+	UserNotFound:     http.StatusNotFound,
+	NotFound:         http.StatusNotFound,
+	SelfReference:    http.StatusBadRequest,
+	Blocked:          http.StatusForbidden,
+	Suspended:        http.StatusForbidden,
+	AlreadyExists:    http.StatusConflict,
+	Conflict:         http.StatusConflict,
+	Unavailable:      http.StatusServiceUnavailable,
+	Internal:         http.StatusInternalServerError,
+}
+
+// Error single problem of failed request as rendered in error response
+type Error struct {
+	Code Code `json:"code"`
+	// Field path of request field at fault, such as friends[1], empty when the problem is not about single field
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+	// format English message format, it is also the key of its translation
+	format string
+	args   []interface{}
+}
+
+// New create error with message formatted from English format, which is translated when rendered by Handler
+func New(code Code, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...), format: format, args: args}
+}
+
+// NewField create error about single request field
+func NewField(code Code, field, format string, args ...interface{}) *Error {
+	err := New(code, format, args...)
+	err.Field = field
+	return err
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Status http status the error is responded with
+func (e *Error) Status() int {
+	if status, ok := statuses[e.Code]; ok {
+		return status
+	}
+
+	return http.StatusInternalServerError
+}
+
+// localize get copy of the error with message in given language
+func (e *Error) localize(lang string) *Error {
+	localized := *e
+	localized.Message = fmt.Sprintf(translate(lang, e.format), e.args...)
+	return &localized
+}
+
+// Abort stop handler chain of the request with given errors, they are rendered by Handler once the chain returns
+func Abort(c *gin.Context, errs ...*Error) {
+	for _, err := range errs {
+		c.Error(err)
+	}
+	c.Abort()
+}
+
+// Handler middleware rendering errors of aborted request as {"success": false, "errors": [...]}, using http status
+// of the first error and message in the language asked by Accept-Language header
+func Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if c.Writer.Written() || len(c.Errors) == 0 {
+			return
+		}
+
+		lang := Language(c.GetHeader("Accept-Language"))
+		errs := make([]*Error, 0, len(c.Errors))
+		for _, e := range c.Errors {
+			err, ok := e.Err.(*Error)
+			if !ok {
+				glog.Errorf("Unexpected error of %s %s: %s", c.Request.Method, c.Request.URL.Path, e.Err)
+				err = New(Internal, "Internal server error")
+			}
+			errs = append(errs, err.localize(lang))
+		}
+
+		c.JSON(errs[0].Status(), gin.H{"success": false, "errors": errs})
+	}
+}
@@ -0,0 +1,142 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestStatus(t *testing.T) {
+	tests := []struct {
+		code   Code
+		status int
+	}{
+		{InvalidRequest, http.StatusBadRequest},
+		{ValidationFailed, http.StatusBadRequest},
+		{SelfReference, http.StatusBadRequest},
+		{Unauthenticated, http.StatusUnauthorized},
+		{Forbidden, http.StatusForbidden},
+		{Blocked, http.StatusForbidden},
+		{Suspended, http.StatusForbidden},
+		{UserNotFound, http.StatusNotFound},
+		{NotFound, http.StatusNotFound},
+		{AlreadyExists, http.StatusConflict},
+		{Conflict, http.StatusConflict},
+		{Unavailable, http.StatusServiceUnavailable},
+		{Internal, http.StatusInternalServerError},
+		{Code("UNKNOWN"), http.StatusInternalServerError},
+	}
+	for _, test := range tests {
+		if status := New(test.code, "failed").Status(); status != test.status {
+			t.Errorf("status of %s is %d, want %d", test.code, status, test.status)
+		}
+	}
+}
+
+func TestLanguage(t *testing.T) {
+	tests := []struct {
+		header string
+		lang   string
+	}{
+		{"", "en"},
+		{"id", "id"},
+		{"id-ID,id;q=0.9,en;q=0.8", "id"},
+		{"ID-id", "id"},
+		{"en-US,id;q=0.5", "en"},
+		{"en;q=0.4, id;q=0.6", "id"},
+		{"fr-FR,fr;q=0.9", "en"},
+		{"fr-FR,id;q=0.2", "id"},
+		{"id;q=0", "en"},
+		{"id;q=abc", "id"},
+		{"*", "en"},
+	}
+	for _, test := range tests {
+		if lang := Language(test.header); lang != test.lang {
+			t.Errorf("Language(%q) = %s, want %s", test.header, lang, test.lang)
+		}
+	}
+}
+
+func TestCatalog(t *testing.T) {
+	for lang, catalog := range catalogs {
+		for format, translated := range catalog {
+			// translation is formatted with arguments of English format, it must take just as many of them
+			if strings.Count(format, "%s") != strings.Count(translated, "%s") || strings.Count(format, "%d") != strings.Count(translated, "%d") {
+				t.Errorf("%s translation %q does not take the arguments of %q", lang, translated, format)
+			}
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Handler())
+	router.GET("/fail", func(c *gin.Context) {
+		Abort(c, NewField(ValidationFailed, "friends[1]", "%s is required", "friends[1]"), New(Internal, "Internal server error"))
+	})
+	router.GET("/panic", func(c *gin.Context) {
+		c.Error(errors.New("connection refused"))
+		c.Abort()
+	})
+	router.GET("/written", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"success": true})
+		Abort(c, New(Internal, "Internal server error"))
+	})
+
+	tests := []struct {
+		path     string
+		language string
+		status   int
+		code     Code
+		message  string
+	}{
+		{"/fail", "", http.StatusBadRequest, ValidationFailed, "friends[1] is required"},
+		{"/fail", "id-ID,id;q=0.9", http.StatusBadRequest, ValidationFailed, "friends[1] wajib diisi"},
+		{"/fail", "fr", http.StatusBadRequest, ValidationFailed, "friends[1] is required"},
+		{"/panic", "", http.StatusInternalServerError, Internal, "Internal server error"},
+		{"/panic", "id", http.StatusInternalServerError, Internal, "Terjadi kesalahan pada server"},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, test.path, nil)
+		req.Header.Set("Accept-Language", test.language)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var resp struct {
+			Success bool     `json:"success"`
+			Errors  []*Error `json:"errors"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s responded with invalid JSON %q: %s", test.path, w.Body.String(), err)
+		}
+		if w.Code != test.status || resp.Success || len(resp.Errors) == 0 {
+			t.Errorf("%s in %q responded %d %s", test.path, test.language, w.Code, w.Body.String())
+			continue
+		}
+		if err := resp.Errors[0]; err.Code != test.code || err.Message != test.message {
+			t.Errorf("%s in %q got %s %q, want %s %q", test.path, test.language, err.Code, err.Message, test.code, test.message)
+		}
+	}
+
+	// every error is rendered, status comes from the first one
+	req := httptest.NewRequest(http.MethodGet, "/fail", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if !strings.Contains(w.Body.String(), `"field":"friends[1]"`) || strings.Count(w.Body.String(), `"code"`) != 2 {
+		t.Errorf("response %s does not carry both errors", w.Body.String())
+	}
+
+	// response already written by handler is left alone
+	req = httptest.NewRequest(http.MethodGet, "/written", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "errors") {
+		t.Errorf("written response was overwritten by %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,189 @@
+package apierror
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultLanguage language of message format given to New, used when client asks for none of the translated one
+const defaultLanguage = "en"
+
+// catalogs translation of English message format keyed by language
+var catalogs = map[string]map[string]string{
+	"id": {
+		// request
+		"Internal server error":           "Terjadi kesalahan pada server",
+		"Request could not be parsed: %s": "Permintaan tidak dapat dibaca: %s",
+		"Tenant %s is invalid":            "Tenant %s tidak valid",
+		"WebSocket upgrade failed: %s":    "Gagal beralih ke WebSocket: %s",
+
+		// validation
+		"%s is required":                      "%s wajib diisi",
+		"%s is invalid":                       "%s tidak valid",
+		"%s should be %s":                     "%s harus %s",
+		"%s should be at least %s":            "%s minimal %s",
+		"%s should be at most %s":             "%s maksimal %s",
+		"%s should be exactly %s characters":  "%s harus tepat %s karakter",
+		"%s should be at least %s characters": "%s minimal %s karakter",
+		"%s should be at most %s characters":  "%s maksimal %s karakter",
+		"%s should have exactly %s items":     "%s harus berisi tepat %s item",
+		"%s should have at least %s items":    "%s harus berisi minimal %s item",
+		"%s should have at most %s items":     "%s harus berisi maksimal %s item",
+		"%s should be one of %s":              "%s harus salah satu dari %s",
+		"%s must use http or https scheme":    "%s harus menggunakan skema http atau https",
+		"%s must be a public address":         "%s harus alamat publik",
+		"%s host could not be resolved":       "host %s tidak dapat ditemukan",
+		"%s is an invalid email format":       "%s bukan format email yang valid",
+		"%s is invalid inbox entry id":        "%s bukan id kotak masuk yang valid",
+		"%s must be in the future":            "%s harus di masa depan",
+
+		// authentication
+		"Authorization header is not a bearer token":   "Header Authorization bukan bearer token",
+		"Bearer token is required":                     "Bearer token wajib disertakan",
+		"Bearer token is invalid: %s":                  "Bearer token tidak valid: %s",
+		"Caller is not allowed to act on behalf of %s": "Pemanggil tidak diizinkan bertindak atas nama %s",
+		"%s does not prove ownership of %s":            "%s tidak membuktikan kepemilikan %s",
+		"API key is required":                          "API key wajib disertakan",
+		"API key is invalid: %s":                       "API key tidak valid: %s",
+		"API key is not granted %s scope":              "API key tidak memiliki cakupan %s",
+		"API key is not allowed to act on tenant %s":   "API key tidak diizinkan bertindak pada tenant %s",
+		"Caller is not allowed to act on tenant %s":    "Pemanggil tidak diizinkan bertindak pada tenant %s",
+		"Caller with %s role is required":              "Pemanggil dengan peran %s wajib",
+
+		// missing resource
+		"User with email %s does not exist":     "Pengguna dengan email %s tidak ditemukan",
+		"Alias does not exist":                  "Alias tidak ditemukan",
+		"Webhook does not exist":                "Webhook tidak ditemukan",
+		"Message does not exist":                "Pesan tidak ditemukan",
+		"API key does not exist":                "API key tidak ditemukan",
+		"Pending friend request does not exist": "Permintaan pertemanan yang menunggu tidak ditemukan",
+
+		// conflict
+		"Alias is the primary email of the user":                                                                                   "Alias adalah email utama pengguna",
+		"New email is the same as current email":                                                                                   "Email baru sama dengan email saat ini",
+		"Requestor and target are already friends":                                                                                 "Peminta dan target sudah berteman",
+		"Pending friend request between requestor and target already exist":                                                        "Permintaan pertemanan yang menunggu antara peminta dan target sudah ada",
+		"Email %s is already used by another user, merge both users instead":                                                       "Email %s sudah digunakan pengguna lain, gabungkan kedua pengguna sebagai gantinya",
+		"Could not merge users who are friends, subscribed to or blocking each other, or have pending friend request between them": "Tidak dapat menggabungkan pengguna yang saling berteman, berlangganan atau memblokir, atau memiliki permintaan pertemanan yang menunggu",
+
+		// self reference
+		"Could not connect same email":                             "Tidak dapat menghubungkan email yang sama",
+		"Could not connect same user":                              "Tidak dapat menghubungkan pengguna yang sama",
+		"Could not get common friend list from same email address": "Tidak dapat mengambil daftar teman bersama dari alamat email yang sama",
+		"Could not disconnect same email":                          "Tidak dapat memutuskan email yang sama",
+		"Could not find path to self":                              "Tidak dapat mencari jalur ke diri sendiri",
+		"Could not merge user into itself":                         "Tidak dapat menggabungkan pengguna dengan dirinya sendiri",
+		"Could not send friend request to self":                    "Tidak dapat mengirim permintaan pertemanan ke diri sendiri",
+		"Could not subscribe to self":                              "Tidak dapat berlangganan ke diri sendiri",
+		"Could not unsubscribe from self":                          "Tidak dapat berhenti berlangganan dari diri sendiri",
+		"Could not block self":                                     "Tidak dapat memblokir diri sendiri",
+		"Could not unblock self":                                   "Tidak dapat membuka blokir diri sendiri",
+
+		// block
+		"Friend connection are being blocked":  "Pertemanan sedang diblokir",
+		"Friend request are being blocked":     "Permintaan pertemanan sedang diblokir",
+		"Requestor is being blocked by target": "Peminta sedang diblokir oleh target",
+
+		// suspension
+		"User %s is suspended":     "Pengguna %s sedang ditangguhkan",
+		"User %s is not suspended": "Pengguna %s tidak sedang ditangguhkan",
+
+		// server
+		"Server is shutting down": "Server sedang dimatikan",
+
+		// internal failure
+		"Failed to start new db transaction": "Gagal memulai transaksi basis data",
+		"Failed to commit db transaction":    "Gagal menyimpan transaksi basis data",
+		"Failed to get user":                 "Gagal mengambil pengguna",
+		"Failed to create new user":          "Gagal membuat pengguna baru",
+		"Failed to update profile":           "Gagal memperbarui profil",
+		"Failed to change email":             "Gagal mengubah email",
+		"Failed to merge users":              "Gagal menggabungkan pengguna",
+		"Failed to add alias":                "Gagal menambah alias",
+		"Failed to remove alias":             "Gagal menghapus alias",
+		"Failed to get alias list":           "Gagal mengambil daftar alias",
+		"Failed to check friend connection":  "Gagal memeriksa pertemanan",
+		"Failed to check block":              "Gagal memeriksa blokir",
+		"Failed to create friend connection": "Gagal membuat pertemanan",
+		"Failed to remove friend connection": "Gagal menghapus pertemanan",
+		"Failed to get friend list":          "Gagal mengambil daftar teman",
+		"Failed to find connection path":     "Gagal mencari jalur pertemanan",
+		"Failed to get suggested users":      "Gagal mengambil saran pengguna",
+		"Failed to create friend request":    "Gagal membuat permintaan pertemanan",
+		"Failed to get friend request":       "Gagal mengambil permintaan pertemanan",
+		"Failed to update friend request":    "Gagal memperbarui permintaan pertemanan",
+		"Failed to create subscription":      "Gagal membuat langganan",
+		"Failed to remove subscription":      "Gagal menghapus langganan",
+		"Failed to create block":             "Gagal membuat blokir",
+		"Failed to remove block":             "Gagal menghapus blokir",
+		"Failed to get block list":           "Gagal mengambil daftar blokir",
+		"Failed to get subscriber list":      "Gagal mengambil daftar pelanggan",
+		"Failed to get subscription list":    "Gagal mengambil daftar langganan",
+		"Failed to create message":           "Gagal membuat pesan",
+		"Failed to get message":              "Gagal mengambil pesan",
+		"Failed to get recipient list":       "Gagal mengambil daftar penerima",
+		"Failed to get inbox":                "Gagal mengambil kotak masuk",
+		"Failed to mark inbox as read":       "Gagal menandai kotak masuk sebagai sudah dibaca",
+		"Failed to get delivery list":        "Gagal mengambil daftar pengiriman",
+		"Failed to create webhook":           "Gagal membuat webhook",
+		"Failed to generate webhook secret":  "Gagal membuat rahasia webhook",
+		"Failed to get webhook list":         "Gagal mengambil daftar webhook",
+		"Failed to remove webhook":           "Gagal menghapus webhook",
+		"Failed to authenticate API key":     "Gagal mengautentikasi API key",
+		"Failed to generate API key":         "Gagal membuat API key",
+		"Failed to create API key":           "Gagal menyimpan API key",
+		"Failed to get API key list":         "Gagal mengambil daftar API key",
+		"Failed to get API key":              "Gagal mengambil API key",
+		"Failed to revoke API key":           "Gagal mencabut API key",
+		"Failed to update suspension":        "Gagal memperbarui penangguhan",
+		"Failed to get graph counts":         "Gagal mengambil jumlah data graf",
+		"Failed to get audit events":         "Gagal mengambil jejak audit",
+		"Failed to record audit event":       "Gagal mencatat jejak audit",
+	},
+}
+
+// translate get message format in given language, falling back to the English one when it has no translation
+func translate(lang, format string) string {
+	if translated, ok := catalogs[lang][format]; ok {
+		return translated
+	}
+
+	return format
+}
+
+// Language pick the most preferred language of Accept-Language header that messages are translated into, e.g. id for
+// "id-ID,id;q=0.9,en;q=0.8", falling back to English
+func Language(header string) string {
+	type preference struct {
+		lang    string
+		quality float64
+	}
+
+	var preferences []preference
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		lang := strings.ToLower(strings.TrimSpace(strings.SplitN(params[0], "-", 2)[0]))
+		quality := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					quality = q
+				}
+			}
+		}
+		if lang != "" && quality > 0 {
+			preferences = append(preferences, preference{lang, quality})
+		}
+	}
+	sort.SliceStable(preferences, func(i, j int) bool { return preferences[i].quality > preferences[j].quality })
+
+	for _, p := range preferences {
+		if _, ok := catalogs[p.lang]; ok || p.lang == defaultLanguage {
+			return p.lang
+		}
+	}
+
+	return defaultLanguage
+}
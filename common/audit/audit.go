@@ -0,0 +1,88 @@
+package audit
+
+import (
+	"fmgo/common/apierror"
+	"fmgo/common/auth"
+	"fmgo/common/data"
+	"fmgo/common/data/model"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+	"github.com/satori/go.uuid"
+)
+
+// Header carries id of the request, given by client or proxy to correlate its own log, and echoed in response
+const Header = "X-Request-ID"
+
+// contextKey context key of id of the request
+const contextKey = "fmgo.audit.requestid"
+
+// eventsKey context key of audit events recorded for the request and not yet committed
+const eventsKey = "fmgo.audit.events"
+
+var requestIDPattern = regexp.MustCompile("^[A-Za-z0-9._:-]{1,64}$")
+
+// Middleware take request id from request header, or generate one when it is missing or malformed, then put it on
+// the context and response header
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(Header)
+		if !requestIDPattern.MatchString(id) {
+			id = uuid.NewV4().String()
+		}
+
+		c.Set(contextKey, id)
+		c.Header(Header, id)
+		c.Next()
+	}
+}
+
+// RequestID get id of the request, empty when Middleware is not installed
+func RequestID(c *gin.Context) string {
+	return c.GetString(contextKey)
+}
+
+// Record queue audit event of an action done by the caller of the request. It is stored by Commit in the
+// transaction of the action itself, so the action is never done without its event
+func Record(c *gin.Context, action, subject, target, detail string) {
+	c.Set(eventsKey, append(recorded(c), model.AuditEvent{
+		Actor:     auth.Actor(c),
+		Action:    action,
+		Subject:   subject,
+		Target:    target,
+		Detail:    detail,
+		RequestID: RequestID(c),
+		ClientIP:  c.ClientIP(),
+	}))
+}
+
+// Commit store every audit event recorded for the request in its transaction then commit it. Request is aborted and
+// false is returned when either fails, the transaction is then rolled back
+func Commit(c *gin.Context, tx data.GraphStore) bool {
+	events := recorded(c)
+	c.Set(eventsKey, []model.AuditEvent(nil))
+	for i := range events {
+		if err := tx.CreateAuditEvent(&events[i]); err != nil {
+			tx.Rollback()
+			glog.Errorf("Failed to record audit event %s of %s: %s", events[i].Action, events[i].Subject, err)
+			apierror.Abort(c, apierror.New(apierror.Internal, "Failed to record audit event"))
+			return false
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		glog.Errorf("Failed to commit db transaction: %s", err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to commit db transaction"))
+		return false
+	}
+
+	return true
+}
+
+// recorded get audit events recorded for the request and not yet committed
+func recorded(c *gin.Context) []model.AuditEvent {
+	value, _ := c.Get(eventsKey)
+	events, _ := value.([]model.AuditEvent)
+	return events
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmgo/common/data"
+	"fmgo/common/data/model"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/satori/go.uuid"
+)
+
+const (
+	// apiKeyPrefix marks API key so it is recognized when leaked, it is followed by hex encoded key id, a dot and
+	// the secret
+	apiKeyPrefix = "fmgo_"
+	// touchInterval how often last used time of API key is recorded, so busy key does not write on every request
+	touchInterval = time.Minute
+)
+
+// keyError reason API key is refused, other error of API key authentication is a store failure
+type keyError string
+
+func (e keyError) Error() string { return string(e) }
+
+const (
+	errMalformedKey keyError = "malformed key"
+	errUnknownKey   keyError = "unknown key"
+	errRevokedKey   keyError = "key is revoked"
+	errExpiredKey   keyError = "key is expired"
+)
+
+// MintAPIKey create API key with fresh random secret, returned along with the key string to hand to its client. Only
+// hash of the secret is kept in the model, so the key string can not be shown again once it is lost
+func MintAPIKey(name string, scopes []string, expiresAt *time.Time) (*model.APIKey, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", err
+	}
+
+	secret := base64.RawURLEncoding.EncodeToString(buf)
+	key := &model.APIKey{Name: name, SecretHash: hashSecret(secret), Scopes: strings.Join(scopes, " "), ExpiresAt: expiresAt}
+	key.ID = uuid.NewV4()
+	return key, apiKeyPrefix + hex.EncodeToString(key.ID.Bytes()) + "." + secret, nil
+}
+
+// parseAPIKey split key string into key id and secret
+func parseAPIKey(s string) (uuid.UUID, string, error) {
+	if !strings.HasPrefix(s, apiKeyPrefix) {
+		return uuid.Nil, "", errMalformedKey
+	}
+
+	parts := strings.SplitN(s[len(apiKeyPrefix):], ".", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return uuid.Nil, "", errMalformedKey
+	}
+
+	b, err := hex.DecodeString(parts[0])
+	if err != nil {
+		return uuid.Nil, "", errMalformedKey
+	}
+	id, err := uuid.FromBytes(b)
+	if err != nil {
+		return uuid.Nil, "", errMalformedKey
+	}
+
+	return id, parts[1], nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// authenticateKey find active API key of key string, recording when it is used
+func (a *Authenticator) authenticateKey(s string) (*model.APIKey, error) {
+	id, secret, err := parseAPIKey(s)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := a.keys.FindAPIKey(id)
+	if err == data.ErrNotFound {
+		return nil, errUnknownKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// wrong secret is reported the same as unknown id, so the key id alone tells nothing to whoever guesses
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(key.SecretHash)) != 1 {
+		return nil, errUnknownKey
+	}
+
+	now := time.Now()
+	if key.RevokedAt != nil {
+		return nil, errRevokedKey
+	}
+	if !key.Active(now) {
+		return nil, errExpiredKey
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= touchInterval {
+		if err := a.keys.TouchAPIKey(key.ID, now); err != nil {
+			glog.Warningf("Failed to record last use of API key %s: %s", key.ID, err)
+		}
+		key.LastUsedAt = &now
+	}
+
+	return key, nil
+}
@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"encoding/hex"
+	"fmgo/common/apierror"
+	"fmgo/common/config"
+	"fmgo/common/data"
+	"fmgo/common/data/model"
+	"fmgo/common/mailaddr"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// mint create API key of given scopes in store, returning it along with its key string
+func mint(t *testing.T, store data.APIKeyRepository, expiresAt *time.Time, scopes ...string) (*model.APIKey, string) {
+	key, s, err := MintAPIKey("service", scopes, expiresAt)
+	if err != nil {
+		t.Fatalf("MintAPIKey: %s", err)
+	}
+	if err := store.CreateAPIKey(key); err != nil {
+		t.Fatalf("CreateAPIKey: %s", err)
+	}
+
+	return key, s
+}
+
+func TestParseAPIKey(t *testing.T) {
+	key, s, err := MintAPIKey("service", []string{model.ScopeFriendRead}, nil)
+	if err != nil {
+		t.Fatalf("MintAPIKey: %s", err)
+	}
+	if !strings.HasPrefix(s, apiKeyPrefix) || key.SecretHash == "" || strings.Contains(s, key.SecretHash) {
+		t.Fatalf("key string %q does not look like fmgo_<id>.<secret> of hash %s", s, key.SecretHash)
+	}
+
+	id, secret, err := parseAPIKey(s)
+	if err != nil || id != key.ID || hashSecret(secret) != key.SecretHash {
+		t.Fatalf("parseAPIKey got %s, %v, want id %s and secret of the hash", id, err, key.ID)
+	}
+
+	hexID := hex.EncodeToString(key.ID.Bytes())
+	for _, malformed := range []string{
+		"",
+		hexID + "." + secret,
+		"fmgo-" + hexID + "." + secret,
+		"fmgo_" + hexID,
+		"fmgo_" + hexID + ".",
+		"fmgo_" + "zz" + hexID[2:] + "." + secret,
+		"fmgo_" + hexID[2:] + "." + secret,
+	} {
+		if _, _, err := parseAPIKey(malformed); err != errMalformedKey {
+			t.Errorf("parseAPIKey(%q) returned %v, want errMalformedKey", malformed, err)
+		}
+	}
+}
+
+func TestAuthenticateKey(t *testing.T) {
+	store := data.NewMemoryStore()
+	a, err := NewAuthenticator(config.AuthConfiguration{}, mailaddr.NewCanonicalizer(config.EmailConfiguration{}), store)
+	if err != nil {
+		t.Fatalf("NewAuthenticator: %s", err)
+	}
+
+	key, s := mint(t, store, nil, model.ScopeFriendRead)
+	authenticated, err := a.authenticateKey(s)
+	if err != nil || authenticated.ID != key.ID || authenticated.LastUsedAt == nil {
+		t.Fatalf("authenticateKey got %+v, %v", authenticated, err)
+	}
+	stored, _ := store.FindAPIKey(key.ID)
+	if stored.LastUsedAt == nil {
+		t.Fatal("last use of key was not recorded")
+	}
+
+	// use within touchInterval is not written again
+	lastUsedAt := *stored.LastUsedAt
+	if _, err := a.authenticateKey(s); err != nil {
+		t.Fatalf("authenticateKey: %s", err)
+	}
+	if stored, _ := store.FindAPIKey(key.ID); !stored.LastUsedAt.Equal(lastUsedAt) {
+		t.Errorf("last use was written again after %s", stored.LastUsedAt.Sub(lastUsedAt))
+	}
+
+	past := time.Now().Add(-time.Minute)
+	_, expired := mint(t, store, &past, model.ScopeFriendRead)
+	revokedKey, revoked := mint(t, store, nil, model.ScopeFriendRead)
+	if _, err := store.RevokeAPIKey(revokedKey.ID); err != nil {
+		t.Fatalf("RevokeAPIKey: %s", err)
+	}
+	id, _, _ := parseAPIKey(s)
+	unknown, _, _ := MintAPIKey("unknown", nil, nil)
+
+	tests := []struct {
+		name string
+		key  string
+		err  error
+	}{
+		{"malformed", "fmgo_garbage", errMalformedKey},
+		{"wrong secret", apiKeyPrefix + hex.EncodeToString(id.Bytes()) + ".wrong", errUnknownKey},
+		{"unknown id", apiKeyPrefix + hex.EncodeToString(unknown.ID.Bytes()) + "." + s[strings.Index(s, ".")+1:], errUnknownKey},
+		{"expired", expired, errExpiredKey},
+		{"revoked", revoked, errRevokedKey},
+	}
+	for _, test := range tests {
+		if _, err := a.authenticateKey(test.key); err != test.err {
+			t.Errorf("%s: authenticateKey returned %v, want %v", test.name, err, test.err)
+		}
+	}
+}
+
+func TestRequireKeyScope(t *testing.T) {
+	store := data.NewMemoryStore()
+	gin.SetMode(gin.TestMode)
+	authenticator, err := NewAuthenticator(config.AuthConfiguration{Enabled: true, Secret: testSecret}, mailaddr.NewCanonicalizer(config.EmailConfiguration{}), store)
+	if err != nil {
+		t.Fatalf("NewAuthenticator: %s", err)
+	}
+
+	router := gin.New()
+	router.Use(apierror.Handler(), authenticator.Middleware(), RequireKeyScope(model.ScopeFriendWrite))
+	router.GET("/service", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"success": true, "actor": Actor(c)})
+	})
+
+	_, reader := mint(t, store, nil, model.ScopeFriendRead)
+	_, writer := mint(t, store, nil, model.ScopeFriendWrite)
+	_, admin := mint(t, store, nil, model.ScopeAdmin)
+	token := signHS256(t, []byte(testSecret), hs256, claimsOf(map[string]interface{}{"roles": "admin"}))
+
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		status int
+	}{
+		{"key granted scope", apiKeyHeader, writer, http.StatusOK},
+		{"admin key", apiKeyHeader, admin, http.StatusOK},
+		{"key lacking scope", apiKeyHeader, reader, http.StatusForbidden},
+		{"invalid key", apiKeyHeader, "fmgo_garbage", http.StatusUnauthorized},
+		{"user", "Authorization", "Bearer " + token, http.StatusForbidden},
+		{"anonymous", "", "", http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/service", nil)
+		if test.header != "" {
+			req.Header.Set(test.header, test.value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != test.status {
+			t.Errorf("%s responded %d %s, want %d", test.name, w.Code, w.Body.String(), test.status)
+		}
+		if test.status == http.StatusOK && !strings.Contains(w.Body.String(), `"actor":"apikey:`) {
+			t.Errorf("%s responded %s without key actor", test.name, w.Body.String())
+		}
+	}
+}
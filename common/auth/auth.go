@@ -0,0 +1,266 @@
+package auth
+
+import (
+	"fmgo/common/apierror"
+	"fmgo/common/config"
+	"fmgo/common/data"
+	"fmgo/common/data/model"
+	"fmgo/common/mailaddr"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+)
+
+const (
+	// callerKey context key of canonical email of authenticated caller
+	callerKey = "fmgo.auth.caller"
+	// rolesKey context key of roles of authenticated caller
+	rolesKey = "fmgo.auth.roles"
+	// tenantKey context key of tenant authenticated caller is bound to
+	tenantKey = "fmgo.auth.tenant"
+	// authenticatorKey context key of Authenticator which authenticated the request
+	authenticatorKey = "fmgo.auth.authenticator"
+	// apiKeyKey context key of API key of service caller
+	apiKeyKey = "fmgo.auth.apikey"
+	// apiKeyHeader carries API key of backend service
+	apiKeyHeader = "X-API-Key"
+	// tokenQueryParam carries the token of client unable to set header, such as EventSource and browser WebSocket
+	tokenQueryParam = "access_token"
+)
+
+// RoleAdmin role of support staff allowed to inspect and fix the social graph of any user
+const RoleAdmin = "admin"
+
+// Authenticator authenticate API caller by service API key or, when enabled, by JWT bearer token of user
+type Authenticator struct {
+	// verifier is nil when bearer token authentication is disabled
+	verifier      *Verifier
+	canonicalizer *mailaddr.Canonicalizer
+	keys          data.APIKeyRepository
+}
+
+// NewAuthenticator initialize new Authenticator verifying token as configured and API key kept in given repository
+func NewAuthenticator(cfg config.AuthConfiguration, canonicalizer *mailaddr.Canonicalizer, keys data.APIKeyRepository) (*Authenticator, error) {
+	a := &Authenticator{canonicalizer: canonicalizer, keys: keys}
+	if cfg.Enabled {
+		verifier, err := NewVerifier(cfg)
+		if err != nil {
+			return nil, err
+		}
+		a.verifier = verifier
+	}
+
+	return a, nil
+}
+
+// Middleware authenticate request carrying API key, putting the key on the context, or refuse it with 401 when the
+// key is not valid. Request without API key needs valid bearer token when it is enabled, email of the caller is then
+// put on the context, otherwise it goes through anonymously
+func (a *Authenticator) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s := c.GetHeader(apiKeyHeader); s != "" {
+			key, err := a.authenticateKey(s)
+			if _, ok := err.(keyError); ok {
+				unauthenticated(c, apierror.New(apierror.Unauthenticated, "API key is invalid: %s", err.Error()))
+				return
+			}
+			if err != nil {
+				glog.Errorf("Failed to authenticate API key: %s", err)
+				apierror.Abort(c, apierror.New(apierror.Internal, "Failed to authenticate API key"))
+				return
+			}
+
+			c.Set(apiKeyKey, key)
+			if key.Tenant != "" {
+				c.Set(tenantKey, key.Tenant)
+			}
+			c.Next()
+			return
+		}
+
+		if a.verifier == nil {
+			c.Next()
+			return
+		}
+
+		token := c.Query(tokenQueryParam)
+		if header := c.GetHeader("Authorization"); header != "" {
+			if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+				unauthenticated(c, apierror.New(apierror.Unauthenticated, "Authorization header is not a bearer token"))
+				return
+			}
+
+			token = strings.TrimSpace(header[7:])
+		}
+		if token == "" {
+			unauthenticated(c, apierror.New(apierror.Unauthenticated, "Bearer token is required"))
+			return
+		}
+
+		identity, err := a.authenticate(token)
+		if err != nil {
+			unauthenticated(c, apierror.New(apierror.Unauthenticated, "Bearer token is invalid: %s", err.Error()))
+			return
+		}
+
+		c.Set(callerKey, identity.Email)
+		c.Set(rolesKey, identity.Roles)
+		c.Set(tenantKey, identity.Tenant)
+		c.Set(authenticatorKey, a)
+		c.Next()
+	}
+}
+
+// authenticate verify token and get identity of its subject with canonical email
+func (a *Authenticator) authenticate(token string) (*Identity, error) {
+	identity, err := a.verifier.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+
+	identity.Email = a.canonicalizer.Canonicalize(identity.Email)
+	if identity.Tenant == "" {
+		identity.Tenant = data.DefaultTenant
+	}
+	return identity, nil
+}
+
+func unauthenticated(c *gin.Context, err *apierror.Error) {
+	c.Header("WWW-Authenticate", `Bearer realm="fmgo"`)
+	apierror.Abort(c, err)
+}
+
+// Caller get canonical email of authenticated caller, empty when authentication is disabled or caller is a service
+func Caller(c *gin.Context) string {
+	return c.GetString(callerKey)
+}
+
+// Actor get who made the request for audit trail: canonical email of user, apikey:<id> of service, or empty when caller
+// is anonymous
+func Actor(c *gin.Context) string {
+	if key := APIKey(c); key != nil {
+		return "apikey:" + key.ID.String()
+	}
+
+	return Caller(c)
+}
+
+// Tenant get tenant authenticated caller is bound to, either by its token or by its API key. It is not ok when caller
+// may act on any tenant, that is anonymous caller and API key bound to no tenant
+func Tenant(c *gin.Context) (string, bool) {
+	tenant := c.GetString(tenantKey)
+	return tenant, tenant != ""
+}
+
+// HasRole check that authenticated user caller is granted given role
+func HasRole(c *gin.Context, role string) bool {
+	value, ok := c.Get(rolesKey)
+	if !ok {
+		return false
+	}
+
+	for _, r := range value.([]string) {
+		if r == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+// APIKey get API key of service caller, nil when caller is not a service
+func APIKey(c *gin.Context) *model.APIKey {
+	if key, ok := c.Get(apiKeyKey); ok {
+		return key.(*model.APIKey)
+	}
+
+	return nil
+}
+
+// RequireScope middleware refusing API key lacking given scope with 403. User and anonymous caller is let through,
+// as it may only act on its own behalf which is checked by the handler
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if key := APIKey(c); key != nil && !key.HasScope(scope) {
+			apierror.Abort(c, apierror.New(apierror.Forbidden, "API key is not granted %s scope", scope))
+		}
+	}
+}
+
+// RequireKeyScope middleware letting through only API key granted given scope, for endpoint not acting on behalf of
+// any user. Request without API key is refused with 401, or 403 when it is made by user
+func RequireKeyScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := APIKey(c)
+		if key == nil && Caller(c) == "" {
+			unauthenticated(c, apierror.New(apierror.Unauthenticated, "API key is required"))
+			return
+		}
+		if key == nil {
+			apierror.Abort(c, apierror.New(apierror.Forbidden, "API key is required"))
+			return
+		}
+		if !key.HasScope(scope) {
+			apierror.Abort(c, apierror.New(apierror.Forbidden, "API key is not granted %s scope", scope))
+		}
+	}
+}
+
+// RequireRole middleware letting through only user granted given role, or API key granted admin scope. Anonymous
+// request is refused with 401, otherwise with 403
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if key := APIKey(c); key != nil {
+			if !key.HasScope(model.ScopeAdmin) {
+				apierror.Abort(c, apierror.New(apierror.Forbidden, "API key is not granted %s scope", model.ScopeAdmin))
+			}
+			return
+		}
+		if Caller(c) == "" {
+			unauthenticated(c, apierror.New(apierror.Unauthenticated, "Bearer token is required"))
+			return
+		}
+		if !HasRole(c, role) {
+			apierror.Abort(c, apierror.New(apierror.Forbidden, "Caller with %s role is required", role))
+		}
+	}
+}
+
+// Authorize check that authenticated caller is one of given canonical email, otherwise the request is aborted with 403
+// and false is returned. It always passes for service caller, whose scope is checked by RequireScope, and when
+// authentication is disabled
+func Authorize(c *gin.Context, emails ...string) bool {
+	caller, ok := c.Get(callerKey)
+	if !ok {
+		return true
+	}
+
+	for _, email := range emails {
+		if email == caller {
+			return true
+		}
+	}
+
+	apierror.Abort(c, apierror.New(apierror.Forbidden, "Caller is not allowed to act on behalf of %s", strings.Join(emails, " or ")))
+	return false
+}
+
+// Prove check that token given in request field belongs to canonical email, for request which needs consent of other
+// user than the caller. Request is aborted with 403 and false is returned when it does not, it always passes for
+// service caller and when authentication is disabled
+func Prove(c *gin.Context, field, token, email string) bool {
+	value, ok := c.Get(authenticatorKey)
+	if !ok {
+		return true
+	}
+
+	// the same email of another tenant is another user
+	owner, err := value.(*Authenticator).authenticate(token)
+	if err != nil || owner.Email != email || owner.Tenant != c.GetString(tenantKey) {
+		apierror.Abort(c, apierror.NewField(apierror.Forbidden, field, "%s does not prove ownership of %s", field, email))
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmgo/common/apierror"
+	"fmgo/common/config"
+	"fmgo/common/data"
+	"fmgo/common/mailaddr"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newRouter serve endpoint acting on behalf of email given in query string behind authentication middleware
+func newRouter(t *testing.T, store data.GraphStore, cfg config.AuthConfiguration) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	authenticator, err := NewAuthenticator(cfg, mailaddr.NewCanonicalizer(config.EmailConfiguration{CaseFolding: true}), store)
+	if err != nil {
+		t.Fatalf("NewAuthenticator: %s", err)
+	}
+
+	router := gin.New()
+	router.Use(apierror.Handler(), authenticator.Middleware())
+	router.GET("/act", func(c *gin.Context) {
+		if !Authorize(c, c.Query("as"), c.Query("or")) {
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"success": true, "caller": Caller(c), "actor": Actor(c)})
+	})
+	return router
+}
+
+// act request endpoint with given query and headers, returning status and decoded response body
+func act(t *testing.T, router *gin.Engine, query url.Values, headers map[string]string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	req := httptest.NewRequest(http.MethodGet, "/act?"+query.Encode(), nil)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("response is invalid JSON %q: %s", w.Body.String(), err)
+	}
+
+	return w, resp
+}
+
+// errorCode get code of the first error in failed response
+func errorCode(resp map[string]interface{}) string {
+	errs, _ := resp["errors"].([]interface{})
+	if len(errs) == 0 {
+		return ""
+	}
+
+	code, _ := errs[0].(map[string]interface{})["code"].(string)
+	return code
+}
+
+func TestMiddlewareBearerToken(t *testing.T) {
+	router := newRouter(t, data.NewMemoryStore(), config.AuthConfiguration{Enabled: true, Secret: testSecret})
+	token := signHS256(t, []byte(testSecret), hs256, claimsOf(map[string]interface{}{"email": "Andy@Example.com"}))
+	expired := signHS256(t, []byte(testSecret), hs256, claimsOf(map[string]interface{}{"exp": 1}))
+
+	tests := []struct {
+		name    string
+		query   url.Values
+		headers map[string]string
+		status  int
+		code    string
+	}{
+		{"caller itself", url.Values{"as": {"andy@example.com"}}, map[string]string{"Authorization": "Bearer " + token}, http.StatusOK, ""},
+		{"caller among parties", url.Values{"as": {"john@example.com"}, "or": {"andy@example.com"}}, map[string]string{"Authorization": "bearer " + token}, http.StatusOK, ""},
+		{"caller not a party", url.Values{"as": {"john@example.com"}, "or": {"kate@example.com"}}, map[string]string{"Authorization": "Bearer " + token}, http.StatusForbidden, string(apierror.Forbidden)},
+		{"token in query string", url.Values{"as": {"andy@example.com"}, "access_token": {token}}, nil, http.StatusOK, ""},
+		{"header wins over query string", url.Values{"as": {"andy@example.com"}, "access_token": {token}}, map[string]string{"Authorization": "Bearer " + expired}, http.StatusUnauthorized, string(apierror.Unauthenticated)},
+		{"invalid token in query string", url.Values{"as": {"andy@example.com"}, "access_token": {expired}}, nil, http.StatusUnauthorized, string(apierror.Unauthenticated)},
+		{"no token", url.Values{"as": {"andy@example.com"}}, nil, http.StatusUnauthorized, string(apierror.Unauthenticated)},
+		{"not a bearer token", url.Values{"as": {"andy@example.com"}}, map[string]string{"Authorization": "Basic YW5keTpzZWNyZXQ="}, http.StatusUnauthorized, string(apierror.Unauthenticated)},
+		{"expired token", url.Values{"as": {"andy@example.com"}}, map[string]string{"Authorization": "Bearer " + expired}, http.StatusUnauthorized, string(apierror.Unauthenticated)},
+	}
+	for _, test := range tests {
+		w, resp := act(t, router, test.query, test.headers)
+		if w.Code != test.status || errorCode(resp) != test.code {
+			t.Errorf("%s responded %d %v, want %d %s", test.name, w.Code, resp, test.status, test.code)
+			continue
+		}
+		if test.status == http.StatusOK && (resp["caller"] != "andy@example.com" || resp["actor"] != "andy@example.com") {
+			t.Errorf("%s got caller %v and actor %v", test.name, resp["caller"], resp["actor"])
+		}
+		if test.status == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s responded 401 without WWW-Authenticate header", test.name)
+		}
+	}
+}
+
+func TestMiddlewareDisabled(t *testing.T) {
+	router := newRouter(t, data.NewMemoryStore(), config.AuthConfiguration{})
+
+	// anonymous caller acts on behalf of anyone, token is not even looked at
+	w, resp := act(t, router, url.Values{"as": {"john@example.com"}}, map[string]string{"Authorization": "Bearer garbage"})
+	if w.Code != http.StatusOK || resp["caller"] != "" {
+		t.Fatalf("anonymous request responded %d %v", w.Code, resp)
+	}
+}
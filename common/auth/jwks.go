@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+)
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// loadJWKS read RSA signing key of JSON Web Key Set file, other kind of key is skipped
+func loadJWKS(path string) (map[string]*rsa.PublicKey, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("auth: failed to read jwks file: %s", err)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("auth: failed to parse jwks file: %s", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") || (k.Alg != "" && k.Alg != "RS256") {
+			continue
+		}
+
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("auth: invalid modulus of key %q: %s", k.Kid, err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil || e.Sign() == 0 || e.BitLen() > 31 {
+			return nil, fmt.Errorf("auth: invalid exponent of key %q", k.Kid)
+		}
+
+		keys[k.Kid] = &rsa.PublicKey{N: n, E: int(e.Int64())}
+	}
+
+	return keys, nil
+}
+
+// decodeBigInt decode base64url encoded big-endian unsigned integer, some issuer keeps the padding
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,240 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmgo/common/config"
+	"strings"
+	"time"
+)
+
+const (
+	defaultEmailClaim  = "email"
+	defaultRolesClaim  = "roles"
+	defaultTenantClaim = "tenant"
+)
+
+// Error of token verification
+var (
+	ErrMalformedToken   = errors.New("malformed token")
+	ErrUnsupportedAlg   = errors.New("unsupported signing algorithm")
+	ErrUnknownKey       = errors.New("unknown signing key")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrExpiredToken     = errors.New("token has expired")
+	ErrTokenNotYetValid = errors.New("token is not valid yet")
+	ErrInvalidIssuer    = errors.New("invalid issuer")
+	ErrInvalidAudience  = errors.New("invalid audience")
+	ErrMissingEmail     = errors.New("token has no verified email")
+)
+
+// Identity subject of verified token
+type Identity struct {
+	Email string
+	Roles []string
+	// Tenant the subject belongs to, empty when token does not name any
+	Tenant string
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verifier check signature and claims of JWT, either HS256 signed with shared secret or RS256 signed with one of the
+// key of JWKS
+type Verifier struct {
+	secret []byte
+	// keys RSA public key keyed by kid, key without kid is kept under empty string
+	keys        map[string]*rsa.PublicKey
+	issuer      string
+	audience    string
+	emailClaim  string
+	rolesClaim  string
+	tenantClaim string
+	leeway      time.Duration
+}
+
+// NewVerifier initialize new Verifier accepting token signed by configured secret or JWKS file
+func NewVerifier(cfg config.AuthConfiguration) (*Verifier, error) {
+	v := &Verifier{
+		secret:      []byte(cfg.Secret),
+		issuer:      cfg.Issuer,
+		audience:    cfg.Audience,
+		emailClaim:  cfg.EmailClaim,
+		rolesClaim:  cfg.RolesClaim,
+		tenantClaim: cfg.TenantClaim,
+		leeway:      time.Duration(cfg.Leeway) * time.Second,
+	}
+	if v.emailClaim == "" {
+		v.emailClaim = defaultEmailClaim
+	}
+	if v.rolesClaim == "" {
+		v.rolesClaim = defaultRolesClaim
+	}
+	if v.tenantClaim == "" {
+		v.tenantClaim = defaultTenantClaim
+	}
+
+	if cfg.JWKSFile != "" {
+		keys, err := loadJWKS(cfg.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+
+		v.keys = keys
+	}
+
+	if len(v.secret) == 0 && len(v.keys) == 0 {
+		return nil, errors.New("auth: neither secret nor jwks file with RSA key is configured")
+	}
+
+	return v, nil
+}
+
+// Verify check signature, validity period, issuer and audience of the token, then get email address, roles and tenant
+// of its subject
+func (v *Verifier) Verify(token string) (*Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformedToken
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, ErrMalformedToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	if err := v.verifySignature(h, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	return v.verifyClaims(claims, time.Now())
+}
+
+func (v *Verifier) verifySignature(h header, signingInput string, signature []byte) error {
+	switch h.Alg {
+	case "HS256":
+		if len(v.secret) == 0 {
+			return ErrUnsupportedAlg
+		}
+
+		mac := hmac.New(sha256.New, v.secret)
+		mac.Write([]byte(signingInput))
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return ErrInvalidSignature
+		}
+
+		return nil
+	case "RS256":
+		if len(v.keys) == 0 {
+			return ErrUnsupportedAlg
+		}
+
+		key, ok := v.keys[h.Kid]
+		// token without kid is fine as long as there is no other key it could mean
+		if !ok && h.Kid == "" && len(v.keys) == 1 {
+			for _, k := range v.keys {
+				key, ok = k, true
+			}
+		}
+		if !ok {
+			return ErrUnknownKey
+		}
+
+		hash := sha256.Sum256([]byte(signingInput))
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], signature); err != nil {
+			return ErrInvalidSignature
+		}
+
+		return nil
+	}
+
+	// none and every other algorithm are refused, so is HS256 token claiming to be signed with RSA key
+	return ErrUnsupportedAlg
+}
+
+func (v *Verifier) verifyClaims(claims map[string]interface{}, now time.Time) (*Identity, error) {
+	// token without expiry would be valid forever, it is refused
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, ErrMalformedToken
+	}
+	if now.Add(-v.leeway).After(time.Unix(int64(exp), 0)) {
+		return nil, ErrExpiredToken
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(v.leeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, ErrTokenNotYetValid
+	}
+
+	if v.issuer != "" && claims["iss"] != v.issuer {
+		return nil, ErrInvalidIssuer
+	}
+	if v.audience != "" && !hasAudience(claims["aud"], v.audience) {
+		return nil, ErrInvalidAudience
+	}
+
+	email, _ := claims[v.emailClaim].(string)
+	if verified, ok := claims["email_verified"].(bool); email == "" || (ok && !verified) {
+		return nil, ErrMissingEmail
+	}
+
+	tenant, _ := claims[v.tenantClaim].(string)
+	return &Identity{Email: email, Roles: roles(claims[v.rolesClaim]), Tenant: tenant}, nil
+}
+
+// roles read roles claim, which is either list of string or single space separated string
+func roles(claim interface{}) []string {
+	switch claim := claim.(type) {
+	case string:
+		return strings.Fields(claim)
+	case []interface{}:
+		roles := make([]string, 0, len(claim))
+		for _, r := range claim {
+			if role, ok := r.(string); ok {
+				roles = append(roles, role)
+			}
+		}
+		return roles
+	}
+
+	return nil
+}
+
+// hasAudience check aud claim, which is either single string or list of them
+func hasAudience(aud interface{}, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, v)
+}
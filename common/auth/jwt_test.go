@@ -0,0 +1,300 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmgo/common/config"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "jwt-test-secret"
+
+// rsaKeys RSA key pairs shared by every test, generating them is slow
+var rsaKeys []*rsa.PrivateKey
+
+func rsaKey(t *testing.T, i int) *rsa.PrivateKey {
+	for len(rsaKeys) <= i {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatalf("GenerateKey: %s", err)
+		}
+		rsaKeys = append(rsaKeys, key)
+	}
+
+	return rsaKeys[i]
+}
+
+// encode serialize header and claims into signing input of JWT
+func encode(t *testing.T, header, claims map[string]interface{}) string {
+	segments := ""
+	for _, v := range []map[string]interface{}{header, claims} {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("Marshal: %s", err)
+		}
+		if segments != "" {
+			segments += "."
+		}
+		segments += base64.RawURLEncoding.EncodeToString(b)
+	}
+
+	return segments
+}
+
+// signHS256 sign token with shared secret, whatever alg header claims
+func signHS256(t *testing.T, secret []byte, header, claims map[string]interface{}) string {
+	input := encode(t, header, claims)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(input))
+	return input + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// signRS256 sign token with RSA private key
+func signRS256(t *testing.T, key *rsa.PrivateKey, header, claims map[string]interface{}) string {
+	input := encode(t, header, claims)
+	hash := sha256.Sum256([]byte(input))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	if err != nil {
+		t.Fatalf("SignPKCS1v15: %s", err)
+	}
+
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// claimsOf valid claims of andy@example.com, with given claims added or overridden
+func claimsOf(extra map[string]interface{}) map[string]interface{} {
+	claims := map[string]interface{}{
+		"email": "andy@example.com",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"iss":   "https://issuer.example",
+		"aud":   "fmgo",
+	}
+	for name, value := range extra {
+		if value == nil {
+			delete(claims, name)
+			continue
+		}
+		claims[name] = value
+	}
+
+	return claims
+}
+
+// writeJWKS write JSON Web Key Set of public key of given RSA key by kid into temporary file, returning its path
+func writeJWKS(t *testing.T, keys map[string]*rsa.PrivateKey, extra ...map[string]string) string {
+	set := make([]map[string]string, 0)
+	for kid, key := range keys {
+		set = append(set, map[string]string{
+			"kty": "RSA",
+			"kid": kid,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		})
+	}
+	set = append(set, extra...)
+
+	f, err := ioutil.TempFile("", "jwks")
+	if err != nil {
+		t.Fatalf("TempFile: %s", err)
+	}
+	defer f.Close()
+	if err := json.NewEncoder(f).Encode(map[string]interface{}{"keys": set}); err != nil {
+		t.Fatalf("Encode: %s", err)
+	}
+
+	return f.Name()
+}
+
+func newVerifier(t *testing.T, cfg config.AuthConfiguration) *Verifier {
+	v, err := NewVerifier(cfg)
+	if err != nil {
+		t.Fatalf("NewVerifier: %s", err)
+	}
+
+	return v
+}
+
+var hs256 = map[string]interface{}{"alg": "HS256", "typ": "JWT"}
+
+func TestVerifyHS256(t *testing.T) {
+	v := newVerifier(t, config.AuthConfiguration{Secret: testSecret})
+
+	token := signHS256(t, []byte(testSecret), hs256, claimsOf(map[string]interface{}{"roles": "admin support", "tenant": "acme"}))
+	identity, err := v.Verify(token)
+	if err != nil {
+		t.Fatalf("Verify: %s", err)
+	}
+	if identity.Email != "andy@example.com" || len(identity.Roles) != 2 || identity.Roles[0] != "admin" || identity.Tenant != "acme" {
+		t.Fatalf("identity is %+v", identity)
+	}
+
+	parts := strings.Split(token, ".")
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"wrong secret", signHS256(t, []byte("other secret"), hs256, claimsOf(nil)), ErrInvalidSignature},
+		{"tampered claims", encode(t, hs256, claimsOf(map[string]interface{}{"email": "john@example.com"})) + "." + parts[2], ErrInvalidSignature},
+		{"two segments", parts[0] + "." + parts[1], ErrMalformedToken},
+		{"garbage header", "!!!." + parts[1] + "." + parts[2], ErrMalformedToken},
+		{"garbage signature", parts[0] + "." + parts[1] + ".!!!", ErrMalformedToken},
+	}
+	for _, test := range tests {
+		if _, err := v.Verify(test.token); err != test.err {
+			t.Errorf("%s: Verify returned %v, want %v", test.name, err, test.err)
+		}
+	}
+}
+
+func TestVerifyRS256(t *testing.T) {
+	path := writeJWKS(t, map[string]*rsa.PrivateKey{"k1": rsaKey(t, 0), "k2": rsaKey(t, 1)})
+	defer os.Remove(path)
+	v := newVerifier(t, config.AuthConfiguration{JWKSFile: path})
+
+	tests := []struct {
+		name  string
+		kid   string
+		key   *rsa.PrivateKey
+		err   error
+		email string
+	}{
+		{"first key", "k1", rsaKey(t, 0), nil, "andy@example.com"},
+		{"second key", "k2", rsaKey(t, 1), nil, "andy@example.com"},
+		{"key of another kid", "k1", rsaKey(t, 1), ErrInvalidSignature, ""},
+		{"unknown kid", "k3", rsaKey(t, 0), ErrUnknownKey, ""},
+		{"no kid among several keys", "", rsaKey(t, 0), ErrUnknownKey, ""},
+	}
+	for _, test := range tests {
+		header := map[string]interface{}{"alg": "RS256", "typ": "JWT"}
+		if test.kid != "" {
+			header["kid"] = test.kid
+		}
+
+		identity, err := v.Verify(signRS256(t, test.key, header, claimsOf(nil)))
+		if err != test.err || (err == nil && identity.Email != test.email) {
+			t.Errorf("%s: Verify returned %+v, %v, want %v", test.name, identity, err, test.err)
+		}
+	}
+}
+
+func TestVerifyRS256SingleKeyWithoutKid(t *testing.T) {
+	// key of other type or use is skipped, so the RSA key is the only one token without kid could mean
+	path := writeJWKS(t, map[string]*rsa.PrivateKey{"k1": rsaKey(t, 0)},
+		map[string]string{"kty": "EC", "kid": "ec", "crv": "P-256"},
+		map[string]string{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"})
+	defer os.Remove(path)
+	v := newVerifier(t, config.AuthConfiguration{JWKSFile: path})
+
+	if _, err := v.Verify(signRS256(t, rsaKey(t, 0), map[string]interface{}{"alg": "RS256"}, claimsOf(nil))); err != nil {
+		t.Fatalf("token without kid: %s", err)
+	}
+	if _, err := v.Verify(signRS256(t, rsaKey(t, 1), map[string]interface{}{"alg": "RS256"}, claimsOf(nil))); err != ErrInvalidSignature {
+		t.Fatalf("token without kid signed by another key: %v", err)
+	}
+}
+
+func TestVerifyAlgorithm(t *testing.T) {
+	path := writeJWKS(t, map[string]*rsa.PrivateKey{"k1": rsaKey(t, 0)})
+	defer os.Remove(path)
+	rsOnly := newVerifier(t, config.AuthConfiguration{JWKSFile: path})
+	hsOnly := newVerifier(t, config.AuthConfiguration{Secret: testSecret})
+
+	publicKey, err := x509.MarshalPKIXPublicKey(&rsaKey(t, 0).PublicKey)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey: %s", err)
+	}
+
+	tests := []struct {
+		name     string
+		verifier *Verifier
+		token    string
+	}{
+		{"alg none", hsOnly, encode(t, map[string]interface{}{"alg": "none"}, claimsOf(nil)) + "."},
+		{"alg None", rsOnly, encode(t, map[string]interface{}{"alg": "None"}, claimsOf(nil)) + "."},
+		{"alg missing", hsOnly, signHS256(t, []byte(testSecret), map[string]interface{}{}, claimsOf(nil))},
+		{"HS512", hsOnly, signHS256(t, []byte(testSecret), map[string]interface{}{"alg": "HS512"}, claimsOf(nil))},
+		// HMAC keyed by the public RSA key anyone can get must not pass as signature of the RSA key
+		{"HS256 keyed by RSA public key", rsOnly, signHS256(t, publicKey, map[string]interface{}{"alg": "HS256", "kid": "k1"}, claimsOf(nil))},
+		{"RS256 without JWKS", hsOnly, signRS256(t, rsaKey(t, 0), map[string]interface{}{"alg": "RS256", "kid": "k1"}, claimsOf(nil))},
+	}
+	for _, test := range tests {
+		if _, err := test.verifier.Verify(test.token); err != ErrUnsupportedAlg {
+			t.Errorf("%s: Verify returned %v, want ErrUnsupportedAlg", test.name, err)
+		}
+	}
+}
+
+func TestVerifyClaims(t *testing.T) {
+	v := newVerifier(t, config.AuthConfiguration{Secret: testSecret, Issuer: "https://issuer.example", Audience: "fmgo", Leeway: 30})
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+		err    error
+	}{
+		{"valid", nil, nil},
+		{"without exp", map[string]interface{}{"exp": nil}, ErrMalformedToken},
+		{"expired", map[string]interface{}{"exp": now.Add(-time.Minute).Unix()}, ErrExpiredToken},
+		{"expired within leeway", map[string]interface{}{"exp": now.Add(-10 * time.Second).Unix()}, nil},
+		{"not valid yet", map[string]interface{}{"nbf": now.Add(time.Minute).Unix()}, ErrTokenNotYetValid},
+		{"not valid yet within leeway", map[string]interface{}{"nbf": now.Add(10 * time.Second).Unix()}, nil},
+		{"without iss", map[string]interface{}{"iss": nil}, ErrInvalidIssuer},
+		{"another iss", map[string]interface{}{"iss": "https://evil.example"}, ErrInvalidIssuer},
+		{"without aud", map[string]interface{}{"aud": nil}, ErrInvalidAudience},
+		{"another aud", map[string]interface{}{"aud": "other"}, ErrInvalidAudience},
+		{"aud list", map[string]interface{}{"aud": []string{"other", "fmgo"}}, nil},
+		{"aud list without fmgo", map[string]interface{}{"aud": []string{"other"}}, ErrInvalidAudience},
+		{"without email", map[string]interface{}{"email": nil}, ErrMissingEmail},
+		{"unverified email", map[string]interface{}{"email_verified": false}, ErrMissingEmail},
+		{"verified email", map[string]interface{}{"email_verified": true}, nil},
+	}
+	for _, test := range tests {
+		if _, err := v.Verify(signHS256(t, []byte(testSecret), hs256, claimsOf(test.claims))); err != test.err {
+			t.Errorf("%s: Verify returned %v, want %v", test.name, err, test.err)
+		}
+	}
+}
+
+func TestVerifyCustomClaims(t *testing.T) {
+	v := newVerifier(t, config.AuthConfiguration{Secret: testSecret, EmailClaim: "upn", RolesClaim: "groups", TenantClaim: "org"})
+
+	claims := claimsOf(map[string]interface{}{"email": nil, "upn": "andy@example.com", "groups": []string{"admin"}, "org": "acme", "tenant": "beta"})
+	identity, err := v.Verify(signHS256(t, []byte(testSecret), hs256, claims))
+	if err != nil {
+		t.Fatalf("Verify: %s", err)
+	}
+	if identity.Email != "andy@example.com" || len(identity.Roles) != 1 || identity.Roles[0] != "admin" || identity.Tenant != "acme" {
+		t.Fatalf("identity is %+v", identity)
+	}
+}
+
+func TestNewVerifier(t *testing.T) {
+	if _, err := NewVerifier(config.AuthConfiguration{}); err == nil {
+		t.Error("verifier without secret nor JWKS was created")
+	}
+	if _, err := NewVerifier(config.AuthConfiguration{JWKSFile: "/nonexistent/jwks.json"}); err == nil {
+		t.Error("verifier of missing JWKS file was created")
+	}
+
+	// set holding no RSA signing key leaves nothing to verify RS256 with
+	path := writeJWKS(t, nil, map[string]string{"kty": "EC", "kid": "ec", "crv": "P-256"})
+	defer os.Remove(path)
+	if _, err := NewVerifier(config.AuthConfiguration{JWKSFile: path}); err == nil {
+		t.Error("verifier of JWKS without RSA key was created")
+	}
+}
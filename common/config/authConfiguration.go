@@ -0,0 +1,18 @@
+package config
+
+// AuthConfiguration model for JWT bearer token authentication of API caller
+type AuthConfiguration struct {
+	Enabled bool
+	// Secret shared key of HS256 signed token, HS256 is refused when it is empty
+	Secret string
+	// JWKSFile path of JSON Web Key Set holding RSA public key of RS256 signed token, RS256 is refused when it is empty
+	JWKSFile   string
+	Issuer     string
+	Audience   string
+	EmailClaim string
+	// RolesClaim claim holding roles of the caller, such as admin
+	RolesClaim string
+	// TenantClaim claim holding tenant of the caller, token without it acts on default tenant
+	TenantClaim string
+	Leeway      int
+}
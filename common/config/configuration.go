@@ -9,6 +9,12 @@ import (
 type Configuration struct {
 	Server   ServerConfiguration
 	Database DatabaseConfiguration
+	Graph    GraphConfiguration
+	Webhook  WebhookConfiguration
+	SMTP     SMTPConfiguration
+	Stream   StreamConfiguration
+	Email    EmailConfiguration
+	Auth     AuthConfiguration
 }
 
 // New create new instance of configuration object based on configuration file
@@ -2,6 +2,9 @@ package config
 
 // DatabaseConfiguration is configuration model for database connection
 type DatabaseConfiguration struct {
-	DbType        string
-	ConnectionURI string
+	DbType          string
+	ConnectionURI   string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime int
 }
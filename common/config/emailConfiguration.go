@@ -0,0 +1,15 @@
+package config
+
+// EmailConfiguration model for email address canonicalization
+type EmailConfiguration struct {
+	CaseFolding bool
+	IDN         bool
+	Providers   []EmailProviderConfiguration
+}
+
+// EmailProviderConfiguration model for address rule of single mail provider, Domains[0] is the canonical domain
+type EmailProviderConfiguration struct {
+	Domains      []string
+	IgnoreDots   bool
+	TagSeparator string
+}
@@ -0,0 +1,6 @@
+package config
+
+// GraphConfiguration model for social graph traversal behaviour
+type GraphConfiguration struct {
+	MaxPathDepth int
+}
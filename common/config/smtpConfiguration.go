@@ -0,0 +1,18 @@
+package config
+
+// SMTPConfiguration model for email delivery behaviour
+type SMTPConfiguration struct {
+	Enabled         bool
+	Host            string
+	Port            int
+	TLS             string
+	Username        string
+	Password        string
+	From            string
+	SubjectTemplate string
+	BodyTemplate    string
+	Workers         int
+	QueueSize       int
+	MaxAttempts     int
+	Timeout         int
+}
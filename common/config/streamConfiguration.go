@@ -0,0 +1,9 @@
+package config
+
+// StreamConfiguration model for real-time notification stream behaviour
+type StreamConfiguration struct {
+	Heartbeat   int
+	BufferSize  int
+	ReplayLimit int
+	Retry       int
+}
@@ -0,0 +1,12 @@
+package config
+
+// WebhookConfiguration model for outbound webhook delivery behaviour
+type WebhookConfiguration struct {
+	Workers        int
+	QueueSize      int
+	MaxAttempts    int
+	InitialBackoff int
+	Timeout        int
+	// AllowPrivateHosts let webhook URL point to loopback, link-local or private address, meant for development only
+	AllowPrivateHosts bool
+}
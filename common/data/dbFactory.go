@@ -1,20 +1,30 @@
 package data
 
 import (
+	"database/sql"
 	"fmgo/common/config"
+	"sync"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/jinzhu/gorm"
-	// importing all possible database dialect
+	// importing all supported database dialect
 	_ "github.com/jinzhu/gorm/dialects/mysql"
 	// _ "github.com/jinzhu/gorm/dialects/mssql"
-	// _ "github.com/jinzhu/gorm/dialects/postgres"
-	// _ "github.com/jinzhu/gorm/dialects/sqlite"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
 )
 
+// dialects maps configured database type into registered GORM dialect name
+var dialects = map[string]string{
+	"sqlite": "sqlite3",
+}
+
 // DBFactory struct
 type DBFactory struct {
 	config config.DatabaseConfiguration
+	mu     sync.Mutex
+	db     *gorm.DB
 }
 
 // NewDbFactory initialize new DBFactory instance
@@ -22,13 +32,77 @@ func NewDbFactory(cfg config.DatabaseConfiguration) *DBFactory {
 	return &DBFactory{config: cfg}
 }
 
-// DBConnection get open database connection
+// DBConnection get shared database handle backed by connection pool, it is opened on first call.
+// The handle is safe for concurrent use and must not be closed by caller, use Close on shutdown instead.
 func (f *DBFactory) DBConnection() (*gorm.DB, error) {
-	db, err := gorm.Open(f.config.DbType, f.config.ConnectionURI)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.db != nil {
+		return f.db, nil
+	}
+
+	dialect := f.Dialect()
+	db, err := gorm.Open(dialect, f.config.ConnectionURI)
 	if err != nil {
 		glog.Errorf("Failed to connect to database: %s", err)
 		return nil, err
 	}
 
-	return db, nil
+	pool := db.DB()
+	if dialect == "sqlite3" {
+		// sqlite only allows single writer and every connection to in-memory database is a separate database,
+		// so the pool is pinned to one connection that is never recycled
+		pool.SetMaxOpenConns(1)
+		pool.SetMaxIdleConns(1)
+		pool.SetConnMaxLifetime(0)
+	} else {
+		if f.config.MaxOpenConns > 0 {
+			pool.SetMaxOpenConns(f.config.MaxOpenConns)
+		}
+		if f.config.MaxIdleConns > 0 {
+			pool.SetMaxIdleConns(f.config.MaxIdleConns)
+		}
+		if f.config.ConnMaxLifetime > 0 {
+			pool.SetConnMaxLifetime(time.Duration(f.config.ConnMaxLifetime) * time.Second)
+		}
+	}
+
+	f.db = db
+	return f.db, nil
+}
+
+// Dialect get GORM dialect name of configured database type
+func (f *DBFactory) Dialect() string {
+	if dialect, ok := dialects[f.config.DbType]; ok {
+		return dialect
+	}
+
+	return f.config.DbType
+}
+
+// Stats get connection pool statistics, it is empty when database handle has not been opened yet
+func (f *DBFactory) Stats() sql.DBStats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.db == nil {
+		return sql.DBStats{}
+	}
+
+	return f.db.DB().Stats()
+}
+
+// Close close shared database handle and all of its pooled connection
+func (f *DBFactory) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.db == nil {
+		return nil
+	}
+
+	err := f.db.Close()
+	f.db = nil
+	return err
 }
@@ -0,0 +1,1096 @@
+package data
+
+import (
+	"errors"
+	"fmgo/common/data/model"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/satori/go.uuid"
+)
+
+// GormStore GraphStore implementation backed by relational database through GORM
+type GormStore struct {
+	factory *DBFactory
+	tx      *gorm.DB
+	tenant  string
+}
+
+// NewGormStore initialize new GormStore instance scoped to DefaultTenant
+func NewGormStore(factory *DBFactory) *GormStore {
+	return &GormStore{factory: factory, tenant: DefaultTenant}
+}
+
+// session get db handle to run query on, it is the transaction when store is transactional
+// or the shared pooled handle otherwise
+func (s *GormStore) session() (*gorm.DB, error) {
+	if s.tx != nil {
+		return s.tx, nil
+	}
+
+	return s.factory.DBConnection()
+}
+
+// Begin start new transaction
+func (s *GormStore) Begin() (GraphStore, error) {
+	if s.tx != nil {
+		return nil, errors.New("transaction already started")
+	}
+
+	db, err := s.factory.DBConnection()
+	if err != nil {
+		return nil, err
+	}
+
+	tx := db.Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	return &GormStore{factory: s.factory, tx: tx, tenant: s.tenant}, nil
+}
+
+// Commit commit current transaction
+func (s *GormStore) Commit() error {
+	if s.tx == nil {
+		return errors.New("no transaction to commit")
+	}
+
+	return s.tx.Commit().Error
+}
+
+// Rollback rollback current transaction
+func (s *GormStore) Rollback() error {
+	if s.tx == nil {
+		return errors.New("no transaction to rollback")
+	}
+
+	return s.tx.Rollback().Error
+}
+
+// Tenant get tenant the store is scoped to
+func (s *GormStore) Tenant() string {
+	return s.tenant
+}
+
+// WithTenant get store scoped to given tenant, sharing transaction of current store if any
+func (s *GormStore) WithTenant(tenant string) GraphStore {
+	return &GormStore{factory: s.factory, tx: s.tx, tenant: tenant}
+}
+
+// FindUser get user by its email or alias
+func (s *GormStore) FindUser(email string) (*model.User, error) {
+	db, err := s.session()
+	if err != nil {
+		return nil, err
+	}
+
+	var user model.User
+	scope := "tenant = ? AND (email = ? OR id IN (SELECT user_id FROM user_aliases WHERE tenant = ? AND email = ?))"
+	if err := db.First(&user, scope, s.tenant, email, s.tenant, email).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// FindOrCreateUser get user by its email, create new one if email does not exist yet
+func (s *GormStore) FindOrCreateUser(email string) (*model.User, error) {
+	user, err := s.FindUser(email)
+	if err != ErrNotFound {
+		return user, err
+	}
+
+	db, err := s.session()
+	if err != nil {
+		return nil, err
+	}
+
+	user = &model.User{Tenant: s.tenant, Email: email}
+	if err := db.Create(user).Error; err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// FindUsers get users by their id
+func (s *GormStore) FindUsers(ids []uuid.UUID) ([]model.User, error) {
+	users := make([]model.User, 0)
+	if len(ids) == 0 {
+		return users, nil
+	}
+
+	db, err := s.session()
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Where("tenant = ? AND id IN (?)", s.tenant, ids).Find(&users).Error
+	return users, err
+}
+
+// UpdateProfile save user profile
+func (s *GormStore) UpdateProfile(user *model.User) error {
+	db, err := s.session()
+	if err != nil {
+		return err
+	}
+
+	return db.Model(user).Where("tenant = ?", s.tenant).Updates(map[string]interface{}{
+		"display_name": user.DisplayName,
+		"avatar_url":   user.AvatarURL,
+		"locale":       user.Locale,
+		"timezone":     user.Timezone,
+		"bio":          user.Bio,
+	}).Error
+}
+
+// UpdateSuspension save suspension time and reason of user
+func (s *GormStore) UpdateSuspension(user *model.User) error {
+	db, err := s.session()
+	if err != nil {
+		return err
+	}
+
+	return db.Model(user).Where("tenant = ?", s.tenant).Updates(map[string]interface{}{
+		"suspended_at":   user.SuspendedAt,
+		"suspend_reason": user.SuspendReason,
+	}).Error
+}
+
+// ChangeEmail change primary email of user
+func (s *GormStore) ChangeEmail(user *model.User, email string) error {
+	db, err := s.session()
+	if err != nil {
+		return err
+	}
+
+	taken, err := s.emailTaken(email, user.ID)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrEmailTaken
+	}
+
+	if err := db.Model(user).Where("tenant = ?", s.tenant).Update("email", email).Error; err != nil {
+		return err
+	}
+	if err := db.Delete(&model.UserAlias{}, "tenant = ? AND email = ?", s.tenant, email).Error; err != nil {
+		return err
+	}
+
+	user.Email = email
+	return nil
+}
+
+// MergeUsers move all record of source user to target user then delete source user
+func (s *GormStore) MergeUsers(sourceID, targetID uuid.UUID) error {
+	db, err := s.session()
+	if err != nil {
+		return err
+	}
+
+	var source model.User
+	if err := db.First(&source, "tenant = ? AND id = ?", s.tenant, sourceID).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	for table, targetColumn := range edgeTables {
+		related, err := s.exists(table, targetColumn, sourceID, targetID)
+		if err != nil {
+			return err
+		}
+		reverse, err := s.exists(table, targetColumn, targetID, sourceID)
+		if err != nil {
+			return err
+		}
+		if related || reverse {
+			return ErrSelfEdge
+		}
+	}
+
+	var pending int
+	err = db.Model(&model.FriendRequest{}).
+		Where("tenant = ? AND ((requestor_id = ? AND target_id = ?) OR (requestor_id = ? AND target_id = ?)) AND status = ?", s.tenant, sourceID, targetID, targetID, sourceID, model.FriendRequestPending).
+		Count(&pending).Error
+	if err != nil {
+		return err
+	}
+	if pending > 0 {
+		return ErrSelfEdge
+	}
+
+	for table, targetColumn := range edgeTables {
+		if err := s.repoint(table, "user_id", targetColumn, sourceID, targetID); err != nil {
+			return err
+		}
+		if err := s.repoint(table, targetColumn, "user_id", sourceID, targetID); err != nil {
+			return err
+		}
+	}
+
+	// answered request between both users would become request to itself, it is only history so drop it
+	err = db.Unscoped().Where("tenant = ? AND ((requestor_id = ? AND target_id = ?) OR (requestor_id = ? AND target_id = ?))", s.tenant, sourceID, targetID, targetID, sourceID).
+		Delete(&model.FriendRequest{}).Error
+	if err != nil {
+		return err
+	}
+
+	// target keeps its own pending request when both have one to or from the same user
+	for _, column := range []string{"requestor_id", "target_id"} {
+		other := "target_id"
+		if column == "target_id" {
+			other = "requestor_id"
+		}
+
+		var duplicates []model.FriendRequest
+		err := db.Where("tenant = ? AND "+column+" = ? AND status = ?", s.tenant, sourceID, model.FriendRequestPending).
+			Where(other+" IN (SELECT "+other+" FROM friend_requests WHERE tenant = ? AND "+column+" = ? AND status = ?)", s.tenant, targetID, model.FriendRequestPending).
+			Find(&duplicates).Error
+		if err != nil {
+			return err
+		}
+		for i := range duplicates {
+			if err := s.UpdateFriendRequestStatus(&duplicates[i], model.FriendRequestCancelled); err != nil {
+				return err
+			}
+		}
+
+		if err := db.Exec("UPDATE friend_requests SET "+column+" = ? WHERE tenant = ? AND "+column+" = ?", targetID, s.tenant, sourceID).Error; err != nil {
+			return err
+		}
+	}
+
+	// both users may have received the same message
+	if err := s.repoint("inbox_entries", "recipient_id", "message_id", sourceID, targetID); err != nil {
+		return err
+	}
+
+	updates := []struct{ table, column string }{
+		{"messages", "sender_id"},
+		{"webhooks", "user_id"},
+		{"webhook_dead_letters", "recipient_id"},
+		{"email_deliveries", "recipient_id"},
+		{"user_aliases", "user_id"},
+	}
+	for _, u := range updates {
+		if err := db.Exec("UPDATE "+u.table+" SET "+u.column+" = ? WHERE tenant = ? AND "+u.column+" = ?", targetID, s.tenant, sourceID).Error; err != nil {
+			return err
+		}
+	}
+
+	// hard delete so the email of source user is free to become alias
+	if err := db.Unscoped().Delete(&model.User{}, "tenant = ? AND id = ?", s.tenant, sourceID).Error; err != nil {
+		return err
+	}
+
+	return db.Create(&model.UserAlias{Tenant: s.tenant, Email: source.Email, UserID: targetID}).Error
+}
+
+// Aliases get all alias of user
+func (s *GormStore) Aliases(userID uuid.UUID) ([]model.UserAlias, error) {
+	db, err := s.session()
+	if err != nil {
+		return nil, err
+	}
+
+	aliases := make([]model.UserAlias, 0)
+	err = db.Where("tenant = ? AND user_id = ?", s.tenant, userID).Order("email").Find(&aliases).Error
+	return aliases, err
+}
+
+// AddAlias make email resolve to user
+func (s *GormStore) AddAlias(alias *model.UserAlias) error {
+	db, err := s.session()
+	if err != nil {
+		return err
+	}
+
+	var existing model.UserAlias
+	err = db.First(&existing, "tenant = ? AND email = ?", s.tenant, alias.Email).Error
+	if err == nil {
+		if existing.UserID != alias.UserID {
+			return ErrEmailTaken
+		}
+
+		*alias = existing
+		return nil
+	}
+	if !gorm.IsRecordNotFoundError(err) {
+		return err
+	}
+
+	taken, err := s.emailTaken(alias.Email, uuid.Nil)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrEmailTaken
+	}
+
+	alias.Tenant = s.tenant
+	return db.Create(alias).Error
+}
+
+// RemoveAlias remove alias of user
+func (s *GormStore) RemoveAlias(userID uuid.UUID, email string) (bool, error) {
+	db, err := s.session()
+	if err != nil {
+		return false, err
+	}
+
+	result := db.Delete(&model.UserAlias{}, "tenant = ? AND user_id = ? AND email = ?", s.tenant, userID, email)
+	return result.RowsAffected > 0, result.Error
+}
+
+// emailTaken check whether email is primary email of any user but userID, or alias of any user but userID
+func (s *GormStore) emailTaken(email string, userID uuid.UUID) (bool, error) {
+	db, err := s.session()
+	if err != nil {
+		return false, err
+	}
+
+	// unique index also covers soft deleted user
+	var count int
+	if err := db.Unscoped().Model(&model.User{}).Where("tenant = ? AND email = ? AND id <> ?", s.tenant, email, userID).Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return true, nil
+	}
+
+	err = db.Model(&model.UserAlias{}).Where("tenant = ? AND email = ? AND user_id <> ?", s.tenant, email, userID).Count(&count).Error
+	return count > 0, err
+}
+
+// Friends get all friend of given user
+func (s *GormStore) Friends(userID uuid.UUID) ([]model.User, error) {
+	return s.related("friends", "friend_id", "user_id", userID)
+}
+
+// FriendPage get page of friend matching query
+func (s *GormStore) FriendPage(userID, mutualID uuid.UUID, query ListQuery) ([]Connection, int, error) {
+	db, err := s.session()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	scope := db.Table("users").Joins("JOIN friends ON friends.friend_id = users.id").
+		Where("friends.tenant = ? AND friends.user_id = ? AND users.deleted_at IS NULL", s.tenant, userID)
+	if mutualID != uuid.Nil {
+		scope = scope.Where("users.id IN (SELECT friend_id FROM friends WHERE tenant = ? AND user_id = ?)", s.tenant, mutualID)
+	}
+
+	scope, total, err := page(scope, "friends.created_at", query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows := make([]connectionRow, 0)
+	err = scope.Select("users.*, friends.created_at AS connected_at, friends.source, COALESCE(friends.label, '') AS label").Scan(&rows).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	connections := make([]Connection, 0)
+	for _, row := range rows {
+		connections = append(connections, row.connection())
+	}
+
+	return connections, total, nil
+}
+
+// FriendEdges get all friend connection owned by given users
+func (s *GormStore) FriendEdges(userIDs []uuid.UUID) ([]Edge, error) {
+	edges := make([]Edge, 0)
+	if len(userIDs) == 0 {
+		return edges, nil
+	}
+
+	db, err := s.session()
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Table("friends").Select("user_id, friend_id AS target_id").Where("tenant = ? AND user_id IN (?)", s.tenant, userIDs).Scan(&edges).Error
+	return edges, err
+}
+
+// IsFriend check whether both user are connected
+func (s *GormStore) IsFriend(userID, friendID uuid.UUID) (bool, error) {
+	return s.exists("friends", "friend_id", userID, friendID)
+}
+
+// AddFriend connect both user to each other
+func (s *GormStore) AddFriend(friend *model.Friend) error {
+	db, err := s.session()
+	if err != nil {
+		return err
+	}
+
+	friend.Tenant = s.tenant
+	friend.CreatedAt = time.Now()
+	reverse := *friend
+	reverse.UserID, reverse.FriendID = friend.FriendID, friend.UserID
+	for _, f := range []*model.Friend{friend, &reverse} {
+		found, err := s.exists("friends", "friend_id", f.UserID, f.FriendID)
+		if err != nil {
+			return err
+		}
+		if found {
+			continue
+		}
+
+		if err := db.Create(f).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RemoveFriend remove connection on both side
+func (s *GormStore) RemoveFriend(userID, friendID uuid.UUID) (bool, error) {
+	db, err := s.session()
+	if err != nil {
+		return false, err
+	}
+
+	result := db.Exec("DELETE FROM friends WHERE tenant = ? AND ((user_id = ? AND friend_id = ?) OR (user_id = ? AND friend_id = ?))", s.tenant, userID, friendID, friendID, userID)
+	return result.RowsAffected > 0, result.Error
+}
+
+// FindFriendRequest get friend request between requestor and target with given status
+func (s *GormStore) FindFriendRequest(requestorID, targetID uuid.UUID, status string) (*model.FriendRequest, error) {
+	db, err := s.session()
+	if err != nil {
+		return nil, err
+	}
+
+	var friendRequest model.FriendRequest
+	if err := db.Where("tenant = ? AND requestor_id = ? AND target_id = ? AND status = ?", s.tenant, requestorID, targetID, status).First(&friendRequest).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &friendRequest, nil
+}
+
+// FriendRequests get request sent or received by user, newest first
+func (s *GormStore) FriendRequests(userID uuid.UUID, outgoing bool, status string) ([]model.FriendRequest, error) {
+	db, err := s.session()
+	if err != nil {
+		return nil, err
+	}
+
+	query := db.Preload("Requestor").Preload("Target").Where("tenant = ? AND status = ?", s.tenant, status)
+	if outgoing {
+		query = query.Where("requestor_id = ?", userID)
+	} else {
+		query = query.Where("target_id = ?", userID)
+	}
+
+	friendRequests := make([]model.FriendRequest, 0)
+	err = query.Order("created_at desc").Find(&friendRequests).Error
+	return friendRequests, err
+}
+
+// CreateFriendRequest store new friend request
+func (s *GormStore) CreateFriendRequest(friendRequest *model.FriendRequest) error {
+	db, err := s.session()
+	if err != nil {
+		return err
+	}
+
+	friendRequest.Tenant = s.tenant
+	return db.Create(friendRequest).Error
+}
+
+// UpdateFriendRequestStatus answer friend request with given status
+func (s *GormStore) UpdateFriendRequestStatus(friendRequest *model.FriendRequest, status string) error {
+	db, err := s.session()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	return db.Model(friendRequest).Where("tenant = ?", s.tenant).Updates(map[string]interface{}{"status": status, "responded_at": &now}).Error
+}
+
+// Subscriptions get all user subscribed by given user
+func (s *GormStore) Subscriptions(userID uuid.UUID) ([]model.User, error) {
+	return s.related("notifications", "target_id", "user_id", userID)
+}
+
+// IsSubscribed check whether user subscribed to target
+func (s *GormStore) IsSubscribed(userID, targetID uuid.UUID) (bool, error) {
+	return s.exists("notifications", "target_id", userID, targetID)
+}
+
+// Subscribe subscribe user to target notification
+func (s *GormStore) Subscribe(userID, targetID uuid.UUID) error {
+	return s.insert("notifications", "target_id", userID, targetID)
+}
+
+// Unsubscribe remove user subscription to target
+func (s *GormStore) Unsubscribe(userID, targetID uuid.UUID) (bool, error) {
+	return s.delete("notifications", "target_id", userID, targetID)
+}
+
+// IsBlocked check whether user blocked target
+func (s *GormStore) IsBlocked(userID, targetID uuid.UUID) (bool, error) {
+	return s.exists("blocks", "target_id", userID, targetID)
+}
+
+// Block record user block to target
+func (s *GormStore) Block(userID, targetID uuid.UUID) error {
+	return s.insert("blocks", "target_id", userID, targetID)
+}
+
+// Unblock remove user block to target
+func (s *GormStore) Unblock(userID, targetID uuid.UUID) (bool, error) {
+	return s.delete("blocks", "target_id", userID, targetID)
+}
+
+// Blocks get all user blocked by given user
+func (s *GormStore) Blocks(userID uuid.UUID) ([]model.User, error) {
+	return s.related("blocks", "target_id", "user_id", userID)
+}
+
+// Blockers get all user that has been blocking given user
+func (s *GormStore) Blockers(userID uuid.UUID) ([]model.User, error) {
+	return s.related("blocks", "user_id", "target_id", userID)
+}
+
+// BlockEdges get all block involving given users in either direction
+func (s *GormStore) BlockEdges(userIDs []uuid.UUID) ([]Edge, error) {
+	edges := make([]Edge, 0)
+	if len(userIDs) == 0 {
+		return edges, nil
+	}
+
+	db, err := s.session()
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Table("blocks").Select("user_id, target_id").Where("tenant = ? AND (user_id IN (?) OR target_id IN (?))", s.tenant, userIDs, userIDs).Scan(&edges).Error
+	return edges, err
+}
+
+// CreateMessage store message along with unread inbox entry for every recipient
+func (s *GormStore) CreateMessage(message *model.Message, recipientIDs []uuid.UUID) error {
+	db, err := s.session()
+	if err != nil {
+		return err
+	}
+
+	message.Tenant = s.tenant
+	if err := db.Create(message).Error; err != nil {
+		return err
+	}
+
+	for _, recipientID := range recipientIDs {
+		if err := db.Create(&model.InboxEntry{Tenant: s.tenant, MessageID: message.ID, RecipientID: recipientID}).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FindMessage get message by its id
+func (s *GormStore) FindMessage(messageID uuid.UUID) (*model.Message, error) {
+	db, err := s.session()
+	if err != nil {
+		return nil, err
+	}
+
+	var message model.Message
+	if err := db.Preload("Sender").First(&message, "tenant = ? AND id = ?", s.tenant, messageID).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &message, nil
+}
+
+// MessageRecipients get page of message recipient matching query
+func (s *GormStore) MessageRecipients(messageID uuid.UUID, query ListQuery) ([]model.User, int, error) {
+	db, err := s.session()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	scope := db.Table("users").Joins("JOIN inbox_entries ON inbox_entries.recipient_id = users.id").
+		Where("inbox_entries.tenant = ? AND inbox_entries.message_id = ? AND users.deleted_at IS NULL", s.tenant, messageID)
+
+	query.SortBy = SortByEmail
+	scope, total, err := page(scope, "", query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	users := make([]model.User, 0)
+	err = scope.Select("users.*").Find(&users).Error
+	return users, total, err
+}
+
+// InboxEntries get page of user inbox newest first
+func (s *GormStore) InboxEntries(recipientID uuid.UUID, unreadOnly bool, offset, limit int) ([]model.InboxEntry, int, error) {
+	db, err := s.session()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := db.Model(&model.InboxEntry{}).Where("tenant = ? AND recipient_id = ?", s.tenant, recipientID)
+	if unreadOnly {
+		query = query.Where("read_at IS NULL")
+	}
+
+	var total int
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	entries := make([]model.InboxEntry, 0)
+	err = query.Preload("Message").Preload("Message.Sender").Order("created_at desc, id").Offset(offset).Limit(limit).Find(&entries).Error
+	return entries, total, err
+}
+
+// InboxEntriesSince get inbox entries delivered to user after the one of given message, oldest first
+func (s *GormStore) InboxEntriesSince(recipientID, messageID uuid.UUID, limit int) ([]model.InboxEntry, error) {
+	db, err := s.session()
+	if err != nil {
+		return nil, err
+	}
+
+	var last model.InboxEntry
+	if err := db.Where("tenant = ? AND recipient_id = ? AND message_id = ?", s.tenant, recipientID, messageID).First(&last).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrNotFound
+		}
+
+		return nil, err
+	}
+
+	// entries delivered at the same time are ordered by id, so they are neither skipped nor replayed twice
+	entries := make([]model.InboxEntry, 0)
+	err = db.Preload("Message").Preload("Message.Sender").
+		Where("tenant = ? AND recipient_id = ? AND (created_at > ? OR (created_at = ? AND id > ?))", s.tenant, recipientID, last.CreatedAt, last.CreatedAt, last.ID).
+		Order("created_at, id").Limit(limit).Find(&entries).Error
+	return entries, err
+}
+
+// UnreadCount count unread inbox entry of user
+func (s *GormStore) UnreadCount(recipientID uuid.UUID) (int, error) {
+	db, err := s.session()
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	err = db.Model(&model.InboxEntry{}).Where("tenant = ? AND recipient_id = ? AND read_at IS NULL", s.tenant, recipientID).Count(&count).Error
+	return count, err
+}
+
+// MarkRead mark unread inbox entries of user as read
+func (s *GormStore) MarkRead(recipientID uuid.UUID, entryIDs []uuid.UUID) (int, error) {
+	db, err := s.session()
+	if err != nil {
+		return 0, err
+	}
+
+	query := db.Model(&model.InboxEntry{}).Where("tenant = ? AND recipient_id = ? AND read_at IS NULL", s.tenant, recipientID)
+	if len(entryIDs) > 0 {
+		query = query.Where("id IN (?)", entryIDs)
+	}
+
+	now := time.Now()
+	result := query.Updates(map[string]interface{}{"read_at": &now})
+	return int(result.RowsAffected), result.Error
+}
+
+// CreateWebhook store new webhook
+func (s *GormStore) CreateWebhook(webhook *model.Webhook) error {
+	db, err := s.session()
+	if err != nil {
+		return err
+	}
+
+	webhook.Tenant = s.tenant
+	return db.Create(webhook).Error
+}
+
+// Webhooks get all webhook owned by any of given users
+func (s *GormStore) Webhooks(userIDs []uuid.UUID) ([]model.Webhook, error) {
+	webhooks := make([]model.Webhook, 0)
+	if len(userIDs) == 0 {
+		return webhooks, nil
+	}
+
+	db, err := s.session()
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Where("tenant = ? AND user_id IN (?)", s.tenant, userIDs).Order("created_at, id").Find(&webhooks).Error
+	return webhooks, err
+}
+
+// DeleteWebhook remove webhook owned by user
+func (s *GormStore) DeleteWebhook(userID, webhookID uuid.UUID) (bool, error) {
+	db, err := s.session()
+	if err != nil {
+		return false, err
+	}
+
+	result := db.Where("tenant = ? AND user_id = ? AND id = ?", s.tenant, userID, webhookID).Delete(&model.Webhook{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// CreateWebhookDeadLetter store permanently failed webhook delivery
+func (s *GormStore) CreateWebhookDeadLetter(deadLetter *model.WebhookDeadLetter) error {
+	db, err := s.session()
+	if err != nil {
+		return err
+	}
+
+	deadLetter.Tenant = s.tenant
+	return db.Create(deadLetter).Error
+}
+
+// CreateEmailDelivery store new email delivery
+func (s *GormStore) CreateEmailDelivery(emailDelivery *model.EmailDelivery) error {
+	db, err := s.session()
+	if err != nil {
+		return err
+	}
+
+	emailDelivery.Tenant = s.tenant
+	return db.Create(emailDelivery).Error
+}
+
+// UpdateEmailDelivery save email delivery state
+func (s *GormStore) UpdateEmailDelivery(emailDelivery *model.EmailDelivery) error {
+	db, err := s.session()
+	if err != nil {
+		return err
+	}
+
+	return db.Model(emailDelivery).Where("tenant = ?", s.tenant).Updates(map[string]interface{}{
+		"status":     emailDelivery.Status,
+		"attempts":   emailDelivery.Attempts,
+		"last_error": emailDelivery.LastError,
+		"sent_at":    emailDelivery.SentAt,
+	}).Error
+}
+
+// EmailDeliveries get all email delivery of a message
+func (s *GormStore) EmailDeliveries(messageID uuid.UUID) ([]model.EmailDelivery, error) {
+	db, err := s.session()
+	if err != nil {
+		return nil, err
+	}
+
+	emailDeliveries := make([]model.EmailDelivery, 0)
+	err = db.Where("tenant = ? AND message_id = ?", s.tenant, messageID).Order("email").Find(&emailDeliveries).Error
+	return emailDeliveries, err
+}
+
+// CreateAPIKey store new API key
+func (s *GormStore) CreateAPIKey(key *model.APIKey) error {
+	db, err := s.session()
+	if err != nil {
+		return err
+	}
+
+	return db.Create(key).Error
+}
+
+// FindAPIKey get API key by its id
+func (s *GormStore) FindAPIKey(id uuid.UUID) (*model.APIKey, error) {
+	db, err := s.session()
+	if err != nil {
+		return nil, err
+	}
+
+	var key model.APIKey
+	if err := db.First(&key, "id = ?", id).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+// APIKeys get every API key, revoked and expired one included, oldest first
+func (s *GormStore) APIKeys() ([]model.APIKey, error) {
+	db, err := s.session()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]model.APIKey, 0)
+	err = db.Order("created_at").Find(&keys).Error
+	return keys, err
+}
+
+// RevokeAPIKey returns false when there is no such key or it is already revoked
+func (s *GormStore) RevokeAPIKey(id uuid.UUID) (bool, error) {
+	db, err := s.session()
+	if err != nil {
+		return false, err
+	}
+
+	result := db.Model(&model.APIKey{}).Where("id = ? AND revoked_at IS NULL", id).Update("revoked_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+// TouchAPIKey record the time key was last used
+func (s *GormStore) TouchAPIKey(id uuid.UUID, usedAt time.Time) error {
+	db, err := s.session()
+	if err != nil {
+		return err
+	}
+
+	return db.Model(&model.APIKey{}).Where("id = ?", id).UpdateColumn("last_used_at", usedAt).Error
+}
+
+// CreateAuditEvent store audit event of store tenant
+func (s *GormStore) CreateAuditEvent(event *model.AuditEvent) error {
+	db, err := s.session()
+	if err != nil {
+		return err
+	}
+
+	event.Tenant = s.tenant
+	return db.Create(event).Error
+}
+
+// AuditEvents get page of audit trail of store tenant matching query newest first
+func (s *GormStore) AuditEvents(query AuditQuery) ([]model.AuditEvent, int, error) {
+	db, err := s.session()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	scope := db.Model(&model.AuditEvent{}).Where("tenant = ?", s.tenant)
+	if query.Email != "" {
+		scope = scope.Where("(actor = ? OR subject = ? OR target = ?)", query.Email, query.Email, query.Email)
+	}
+	if !query.From.IsZero() {
+		scope = scope.Where("created_at >= ?", query.From)
+	}
+	if !query.To.IsZero() {
+		scope = scope.Where("created_at < ?", query.To)
+	}
+
+	var total int
+	if err := scope.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	events := make([]model.AuditEvent, 0)
+	err = scope.Order("created_at desc").Order("id").Offset(query.Offset).Limit(query.Limit).Find(&events).Error
+	return events, total, err
+}
+
+// Counts get number of record in the social graph of store tenant
+func (s *GormStore) Counts() (*GraphCounts, error) {
+	db, err := s.session()
+	if err != nil {
+		return nil, err
+	}
+
+	var counts GraphCounts
+	var friends int
+	queries := []struct {
+		scope *gorm.DB
+		count *int
+	}{
+		{db.Model(&model.User{}).Where("tenant = ?", s.tenant), &counts.Users},
+		{db.Model(&model.User{}).Where("tenant = ? AND suspended_at IS NOT NULL", s.tenant), &counts.SuspendedUsers},
+		{db.Table("friends").Where("tenant = ?", s.tenant), &friends},
+		{db.Table("notifications").Where("tenant = ?", s.tenant), &counts.Subscriptions},
+		{db.Table("blocks").Where("tenant = ?", s.tenant), &counts.Blocks},
+		{db.Model(&model.FriendRequest{}).Where("tenant = ? AND status = ?", s.tenant, model.FriendRequestPending), &counts.PendingFriendRequests},
+		{db.Model(&model.Message{}).Where("tenant = ?", s.tenant), &counts.Messages},
+	}
+	for _, q := range queries {
+		if err := q.scope.Count(q.count).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	// friend connection is stored as a row on each side
+	counts.Friendships = friends / 2
+	return &counts, nil
+}
+
+// connectionRow is a row of friend page query
+type connectionRow struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Email       string
+	DisplayName string
+	AvatarURL   string
+	Locale      string
+	Timezone    string
+	Bio         string
+	ConnectedAt *time.Time
+	Source      string
+	Label       string
+}
+
+func (row connectionRow) connection() Connection {
+	connection := Connection{Source: row.Source, Label: row.Label}
+	connection.ID = row.ID
+	connection.CreatedAt = row.CreatedAt
+	connection.UpdatedAt = row.UpdatedAt
+	connection.Email = row.Email
+	connection.DisplayName = row.DisplayName
+	connection.AvatarURL = row.AvatarURL
+	connection.Locale = row.Locale
+	connection.Timezone = row.Timezone
+	connection.Bio = row.Bio
+	if row.ConnectedAt != nil {
+		connection.ConnectedAt = *row.ConnectedAt
+	}
+
+	return connection
+}
+
+// page count users of scope matching query filter then narrow scope down to the requested page,
+// connectedAtColumn is the column to order by when query is sorted by connection time
+func page(scope *gorm.DB, connectedAtColumn string, query ListQuery) (*gorm.DB, int, error) {
+	if query.EmailPrefix != "" {
+		scope = scope.Where("users.email LIKE ? ESCAPE '!'", escapeLike(query.EmailPrefix)+"%")
+	}
+
+	var total int
+	if err := scope.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	direction, after := "", ">"
+	if query.Desc {
+		direction, after = " desc", "<"
+	}
+
+	c := query.After
+	if query.SortBy == SortByConnectedAt && connectedAtColumn != "" {
+		if c != nil {
+			scope = scope.Where("("+connectedAtColumn+" "+after+" ? OR ("+connectedAtColumn+" = ? AND users.email "+after+" ?))", c.ConnectedAt, c.ConnectedAt, c.Email)
+		}
+		scope = scope.Order(connectedAtColumn + direction).Order("users.email" + direction)
+	} else {
+		if c != nil {
+			scope = scope.Where("users.email "+after+" ?", c.Email)
+		}
+		scope = scope.Order("users.email" + direction)
+	}
+
+	return scope.Limit(query.Limit), total, nil
+}
+
+// escapeLike escape LIKE wildcard in s using ! as escape character
+func escapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
+
+// edgeTables join tables of relation between two user along with the column referencing the other user
+var edgeTables = map[string]string{
+	"friends":       "friend_id",
+	"notifications": "target_id",
+	"blocks":        "target_id",
+}
+
+// repoint move rows of table whose column references source user to target user. Row that would duplicate the one
+// target user already has, i.e. same otherColumn value, is deleted instead
+func (s *GormStore) repoint(table, column, otherColumn string, sourceID, targetID uuid.UUID) error {
+	db, err := s.session()
+	if err != nil {
+		return err
+	}
+
+	var owned []uuid.UUID
+	if err := db.Table(table).Where("tenant = ? AND "+column+" = ?", s.tenant, targetID).Pluck(otherColumn, &owned).Error; err != nil {
+		return err
+	}
+
+	// deleting by subquery on the same table is not allowed by mysql, so target rows are looked up first
+	if len(owned) > 0 {
+		err := db.Exec("DELETE FROM "+table+" WHERE tenant = ? AND "+column+" = ? AND "+otherColumn+" IN (?)", s.tenant, sourceID, owned).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return db.Exec("UPDATE "+table+" SET "+column+" = ? WHERE tenant = ? AND "+column+" = ?", targetID, s.tenant, sourceID).Error
+}
+
+// related get users referenced by selectColumn of join table rows whose whereColumn match given id
+func (s *GormStore) related(table, selectColumn, whereColumn string, id uuid.UUID) ([]model.User, error) {
+	db, err := s.session()
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]model.User, 0)
+	subQuery := "id IN (SELECT " + selectColumn + " FROM " + table + " WHERE tenant = ? AND " + whereColumn + " = ?)"
+	err = db.Where("tenant = ? AND "+subQuery, s.tenant, s.tenant, id).Order("email").Find(&users).Error
+	return users, err
+}
+
+func (s *GormStore) exists(table, targetColumn string, userID, targetID uuid.UUID) (bool, error) {
+	db, err := s.session()
+	if err != nil {
+		return false, err
+	}
+
+	var count int
+	err = db.Table(table).Where("tenant = ? AND user_id = ? AND "+targetColumn+" = ?", s.tenant, userID, targetID).Count(&count).Error
+	return count > 0, err
+}
+
+// insert add join table row when it does not exist yet
+func (s *GormStore) insert(table, targetColumn string, userID, targetID uuid.UUID) error {
+	found, err := s.exists(table, targetColumn, userID, targetID)
+	if err != nil || found {
+		return err
+	}
+
+	db, err := s.session()
+	if err != nil {
+		return err
+	}
+
+	return db.Exec("INSERT INTO "+table+" (tenant, user_id, "+targetColumn+") VALUES (?, ?, ?)", s.tenant, userID, targetID).Error
+}
+
+func (s *GormStore) delete(table, targetColumn string, userID, targetID uuid.UUID) (bool, error) {
+	db, err := s.session()
+	if err != nil {
+		return false, err
+	}
+
+	result := db.Exec("DELETE FROM "+table+" WHERE tenant = ? AND user_id = ? AND "+targetColumn+" = ?", s.tenant, userID, targetID)
+	return result.RowsAffected > 0, result.Error
+}
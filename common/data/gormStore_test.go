@@ -0,0 +1,726 @@
+package data
+
+import (
+	"fmgo/common/config"
+	"fmgo/common/data/migration"
+	"fmgo/common/data/model"
+	"fmgo/common/mailaddr"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+// newSQLiteStore open fresh in-memory sqlite database with every migration applied, the database is gone once
+// store.factory is closed
+func newSQLiteStore(t *testing.T) *GormStore {
+	factory := NewDbFactory(config.DatabaseConfiguration{DbType: "sqlite", ConnectionURI: ":memory:"})
+	db, err := factory.DBConnection()
+	if err != nil {
+		t.Fatalf("Failed to open sqlite database: %s", err)
+	}
+	if _, err := migration.New(db, mailaddr.NewCanonicalizer(config.EmailConfiguration{CaseFolding: true}).Canonicalize).Up(); err != nil {
+		t.Fatalf("Failed to migrate sqlite database: %s", err)
+	}
+
+	return NewGormStore(factory)
+}
+
+// users find or create user of every email, failing the test on error
+func users(t *testing.T, store GraphStore, emails ...string) []*model.User {
+	result := make([]*model.User, 0, len(emails))
+	for _, email := range emails {
+		user, err := store.FindOrCreateUser(email)
+		if err != nil {
+			t.Fatalf("Failed to find or create %s: %s", email, err)
+		}
+		result = append(result, user)
+	}
+
+	return result
+}
+
+// emailsOf get email of every user in order
+func emailsOf(users []model.User) []string {
+	emails := make([]string, 0, len(users))
+	for _, user := range users {
+		emails = append(emails, user.Email)
+	}
+
+	return emails
+}
+
+func assertEmails(t *testing.T, what string, got []model.User, want ...string) {
+	emails := emailsOf(got)
+	if len(emails) != len(want) {
+		t.Fatalf("%s: got %v, want %v", what, emails, want)
+	}
+	for i := range want {
+		if emails[i] != want[i] {
+			t.Fatalf("%s: got %v, want %v", what, emails, want)
+		}
+	}
+}
+
+// assertReplay post three updates to the same recipient, then have sameTime set every inbox entry to the same time
+// and check that replay after each update gets exactly the later ones in id order
+func assertReplay(t *testing.T, store GraphStore, sameTime func(at time.Time)) {
+	u := users(t, store, "andy@example.com", "john@example.com")
+	for i := 0; i < 3; i++ {
+		if err := store.CreateMessage(&model.Message{SenderID: u[0].ID, Text: "hello"}, []uuid.UUID{u[1].ID}); err != nil {
+			t.Fatalf("CreateMessage: %s", err)
+		}
+	}
+	sameTime(time.Now().Truncate(time.Second))
+
+	// newest first, entries of the same time by id
+	entries, _, err := store.InboxEntries(u[1].ID, false, 0, 10)
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("InboxEntries returned %d entries, %v", len(entries), err)
+	}
+
+	for i, entry := range entries {
+		replayed, err := store.InboxEntriesSince(u[1].ID, entry.MessageID, 10)
+		if err != nil {
+			t.Fatalf("InboxEntriesSince: %s", err)
+		}
+
+		want := entries[i+1:]
+		if len(replayed) != len(want) {
+			t.Fatalf("replay after entry %d got %d entries, want %d", i, len(replayed), len(want))
+		}
+		for j := range want {
+			if replayed[j].ID != want[j].ID {
+				t.Fatalf("replay after entry %d got %s at %d, want %s", i, replayed[j].ID, j, want[j].ID)
+			}
+		}
+	}
+}
+
+// assertTenantIsolation connect users of default tenant, then check that store scoped to another tenant neither sees
+// nor changes any of their records when given their ids
+func assertTenantIsolation(t *testing.T, store GraphStore) {
+	u := users(t, store, "andy@example.com", "john@example.com", "lisa@example.com")
+	if err := store.AddFriend(&model.Friend{UserID: u[0].ID, FriendID: u[1].ID, Source: model.FriendSourceAPI}); err != nil {
+		t.Fatalf("AddFriend: %s", err)
+	}
+	if err := store.Block(u[0].ID, u[2].ID); err != nil {
+		t.Fatalf("Block: %s", err)
+	}
+	if err := store.CreateFriendRequest(&model.FriendRequest{RequestorID: u[2].ID, TargetID: u[1].ID, Status: model.FriendRequestPending}); err != nil {
+		t.Fatalf("CreateFriendRequest: %s", err)
+	}
+	if err := store.CreateMessage(&model.Message{SenderID: u[0].ID, Text: "hello"}, []uuid.UUID{u[1].ID}); err != nil {
+		t.Fatalf("CreateMessage: %s", err)
+	}
+	webhook := model.Webhook{UserID: u[1].ID, URL: "https://example.com/hook", Secret: "secret"}
+	if err := store.CreateWebhook(&webhook); err != nil {
+		t.Fatalf("CreateWebhook: %s", err)
+	}
+
+	other := store.WithTenant("acme")
+	if friends, err := other.Friends(u[0].ID); err != nil || len(friends) != 0 {
+		t.Errorf("Friends in other tenant: %v %v", emailsOf(friends), err)
+	}
+	if edges, err := other.FriendEdges([]uuid.UUID{u[0].ID, u[1].ID}); err != nil || len(edges) != 0 {
+		t.Errorf("FriendEdges in other tenant: %v %v", edges, err)
+	}
+	if edges, err := other.BlockEdges([]uuid.UUID{u[0].ID, u[2].ID}); err != nil || len(edges) != 0 {
+		t.Errorf("BlockEdges in other tenant: %v %v", edges, err)
+	}
+	if _, err := other.FindFriendRequest(u[2].ID, u[1].ID, model.FriendRequestPending); err != ErrNotFound {
+		t.Errorf("FindFriendRequest in other tenant: %v", err)
+	}
+	if entries, total, err := other.InboxEntries(u[1].ID, false, 0, 10); err != nil || total != 0 || len(entries) != 0 {
+		t.Errorf("InboxEntries in other tenant: %d of %d, %v", len(entries), total, err)
+	}
+	if webhooks, err := other.Webhooks([]uuid.UUID{u[1].ID}); err != nil || len(webhooks) != 0 {
+		t.Errorf("Webhooks in other tenant: %d, %v", len(webhooks), err)
+	}
+
+	if removed, err := other.RemoveFriend(u[0].ID, u[1].ID); err != nil || removed {
+		t.Errorf("RemoveFriend in other tenant: %v %v", removed, err)
+	}
+	if unblocked, err := other.Unblock(u[0].ID, u[2].ID); err != nil || unblocked {
+		t.Errorf("Unblock in other tenant: %v %v", unblocked, err)
+	}
+	if deleted, err := other.DeleteWebhook(u[1].ID, webhook.ID); err != nil || deleted {
+		t.Errorf("DeleteWebhook in other tenant: %v %v", deleted, err)
+	}
+
+	// records are still there for their own tenant
+	if friend, err := store.IsFriend(u[0].ID, u[1].ID); err != nil || !friend {
+		t.Errorf("friendship is gone: %v", err)
+	}
+	if blocked, err := store.IsBlocked(u[0].ID, u[2].ID); err != nil || !blocked {
+		t.Errorf("block is gone: %v", err)
+	}
+	if webhooks, err := store.Webhooks([]uuid.UUID{u[1].ID}); err != nil || len(webhooks) != 1 || webhooks[0].Tenant != store.Tenant() {
+		t.Errorf("Webhooks: %+v %v", webhooks, err)
+	}
+}
+
+// assertMergeSelfEdge check that users related to each other in any way are refused to merge, leaving both intact
+func assertMergeSelfEdge(t *testing.T, store GraphStore) {
+	tests := []struct {
+		name   string
+		relate func(source, target uuid.UUID) error
+	}{
+		{"friends", func(source, target uuid.UUID) error {
+			return store.AddFriend(&model.Friend{UserID: source, FriendID: target, Source: model.FriendSourceAPI})
+		}},
+		{"source subscribed to target", func(source, target uuid.UUID) error { return store.Subscribe(source, target) }},
+		{"target subscribed to source", func(source, target uuid.UUID) error { return store.Subscribe(target, source) }},
+		{"source blocking target", func(source, target uuid.UUID) error { return store.Block(source, target) }},
+		{"target blocking source", func(source, target uuid.UUID) error { return store.Block(target, source) }},
+		{"pending request from source", func(source, target uuid.UUID) error {
+			return store.CreateFriendRequest(&model.FriendRequest{RequestorID: source, TargetID: target, Status: model.FriendRequestPending})
+		}},
+		{"pending request to source", func(source, target uuid.UUID) error {
+			return store.CreateFriendRequest(&model.FriendRequest{RequestorID: target, TargetID: source, Status: model.FriendRequestPending})
+		}},
+	}
+
+	for i, test := range tests {
+		u := users(t, store, fmt.Sprintf("source%d@example.com", i), fmt.Sprintf("target%d@example.com", i))
+		if err := test.relate(u[0].ID, u[1].ID); err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		if err := store.MergeUsers(u[0].ID, u[1].ID); err != ErrSelfEdge {
+			t.Errorf("%s: MergeUsers returned %v, want ErrSelfEdge", test.name, err)
+		}
+		if found, err := store.FindUser(u[0].Email); err != nil || found.ID != u[0].ID {
+			t.Errorf("%s: source user is gone after refused merge: %v", test.name, err)
+		}
+	}
+}
+
+// assertMergeUsers merge user holding every kind of record into another one, then check that each record follows
+// the target user without duplicate. deadLetterRecipients gets recipient of every webhook dead letter, which the
+// store does not list
+func assertMergeUsers(t *testing.T, store GraphStore, deadLetterRecipients func() []uuid.UUID) {
+	u := users(t, store, "source@example.com", "target@example.com", "kate@example.com", "mike@example.com", "lisa@example.com",
+		"nina@example.com", "paul@example.com")
+	source, target, kate, mike, lisa, nina, paul := u[0], u[1], u[2], u[3], u[4], u[5], u[6]
+
+	// both are friend of kate, only source of mike
+	for _, friend := range []model.Friend{{UserID: source.ID, FriendID: kate.ID}, {UserID: target.ID, FriendID: kate.ID}, {UserID: mike.ID, FriendID: source.ID}} {
+		friend.Source = model.FriendSourceAPI
+		if err := store.AddFriend(&friend); err != nil {
+			t.Fatalf("AddFriend: %s", err)
+		}
+	}
+	for _, edge := range [][2]uuid.UUID{{kate.ID, source.ID}, {kate.ID, target.ID}, {source.ID, mike.ID}} {
+		if err := store.Subscribe(edge[0], edge[1]); err != nil {
+			t.Fatalf("Subscribe: %s", err)
+		}
+	}
+	if err := store.Block(source.ID, lisa.ID); err != nil {
+		t.Fatalf("Block: %s", err)
+	}
+
+	// both asked nina, paul asked source, and source already rejected target once
+	rejected := model.FriendRequest{RequestorID: target.ID, TargetID: source.ID, Status: model.FriendRequestPending}
+	for _, friendRequest := range []*model.FriendRequest{
+		{RequestorID: source.ID, TargetID: nina.ID, Status: model.FriendRequestPending},
+		{RequestorID: target.ID, TargetID: nina.ID, Status: model.FriendRequestPending},
+		{RequestorID: paul.ID, TargetID: source.ID, Status: model.FriendRequestPending},
+		&rejected,
+	} {
+		if err := store.CreateFriendRequest(friendRequest); err != nil {
+			t.Fatalf("CreateFriendRequest: %s", err)
+		}
+	}
+	if err := store.UpdateFriendRequestStatus(&rejected, model.FriendRequestRejected); err != nil {
+		t.Fatalf("UpdateFriendRequestStatus: %s", err)
+	}
+
+	// kate posted to both, source posted to kate
+	toBoth := model.Message{SenderID: kate.ID, Text: "hello both"}
+	if err := store.CreateMessage(&toBoth, []uuid.UUID{source.ID, target.ID}); err != nil {
+		t.Fatalf("CreateMessage: %s", err)
+	}
+	fromSource := model.Message{SenderID: source.ID, Text: "hello kate"}
+	if err := store.CreateMessage(&fromSource, []uuid.UUID{kate.ID}); err != nil {
+		t.Fatalf("CreateMessage: %s", err)
+	}
+
+	webhook := model.Webhook{UserID: source.ID, URL: "https://example.com/hook", Secret: "secret"}
+	if err := store.CreateWebhook(&webhook); err != nil {
+		t.Fatalf("CreateWebhook: %s", err)
+	}
+	if err := store.CreateWebhookDeadLetter(&model.WebhookDeadLetter{WebhookID: webhook.ID, MessageID: toBoth.ID, RecipientID: source.ID, URL: webhook.URL}); err != nil {
+		t.Fatalf("CreateWebhookDeadLetter: %s", err)
+	}
+	if err := store.CreateEmailDelivery(&model.EmailDelivery{MessageID: toBoth.ID, RecipientID: source.ID, Email: source.Email, Status: model.EmailDeliverySent}); err != nil {
+		t.Fatalf("CreateEmailDelivery: %s", err)
+	}
+	if err := store.AddAlias(&model.UserAlias{UserID: source.ID, Email: "source.work@example.com"}); err != nil {
+		t.Fatalf("AddAlias: %s", err)
+	}
+
+	if err := store.MergeUsers(source.ID, target.ID); err != nil {
+		t.Fatalf("MergeUsers: %s", err)
+	}
+
+	if found, err := store.FindUsers([]uuid.UUID{source.ID}); err != nil || len(found) != 0 {
+		t.Errorf("source user is still there: %d, %v", len(found), err)
+	}
+	for _, email := range []string{"source@example.com", "source.work@example.com"} {
+		if found, err := store.FindUser(email); err != nil || found.ID != target.ID {
+			t.Errorf("%s does not resolve to target user: %v", email, err)
+		}
+	}
+	aliases, err := store.Aliases(target.ID)
+	if err != nil || len(aliases) != 2 || aliases[0].Email != "source.work@example.com" || aliases[1].Email != "source@example.com" {
+		t.Errorf("Aliases of target: %+v %v", aliases, err)
+	}
+
+	friends, err := store.Friends(target.ID)
+	if err != nil {
+		t.Fatalf("Friends: %s", err)
+	}
+	assertEmails(t, "friends of target", friends, "kate@example.com", "mike@example.com")
+	friends, err = store.Friends(kate.ID)
+	if err != nil {
+		t.Fatalf("Friends: %s", err)
+	}
+	assertEmails(t, "friends of kate", friends, "target@example.com")
+	subscriptions, err := store.Subscriptions(target.ID)
+	if err != nil {
+		t.Fatalf("Subscriptions: %s", err)
+	}
+	assertEmails(t, "subscriptions of target", subscriptions, "mike@example.com")
+	subscriptions, err = store.Subscriptions(kate.ID)
+	if err != nil {
+		t.Fatalf("Subscriptions: %s", err)
+	}
+	assertEmails(t, "subscriptions of kate", subscriptions, "target@example.com")
+	if blocked, err := store.IsBlocked(target.ID, lisa.ID); err != nil || !blocked {
+		t.Errorf("block of source was not moved: %v", err)
+	}
+
+	// target keeps its own request to nina, the one of source is cancelled
+	outgoing, err := store.FriendRequests(target.ID, true, model.FriendRequestPending)
+	if err != nil || len(outgoing) != 1 || outgoing[0].TargetID != nina.ID {
+		t.Errorf("pending outgoing request of target: %+v %v", outgoing, err)
+	}
+	if cancelled, err := store.FriendRequests(target.ID, true, model.FriendRequestCancelled); err != nil || len(cancelled) != 1 {
+		t.Errorf("cancelled outgoing request of target: %d, %v", len(cancelled), err)
+	}
+	incoming, err := store.FriendRequests(target.ID, false, model.FriendRequestPending)
+	if err != nil || len(incoming) != 1 || incoming[0].RequestorID != paul.ID {
+		t.Errorf("pending incoming request of target: %+v %v", incoming, err)
+	}
+	if answered, err := store.FriendRequests(target.ID, true, model.FriendRequestRejected); err != nil || len(answered) != 0 {
+		t.Errorf("rejected request between both users was kept: %d, %v", len(answered), err)
+	}
+
+	entries, total, err := store.InboxEntries(target.ID, false, 0, 10)
+	if err != nil || total != 1 || len(entries) != 1 || entries[0].MessageID != toBoth.ID {
+		t.Errorf("inbox of target: %d of %d, %v", len(entries), total, err)
+	}
+	entries, _, err = store.InboxEntries(kate.ID, false, 0, 10)
+	if err != nil || len(entries) != 1 || entries[0].Message.SenderID != target.ID {
+		t.Errorf("message of source was not moved: %+v %v", entries, err)
+	}
+
+	if webhooks, err := store.Webhooks([]uuid.UUID{target.ID}); err != nil || len(webhooks) != 1 || webhooks[0].ID != webhook.ID {
+		t.Errorf("webhook of source was not moved: %+v %v", webhooks, err)
+	}
+	if recipients := deadLetterRecipients(); len(recipients) != 1 || recipients[0] != target.ID {
+		t.Errorf("dead letter recipients %v, want target", recipients)
+	}
+	emailDeliveries, err := store.EmailDeliveries(toBoth.ID)
+	if err != nil || len(emailDeliveries) != 1 || emailDeliveries[0].RecipientID != target.ID {
+		t.Errorf("email delivery of source was not moved: %+v %v", emailDeliveries, err)
+	}
+}
+
+// assertChangeEmail check that user takes new primary email keeping its relations, promoting its own alias, and that
+// email of another user is refused
+func assertChangeEmail(t *testing.T, store GraphStore) {
+	u := users(t, store, "andy@example.com", "john@example.com", "kate@example.com")
+	if err := store.AddFriend(&model.Friend{UserID: u[0].ID, FriendID: u[1].ID, Source: model.FriendSourceAPI}); err != nil {
+		t.Fatalf("AddFriend: %s", err)
+	}
+	for _, alias := range []model.UserAlias{{UserID: u[0].ID, Email: "andrew@example.com"}, {UserID: u[2].ID, Email: "katie@example.com"}} {
+		if err := store.AddAlias(&alias); err != nil {
+			t.Fatalf("AddAlias: %s", err)
+		}
+	}
+
+	tests := []struct {
+		email string
+		err   error
+	}{
+		{"john@example.com", ErrEmailTaken},
+		{"katie@example.com", ErrEmailTaken},
+		{"andrew@example.com", nil},
+		{"andy.new@example.com", nil},
+	}
+	for _, test := range tests {
+		if err := store.ChangeEmail(u[0], test.email); err != test.err {
+			t.Errorf("ChangeEmail to %s returned %v, want %v", test.email, err, test.err)
+		}
+	}
+
+	if u[0].Email != "andy.new@example.com" {
+		t.Fatalf("user email is %s after change", u[0].Email)
+	}
+	for email, found := range map[string]bool{"andy.new@example.com": true, "andy@example.com": false, "andrew@example.com": false} {
+		user, err := store.FindUser(email)
+		if found && (err != nil || user.ID != u[0].ID) {
+			t.Errorf("%s does not resolve to user: %v", email, err)
+		}
+		if !found && err != ErrNotFound {
+			t.Errorf("%s still resolves: %v", email, err)
+		}
+	}
+	if aliases, err := store.Aliases(u[0].ID); err != nil || len(aliases) != 0 {
+		t.Errorf("promoted alias was kept: %+v %v", aliases, err)
+	}
+
+	friends, err := store.Friends(u[1].ID)
+	if err != nil {
+		t.Fatalf("Friends: %s", err)
+	}
+	assertEmails(t, "friends of john", friends, "andy.new@example.com")
+}
+
+func TestGormStoreFindOrCreateUser(t *testing.T) {
+	store := newSQLiteStore(t)
+	defer store.factory.Close()
+
+	created, err := store.FindOrCreateUser("andy@example.com")
+	if err != nil {
+		t.Fatalf("FindOrCreateUser: %s", err)
+	}
+	if created.ID == uuid.Nil || created.Tenant != DefaultTenant {
+		t.Fatalf("created user has id %s and tenant %q", created.ID, created.Tenant)
+	}
+
+	found, err := store.FindOrCreateUser("andy@example.com")
+	if err != nil {
+		t.Fatalf("FindOrCreateUser: %s", err)
+	}
+	if found.ID != created.ID {
+		t.Fatalf("existing user resolved to %s, want %s", found.ID, created.ID)
+	}
+
+	if _, err := store.FindUser("john@example.com"); err != ErrNotFound {
+		t.Fatalf("FindUser of unknown email returned %v, want ErrNotFound", err)
+	}
+
+	if err := store.AddAlias(&model.UserAlias{UserID: created.ID, Email: "andrew@example.com"}); err != nil {
+		t.Fatalf("AddAlias: %s", err)
+	}
+	byAlias, err := store.FindOrCreateUser("andrew@example.com")
+	if err != nil {
+		t.Fatalf("FindOrCreateUser by alias: %s", err)
+	}
+	if byAlias.ID != created.ID {
+		t.Fatalf("alias resolved to %s, want %s", byAlias.ID, created.ID)
+	}
+
+	other, err := store.WithTenant("acme").FindOrCreateUser("andy@example.com")
+	if err != nil {
+		t.Fatalf("FindOrCreateUser in other tenant: %s", err)
+	}
+	if other.ID == created.ID {
+		t.Fatal("the same email of another tenant resolved to the same user")
+	}
+}
+
+func TestGormStoreCanonicalEmailMigration(t *testing.T) {
+	store := newSQLiteStore(t)
+	defer store.factory.Close()
+
+	// stored before canonicalization, both gmail addresses are the same mailbox
+	u := users(t, store, "John.Doe+news@Gmail.com", "johndoe@gmail.com", "Lisa@Example.com", "kate@example.com")
+	for _, friend := range []model.Friend{{UserID: u[0].ID, FriendID: u[3].ID}, {UserID: u[1].ID, FriendID: u[3].ID}, {UserID: u[0].ID, FriendID: u[1].ID}} {
+		friend.Source = model.FriendSourceAPI
+		if err := store.AddFriend(&friend); err != nil {
+			t.Fatalf("AddFriend: %s", err)
+		}
+	}
+	if err := store.Subscribe(u[0].ID, u[2].ID); err != nil {
+		t.Fatalf("Subscribe: %s", err)
+	}
+	if err := store.AddAlias(&model.UserAlias{UserID: u[2].ID, Email: "Lisa.Work@Example.com"}); err != nil {
+		t.Fatalf("AddAlias: %s", err)
+	}
+
+	// run canonical email migration again, now with gmail rule. Later migration can not be reverted on sqlite, so
+	// it is only marked as pending
+	db, err := store.factory.DBConnection()
+	if err != nil {
+		t.Fatalf("DBConnection: %s", err)
+	}
+	if err := db.Exec("DELETE FROM schema_migrations WHERE version = 14").Error; err != nil {
+		t.Fatalf("Failed to mark migration pending: %s", err)
+	}
+	canonicalizer := mailaddr.NewCanonicalizer(config.EmailConfiguration{
+		CaseFolding: true,
+		Providers:   []config.EmailProviderConfiguration{{Domains: []string{"gmail.com"}, IgnoreDots: true, TagSeparator: "+"}},
+	})
+	if _, err := migration.New(db, canonicalizer.Canonicalize).Up(); err != nil {
+		t.Fatalf("Up: %s", err)
+	}
+
+	// user already holding canonical email takes over the other one, connection between both is dropped
+	john, err := store.FindUser("johndoe@gmail.com")
+	if err != nil || john.ID != u[1].ID {
+		t.Fatalf("canonical gmail address resolved to %v, %v, want %s", john, err, u[1].ID)
+	}
+	if _, err := store.FindUser(u[0].Email); err != ErrNotFound {
+		t.Fatalf("merged email returned %v, want ErrNotFound", err)
+	}
+	friends, err := store.Friends(john.ID)
+	if err != nil {
+		t.Fatalf("Friends: %s", err)
+	}
+	assertEmails(t, "friends of merged user", friends, "kate@example.com")
+	subscriptions, err := store.Subscriptions(john.ID)
+	if err != nil {
+		t.Fatalf("Subscriptions: %s", err)
+	}
+	assertEmails(t, "subscriptions of merged user", subscriptions, "lisa@example.com")
+
+	for _, email := range []string{"lisa@example.com", "lisa.work@example.com"} {
+		if lisa, err := store.FindUser(email); err != nil || lisa.ID != u[2].ID {
+			t.Fatalf("%s resolved to %v, %v, want %s", email, lisa, err, u[2].ID)
+		}
+	}
+}
+
+func TestGormStoreFriends(t *testing.T) {
+	store := newSQLiteStore(t)
+	defer store.factory.Close()
+	u := users(t, store, "andy@example.com", "john@example.com", "kate@example.com")
+
+	tx, err := store.Begin()
+	if err != nil {
+		t.Fatalf("Begin: %s", err)
+	}
+	for _, friend := range []*model.User{u[1], u[2]} {
+		if err := tx.AddFriend(&model.Friend{UserID: u[0].ID, FriendID: friend.ID, Source: model.FriendSourceAPI}); err != nil {
+			t.Fatalf("AddFriend: %s", err)
+		}
+	}
+	if err := tx.AddFriend(&model.Friend{UserID: u[1].ID, FriendID: u[0].ID, Source: model.FriendSourceAPI}); err != nil {
+		t.Fatalf("AddFriend of existing connection: %s", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit: %s", err)
+	}
+
+	friends, err := store.Friends(u[0].ID)
+	if err != nil {
+		t.Fatalf("Friends: %s", err)
+	}
+	assertEmails(t, "friends of andy", friends, "john@example.com", "kate@example.com")
+
+	friends, err = store.Friends(u[2].ID)
+	if err != nil {
+		t.Fatalf("Friends: %s", err)
+	}
+	assertEmails(t, "friends of kate", friends, "andy@example.com")
+
+	connections, total, err := store.FriendPage(u[1].ID, u[2].ID, ListQuery{SortBy: SortByConnectedAt, Limit: 10})
+	if err != nil {
+		t.Fatalf("FriendPage: %s", err)
+	}
+	if total != 1 || len(connections) != 1 || connections[0].Email != "andy@example.com" || connections[0].Source != model.FriendSourceAPI {
+		t.Fatalf("common friends of john and kate: got %d %+v", total, connections)
+	}
+
+	removed, err := store.RemoveFriend(u[2].ID, u[0].ID)
+	if err != nil || !removed {
+		t.Fatalf("RemoveFriend returned %v, %v", removed, err)
+	}
+	if connected, err := store.IsFriend(u[0].ID, u[2].ID); err != nil || connected {
+		t.Fatalf("IsFriend after removal returned %v, %v", connected, err)
+	}
+}
+
+func TestGormStoreSubscriptions(t *testing.T) {
+	store := newSQLiteStore(t)
+	defer store.factory.Close()
+	u := users(t, store, "andy@example.com", "john@example.com")
+
+	for i := 0; i < 2; i++ {
+		if err := store.Subscribe(u[0].ID, u[1].ID); err != nil {
+			t.Fatalf("Subscribe: %s", err)
+		}
+	}
+
+	subscriptions, err := store.Subscriptions(u[0].ID)
+	if err != nil {
+		t.Fatalf("Subscriptions: %s", err)
+	}
+	assertEmails(t, "subscriptions of andy", subscriptions, "john@example.com")
+
+	if subscribed, err := store.IsSubscribed(u[1].ID, u[0].ID); err != nil || subscribed {
+		t.Fatalf("reverse IsSubscribed returned %v, %v", subscribed, err)
+	}
+
+	removed, err := store.Unsubscribe(u[0].ID, u[1].ID)
+	if err != nil || !removed {
+		t.Fatalf("Unsubscribe returned %v, %v", removed, err)
+	}
+	removed, err = store.Unsubscribe(u[0].ID, u[1].ID)
+	if err != nil || removed {
+		t.Fatalf("second Unsubscribe returned %v, %v", removed, err)
+	}
+}
+
+func TestGormStoreBlocks(t *testing.T) {
+	store := newSQLiteStore(t)
+	defer store.factory.Close()
+	u := users(t, store, "andy@example.com", "john@example.com", "kate@example.com", "lisa@example.com")
+
+	for _, blocker := range []*model.User{u[1], u[2]} {
+		if err := store.Block(blocker.ID, u[0].ID); err != nil {
+			t.Fatalf("Block: %s", err)
+		}
+	}
+
+	blocked, err := store.IsBlocked(u[1].ID, u[0].ID)
+	if err != nil || !blocked {
+		t.Fatalf("IsBlocked returned %v, %v", blocked, err)
+	}
+
+	blocks, err := store.Blocks(u[1].ID)
+	if err != nil {
+		t.Fatalf("Blocks: %s", err)
+	}
+	assertEmails(t, "blocked by john", blocks, "andy@example.com")
+
+	blockers, err := store.Blockers(u[0].ID)
+	if err != nil {
+		t.Fatalf("Blockers: %s", err)
+	}
+	assertEmails(t, "blockers of andy", blockers, "john@example.com", "kate@example.com")
+
+	edges, err := store.BlockEdges([]uuid.UUID{u[0].ID, u[3].ID})
+	if err != nil {
+		t.Fatalf("BlockEdges: %s", err)
+	}
+	if len(edges) != 2 {
+		t.Fatalf("block edges involving andy or lisa: got %+v", edges)
+	}
+	for _, edge := range edges {
+		if edge.TargetID != u[0].ID {
+			t.Fatalf("unexpected block edge %+v", edge)
+		}
+	}
+
+	removed, err := store.Unblock(u[2].ID, u[0].ID)
+	if err != nil || !removed {
+		t.Fatalf("Unblock returned %v, %v", removed, err)
+	}
+	blockers, err = store.Blockers(u[0].ID)
+	if err != nil {
+		t.Fatalf("Blockers: %s", err)
+	}
+	assertEmails(t, "blockers of andy after unblock", blockers, "john@example.com")
+}
+
+func TestGormStoreRecipients(t *testing.T) {
+	store := newSQLiteStore(t)
+	defer store.factory.Close()
+	u := users(t, store, "andy@example.com", "john@example.com", "kate@example.com")
+
+	message := &model.Message{SenderID: u[0].ID, Text: "hello"}
+	if err := store.CreateMessage(message, []uuid.UUID{u[2].ID, u[1].ID}); err != nil {
+		t.Fatalf("CreateMessage: %s", err)
+	}
+
+	recipients, total, err := store.MessageRecipients(message.ID, ListQuery{Limit: 1})
+	if err != nil {
+		t.Fatalf("MessageRecipients: %s", err)
+	}
+	if total != 2 {
+		t.Fatalf("recipient total is %d, want 2", total)
+	}
+	assertEmails(t, "first page of recipients", recipients, "john@example.com")
+
+	recipients, _, err = store.MessageRecipients(message.ID, ListQuery{Limit: 1, After: &ListCursor{Email: "john@example.com"}})
+	if err != nil {
+		t.Fatalf("MessageRecipients: %s", err)
+	}
+	assertEmails(t, "second page of recipients", recipients, "kate@example.com")
+
+	entries, total, err := store.InboxEntries(u[1].ID, true, 0, 10)
+	if err != nil {
+		t.Fatalf("InboxEntries: %s", err)
+	}
+	if total != 1 || len(entries) != 1 || entries[0].Message.Text != "hello" || entries[0].Message.Sender.Email != "andy@example.com" {
+		t.Fatalf("inbox of john: got %d %+v", total, entries)
+	}
+
+	changed, err := store.MarkRead(u[1].ID, nil)
+	if err != nil || changed != 1 {
+		t.Fatalf("MarkRead returned %d, %v", changed, err)
+	}
+	if unread, err := store.UnreadCount(u[1].ID); err != nil || unread != 0 {
+		t.Fatalf("UnreadCount after MarkRead returned %d, %v", unread, err)
+	}
+}
+
+func TestGormStoreInboxEntriesSince(t *testing.T) {
+	store := newSQLiteStore(t)
+	defer store.factory.Close()
+
+	assertReplay(t, store, func(at time.Time) {
+		db, err := store.session()
+		if err != nil {
+			t.Fatalf("session: %s", err)
+		}
+		if err := db.Model(&model.InboxEntry{}).UpdateColumn("created_at", at).Error; err != nil {
+			t.Fatalf("Failed to set inbox entry time: %s", err)
+		}
+	})
+}
+
+func TestGormStoreTenantIsolation(t *testing.T) {
+	store := newSQLiteStore(t)
+	defer store.factory.Close()
+
+	assertTenantIsolation(t, store)
+}
+
+func TestGormStoreMergeUsers(t *testing.T) {
+	store := newSQLiteStore(t)
+	defer store.factory.Close()
+
+	assertMergeUsers(t, store, func() []uuid.UUID {
+		db, err := store.session()
+		if err != nil {
+			t.Fatalf("session: %s", err)
+		}
+
+		var recipients []uuid.UUID
+		if err := db.Model(&model.WebhookDeadLetter{}).Pluck("recipient_id", &recipients).Error; err != nil {
+			t.Fatalf("Failed to get dead letter recipients: %s", err)
+		}
+		return recipients
+	})
+}
+
+func TestGormStoreMergeUsersSelfEdge(t *testing.T) {
+	store := newSQLiteStore(t)
+	defer store.factory.Close()
+
+	assertMergeSelfEdge(t, store)
+}
+
+func TestGormStoreChangeEmail(t *testing.T) {
+	store := newSQLiteStore(t)
+	defer store.factory.Close()
+
+	assertChangeEmail(t, store)
+}
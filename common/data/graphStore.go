@@ -0,0 +1,244 @@
+package data
+
+import (
+	"errors"
+	"fmgo/common/data/model"
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+// MemoryDbType database type that keeps the whole graph in process memory instead of database server
+const MemoryDbType = "memory"
+
+// DefaultTenant tenant of request naming none, every record stored before tenants were introduced belongs to it
+const DefaultTenant = "default"
+
+// ErrNotFound returned by store when requested record does not exist
+var ErrNotFound = errors.New("record not found")
+
+// ErrEmailTaken returned when changing user email to the one owned by another user
+var ErrEmailTaken = errors.New("email already in use")
+
+// ErrSelfEdge returned when merging users who are related to each other, the merged user would be related to itself
+var ErrSelfEdge = errors.New("merge would relate user to itself")
+
+// Edge is a single directed relation between two user, e.g. a row of friends, notifications or blocks table
+type Edge struct {
+	UserID   uuid.UUID
+	TargetID uuid.UUID
+}
+
+// GraphCounts number of record in the social graph of a tenant
+type GraphCounts struct {
+	Users          int
+	SuspendedUsers int
+	// Friendships mutual connection counted once
+	Friendships           int
+	Subscriptions         int
+	Blocks                int
+	PendingFriendRequests int
+	Messages              int
+}
+
+// AuditQuery filter and page of audit trail
+type AuditQuery struct {
+	// Email keep only event the user took part in as actor, subject or target
+	Email string
+	// From keep only event at or after it, zero time leaves it open
+	From time.Time
+	// To keep only event before it, zero time leaves it open
+	To     time.Time
+	Offset int
+	Limit  int
+}
+
+// Transactor wraps set of store operations into single unit of work
+type Transactor interface {
+	// Begin start new transaction, all operation on returned store are part of that transaction
+	Begin() (GraphStore, error)
+	// Commit persist all operation done on transactional store
+	Commit() error
+	// Rollback discard all operation done on transactional store
+	Rollback() error
+}
+
+// TenantScoper narrows store down to social graph of single tenant. Email, user id and message id only resolve to
+// record of store tenant, and every record created through the store belongs to it
+type TenantScoper interface {
+	// Tenant get tenant the store is scoped to
+	Tenant() string
+	// WithTenant get store on the same database or transaction scoped to given tenant
+	WithTenant(tenant string) GraphStore
+}
+
+// UserRepository persistence of user entity
+type UserRepository interface {
+	// FindUser get user by its primary email or any of its alias
+	FindUser(email string) (*model.User, error)
+	// FindOrCreateUser get user like FindUser, email that resolves to nobody becomes primary email of new user
+	FindOrCreateUser(email string) (*model.User, error)
+	FindUsers(ids []uuid.UUID) ([]model.User, error)
+	// UpdateProfile save display name, avatar URL, locale, timezone and bio of user
+	UpdateProfile(user *model.User) error
+	// ChangeEmail change primary email of user keeping all of its relation, returns ErrEmailTaken when another user
+	// already has that email as primary email or alias. Alias of the user itself is promoted
+	ChangeEmail(user *model.User, email string) error
+	// MergeUsers move every friend, subscription, block, friend request, message, inbox entry, webhook, delivery
+	// record and alias of source user to target user, dropping duplicates, then delete source user keeping its email
+	// as alias of target user. Returns ErrSelfEdge when both are friends, subscribed to or blocking each other,
+	// or have pending friend request between them
+	MergeUsers(sourceID, targetID uuid.UUID) error
+	// UpdateSuspension save suspension time and reason of user, nil SuspendedAt lifts the suspension
+	UpdateSuspension(user *model.User) error
+}
+
+// AliasRepository persistence of additional email address of user
+type AliasRepository interface {
+	// Aliases get all alias of user ordered by email
+	Aliases(userID uuid.UUID) ([]model.UserAlias, error)
+	// AddAlias make alias.Email resolve to alias.UserID, returns ErrEmailTaken when it is primary email of any user
+	// or alias of another user. Existing alias of the same user is kept as is
+	AddAlias(alias *model.UserAlias) error
+	// RemoveAlias returns false when user has no such alias
+	RemoveAlias(userID uuid.UUID, email string) (bool, error)
+}
+
+// FriendRepository persistence of mutual friend connection
+type FriendRepository interface {
+	Friends(userID uuid.UUID) ([]model.User, error)
+	// FriendPage get at most query.Limit friend matching query along with total number of matching friend.
+	// Only friend shared with mutualID is listed unless it is uuid.Nil
+	FriendPage(userID, mutualID uuid.UUID, query ListQuery) ([]Connection, int, error)
+	FriendEdges(userIDs []uuid.UUID) ([]Edge, error)
+	IsFriend(userID, friendID uuid.UUID) (bool, error)
+	// AddFriend connect friend.UserID and friend.FriendID to each other with the same source and label,
+	// CreatedAt is set to connection time. Existing connection is kept as is
+	AddFriend(friend *model.Friend) error
+	// RemoveFriend remove connection on both side, returns false when they were not connected
+	RemoveFriend(userID, friendID uuid.UUID) (bool, error)
+}
+
+// FriendRequestRepository persistence of pending and answered friend request
+type FriendRequestRepository interface {
+	FindFriendRequest(requestorID, targetID uuid.UUID, status string) (*model.FriendRequest, error)
+	// FriendRequests get request sent (outgoing) or received by user, with requestor and target loaded
+	FriendRequests(userID uuid.UUID, outgoing bool, status string) ([]model.FriendRequest, error)
+	CreateFriendRequest(friendRequest *model.FriendRequest) error
+	UpdateFriendRequestStatus(friendRequest *model.FriendRequest, status string) error
+}
+
+// SubscriptionRepository persistence of notification subscription
+type SubscriptionRepository interface {
+	Subscriptions(userID uuid.UUID) ([]model.User, error)
+	IsSubscribed(userID, targetID uuid.UUID) (bool, error)
+	Subscribe(userID, targetID uuid.UUID) error
+	// Unsubscribe returns false when there was no subscription to remove
+	Unsubscribe(userID, targetID uuid.UUID) (bool, error)
+}
+
+// BlockRepository persistence of user block
+type BlockRepository interface {
+	IsBlocked(userID, targetID uuid.UUID) (bool, error)
+	Block(userID, targetID uuid.UUID) error
+	// Unblock returns false when there was no block to remove
+	Unblock(userID, targetID uuid.UUID) (bool, error)
+	// Blocks get all user blocked by given user
+	Blocks(userID uuid.UUID) ([]model.User, error)
+	// Blockers get all user that has been blocking given user
+	Blockers(userID uuid.UUID) ([]model.User, error)
+	// BlockEdges get all block involving given users in either direction
+	BlockEdges(userIDs []uuid.UUID) ([]Edge, error)
+}
+
+// MessageRepository persistence of posted update and its delivery into recipient inbox
+type MessageRepository interface {
+	// CreateMessage store message along with unread inbox entry for every recipient
+	CreateMessage(message *model.Message, recipientIDs []uuid.UUID) error
+	FindMessage(messageID uuid.UUID) (*model.Message, error)
+	// MessageRecipients get at most query.Limit recipient of message matching query along with total number of
+	// matching recipient. Recipient has no connection time, so they are always ordered by email
+	MessageRecipients(messageID uuid.UUID, query ListQuery) ([]model.User, int, error)
+	// InboxEntries get page of user inbox newest first with message and its sender loaded, along with total entry count
+	InboxEntries(recipientID uuid.UUID, unreadOnly bool, offset, limit int) ([]model.InboxEntry, int, error)
+	// InboxEntriesSince get at most limit inbox entries delivered to user after the one of given message, oldest first
+	// with message and its sender loaded. Returns ErrNotFound when given message is not in user inbox
+	InboxEntriesSince(recipientID, messageID uuid.UUID, limit int) ([]model.InboxEntry, error)
+	UnreadCount(recipientID uuid.UUID) (int, error)
+	// MarkRead mark given unread inbox entries of user as read, or all of them when entryIDs is empty.
+	// Returns number of changed entry
+	MarkRead(recipientID uuid.UUID, entryIDs []uuid.UUID) (int, error)
+}
+
+// WebhookRepository persistence of webhook registry and its failed delivery
+type WebhookRepository interface {
+	CreateWebhook(webhook *model.Webhook) error
+	// Webhooks get all webhook owned by any of given users, oldest first
+	Webhooks(userIDs []uuid.UUID) ([]model.Webhook, error)
+	// DeleteWebhook returns false when user does not own such webhook
+	DeleteWebhook(userID, webhookID uuid.UUID) (bool, error)
+	CreateWebhookDeadLetter(deadLetter *model.WebhookDeadLetter) error
+}
+
+// EmailDeliveryRepository persistence of per recipient email delivery status
+type EmailDeliveryRepository interface {
+	CreateEmailDelivery(emailDelivery *model.EmailDelivery) error
+	// UpdateEmailDelivery save status, attempts, last error and sent time of email delivery
+	UpdateEmailDelivery(emailDelivery *model.EmailDelivery) error
+	// EmailDeliveries get all email delivery of a message ordered by recipient email
+	EmailDeliveries(messageID uuid.UUID) ([]model.EmailDelivery, error)
+}
+
+// APIKeyRepository persistence of service API key
+type APIKeyRepository interface {
+	CreateAPIKey(key *model.APIKey) error
+	FindAPIKey(id uuid.UUID) (*model.APIKey, error)
+	// APIKeys get every API key, revoked and expired one included, oldest first
+	APIKeys() ([]model.APIKey, error)
+	// RevokeAPIKey returns false when there is no such key or it is already revoked
+	RevokeAPIKey(id uuid.UUID) (bool, error)
+	// TouchAPIKey record the time key was last used
+	TouchAPIKey(id uuid.UUID, usedAt time.Time) error
+}
+
+// AuditRepository persistence of append only audit trail
+type AuditRepository interface {
+	// CreateAuditEvent store event as belonging to store tenant, CreatedAt is set to the time it is stored
+	CreateAuditEvent(event *model.AuditEvent) error
+	// AuditEvents get page of audit trail of store tenant matching query newest first, along with total number of
+	// matching event
+	AuditEvents(query AuditQuery) ([]model.AuditEvent, int, error)
+}
+
+// StatsRepository aggregate of the social graph
+type StatsRepository interface {
+	// Counts get number of user, relation, pending friend request and message of store tenant
+	Counts() (*GraphCounts, error)
+}
+
+// GraphStore is the whole social graph storage used by controllers
+type GraphStore interface {
+	Transactor
+	TenantScoper
+	UserRepository
+	AliasRepository
+	FriendRepository
+	FriendRequestRepository
+	SubscriptionRepository
+	BlockRepository
+	MessageRepository
+	WebhookRepository
+	EmailDeliveryRepository
+	APIKeyRepository
+	AuditRepository
+	StatsRepository
+}
+
+// NewGraphStore create GraphStore implementation suitable for configured database type, scoped to DefaultTenant
+func NewGraphStore(factory *DBFactory) GraphStore {
+	if factory.config.DbType == MemoryDbType {
+		return NewMemoryStore()
+	}
+
+	return NewGormStore(factory)
+}
@@ -0,0 +1,99 @@
+package data
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmgo/common/data/model"
+	"strings"
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+// Sort field of paged user list
+const (
+	SortByEmail       = "email"
+	SortByConnectedAt = "connectedAt"
+)
+
+// ErrInvalidCursor returned when list cursor is malformed or was issued for different sort order
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ListQuery filter, order and position of paged user list
+type ListQuery struct {
+	// EmailPrefix keep only user whose email starts with it
+	EmailPrefix string
+	SortBy      string
+	Desc        bool
+	// After start listing right after this position, nil starts from the first user
+	After *ListCursor
+	Limit int
+}
+
+// ListCursor position of a user in paged list, it is handed to client as opaque string
+type ListCursor struct {
+	SortBy      string    `json:"s"`
+	Desc        bool      `json:"d,omitempty"`
+	Email       string    `json:"e"`
+	ConnectedAt time.Time `json:"t"`
+	// MessageID message whose recipients are listed, only set on recipient list
+	MessageID uuid.UUID `json:"m"`
+}
+
+// Connection user listed along with time, source and label of its connection to list owner
+type Connection struct {
+	model.User
+	ConnectedAt time.Time
+	Source      string
+	Label       string
+}
+
+// NewListQuery build query out of list parameter given by client, empty sortBy sorts by email and order is either
+// asc or desc. Cursor must be the one issued for the same sort order
+func NewListQuery(sortBy, order, emailPrefix, cursor string, limit int) (ListQuery, error) {
+	if sortBy == "" {
+		sortBy = SortByEmail
+	}
+
+	query := ListQuery{EmailPrefix: strings.ToLower(emailPrefix), SortBy: sortBy, Desc: order == "desc", Limit: limit}
+	if cursor != "" {
+		after, err := DecodeListCursor(cursor, query.SortBy, query.Desc)
+		if err != nil {
+			return query, err
+		}
+
+		query.After = after
+	}
+
+	return query, nil
+}
+
+// CursorOf get position of given user within list ordered by query
+func (q ListQuery) CursorOf(connection Connection) *ListCursor {
+	return &ListCursor{SortBy: q.SortBy, Desc: q.Desc, Email: connection.Email, ConnectedAt: connection.ConnectedAt}
+}
+
+// Encode serialize cursor into URL safe string
+func (c *ListCursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeListCursor parse cursor returned by Encode, it fails unless the cursor was issued for given sort order
+func DecodeListCursor(s, sortBy string, desc bool) (*ListCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c ListCursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if c.SortBy != sortBy || c.Desc != desc {
+		return nil, ErrInvalidCursor
+	}
+
+	return &c, nil
+}
@@ -0,0 +1,1361 @@
+package data
+
+import (
+	"errors"
+	"fmgo/common/data/model"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+// tenantEmail key of email lookup, the same email may be used in every tenant
+type tenantEmail struct {
+	tenant string
+	email  string
+}
+
+// memoryState is the whole graph kept by MemoryStore
+type memoryState struct {
+	users           map[uuid.UUID]model.User
+	emails          map[tenantEmail]uuid.UUID
+	aliases         map[tenantEmail]model.UserAlias
+	friends         map[Edge]bool
+	friendships     map[Edge]model.Friend
+	notifications   map[Edge]bool
+	blocks          map[Edge]bool
+	friendRequests  map[uuid.UUID]model.FriendRequest
+	messages        map[uuid.UUID]model.Message
+	inboxEntries    map[uuid.UUID]model.InboxEntry
+	webhooks        map[uuid.UUID]model.Webhook
+	deadLetters     map[uuid.UUID]model.WebhookDeadLetter
+	emailDeliveries map[uuid.UUID]model.EmailDelivery
+	apiKeys         map[uuid.UUID]model.APIKey
+	auditEvents     map[uuid.UUID]model.AuditEvent
+}
+
+func newMemoryState() *memoryState {
+	return &memoryState{
+		users:           make(map[uuid.UUID]model.User),
+		emails:          make(map[tenantEmail]uuid.UUID),
+		aliases:         make(map[tenantEmail]model.UserAlias),
+		friends:         make(map[Edge]bool),
+		friendships:     make(map[Edge]model.Friend),
+		notifications:   make(map[Edge]bool),
+		blocks:          make(map[Edge]bool),
+		friendRequests:  make(map[uuid.UUID]model.FriendRequest),
+		messages:        make(map[uuid.UUID]model.Message),
+		inboxEntries:    make(map[uuid.UUID]model.InboxEntry),
+		webhooks:        make(map[uuid.UUID]model.Webhook),
+		deadLetters:     make(map[uuid.UUID]model.WebhookDeadLetter),
+		emailDeliveries: make(map[uuid.UUID]model.EmailDelivery),
+		apiKeys:         make(map[uuid.UUID]model.APIKey),
+		auditEvents:     make(map[uuid.UUID]model.AuditEvent),
+	}
+}
+
+// clone copy the state so it can be restored on rollback
+func (st *memoryState) clone() *memoryState {
+	c := newMemoryState()
+	for k, v := range st.users {
+		c.users[k] = v
+	}
+	for k, v := range st.emails {
+		c.emails[k] = v
+	}
+	for k, v := range st.aliases {
+		c.aliases[k] = v
+	}
+	for k, v := range st.friends {
+		c.friends[k] = v
+	}
+	for k, v := range st.friendships {
+		c.friendships[k] = v
+	}
+	for k, v := range st.notifications {
+		c.notifications[k] = v
+	}
+	for k, v := range st.blocks {
+		c.blocks[k] = v
+	}
+	for k, v := range st.friendRequests {
+		c.friendRequests[k] = v
+	}
+	for k, v := range st.messages {
+		c.messages[k] = v
+	}
+	for k, v := range st.inboxEntries {
+		c.inboxEntries[k] = v
+	}
+	for k, v := range st.webhooks {
+		c.webhooks[k] = v
+	}
+	for k, v := range st.deadLetters {
+		c.deadLetters[k] = v
+	}
+	for k, v := range st.emailDeliveries {
+		c.emailDeliveries[k] = v
+	}
+	for k, v := range st.apiKeys {
+		c.apiKeys[k] = v
+	}
+	for k, v := range st.auditEvents {
+		c.auditEvents[k] = v
+	}
+
+	return c
+}
+
+// memoryDB is the storage shared by MemoryStore and all of its transaction
+type memoryDB struct {
+	mu    sync.Mutex
+	state *memoryState
+}
+
+// MemoryStore GraphStore implementation that keeps everything in process memory, meant for tests and local development.
+// Transaction is serialized: it holds the store lock from Begin until Commit or Rollback.
+type MemoryStore struct {
+	db     *memoryDB
+	backup *memoryState
+	inTx   bool
+	tenant string
+}
+
+// NewMemoryStore initialize new empty MemoryStore instance scoped to DefaultTenant
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{db: &memoryDB{state: newMemoryState()}, tenant: DefaultTenant}
+}
+
+// lock acquire store lock unless it is already held by current transaction, returns func to release it
+func (s *MemoryStore) lock() func() {
+	if s.inTx {
+		return func() {}
+	}
+
+	s.db.mu.Lock()
+	return s.db.mu.Unlock
+}
+
+// Begin start new transaction
+func (s *MemoryStore) Begin() (GraphStore, error) {
+	if s.inTx {
+		return nil, errors.New("transaction already started")
+	}
+
+	s.db.mu.Lock()
+	return &MemoryStore{db: s.db, backup: s.db.state.clone(), inTx: true, tenant: s.tenant}, nil
+}
+
+// Commit commit current transaction
+func (s *MemoryStore) Commit() error {
+	if !s.inTx {
+		return errors.New("no transaction to commit")
+	}
+
+	s.inTx = false
+	s.backup = nil
+	s.db.mu.Unlock()
+	return nil
+}
+
+// Rollback rollback current transaction
+func (s *MemoryStore) Rollback() error {
+	if !s.inTx {
+		return errors.New("no transaction to rollback")
+	}
+
+	s.db.state = s.backup
+	s.inTx = false
+	s.backup = nil
+	s.db.mu.Unlock()
+	return nil
+}
+
+// Tenant get tenant the store is scoped to
+func (s *MemoryStore) Tenant() string {
+	return s.tenant
+}
+
+// WithTenant get store scoped to given tenant. Store of transaction is meant to be scoped before any operation, as
+// only the returned one should then be committed or rolled back
+func (s *MemoryStore) WithTenant(tenant string) GraphStore {
+	return &MemoryStore{db: s.db, backup: s.backup, inTx: s.inTx, tenant: tenant}
+}
+
+// FindUser get user by its email or alias
+func (s *MemoryStore) FindUser(email string) (*model.User, error) {
+	defer s.lock()()
+
+	return s.findUser(email)
+}
+
+func (s *MemoryStore) findUser(email string) (*model.User, error) {
+	st := s.db.state
+	key := tenantEmail{tenant: s.tenant, email: email}
+	id, ok := st.emails[key]
+	if !ok {
+		alias, ok := st.aliases[key]
+		if !ok {
+			return nil, ErrNotFound
+		}
+
+		id = alias.UserID
+	}
+
+	user := st.users[id]
+	return &user, nil
+}
+
+// FindOrCreateUser get user by its email, create new one if email does not exist yet
+func (s *MemoryStore) FindOrCreateUser(email string) (*model.User, error) {
+	defer s.lock()()
+
+	if user, err := s.findUser(email); err != ErrNotFound {
+		return user, err
+	}
+
+	now := time.Now()
+	user := model.User{Tenant: s.tenant, Email: email}
+	user.ID = uuid.NewV4()
+	user.CreatedAt = now
+	user.UpdatedAt = now
+
+	st := s.db.state
+	st.users[user.ID] = user
+	st.emails[tenantEmail{tenant: s.tenant, email: email}] = user.ID
+	return &user, nil
+}
+
+// FindUsers get users by their id
+func (s *MemoryStore) FindUsers(ids []uuid.UUID) ([]model.User, error) {
+	defer s.lock()()
+
+	st := s.db.state
+	users := make([]model.User, 0)
+	for _, id := range ids {
+		if user, ok := st.users[id]; ok && user.Tenant == s.tenant {
+			users = append(users, user)
+		}
+	}
+
+	return users, nil
+}
+
+// UpdateProfile save user profile
+func (s *MemoryStore) UpdateProfile(user *model.User) error {
+	defer s.lock()()
+
+	st := s.db.state
+	stored, ok := st.users[user.ID]
+	if !ok || stored.Tenant != s.tenant {
+		return ErrNotFound
+	}
+
+	stored.DisplayName = user.DisplayName
+	stored.AvatarURL = user.AvatarURL
+	stored.Locale = user.Locale
+	stored.Timezone = user.Timezone
+	stored.Bio = user.Bio
+	stored.UpdatedAt = time.Now()
+	st.users[stored.ID] = stored
+
+	user.UpdatedAt = stored.UpdatedAt
+	return nil
+}
+
+// UpdateSuspension save suspension time and reason of user
+func (s *MemoryStore) UpdateSuspension(user *model.User) error {
+	defer s.lock()()
+
+	st := s.db.state
+	stored, ok := st.users[user.ID]
+	if !ok || stored.Tenant != s.tenant {
+		return ErrNotFound
+	}
+
+	stored.SuspendedAt = user.SuspendedAt
+	stored.SuspendReason = user.SuspendReason
+	stored.UpdatedAt = time.Now()
+	st.users[stored.ID] = stored
+
+	user.UpdatedAt = stored.UpdatedAt
+	return nil
+}
+
+// ChangeEmail change primary email of user
+func (s *MemoryStore) ChangeEmail(user *model.User, email string) error {
+	defer s.lock()()
+
+	st := s.db.state
+	if s.emailTaken(email, user.ID) {
+		return ErrEmailTaken
+	}
+
+	stored, ok := st.users[user.ID]
+	if !ok || stored.Tenant != s.tenant {
+		return ErrNotFound
+	}
+
+	key := tenantEmail{tenant: s.tenant, email: email}
+	delete(st.emails, tenantEmail{tenant: s.tenant, email: stored.Email})
+	delete(st.aliases, key)
+	stored.Email = email
+	stored.UpdatedAt = time.Now()
+	st.users[stored.ID] = stored
+	st.emails[key] = stored.ID
+
+	user.Email = stored.Email
+	user.UpdatedAt = stored.UpdatedAt
+	return nil
+}
+
+// MergeUsers move all record of source user to target user then delete source user
+func (s *MemoryStore) MergeUsers(sourceID, targetID uuid.UUID) error {
+	defer s.lock()()
+
+	st := s.db.state
+	source, ok := st.users[sourceID]
+	if !ok || source.Tenant != s.tenant {
+		return ErrNotFound
+	}
+
+	for _, edges := range []map[Edge]bool{st.friends, st.notifications, st.blocks} {
+		if edges[Edge{UserID: sourceID, TargetID: targetID}] || edges[Edge{UserID: targetID, TargetID: sourceID}] {
+			return ErrSelfEdge
+		}
+	}
+	for _, friendRequest := range st.friendRequests {
+		between := (friendRequest.RequestorID == sourceID && friendRequest.TargetID == targetID) ||
+			(friendRequest.RequestorID == targetID && friendRequest.TargetID == sourceID)
+		if between && friendRequest.Status == model.FriendRequestPending {
+			return ErrSelfEdge
+		}
+	}
+
+	moved := mergeEdges(st.friends, sourceID, targetID)
+	for e, friendship := range st.friendships {
+		if st.friends[e] {
+			continue
+		}
+
+		delete(st.friendships, e)
+		if to, ok := moved[e]; ok {
+			friendship.UserID, friendship.FriendID = to.UserID, to.TargetID
+			st.friendships[to] = friendship
+		}
+	}
+	mergeEdges(st.notifications, sourceID, targetID)
+	mergeEdges(st.blocks, sourceID, targetID)
+
+	now := time.Now()
+	for id, friendRequest := range st.friendRequests {
+		if friendRequest.RequestorID != sourceID && friendRequest.TargetID != sourceID {
+			continue
+		}
+
+		// answered request between both users would become request to itself, it is only history so drop it
+		if friendRequest.RequestorID == targetID || friendRequest.TargetID == targetID {
+			delete(st.friendRequests, id)
+			continue
+		}
+
+		if friendRequest.RequestorID == sourceID {
+			friendRequest.RequestorID = targetID
+		} else {
+			friendRequest.TargetID = targetID
+		}
+
+		// target keeps its own pending request when both have one to or from the same user
+		if friendRequest.Status == model.FriendRequestPending {
+			for _, other := range st.friendRequests {
+				if other.ID != id && other.RequestorID == friendRequest.RequestorID && other.TargetID == friendRequest.TargetID &&
+					other.Status == model.FriendRequestPending {
+					friendRequest.Status = model.FriendRequestCancelled
+					friendRequest.RespondedAt = &now
+					break
+				}
+			}
+		}
+
+		friendRequest.UpdatedAt = now
+		st.friendRequests[id] = friendRequest
+	}
+
+	received := make(map[uuid.UUID]bool)
+	for _, entry := range st.inboxEntries {
+		if entry.RecipientID == targetID {
+			received[entry.MessageID] = true
+		}
+	}
+	for id, entry := range st.inboxEntries {
+		if entry.RecipientID != sourceID {
+			continue
+		}
+
+		// both users may have received the same message
+		if received[entry.MessageID] {
+			delete(st.inboxEntries, id)
+			continue
+		}
+
+		entry.RecipientID = targetID
+		st.inboxEntries[id] = entry
+	}
+
+	for id, message := range st.messages {
+		if message.SenderID == sourceID {
+			message.SenderID = targetID
+			st.messages[id] = message
+		}
+	}
+	for id, webhook := range st.webhooks {
+		if webhook.UserID == sourceID {
+			webhook.UserID = targetID
+			st.webhooks[id] = webhook
+		}
+	}
+	for id, deadLetter := range st.deadLetters {
+		if deadLetter.RecipientID == sourceID {
+			deadLetter.RecipientID = targetID
+			st.deadLetters[id] = deadLetter
+		}
+	}
+	for id, emailDelivery := range st.emailDeliveries {
+		if emailDelivery.RecipientID == sourceID {
+			emailDelivery.RecipientID = targetID
+			st.emailDeliveries[id] = emailDelivery
+		}
+	}
+
+	for key, alias := range st.aliases {
+		if alias.UserID == sourceID {
+			alias.UserID = targetID
+			st.aliases[key] = alias
+		}
+	}
+
+	key := tenantEmail{tenant: s.tenant, email: source.Email}
+	delete(st.users, sourceID)
+	delete(st.emails, key)
+	st.aliases[key] = model.UserAlias{Tenant: s.tenant, Email: source.Email, UserID: targetID, CreatedAt: now}
+	return nil
+}
+
+// Aliases get all alias of user
+func (s *MemoryStore) Aliases(userID uuid.UUID) ([]model.UserAlias, error) {
+	defer s.lock()()
+
+	aliases := make([]model.UserAlias, 0)
+	for _, alias := range s.db.state.aliases {
+		if alias.Tenant == s.tenant && alias.UserID == userID {
+			aliases = append(aliases, alias)
+		}
+	}
+
+	sort.Slice(aliases, func(i, j int) bool { return aliases[i].Email < aliases[j].Email })
+	return aliases, nil
+}
+
+// AddAlias make email resolve to user
+func (s *MemoryStore) AddAlias(alias *model.UserAlias) error {
+	defer s.lock()()
+
+	st := s.db.state
+	key := tenantEmail{tenant: s.tenant, email: alias.Email}
+	if existing, ok := st.aliases[key]; ok && existing.UserID == alias.UserID {
+		*alias = existing
+		return nil
+	}
+	if s.emailTaken(alias.Email, uuid.Nil) {
+		return ErrEmailTaken
+	}
+
+	alias.Tenant = s.tenant
+	alias.CreatedAt = time.Now()
+	st.aliases[key] = *alias
+	return nil
+}
+
+// RemoveAlias remove alias of user
+func (s *MemoryStore) RemoveAlias(userID uuid.UUID, email string) (bool, error) {
+	defer s.lock()()
+
+	st := s.db.state
+	key := tenantEmail{tenant: s.tenant, email: email}
+	alias, ok := st.aliases[key]
+	if !ok || alias.UserID != userID {
+		return false, nil
+	}
+
+	delete(st.aliases, key)
+	return true, nil
+}
+
+// emailTaken check whether email is primary email or alias of any user but userID
+func (s *MemoryStore) emailTaken(email string, userID uuid.UUID) bool {
+	st := s.db.state
+	key := tenantEmail{tenant: s.tenant, email: email}
+	if id, ok := st.emails[key]; ok && id != userID {
+		return true
+	}
+	if alias, ok := st.aliases[key]; ok && alias.UserID != userID {
+		return true
+	}
+
+	return false
+}
+
+// Friends get all friend of given user
+func (s *MemoryStore) Friends(userID uuid.UUID) ([]model.User, error) {
+	defer s.lock()()
+
+	return s.related(s.db.state.friends, userID, false), nil
+}
+
+// FriendPage get page of friend matching query
+func (s *MemoryStore) FriendPage(userID, mutualID uuid.UUID, query ListQuery) ([]Connection, int, error) {
+	defer s.lock()()
+
+	st := s.db.state
+	connections := make([]Connection, 0)
+	for e := range st.friends {
+		if e.UserID != userID || !s.inTenant(e.UserID) {
+			continue
+		}
+		if mutualID != uuid.Nil && !st.friends[Edge{UserID: mutualID, TargetID: e.TargetID}] {
+			continue
+		}
+
+		friendship := st.friendships[e]
+		connections = append(connections, Connection{
+			User:        st.users[e.TargetID],
+			ConnectedAt: friendship.CreatedAt,
+			Source:      friendship.Source,
+			Label:       friendship.Label,
+		})
+	}
+
+	connections, total := pageConnections(connections, query)
+	return connections, total, nil
+}
+
+// FriendEdges get all friend connection owned by given users
+func (s *MemoryStore) FriendEdges(userIDs []uuid.UUID) ([]Edge, error) {
+	defer s.lock()()
+
+	owners := make(map[uuid.UUID]bool)
+	for _, id := range userIDs {
+		owners[id] = true
+	}
+
+	edges := make([]Edge, 0)
+	for e := range s.db.state.friends {
+		if owners[e.UserID] && s.inTenant(e.UserID) {
+			edges = append(edges, e)
+		}
+	}
+
+	return sortEdges(edges), nil
+}
+
+// IsFriend check whether both user are connected
+func (s *MemoryStore) IsFriend(userID, friendID uuid.UUID) (bool, error) {
+	defer s.lock()()
+
+	return s.exists(s.db.state.friends, Edge{UserID: userID, TargetID: friendID}), nil
+}
+
+// AddFriend connect both user to each other
+func (s *MemoryStore) AddFriend(friend *model.Friend) error {
+	defer s.lock()()
+
+	st := s.db.state
+	friend.Tenant = s.tenant
+	friend.CreatedAt = time.Now()
+	reverse := *friend
+	reverse.UserID, reverse.FriendID = friend.FriendID, friend.UserID
+	for _, f := range []model.Friend{*friend, reverse} {
+		e := Edge{UserID: f.UserID, TargetID: f.FriendID}
+		if !st.friends[e] {
+			st.friends[e] = true
+			st.friendships[e] = f
+		}
+	}
+	return nil
+}
+
+// RemoveFriend remove connection on both side
+func (s *MemoryStore) RemoveFriend(userID, friendID uuid.UUID) (bool, error) {
+	defer s.lock()()
+
+	st := s.db.state
+	e1 := Edge{UserID: userID, TargetID: friendID}
+	e2 := Edge{UserID: friendID, TargetID: userID}
+	if !s.exists(st.friends, e1) && !s.exists(st.friends, e2) {
+		return false, nil
+	}
+
+	delete(st.friends, e1)
+	delete(st.friends, e2)
+	delete(st.friendships, e1)
+	delete(st.friendships, e2)
+	return true, nil
+}
+
+// FindFriendRequest get friend request between requestor and target with given status
+func (s *MemoryStore) FindFriendRequest(requestorID, targetID uuid.UUID, status string) (*model.FriendRequest, error) {
+	defer s.lock()()
+
+	for _, friendRequest := range s.db.state.friendRequests {
+		if friendRequest.Tenant == s.tenant && friendRequest.RequestorID == requestorID && friendRequest.TargetID == targetID &&
+			friendRequest.Status == status {
+			return &friendRequest, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+// FriendRequests get request sent or received by user, newest first
+func (s *MemoryStore) FriendRequests(userID uuid.UUID, outgoing bool, status string) ([]model.FriendRequest, error) {
+	defer s.lock()()
+
+	st := s.db.state
+	friendRequests := make([]model.FriendRequest, 0)
+	for _, friendRequest := range st.friendRequests {
+		owner := friendRequest.TargetID
+		if outgoing {
+			owner = friendRequest.RequestorID
+		}
+		if friendRequest.Tenant != s.tenant || owner != userID || friendRequest.Status != status {
+			continue
+		}
+
+		friendRequest.Requestor = st.users[friendRequest.RequestorID]
+		friendRequest.Target = st.users[friendRequest.TargetID]
+		friendRequests = append(friendRequests, friendRequest)
+	}
+
+	sort.Slice(friendRequests, func(i, j int) bool {
+		return friendRequests[i].CreatedAt.After(friendRequests[j].CreatedAt)
+	})
+	return friendRequests, nil
+}
+
+// CreateFriendRequest store new friend request
+func (s *MemoryStore) CreateFriendRequest(friendRequest *model.FriendRequest) error {
+	defer s.lock()()
+
+	now := time.Now()
+	if friendRequest.ID == uuid.Nil {
+		friendRequest.ID = uuid.NewV4()
+	}
+	friendRequest.Tenant = s.tenant
+	friendRequest.CreatedAt = now
+	friendRequest.UpdatedAt = now
+
+	s.db.state.friendRequests[friendRequest.ID] = *friendRequest
+	return nil
+}
+
+// UpdateFriendRequestStatus answer friend request with given status
+func (s *MemoryStore) UpdateFriendRequestStatus(friendRequest *model.FriendRequest, status string) error {
+	defer s.lock()()
+
+	st := s.db.state
+	stored, ok := st.friendRequests[friendRequest.ID]
+	if !ok || stored.Tenant != s.tenant {
+		return ErrNotFound
+	}
+
+	now := time.Now()
+	stored.Status = status
+	stored.RespondedAt = &now
+	stored.UpdatedAt = now
+	st.friendRequests[stored.ID] = stored
+
+	friendRequest.Status = stored.Status
+	friendRequest.RespondedAt = stored.RespondedAt
+	friendRequest.UpdatedAt = stored.UpdatedAt
+	return nil
+}
+
+// Subscriptions get all user subscribed by given user
+func (s *MemoryStore) Subscriptions(userID uuid.UUID) ([]model.User, error) {
+	defer s.lock()()
+
+	return s.related(s.db.state.notifications, userID, false), nil
+}
+
+// IsSubscribed check whether user subscribed to target
+func (s *MemoryStore) IsSubscribed(userID, targetID uuid.UUID) (bool, error) {
+	defer s.lock()()
+
+	return s.exists(s.db.state.notifications, Edge{UserID: userID, TargetID: targetID}), nil
+}
+
+// Subscribe subscribe user to target notification
+func (s *MemoryStore) Subscribe(userID, targetID uuid.UUID) error {
+	defer s.lock()()
+
+	s.db.state.notifications[Edge{UserID: userID, TargetID: targetID}] = true
+	return nil
+}
+
+// Unsubscribe remove user subscription to target
+func (s *MemoryStore) Unsubscribe(userID, targetID uuid.UUID) (bool, error) {
+	defer s.lock()()
+
+	return s.deleteEdge(s.db.state.notifications, Edge{UserID: userID, TargetID: targetID}), nil
+}
+
+// IsBlocked check whether user blocked target
+func (s *MemoryStore) IsBlocked(userID, targetID uuid.UUID) (bool, error) {
+	defer s.lock()()
+
+	return s.exists(s.db.state.blocks, Edge{UserID: userID, TargetID: targetID}), nil
+}
+
+// Block record user block to target
+func (s *MemoryStore) Block(userID, targetID uuid.UUID) error {
+	defer s.lock()()
+
+	s.db.state.blocks[Edge{UserID: userID, TargetID: targetID}] = true
+	return nil
+}
+
+// Unblock remove user block to target
+func (s *MemoryStore) Unblock(userID, targetID uuid.UUID) (bool, error) {
+	defer s.lock()()
+
+	return s.deleteEdge(s.db.state.blocks, Edge{UserID: userID, TargetID: targetID}), nil
+}
+
+// Blocks get all user blocked by given user
+func (s *MemoryStore) Blocks(userID uuid.UUID) ([]model.User, error) {
+	defer s.lock()()
+
+	return s.related(s.db.state.blocks, userID, false), nil
+}
+
+// Blockers get all user that has been blocking given user
+func (s *MemoryStore) Blockers(userID uuid.UUID) ([]model.User, error) {
+	defer s.lock()()
+
+	return s.related(s.db.state.blocks, userID, true), nil
+}
+
+// BlockEdges get all block involving given users in either direction
+func (s *MemoryStore) BlockEdges(userIDs []uuid.UUID) ([]Edge, error) {
+	defer s.lock()()
+
+	involved := make(map[uuid.UUID]bool)
+	for _, id := range userIDs {
+		involved[id] = true
+	}
+
+	edges := make([]Edge, 0)
+	for e := range s.db.state.blocks {
+		if (involved[e.UserID] || involved[e.TargetID]) && s.inTenant(e.UserID) {
+			edges = append(edges, e)
+		}
+	}
+
+	return sortEdges(edges), nil
+}
+
+// CreateMessage store message along with unread inbox entry for every recipient
+func (s *MemoryStore) CreateMessage(message *model.Message, recipientIDs []uuid.UUID) error {
+	defer s.lock()()
+
+	st := s.db.state
+	now := time.Now()
+	if message.ID == uuid.Nil {
+		message.ID = uuid.NewV4()
+	}
+	message.Tenant = s.tenant
+	message.CreatedAt = now
+	message.UpdatedAt = now
+	st.messages[message.ID] = *message
+
+	for _, recipientID := range recipientIDs {
+		entry := model.InboxEntry{Tenant: s.tenant, MessageID: message.ID, RecipientID: recipientID}
+		entry.ID = uuid.NewV4()
+		entry.CreatedAt = now
+		entry.UpdatedAt = now
+		st.inboxEntries[entry.ID] = entry
+	}
+
+	return nil
+}
+
+// FindMessage get message by its id
+func (s *MemoryStore) FindMessage(messageID uuid.UUID) (*model.Message, error) {
+	defer s.lock()()
+
+	st := s.db.state
+	message, ok := st.messages[messageID]
+	if !ok || message.Tenant != s.tenant {
+		return nil, ErrNotFound
+	}
+
+	message.Sender = st.users[message.SenderID]
+	return &message, nil
+}
+
+// MessageRecipients get page of message recipient matching query
+func (s *MemoryStore) MessageRecipients(messageID uuid.UUID, query ListQuery) ([]model.User, int, error) {
+	defer s.lock()()
+
+	st := s.db.state
+	connections := make([]Connection, 0)
+	for _, entry := range st.inboxEntries {
+		if entry.Tenant == s.tenant && entry.MessageID == messageID {
+			connections = append(connections, Connection{User: st.users[entry.RecipientID]})
+		}
+	}
+
+	query.SortBy = SortByEmail
+	connections, total := pageConnections(connections, query)
+
+	users := make([]model.User, 0)
+	for _, connection := range connections {
+		users = append(users, connection.User)
+	}
+
+	return users, total, nil
+}
+
+// InboxEntries get page of user inbox newest first
+func (s *MemoryStore) InboxEntries(recipientID uuid.UUID, unreadOnly bool, offset, limit int) ([]model.InboxEntry, int, error) {
+	defer s.lock()()
+
+	st := s.db.state
+	entries := make([]model.InboxEntry, 0)
+	for _, entry := range st.inboxEntries {
+		if entry.Tenant != s.tenant || entry.RecipientID != recipientID || (unreadOnly && entry.ReadAt != nil) {
+			continue
+		}
+
+		entry.Message = st.messages[entry.MessageID]
+		entry.Message.Sender = st.users[entry.Message.SenderID]
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].CreatedAt.Equal(entries[j].CreatedAt) {
+			return entries[i].CreatedAt.After(entries[j].CreatedAt)
+		}
+		return entries[i].ID.String() < entries[j].ID.String()
+	})
+
+	total := len(entries)
+	if offset > total {
+		offset = total
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+
+	return entries[offset:end], total, nil
+}
+
+// InboxEntriesSince get inbox entries delivered to user after the one of given message, oldest first
+func (s *MemoryStore) InboxEntriesSince(recipientID, messageID uuid.UUID, limit int) ([]model.InboxEntry, error) {
+	defer s.lock()()
+
+	st := s.db.state
+	var last *model.InboxEntry
+	for _, entry := range st.inboxEntries {
+		if entry.Tenant == s.tenant && entry.RecipientID == recipientID && entry.MessageID == messageID {
+			last = &entry
+			break
+		}
+	}
+	if last == nil {
+		return nil, ErrNotFound
+	}
+
+	// entries delivered at the same time are ordered by id, so they are neither skipped nor replayed twice
+	entries := make([]model.InboxEntry, 0)
+	for _, entry := range st.inboxEntries {
+		if entry.Tenant != s.tenant || entry.RecipientID != recipientID {
+			continue
+		}
+		if entry.CreatedAt.Before(last.CreatedAt) || (entry.CreatedAt.Equal(last.CreatedAt) && entry.ID.String() <= last.ID.String()) {
+			continue
+		}
+
+		entry.Message = st.messages[entry.MessageID]
+		entry.Message.Sender = st.users[entry.Message.SenderID]
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].CreatedAt.Equal(entries[j].CreatedAt) {
+			return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+		}
+		return entries[i].ID.String() < entries[j].ID.String()
+	})
+
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	return entries, nil
+}
+
+// UnreadCount count unread inbox entry of user
+func (s *MemoryStore) UnreadCount(recipientID uuid.UUID) (int, error) {
+	defer s.lock()()
+
+	count := 0
+	for _, entry := range s.db.state.inboxEntries {
+		if entry.Tenant == s.tenant && entry.RecipientID == recipientID && entry.ReadAt == nil {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// MarkRead mark unread inbox entries of user as read
+func (s *MemoryStore) MarkRead(recipientID uuid.UUID, entryIDs []uuid.UUID) (int, error) {
+	defer s.lock()()
+
+	selected := make(map[uuid.UUID]bool)
+	for _, id := range entryIDs {
+		selected[id] = true
+	}
+
+	st := s.db.state
+	now := time.Now()
+	count := 0
+	for id, entry := range st.inboxEntries {
+		if entry.Tenant != s.tenant || entry.RecipientID != recipientID || entry.ReadAt != nil || (len(selected) > 0 && !selected[id]) {
+			continue
+		}
+
+		entry.ReadAt = &now
+		entry.UpdatedAt = now
+		st.inboxEntries[id] = entry
+		count++
+	}
+
+	return count, nil
+}
+
+// CreateWebhook store new webhook
+func (s *MemoryStore) CreateWebhook(webhook *model.Webhook) error {
+	defer s.lock()()
+
+	now := time.Now()
+	if webhook.ID == uuid.Nil {
+		webhook.ID = uuid.NewV4()
+	}
+	webhook.Tenant = s.tenant
+	webhook.CreatedAt = now
+	webhook.UpdatedAt = now
+
+	s.db.state.webhooks[webhook.ID] = *webhook
+	return nil
+}
+
+// Webhooks get all webhook owned by any of given users
+func (s *MemoryStore) Webhooks(userIDs []uuid.UUID) ([]model.Webhook, error) {
+	defer s.lock()()
+
+	owners := make(map[uuid.UUID]bool)
+	for _, id := range userIDs {
+		owners[id] = true
+	}
+
+	webhooks := make([]model.Webhook, 0)
+	for _, webhook := range s.db.state.webhooks {
+		if webhook.Tenant == s.tenant && owners[webhook.UserID] {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+
+	sort.Slice(webhooks, func(i, j int) bool {
+		if !webhooks[i].CreatedAt.Equal(webhooks[j].CreatedAt) {
+			return webhooks[i].CreatedAt.Before(webhooks[j].CreatedAt)
+		}
+		return webhooks[i].ID.String() < webhooks[j].ID.String()
+	})
+	return webhooks, nil
+}
+
+// DeleteWebhook remove webhook owned by user
+func (s *MemoryStore) DeleteWebhook(userID, webhookID uuid.UUID) (bool, error) {
+	defer s.lock()()
+
+	st := s.db.state
+	webhook, ok := st.webhooks[webhookID]
+	if !ok || webhook.Tenant != s.tenant || webhook.UserID != userID {
+		return false, nil
+	}
+
+	delete(st.webhooks, webhookID)
+	return true, nil
+}
+
+// CreateWebhookDeadLetter store permanently failed webhook delivery
+func (s *MemoryStore) CreateWebhookDeadLetter(deadLetter *model.WebhookDeadLetter) error {
+	defer s.lock()()
+
+	now := time.Now()
+	if deadLetter.ID == uuid.Nil {
+		deadLetter.ID = uuid.NewV4()
+	}
+	deadLetter.Tenant = s.tenant
+	deadLetter.CreatedAt = now
+	deadLetter.UpdatedAt = now
+
+	s.db.state.deadLetters[deadLetter.ID] = *deadLetter
+	return nil
+}
+
+// CreateEmailDelivery store new email delivery
+func (s *MemoryStore) CreateEmailDelivery(emailDelivery *model.EmailDelivery) error {
+	defer s.lock()()
+
+	now := time.Now()
+	if emailDelivery.ID == uuid.Nil {
+		emailDelivery.ID = uuid.NewV4()
+	}
+	emailDelivery.Tenant = s.tenant
+	emailDelivery.CreatedAt = now
+	emailDelivery.UpdatedAt = now
+
+	s.db.state.emailDeliveries[emailDelivery.ID] = *emailDelivery
+	return nil
+}
+
+// UpdateEmailDelivery save email delivery state
+func (s *MemoryStore) UpdateEmailDelivery(emailDelivery *model.EmailDelivery) error {
+	defer s.lock()()
+
+	st := s.db.state
+	stored, ok := st.emailDeliveries[emailDelivery.ID]
+	if !ok || stored.Tenant != s.tenant {
+		return ErrNotFound
+	}
+
+	stored.Status = emailDelivery.Status
+	stored.Attempts = emailDelivery.Attempts
+	stored.LastError = emailDelivery.LastError
+	stored.SentAt = emailDelivery.SentAt
+	stored.UpdatedAt = time.Now()
+	st.emailDeliveries[stored.ID] = stored
+
+	emailDelivery.UpdatedAt = stored.UpdatedAt
+	return nil
+}
+
+// EmailDeliveries get all email delivery of a message
+func (s *MemoryStore) EmailDeliveries(messageID uuid.UUID) ([]model.EmailDelivery, error) {
+	defer s.lock()()
+
+	emailDeliveries := make([]model.EmailDelivery, 0)
+	for _, emailDelivery := range s.db.state.emailDeliveries {
+		if emailDelivery.Tenant == s.tenant && emailDelivery.MessageID == messageID {
+			emailDeliveries = append(emailDeliveries, emailDelivery)
+		}
+	}
+
+	sort.Slice(emailDeliveries, func(i, j int) bool { return emailDeliveries[i].Email < emailDeliveries[j].Email })
+	return emailDeliveries, nil
+}
+
+// CreateAPIKey store new API key
+func (s *MemoryStore) CreateAPIKey(key *model.APIKey) error {
+	defer s.lock()()
+
+	now := time.Now()
+	if key.ID == uuid.Nil {
+		key.ID = uuid.NewV4()
+	}
+	key.CreatedAt = now
+	key.UpdatedAt = now
+
+	s.db.state.apiKeys[key.ID] = *key
+	return nil
+}
+
+// FindAPIKey get API key by its id
+func (s *MemoryStore) FindAPIKey(id uuid.UUID) (*model.APIKey, error) {
+	defer s.lock()()
+
+	key, ok := s.db.state.apiKeys[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &key, nil
+}
+
+// APIKeys get every API key, revoked and expired one included, oldest first
+func (s *MemoryStore) APIKeys() ([]model.APIKey, error) {
+	defer s.lock()()
+
+	keys := make([]model.APIKey, 0, len(s.db.state.apiKeys))
+	for _, key := range s.db.state.apiKeys {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+	return keys, nil
+}
+
+// RevokeAPIKey returns false when there is no such key or it is already revoked
+func (s *MemoryStore) RevokeAPIKey(id uuid.UUID) (bool, error) {
+	defer s.lock()()
+
+	st := s.db.state
+	key, ok := st.apiKeys[id]
+	if !ok || key.RevokedAt != nil {
+		return false, nil
+	}
+
+	now := time.Now()
+	key.RevokedAt = &now
+	key.UpdatedAt = now
+	st.apiKeys[id] = key
+	return true, nil
+}
+
+// TouchAPIKey record the time key was last used
+func (s *MemoryStore) TouchAPIKey(id uuid.UUID, usedAt time.Time) error {
+	defer s.lock()()
+
+	st := s.db.state
+	key, ok := st.apiKeys[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	key.LastUsedAt = &usedAt
+	st.apiKeys[id] = key
+	return nil
+}
+
+// CreateAuditEvent store audit event of store tenant
+func (s *MemoryStore) CreateAuditEvent(event *model.AuditEvent) error {
+	defer s.lock()()
+
+	now := time.Now()
+	event.ID = uuid.NewV4()
+	event.Tenant = s.tenant
+	event.CreatedAt = now
+	event.UpdatedAt = now
+
+	s.db.state.auditEvents[event.ID] = *event
+	return nil
+}
+
+// AuditEvents get page of audit trail of store tenant matching query newest first
+func (s *MemoryStore) AuditEvents(query AuditQuery) ([]model.AuditEvent, int, error) {
+	defer s.lock()()
+
+	matched := make([]model.AuditEvent, 0)
+	for _, event := range s.db.state.auditEvents {
+		if event.Tenant != s.tenant {
+			continue
+		}
+		if query.Email != "" && event.Actor != query.Email && event.Subject != query.Email && event.Target != query.Email {
+			continue
+		}
+		if (!query.From.IsZero() && event.CreatedAt.Before(query.From)) || (!query.To.IsZero() && !event.CreatedAt.Before(query.To)) {
+			continue
+		}
+
+		matched = append(matched, event)
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		if !matched[i].CreatedAt.Equal(matched[j].CreatedAt) {
+			return matched[i].CreatedAt.After(matched[j].CreatedAt)
+		}
+		return matched[i].ID.String() < matched[j].ID.String()
+	})
+
+	total := len(matched)
+	offset := query.Offset
+	if offset > total {
+		offset = total
+	}
+	end := offset + query.Limit
+	if end > total {
+		end = total
+	}
+
+	return matched[offset:end], total, nil
+}
+
+// Counts get number of record in the social graph of store tenant
+func (s *MemoryStore) Counts() (*GraphCounts, error) {
+	defer s.lock()()
+
+	st := s.db.state
+	var counts GraphCounts
+	for _, user := range st.users {
+		if user.Tenant != s.tenant {
+			continue
+		}
+		counts.Users++
+		if user.Suspended() {
+			counts.SuspendedUsers++
+		}
+	}
+
+	counts.Friendships = s.countEdges(st.friends) / 2
+	counts.Subscriptions = s.countEdges(st.notifications)
+	counts.Blocks = s.countEdges(st.blocks)
+	for _, friendRequest := range st.friendRequests {
+		if friendRequest.Tenant == s.tenant && friendRequest.Status == model.FriendRequestPending {
+			counts.PendingFriendRequests++
+		}
+	}
+	for _, message := range st.messages {
+		if message.Tenant == s.tenant {
+			counts.Messages++
+		}
+	}
+
+	return &counts, nil
+}
+
+// countEdges count edges owned by user of store tenant
+func (s *MemoryStore) countEdges(edges map[Edge]bool) int {
+	count := 0
+	for e := range edges {
+		if s.inTenant(e.UserID) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// related get users on the other side of edges owned by given user, or pointing to it when reverse is true
+func (s *MemoryStore) related(edges map[Edge]bool, userID uuid.UUID, reverse bool) []model.User {
+	st := s.db.state
+	users := make([]model.User, 0)
+	for e := range edges {
+		if !s.inTenant(e.UserID) {
+			continue
+		}
+
+		if !reverse && e.UserID == userID {
+			users = append(users, st.users[e.TargetID])
+		} else if reverse && e.TargetID == userID {
+			users = append(users, st.users[e.UserID])
+		}
+	}
+
+	sort.Slice(users, func(i, j int) bool { return users[i].Email < users[j].Email })
+	return users
+}
+
+// mergeEdges move edges on either side of source user to target user, dropping the one target user already has.
+// Returns where every moved edge went
+func mergeEdges(edges map[Edge]bool, sourceID, targetID uuid.UUID) map[Edge]Edge {
+	moved := make(map[Edge]Edge)
+	for e := range edges {
+		if e.UserID != sourceID && e.TargetID != sourceID {
+			continue
+		}
+
+		to := e
+		if to.UserID == sourceID {
+			to.UserID = targetID
+		}
+		if to.TargetID == sourceID {
+			to.TargetID = targetID
+		}
+
+		delete(edges, e)
+		if !edges[to] {
+			edges[to] = true
+			moved[e] = to
+		}
+	}
+
+	return moved
+}
+
+// inTenant check whether user belongs to store tenant, edge belongs to tenant of the user owning it
+func (s *MemoryStore) inTenant(userID uuid.UUID) bool {
+	user, ok := s.db.state.users[userID]
+	return ok && user.Tenant == s.tenant
+}
+
+func (s *MemoryStore) exists(edges map[Edge]bool, e Edge) bool {
+	return edges[e] && s.inTenant(e.UserID)
+}
+
+func (s *MemoryStore) deleteEdge(edges map[Edge]bool, e Edge) bool {
+	if !s.exists(edges, e) {
+		return false
+	}
+
+	delete(edges, e)
+	return true
+}
+
+// pageConnections filter and sort connections by query then cut requested page out of them, along with number of
+// connection matching the filter
+func pageConnections(connections []Connection, query ListQuery) ([]Connection, int) {
+	matched := make([]Connection, 0)
+	for _, connection := range connections {
+		if strings.HasPrefix(connection.Email, query.EmailPrefix) {
+			matched = append(matched, connection)
+		}
+	}
+
+	// compare returns negative when a is listed before b
+	compare := func(a, b Connection) int {
+		result := strings.Compare(a.Email, b.Email)
+		if query.SortBy == SortByConnectedAt && !a.ConnectedAt.Equal(b.ConnectedAt) {
+			result = 1
+			if a.ConnectedAt.Before(b.ConnectedAt) {
+				result = -1
+			}
+		}
+		if query.Desc {
+			result = -result
+		}
+		return result
+	}
+
+	sort.Slice(matched, func(i, j int) bool { return compare(matched[i], matched[j]) < 0 })
+
+	start := 0
+	if c := query.After; c != nil {
+		after := Connection{User: model.User{Email: c.Email}, ConnectedAt: c.ConnectedAt}
+		start = sort.Search(len(matched), func(i int) bool { return compare(matched[i], after) > 0 })
+	}
+
+	end := start + query.Limit
+	if end > len(matched) {
+		end = len(matched)
+	}
+
+	return matched[start:end], len(matched)
+}
+
+// sortEdges keep edge order stable since map iteration order is random
+func sortEdges(edges []Edge) []Edge {
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].UserID != edges[j].UserID {
+			return edges[i].UserID.String() < edges[j].UserID.String()
+		}
+		return edges[i].TargetID.String() < edges[j].TargetID.String()
+	})
+
+	return edges
+}
@@ -0,0 +1,45 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+func TestMemoryStoreInboxEntriesSince(t *testing.T) {
+	store := NewMemoryStore()
+
+	assertReplay(t, store, func(at time.Time) {
+		defer store.lock()()
+		for id, entry := range store.db.state.inboxEntries {
+			entry.CreatedAt = at
+			store.db.state.inboxEntries[id] = entry
+		}
+	})
+}
+
+func TestMemoryStoreTenantIsolation(t *testing.T) {
+	assertTenantIsolation(t, NewMemoryStore())
+}
+
+func TestMemoryStoreMergeUsers(t *testing.T) {
+	store := NewMemoryStore()
+
+	assertMergeUsers(t, store, func() []uuid.UUID {
+		defer store.lock()()
+		recipients := make([]uuid.UUID, 0)
+		for _, deadLetter := range store.db.state.deadLetters {
+			recipients = append(recipients, deadLetter.RecipientID)
+		}
+		return recipients
+	})
+}
+
+func TestMemoryStoreMergeUsersSelfEdge(t *testing.T) {
+	assertMergeSelfEdge(t, NewMemoryStore())
+}
+
+func TestMemoryStoreChangeEmail(t *testing.T) {
+	assertChangeEmail(t, NewMemoryStore())
+}
@@ -0,0 +1,67 @@
+package migration
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Schema snapshot of this migration, they are intentionally decoupled from model package
+// so later model changes do not alter what this migration does.
+
+type user001 struct {
+	ID        string `gorm:"type:char(36);primary_key"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt *time.Time `sql:"index"`
+	Email     string     `gorm:"type:varchar(100);unique_index;not null"`
+}
+
+func (user001) TableName() string { return "users" }
+
+type friend001 struct {
+	UserID   string `gorm:"type:char(36);primary_key"`
+	FriendID string `gorm:"type:char(36);primary_key"`
+}
+
+func (friend001) TableName() string { return "friends" }
+
+type notification001 struct {
+	UserID   string `gorm:"type:char(36);primary_key"`
+	TargetID string `gorm:"type:char(36);primary_key"`
+}
+
+func (notification001) TableName() string { return "notifications" }
+
+type block001 struct {
+	UserID   string `gorm:"type:char(36);primary_key"`
+	TargetID string `gorm:"type:char(36);primary_key"`
+}
+
+func (block001) TableName() string { return "blocks" }
+
+func init() {
+	register(Migration{
+		Version: 1,
+		Name:    "initial schema",
+		// AutoMigrate only creates what is missing, so database created by previous -migrate switch
+		// can adopt this migration as is
+		Up: func(db *gorm.DB) error {
+			if err := db.AutoMigrate(&user001{}, &friend001{}, &notification001{}, &block001{}).Error; err != nil {
+				return err
+			}
+
+			// join table primary key covers lookup by user_id, reverse lookup needs its own index
+			if err := db.Model(&friend001{}).AddIndex("idx_friends_friend_id", "friend_id").Error; err != nil {
+				return err
+			}
+			if err := db.Model(&notification001{}).AddIndex("idx_notifications_target_id", "target_id").Error; err != nil {
+				return err
+			}
+			return db.Model(&block001{}).AddIndex("idx_blocks_target_id", "target_id").Error
+		},
+		Down: func(db *gorm.DB) error {
+			return db.DropTableIfExists(&block001{}, &notification001{}, &friend001{}, &user001{}).Error
+		},
+	})
+}
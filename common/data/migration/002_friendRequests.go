@@ -0,0 +1,33 @@
+package migration
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type friendRequest002 struct {
+	ID          string `gorm:"type:char(36);primary_key"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	DeletedAt   *time.Time `sql:"index"`
+	RequestorID string     `gorm:"type:char(36);index;not null"`
+	TargetID    string     `gorm:"type:char(36);index;not null"`
+	Status      string     `gorm:"type:varchar(20);index;not null"`
+	RespondedAt *time.Time
+}
+
+func (friendRequest002) TableName() string { return "friend_requests" }
+
+func init() {
+	register(Migration{
+		Version: 2,
+		Name:    "friend requests",
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(&friendRequest002{}).Error
+		},
+		Down: func(db *gorm.DB) error {
+			return db.DropTableIfExists(&friendRequest002{}).Error
+		},
+	})
+}
@@ -0,0 +1,43 @@
+package migration
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type message003 struct {
+	ID        string `gorm:"type:char(36);primary_key"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt *time.Time `sql:"index"`
+	SenderID  string     `gorm:"type:char(36);index;not null"`
+	Text      string     `gorm:"type:text"`
+}
+
+func (message003) TableName() string { return "messages" }
+
+type inboxEntry003 struct {
+	ID          string `gorm:"type:char(36);primary_key"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	DeletedAt   *time.Time `sql:"index"`
+	MessageID   string     `gorm:"type:char(36);index;not null"`
+	RecipientID string     `gorm:"type:char(36);index;not null"`
+	ReadAt      *time.Time
+}
+
+func (inboxEntry003) TableName() string { return "inbox_entries" }
+
+func init() {
+	register(Migration{
+		Version: 3,
+		Name:    "messages and inbox",
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(&message003{}, &inboxEntry003{}).Error
+		},
+		Down: func(db *gorm.DB) error {
+			return db.DropTableIfExists(&inboxEntry003{}, &message003{}).Error
+		},
+	})
+}
@@ -0,0 +1,48 @@
+package migration
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type webhook004 struct {
+	ID        string `gorm:"type:char(36);primary_key"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt *time.Time `sql:"index"`
+	UserID    string     `gorm:"type:char(36);index;not null"`
+	URL       string     `gorm:"type:varchar(2048);not null"`
+	Secret    string     `gorm:"type:varchar(128);not null"`
+}
+
+func (webhook004) TableName() string { return "webhooks" }
+
+type webhookDeadLetter004 struct {
+	ID          string `gorm:"type:char(36);primary_key"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	DeletedAt   *time.Time `sql:"index"`
+	WebhookID   string     `gorm:"type:char(36);index;not null"`
+	MessageID   string     `gorm:"type:char(36);index;not null"`
+	RecipientID string     `gorm:"type:char(36);not null"`
+	URL         string     `gorm:"type:varchar(2048);not null"`
+	Payload     string     `gorm:"type:text"`
+	Attempts    int
+	LastError   string `gorm:"type:text"`
+}
+
+func (webhookDeadLetter004) TableName() string { return "webhook_dead_letters" }
+
+func init() {
+	register(Migration{
+		Version: 4,
+		Name:    "webhooks",
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(&webhook004{}, &webhookDeadLetter004{}).Error
+		},
+		Down: func(db *gorm.DB) error {
+			return db.DropTableIfExists(&webhookDeadLetter004{}, &webhook004{}).Error
+		},
+	})
+}
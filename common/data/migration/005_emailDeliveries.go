@@ -0,0 +1,36 @@
+package migration
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type emailDelivery005 struct {
+	ID          string `gorm:"type:char(36);primary_key"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	DeletedAt   *time.Time `sql:"index"`
+	MessageID   string     `gorm:"type:char(36);index;not null"`
+	RecipientID string     `gorm:"type:char(36);not null"`
+	Email       string     `gorm:"type:varchar(100);not null"`
+	Status      string     `gorm:"type:varchar(20);index;not null"`
+	Attempts    int
+	LastError   string `gorm:"type:text"`
+	SentAt      *time.Time
+}
+
+func (emailDelivery005) TableName() string { return "email_deliveries" }
+
+func init() {
+	register(Migration{
+		Version: 5,
+		Name:    "email deliveries",
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(&emailDelivery005{}).Error
+		},
+		Down: func(db *gorm.DB) error {
+			return db.DropTableIfExists(&emailDelivery005{}).Error
+		},
+	})
+}
@@ -0,0 +1,40 @@
+package migration
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type friend006 struct {
+	UserID    string `gorm:"type:char(36);primary_key"`
+	FriendID  string `gorm:"type:char(36);primary_key"`
+	CreatedAt *time.Time
+}
+
+func (friend006) TableName() string { return "friends" }
+
+func init() {
+	register(Migration{
+		Version: 6,
+		Name:    "friend connected at",
+		// connection made before this migration has no known time, it is considered made when migration runs
+		Up: func(db *gorm.DB) error {
+			if err := db.AutoMigrate(&friend006{}).Error; err != nil {
+				return err
+			}
+			if err := db.Model(&friend006{}).AddIndex("idx_friends_user_id_created_at", "user_id", "created_at").Error; err != nil {
+				return err
+			}
+
+			return db.Table("friends").Where("created_at IS NULL").UpdateColumn("created_at", time.Now()).Error
+		},
+		Down: func(db *gorm.DB) error {
+			if err := db.Model(&friend006{}).RemoveIndex("idx_friends_user_id_created_at").Error; err != nil {
+				return err
+			}
+
+			return dropColumn(db, friend006{}.TableName(), "created_at")
+		},
+	})
+}
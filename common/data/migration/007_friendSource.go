@@ -0,0 +1,36 @@
+package migration
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+type friend007 struct {
+	UserID   string `gorm:"type:char(36);primary_key"`
+	FriendID string `gorm:"type:char(36);primary_key"`
+	Source   string `gorm:"type:varchar(20)"`
+	Label    string `gorm:"type:varchar(100)"`
+}
+
+func (friend007) TableName() string { return "friends" }
+
+func init() {
+	register(Migration{
+		Version: 7,
+		Name:    "friend source and label",
+		// only connect endpoint could create connection before this migration
+		Up: func(db *gorm.DB) error {
+			if err := db.AutoMigrate(&friend007{}).Error; err != nil {
+				return err
+			}
+
+			return db.Table("friends").Where("source IS NULL").UpdateColumn("source", "api").Error
+		},
+		Down: func(db *gorm.DB) error {
+			if err := dropColumn(db, friend007{}.TableName(), "label"); err != nil {
+				return err
+			}
+
+			return dropColumn(db, friend007{}.TableName(), "source")
+		},
+	})
+}
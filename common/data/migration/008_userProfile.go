@@ -0,0 +1,48 @@
+package migration
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+type user008 struct {
+	ID          string `gorm:"type:char(36);primary_key"`
+	DisplayName string `gorm:"type:varchar(100)"`
+	AvatarURL   string `gorm:"type:varchar(2048)"`
+	Locale      string `gorm:"type:varchar(35)"`
+	Timezone    string `gorm:"type:varchar(64)"`
+	Bio         string `gorm:"type:text"`
+}
+
+func (user008) TableName() string { return "users" }
+
+var profileColumns008 = []string{"display_name", "avatar_url", "locale", "timezone", "bio"}
+
+func init() {
+	register(Migration{
+		Version: 8,
+		Name:    "user profile",
+		Up: func(db *gorm.DB) error {
+			if err := db.AutoMigrate(&user008{}).Error; err != nil {
+				return err
+			}
+
+			// existing user has empty profile rather than null one, so it can be read into plain string
+			for _, column := range profileColumns008 {
+				if err := db.Table("users").Where(column+" IS NULL").UpdateColumn(column, "").Error; err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+		Down: func(db *gorm.DB) error {
+			for _, column := range profileColumns008 {
+				if err := dropColumn(db, user008{}.TableName(), column); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+	})
+}
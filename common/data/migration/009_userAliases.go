@@ -0,0 +1,28 @@
+package migration
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type userAlias009 struct {
+	Email     string `gorm:"type:varchar(100);primary_key"`
+	UserID    string `gorm:"type:char(36);index;not null"`
+	CreatedAt time.Time
+}
+
+func (userAlias009) TableName() string { return "user_aliases" }
+
+func init() {
+	register(Migration{
+		Version: 9,
+		Name:    "user aliases",
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(&userAlias009{}).Error
+		},
+		Down: func(db *gorm.DB) error {
+			return db.DropTableIfExists(&userAlias009{}).Error
+		},
+	})
+}
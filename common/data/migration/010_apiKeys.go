@@ -0,0 +1,35 @@
+package migration
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type apiKey010 struct {
+	ID         string `gorm:"type:char(36);primary_key"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	DeletedAt  *time.Time `sql:"index"`
+	Name       string     `gorm:"type:varchar(100);not null"`
+	SecretHash string     `gorm:"type:char(64);not null"`
+	Scopes     string     `gorm:"type:varchar(255);not null"`
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
+
+func (apiKey010) TableName() string { return "api_keys" }
+
+func init() {
+	register(Migration{
+		Version: 10,
+		Name:    "api keys",
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(&apiKey010{}).Error
+		},
+		Down: func(db *gorm.DB) error {
+			return db.DropTableIfExists(&apiKey010{}).Error
+		},
+	})
+}
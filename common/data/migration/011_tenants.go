@@ -0,0 +1,113 @@
+package migration
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// tenant011 column added to every table of the social graph, the table is given by db.Table
+type tenant011 struct {
+	Tenant string `gorm:"type:varchar(64)"`
+}
+
+var tenantTables011 = []string{"users", "friends", "notifications", "blocks", "friend_requests", "messages", "inbox_entries"}
+
+// userAlias011 alias is unique per tenant, so tenant becomes part of its primary key
+type userAlias011 struct {
+	Tenant    string `gorm:"type:varchar(64);primary_key"`
+	Email     string `gorm:"type:varchar(100);primary_key"`
+	UserID    string `gorm:"type:char(36);not null"`
+	CreatedAt time.Time
+}
+
+// legacyAlias011 alias table before this migration, without index of user_aliases_011 name
+type legacyAlias011 struct {
+	Email     string `gorm:"type:varchar(100);primary_key"`
+	UserID    string `gorm:"type:char(36);not null"`
+	CreatedAt time.Time
+}
+
+type apiKey011 struct {
+	ID     string `gorm:"type:char(36);primary_key"`
+	Tenant string `gorm:"type:varchar(64)"`
+}
+
+func (apiKey011) TableName() string { return "api_keys" }
+
+func init() {
+	register(Migration{
+		Version: 11,
+		Name:    "tenants",
+		// everything stored before this migration belongs to default tenant, API key stays bound to none
+		Up: func(db *gorm.DB) error {
+			for _, table := range tenantTables011 {
+				if err := db.Table(table).AutoMigrate(&tenant011{}).Error; err != nil {
+					return err
+				}
+				if err := db.Table(table).Where("tenant IS NULL").UpdateColumn("tenant", "default").Error; err != nil {
+					return err
+				}
+			}
+
+			if err := db.Table("users").RemoveIndex("uix_users_email").Error; err != nil {
+				return err
+			}
+			if err := db.Table("users").AddUniqueIndex("uix_users_tenant_email", "tenant", "email").Error; err != nil {
+				return err
+			}
+
+			// primary key can not be altered in place by every database, so alias table is rebuilt
+			err := rebuildAliases011(db, &userAlias011{}, "INSERT INTO user_aliases_011 (tenant, email, user_id, created_at) SELECT 'default', email, user_id, created_at FROM user_aliases")
+			if err != nil {
+				return err
+			}
+
+			return db.AutoMigrate(&apiKey011{}).Error
+		},
+		// fails when the same email is used in more than one tenant, alias of other tenant than default is dropped
+		Down: func(db *gorm.DB) error {
+			if err := dropColumn(db, apiKey011{}.TableName(), "tenant"); err != nil {
+				return err
+			}
+
+			err := rebuildAliases011(db, &legacyAlias011{}, "INSERT INTO user_aliases_011 (email, user_id, created_at) SELECT email, user_id, created_at FROM user_aliases WHERE tenant = 'default'")
+			if err != nil {
+				return err
+			}
+
+			if err := db.Table("users").RemoveIndex("uix_users_tenant_email").Error; err != nil {
+				return err
+			}
+			if err := db.Table("users").AddUniqueIndex("uix_users_email", "email").Error; err != nil {
+				return err
+			}
+
+			for _, table := range tenantTables011 {
+				if err := dropColumn(db, table, "tenant"); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+	})
+}
+
+// rebuildAliases011 replace user_aliases table with the one of given schema, filled by copy statement
+func rebuildAliases011(db *gorm.DB, schema interface{}, copy string) error {
+	if err := db.Table("user_aliases_011").CreateTable(schema).Error; err != nil {
+		return err
+	}
+	if err := db.Exec(copy).Error; err != nil {
+		return err
+	}
+	if err := db.DropTable("user_aliases").Error; err != nil {
+		return err
+	}
+	if err := db.Exec("ALTER TABLE user_aliases_011 RENAME TO user_aliases").Error; err != nil {
+		return err
+	}
+
+	return db.Table("user_aliases").AddIndex("idx_user_aliases_user_id", "user_id").Error
+}
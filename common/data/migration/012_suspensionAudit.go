@@ -0,0 +1,62 @@
+package migration
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type user012 struct {
+	ID            string `gorm:"type:char(36);primary_key"`
+	SuspendedAt   *time.Time
+	SuspendReason string `gorm:"type:varchar(255)"`
+}
+
+func (user012) TableName() string { return "users" }
+
+type auditEvent012 struct {
+	ID        string `gorm:"type:char(36);primary_key"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt *time.Time `sql:"index"`
+	Tenant    string     `gorm:"type:varchar(64);not null"`
+	Actor     string     `gorm:"type:varchar(100)"`
+	Action    string     `gorm:"type:varchar(50);not null"`
+	Subject   string     `gorm:"type:varchar(100)"`
+	Target    string     `gorm:"type:varchar(100)"`
+	Detail    string     `gorm:"type:varchar(255)"`
+	ClientIP  string     `gorm:"type:varchar(45)"`
+}
+
+func (auditEvent012) TableName() string { return "audit_events" }
+
+func init() {
+	register(Migration{
+		Version: 12,
+		Name:    "suspension and audit events",
+		Up: func(db *gorm.DB) error {
+			if err := db.AutoMigrate(&user012{}).Error; err != nil {
+				return err
+			}
+			if err := db.Table("users").Where("suspend_reason IS NULL").UpdateColumn("suspend_reason", "").Error; err != nil {
+				return err
+			}
+
+			if err := db.AutoMigrate(&auditEvent012{}).Error; err != nil {
+				return err
+			}
+
+			return db.Model(&auditEvent012{}).AddIndex("idx_audit_events_tenant_created_at", "tenant", "created_at").Error
+		},
+		Down: func(db *gorm.DB) error {
+			if err := db.DropTableIfExists(&auditEvent012{}).Error; err != nil {
+				return err
+			}
+			if err := dropColumn(db, user012{}.TableName(), "suspended_at"); err != nil {
+				return err
+			}
+
+			return dropColumn(db, user012{}.TableName(), "suspend_reason")
+		},
+	})
+}
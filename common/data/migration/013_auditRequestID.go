@@ -0,0 +1,51 @@
+package migration
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+type auditEvent013 struct {
+	ID        string `gorm:"type:char(36);primary_key"`
+	RequestID string `gorm:"type:varchar(64)"`
+}
+
+func (auditEvent013) TableName() string { return "audit_events" }
+
+// auditIndexes013 event is looked up by user taking part in it on any side
+var auditIndexes013 = map[string]string{
+	"idx_audit_events_actor":   "actor",
+	"idx_audit_events_subject": "subject",
+	"idx_audit_events_target":  "target",
+}
+
+func init() {
+	register(Migration{
+		Version: 13,
+		Name:    "audit request id",
+		Up: func(db *gorm.DB) error {
+			if err := db.AutoMigrate(&auditEvent013{}).Error; err != nil {
+				return err
+			}
+			if err := db.Table("audit_events").Where("request_id IS NULL").UpdateColumn("request_id", "").Error; err != nil {
+				return err
+			}
+
+			for name, column := range auditIndexes013 {
+				if err := db.Model(&auditEvent013{}).AddIndex(name, column).Error; err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+		Down: func(db *gorm.DB) error {
+			for name := range auditIndexes013 {
+				if err := db.Model(&auditEvent013{}).RemoveIndex(name).Error; err != nil {
+					return err
+				}
+			}
+
+			return dropColumn(db, auditEvent013{}.TableName(), "request_id")
+		},
+	})
+}
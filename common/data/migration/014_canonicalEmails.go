@@ -0,0 +1,241 @@
+package migration
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type user014 struct {
+	ID     string
+	Tenant string
+	Email  string
+}
+
+type userAlias014 struct {
+	Tenant string
+	Email  string
+	UserID string
+}
+
+type tenantEmail014 struct {
+	tenant string
+	email  string
+}
+
+// edgeTables014 join tables of relation between two user along with the column referencing the other user
+var edgeTables014 = map[string]string{
+	"friends":       "friend_id",
+	"notifications": "target_id",
+	"blocks":        "target_id",
+}
+
+// userColumns014 columns referencing user whose row simply follows merged user
+var userColumns014 = []struct{ table, column string }{
+	{"messages", "sender_id"},
+	{"webhooks", "user_id"},
+	{"webhook_dead_letters", "recipient_id"},
+	{"email_deliveries", "recipient_id"},
+	{"user_aliases", "user_id"},
+}
+
+func init() {
+	register(Migration{
+		Version: 14,
+		Name:    "canonical emails",
+		// Email stored before canonicalization rules were applied is rewritten into its canonical form, otherwise
+		// the user is no longer found by lookup. Users whose email ends up the same are merged into the one already
+		// holding canonical email, or the oldest one
+		Up: func(db *gorm.DB) error {
+			value, ok := db.Get(canonicalizeSetting)
+			canonicalize, _ := value.(func(email string) string)
+			if !ok || canonicalize == nil {
+				return errors.New("email canonicalizer is not set")
+			}
+
+			if err := canonicalizeUsers014(db, canonicalize); err != nil {
+				return err
+			}
+
+			return canonicalizeAliases014(db, canonicalize)
+		},
+		// canonical email is just as valid before this migration and merged users can not be split again
+		Down: func(db *gorm.DB) error {
+			return nil
+		},
+	})
+}
+
+// canonicalizeUsers014 rewrite every user email into canonical form, merging users that collide
+func canonicalizeUsers014(db *gorm.DB, canonicalize func(email string) string) error {
+	var users []user014
+	if err := db.Table("users").Select("id, tenant, email").Order("created_at, id").Scan(&users).Error; err != nil {
+		return err
+	}
+
+	keys := make([]tenantEmail014, 0)
+	groups := make(map[tenantEmail014][]user014)
+	for _, user := range users {
+		key := tenantEmail014{tenant: user.Tenant, email: canonicalize(user.Email)}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], user)
+	}
+
+	for _, key := range keys {
+		group := groups[key]
+		target := group[0]
+		for _, user := range group {
+			if user.Email == key.email {
+				target = user
+				break
+			}
+		}
+
+		for _, user := range group {
+			if user.ID == target.ID {
+				continue
+			}
+			if err := mergeUser014(db, user.ID, target.ID); err != nil {
+				return err
+			}
+		}
+
+		if target.Email != key.email {
+			if err := db.Exec("UPDATE users SET email = ? WHERE id = ?", key.email, target.ID).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// canonicalizeAliases014 rewrite every alias into canonical form. Alias whose canonical email is primary email of a
+// user or belongs to an older alias could never be found, so it is dropped
+func canonicalizeAliases014(db *gorm.DB, canonicalize func(email string) string) error {
+	var users []user014
+	if err := db.Table("users").Select("id, tenant, email").Scan(&users).Error; err != nil {
+		return err
+	}
+
+	var aliases []userAlias014
+	if err := db.Table("user_aliases").Select("tenant, email, user_id").Order("created_at, email").Scan(&aliases).Error; err != nil {
+		return err
+	}
+
+	taken := make(map[tenantEmail014]bool)
+	for _, user := range users {
+		taken[tenantEmail014{tenant: user.Tenant, email: user.Email}] = true
+	}
+
+	// alias already in canonical form keeps its row, unless user took its email
+	kept := make(map[tenantEmail014]bool)
+	for _, alias := range aliases {
+		key := tenantEmail014{tenant: alias.Tenant, email: alias.Email}
+		if canonicalize(alias.Email) == alias.Email && !taken[key] {
+			kept[key] = true
+		}
+	}
+
+	for _, alias := range aliases {
+		if kept[tenantEmail014{tenant: alias.Tenant, email: alias.Email}] {
+			continue
+		}
+
+		if err := db.Exec("DELETE FROM user_aliases WHERE tenant = ? AND email = ?", alias.Tenant, alias.Email).Error; err != nil {
+			return err
+		}
+
+		key := tenantEmail014{tenant: alias.Tenant, email: canonicalize(alias.Email)}
+		if taken[key] || kept[key] {
+			continue
+		}
+		kept[key] = true
+
+		err := db.Exec("INSERT INTO user_aliases (tenant, email, user_id, created_at) VALUES (?, ?, ?, ?)", key.tenant, key.email, alias.UserID, time.Now()).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mergeUser014 move all record of source user to target user then delete source user. Relation between both users
+// would become relation of user to itself, so it is dropped
+func mergeUser014(db *gorm.DB, sourceID, targetID string) error {
+	for table, otherColumn := range edgeTables014 {
+		err := db.Exec("DELETE FROM "+table+" WHERE (user_id = ? AND "+otherColumn+" = ?) OR (user_id = ? AND "+otherColumn+" = ?)", sourceID, targetID, targetID, sourceID).Error
+		if err != nil {
+			return err
+		}
+
+		if err := repoint014(db, table, "user_id", otherColumn, sourceID, targetID); err != nil {
+			return err
+		}
+		if err := repoint014(db, table, otherColumn, "user_id", sourceID, targetID); err != nil {
+			return err
+		}
+	}
+
+	err := db.Exec("DELETE FROM friend_requests WHERE (requestor_id = ? AND target_id = ?) OR (requestor_id = ? AND target_id = ?)", sourceID, targetID, targetID, sourceID).Error
+	if err != nil {
+		return err
+	}
+
+	// target keeps its own pending request when both have one to or from the same user
+	for _, columns := range [][2]string{{"requestor_id", "target_id"}, {"target_id", "requestor_id"}} {
+		column, otherColumn := columns[0], columns[1]
+
+		var owned []string
+		if err := db.Table("friend_requests").Where(column+" = ? AND status = ?", targetID, "pending").Pluck(otherColumn, &owned).Error; err != nil {
+			return err
+		}
+		if len(owned) > 0 {
+			err := db.Exec("UPDATE friend_requests SET status = ?, responded_at = ?, updated_at = ? WHERE "+column+" = ? AND status = ? AND "+otherColumn+" IN (?)",
+				"cancelled", time.Now(), time.Now(), sourceID, "pending", owned).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := db.Exec("UPDATE friend_requests SET "+column+" = ? WHERE "+column+" = ?", targetID, sourceID).Error; err != nil {
+			return err
+		}
+	}
+
+	// both users may have received the same message
+	if err := repoint014(db, "inbox_entries", "recipient_id", "message_id", sourceID, targetID); err != nil {
+		return err
+	}
+
+	for _, u := range userColumns014 {
+		if err := db.Exec("UPDATE "+u.table+" SET "+u.column+" = ? WHERE "+u.column+" = ?", targetID, sourceID).Error; err != nil {
+			return err
+		}
+	}
+
+	return db.Exec("DELETE FROM users WHERE id = ?", sourceID).Error
+}
+
+// repoint014 move rows of table whose column references source user to target user. Row that would duplicate the one
+// target user already has, i.e. same otherColumn value, is deleted instead
+func repoint014(db *gorm.DB, table, column, otherColumn, sourceID, targetID string) error {
+	var owned []string
+	if err := db.Table(table).Where(column+" = ?", targetID).Pluck(otherColumn, &owned).Error; err != nil {
+		return err
+	}
+
+	// deleting by subquery on the same table is not allowed by mysql, so target rows are looked up first
+	if len(owned) > 0 {
+		err := db.Exec("DELETE FROM "+table+" WHERE "+column+" = ? AND "+otherColumn+" IN (?)", sourceID, owned).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return db.Exec("UPDATE "+table+" SET "+column+" = ? WHERE "+column+" = ?", targetID, sourceID).Error
+}
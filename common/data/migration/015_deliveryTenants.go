@@ -0,0 +1,49 @@
+package migration
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+// tenant015 column added to delivery table, the table is given by db.Table
+type tenant015 struct {
+	Tenant string `gorm:"type:varchar(64)"`
+}
+
+// deliveryTenants015 delivery table along with the user or message reference its tenant is taken from
+var deliveryTenants015 = []struct{ table, owner string }{
+	{"webhooks", "SELECT tenant FROM users WHERE users.id = webhooks.user_id"},
+	{"webhook_dead_letters", "SELECT tenant FROM users WHERE users.id = webhook_dead_letters.recipient_id"},
+	{"email_deliveries", "SELECT tenant FROM messages WHERE messages.id = email_deliveries.message_id"},
+}
+
+func init() {
+	register(Migration{
+		Version: 15,
+		Name:    "delivery tenants",
+		// delivery belongs to tenant of its owner, or to default tenant when owner is gone
+		Up: func(db *gorm.DB) error {
+			for _, t := range deliveryTenants015 {
+				if err := db.Table(t.table).AutoMigrate(&tenant015{}).Error; err != nil {
+					return err
+				}
+				if err := db.Exec("UPDATE " + t.table + " SET tenant = (" + t.owner + ") WHERE tenant IS NULL").Error; err != nil {
+					return err
+				}
+				if err := db.Table(t.table).Where("tenant IS NULL").UpdateColumn("tenant", "default").Error; err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+		Down: func(db *gorm.DB) error {
+			for _, t := range deliveryTenants015 {
+				if err := dropColumn(db, t.table, "tenant"); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+	})
+}
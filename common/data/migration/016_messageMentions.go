@@ -0,0 +1,26 @@
+package migration
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+type message016 struct {
+	ID       string `gorm:"type:char(36);primary_key"`
+	Mentions string `gorm:"type:text"`
+}
+
+func (message016) TableName() string { return "messages" }
+
+func init() {
+	register(Migration{
+		Version: 16,
+		Name:    "message mentions",
+		// mention of earlier message is not known anymore, it is left empty
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(&message016{}).Error
+		},
+		Down: func(db *gorm.DB) error {
+			return dropColumn(db, message016{}.TableName(), "mentions")
+		},
+	})
+}
@@ -0,0 +1,291 @@
+package migration
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/jinzhu/gorm"
+)
+
+// Migration single versioned and reversible schema change
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(db *gorm.DB) error
+	Down    func(db *gorm.DB) error
+}
+
+// Status applied state of a migration
+type Status struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// schemaMigration is a row of schema_migrations table recording applied migration
+type schemaMigration struct {
+	Version   int    `gorm:"primary_key;auto_increment:false"`
+	Name      string `gorm:"type:varchar(255);not null"`
+	AppliedAt time.Time
+}
+
+// TableName gorm table name
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+var registry = make(map[int]Migration)
+
+// register add migration into registry, it is called from init of each migration file
+func register(m Migration) {
+	if _, ok := registry[m.Version]; ok {
+		panic(fmt.Sprintf("migration version %d is registered twice", m.Version))
+	}
+
+	registry[m.Version] = m
+}
+
+// canonicalizeSetting gorm setting holding func bringing email into canonical form, for data migration of user
+const canonicalizeSetting = "fmgo:canonicalize"
+
+// Migrator run registered migrations against database
+type Migrator struct {
+	db *gorm.DB
+}
+
+// New initialize new Migrator instance, canonicalize must apply the same email rules as the app does
+func New(db *gorm.DB, canonicalize func(email string) string) *Migrator {
+	return &Migrator{db: db.Set(canonicalizeSetting, canonicalize)}
+}
+
+// migrations get all registered migration ordered by version
+func (m *Migrator) migrations() []Migration {
+	migrations := make([]Migration, 0, len(registry))
+	for _, migration := range registry {
+		migrations = append(migrations, migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations
+}
+
+// applied get applied migration keyed by version
+func (m *Migrator) applied() (map[int]schemaMigration, error) {
+	if err := m.db.AutoMigrate(&schemaMigration{}).Error; err != nil {
+		return nil, err
+	}
+
+	var rows []schemaMigration
+	if err := m.db.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]schemaMigration)
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+
+	return applied, nil
+}
+
+// Up apply all pending migration in order, returns number of applied migration
+func (m *Migrator) Up() (int, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, migration := range m.migrations() {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		glog.Infof("Applying migration %d %s", migration.Version, migration.Name)
+		err := m.run(migration.Up, func(db *gorm.DB) error {
+			return db.Create(&schemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return count, fmt.Errorf("migration %d %s failed: %s", migration.Version, migration.Name, err)
+		}
+
+		count++
+	}
+
+	return count, nil
+}
+
+// Down revert the last n applied migration in reverse order, returns number of reverted migration
+func (m *Migrator) Down(n int) (int, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return 0, err
+	}
+
+	migrations := m.migrations()
+	count := 0
+	for i := len(migrations) - 1; i >= 0 && count < n; i-- {
+		migration := migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+
+		glog.Infof("Reverting migration %d %s", migration.Version, migration.Name)
+		err := m.run(migration.Down, func(db *gorm.DB) error {
+			return db.Delete(&schemaMigration{Version: migration.Version}).Error
+		})
+		if err != nil {
+			return count, fmt.Errorf("reverting migration %d %s failed: %s", migration.Version, migration.Name, err)
+		}
+
+		count++
+	}
+
+	return count, nil
+}
+
+// Status get applied state of all registered migration
+func (m *Migrator) Status() ([]Status, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0)
+	for _, migration := range m.migrations() {
+		status := Status{Version: migration.Version, Name: migration.Name}
+		if row, ok := applied[migration.Version]; ok {
+			appliedAt := row.AppliedAt
+			status.AppliedAt = &appliedAt
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// run execute schema change then its bookkeeping. Schema change is not wrapped in transaction since gorm
+// dialect inspects schema outside of it and mysql commits DDL statement implicitly anyway, so migration
+// is only recorded once it succeeds and failed one may need manual cleanup before it is retried
+func (m *Migrator) run(change func(db *gorm.DB) error, record func(db *gorm.DB) error) error {
+	if err := change(m.db); err != nil {
+		return err
+	}
+
+	return record(m.db)
+}
+
+// dropColumn drop column of table for down step of migration. SQLite only learned to drop column in 3.35, so there
+// the table is rebuilt without the column and its indexes are created again, column still covered by index or table
+// constraint is refused just like the other databases do
+func dropColumn(db *gorm.DB, table, column string) error {
+	if db.Dialect().GetName() != "sqlite3" {
+		return db.Table(table).DropColumn(column).Error
+	}
+
+	var create string
+	if err := db.Raw("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", table).Row().Scan(&create); err != nil {
+		return err
+	}
+	open, end := strings.Index(create, "("), strings.LastIndex(create, ")")
+	if open < 0 || end < open {
+		return fmt.Errorf("could not parse schema of table %s", table)
+	}
+
+	var definitions, columns []string
+	found := false
+	for _, definition := range splitDefinitions(create[open+1 : end]) {
+		name := strings.Fields(definition)[0]
+		switch strings.ToUpper(name) {
+		case "PRIMARY", "UNIQUE", "CHECK", "FOREIGN", "CONSTRAINT":
+			if strings.Contains(definition, `"`+column+`"`) {
+				return fmt.Errorf("column %s of table %s is used by constraint %s", column, table, definition)
+			}
+		default:
+			if strings.Trim(name, "\"`[]") == column {
+				found = true
+				continue
+			}
+			columns = append(columns, name)
+		}
+		definitions = append(definitions, definition)
+	}
+	if !found {
+		return fmt.Errorf("table %s has no column %s", table, column)
+	}
+
+	rows, err := db.Raw("SELECT sql FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND sql IS NOT NULL", table).Rows()
+	if err != nil {
+		return err
+	}
+	var indexes []string
+	for rows.Next() {
+		var index string
+		if err := rows.Scan(&index); err != nil {
+			rows.Close()
+			return err
+		}
+		if open, end := strings.Index(index, "("), strings.LastIndex(index, ")"); open >= 0 && end > open {
+			for _, indexed := range strings.Split(index[open+1:end], ",") {
+				if strings.Trim(strings.TrimSpace(indexed), "\"`[]") == column {
+					rows.Close()
+					return fmt.Errorf("column %s of table %s is used by index %s", column, table, index)
+				}
+			}
+		}
+		indexes = append(indexes, index)
+	}
+	rows.Close()
+
+	rebuilt := table + "_rebuild"
+	list := strings.Join(columns, ", ")
+	statements := []string{
+		fmt.Sprintf(`CREATE TABLE "%s" (%s)`, rebuilt, strings.Join(definitions, ",")),
+		fmt.Sprintf(`INSERT INTO "%s" (%s) SELECT %s FROM "%s"`, rebuilt, list, list, table),
+		fmt.Sprintf(`DROP TABLE "%s"`, table),
+		fmt.Sprintf(`ALTER TABLE "%s" RENAME TO "%s"`, rebuilt, table),
+	}
+	for _, statement := range append(statements, indexes...) {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// splitDefinitions split column and constraint definitions of CREATE TABLE statement at commas outside parentheses
+// and quotes
+func splitDefinitions(s string) []string {
+	var definitions []string
+	var quote rune
+	depth, start := 0, 0
+	for i, r := range s {
+		if quote != 0 {
+			if r == quote {
+				quote = 0
+			}
+			continue
+		}
+
+		switch r {
+		case '\'', '"', '`':
+			quote = r
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				definitions = append(definitions, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+
+	return append(definitions, strings.TrimSpace(s[start:]))
+}
@@ -0,0 +1,175 @@
+package migration
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+)
+
+// newSQLite open in-memory SQLite database pinned to single connection, the way DBFactory does
+func newSQLite(t *testing.T) *gorm.DB {
+	db, err := gorm.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open sqlite database: %s", err)
+	}
+	db.DB().SetMaxOpenConns(1)
+	db.DB().SetMaxIdleConns(1)
+
+	return db
+}
+
+// assertApplied check that exactly migrations up to given version are applied
+func assertApplied(t *testing.T, m *Migrator, version int) {
+	statuses, err := m.Status()
+	if err != nil {
+		t.Fatalf("Status: %s", err)
+	}
+	if len(statuses) != len(registry) {
+		t.Fatalf("Status got %d migrations, want %d", len(statuses), len(registry))
+	}
+
+	for i, status := range statuses {
+		if i > 0 && statuses[i-1].Version >= status.Version {
+			t.Fatalf("Status is not ordered by version: %d before %d", statuses[i-1].Version, status.Version)
+		}
+		if status.Name != registry[status.Version].Name {
+			t.Errorf("migration %d is named %s, want %s", status.Version, status.Name, registry[status.Version].Name)
+		}
+		if applied := status.AppliedAt != nil; applied != (status.Version <= version) {
+			t.Errorf("migration %d applied is %t, want applied up to %d", status.Version, applied, version)
+		}
+	}
+}
+
+// count number of rows of table matching condition
+func count(t *testing.T, db *gorm.DB, table, condition string, args ...interface{}) int {
+	var n int
+	if err := db.Table(table).Where(condition, args...).Count(&n).Error; err != nil {
+		t.Fatalf("Failed to count %s: %s", table, err)
+	}
+
+	return n
+}
+
+func TestMigrator(t *testing.T) {
+	db := newSQLite(t)
+	defer db.Close()
+	m := New(db, strings.ToLower)
+	latest := m.migrations()[len(registry)-1].Version
+
+	assertApplied(t, m, 0)
+	if n, err := m.Up(); err != nil || n != len(registry) {
+		t.Fatalf("Up applied %d, %v, want %d", n, err, len(registry))
+	}
+	assertApplied(t, m, latest)
+	if n, err := m.Up(); err != nil || n != 0 {
+		t.Fatalf("Up again applied %d, %v, want none", n, err)
+	}
+
+	// users of two tenants, each with an alias
+	now := time.Now()
+	for _, statement := range []struct {
+		sql  string
+		args []interface{}
+	}{
+		{"INSERT INTO users (id, tenant, email, created_at, updated_at) VALUES (?, ?, ?, ?, ?)", []interface{}{"00000000-0000-0000-0000-000000000001", "default", "andy@example.com", now, now}},
+		{"INSERT INTO users (id, tenant, email, created_at, updated_at) VALUES (?, ?, ?, ?, ?)", []interface{}{"00000000-0000-0000-0000-000000000002", "acme", "john@example.com", now, now}},
+		{"INSERT INTO user_aliases (tenant, email, user_id, created_at) VALUES (?, ?, ?, ?)", []interface{}{"default", "andy@example.org", "00000000-0000-0000-0000-000000000001", now}},
+		{"INSERT INTO user_aliases (tenant, email, user_id, created_at) VALUES (?, ?, ?, ?)", []interface{}{"acme", "john@example.org", "00000000-0000-0000-0000-000000000002", now}},
+		{"INSERT INTO friends (user_id, friend_id, tenant, created_at, source) VALUES (?, ?, ?, ?, ?)", []interface{}{"00000000-0000-0000-0000-000000000001", "00000000-0000-0000-0000-000000000002", "default", now, "api"}},
+	} {
+		if err := db.Exec(statement.sql, statement.args...).Error; err != nil {
+			t.Fatalf("Failed to seed %s: %s", statement.sql, err)
+		}
+	}
+
+	// down to the schema before tenants
+	reverted := latest - 10
+	if n, err := m.Down(reverted); err != nil || n != reverted {
+		t.Fatalf("Down(%d) reverted %d, %v", reverted, n, err)
+	}
+	assertApplied(t, m, 10)
+	for _, table := range append(tenantTables011, "api_keys") {
+		if db.Dialect().HasColumn(table, "tenant") {
+			t.Errorf("%s still has tenant column", table)
+		}
+	}
+	if !db.Dialect().HasIndex("users", "uix_users_email") || db.Dialect().HasIndex("users", "uix_users_tenant_email") {
+		t.Error("users is not unique by email alone")
+	}
+	if !db.Dialect().HasIndex("friends", "idx_friends_user_id_created_at") {
+		t.Error("index of rebuilt friends table was lost")
+	}
+	if n := count(t, db, "users", "1 = 1"); n != 2 {
+		t.Errorf("got %d users after down, want 2", n)
+	}
+	if n := count(t, db, "friends", "source = ?", "api"); n != 1 {
+		t.Errorf("got %d friends after down, want 1", n)
+	}
+	// alias of tenant other than default has nowhere to go
+	if n := count(t, db, "user_aliases", "email = ?", "andy@example.org"); n != 1 || count(t, db, "user_aliases", "1 = 1") != 1 {
+		t.Error("only alias of default tenant should be kept")
+	}
+
+	// and up again, everything is back in default tenant
+	if n, err := m.Up(); err != nil || n != reverted {
+		t.Fatalf("Up after down applied %d, %v, want %d", n, err, reverted)
+	}
+	assertApplied(t, m, latest)
+	if n := count(t, db, "users", "tenant = ?", "default"); n != 2 {
+		t.Errorf("got %d users of default tenant, want 2", n)
+	}
+	if n := count(t, db, "user_aliases", "tenant = ? AND email = ?", "default", "andy@example.org"); n != 1 {
+		t.Error("alias did not come back in default tenant")
+	}
+	if !db.Dialect().HasIndex("users", "uix_users_tenant_email") {
+		t.Error("users is not unique by tenant and email")
+	}
+
+	// every migration is reversible
+	if n, err := m.Down(len(registry) + 1); err != nil || n != len(registry) {
+		t.Fatalf("Down of everything reverted %d, %v, want %d", n, err, len(registry))
+	}
+	assertApplied(t, m, 0)
+	if db.HasTable("users") || db.HasTable("friends") {
+		t.Error("tables are left after every migration is reverted")
+	}
+	if n, err := m.Up(); err != nil || n != len(registry) {
+		t.Fatalf("Up from scratch applied %d, %v, want %d", n, err, len(registry))
+	}
+}
+
+func TestDropColumn(t *testing.T) {
+	db := newSQLite(t)
+	defer db.Close()
+	for _, statement := range []string{
+		`CREATE TABLE "items" ("id" integer NOT NULL, "name" varchar(10) DEFAULT 'a,b', "size" numeric(10,2), "tag" text, PRIMARY KEY ("id"))`,
+		`CREATE INDEX idx_items_name ON "items"("name")`,
+		`CREATE INDEX idx_items_tag ON "items"(tag)`,
+		`INSERT INTO items (id, name, size, tag) VALUES (1, 'one', 1.5, 'x')`,
+	} {
+		if err := db.Exec(statement).Error; err != nil {
+			t.Fatalf("Failed to exec %s: %s", statement, err)
+		}
+	}
+
+	if err := dropColumn(db, "items", "size"); err != nil {
+		t.Fatalf("dropColumn: %s", err)
+	}
+	if db.Dialect().HasColumn("items", "size") || !db.Dialect().HasColumn("items", "name") || !db.Dialect().HasIndex("items", "idx_items_name") {
+		t.Fatal("items was not rebuilt with the rest of its columns and indexes")
+	}
+	var name string
+	if err := db.Raw("SELECT name FROM items WHERE id = 1").Row().Scan(&name); err != nil || name != "one" {
+		t.Fatalf("row after rebuild has name %q, %v", name, err)
+	}
+
+	for _, column := range []string{"tag", "name", "id", "missing"} {
+		if err := dropColumn(db, "items", column); err == nil {
+			t.Errorf("dropColumn of %s succeeded, want indexed, key or missing column refused", column)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package model
+
+import (
+	"strings"
+	"time"
+)
+
+// API key scope
+const (
+	ScopeFriendRead        = "friend:read"
+	ScopeFriendWrite       = "friend:write"
+	ScopeNotificationWrite = "notification:write"
+	// ScopeAdmin grants every other scope as well as managing API keys
+	ScopeAdmin = "admin"
+)
+
+// APIKeyScopes every scope API key may be granted
+var APIKeyScopes = []string{ScopeFriendRead, ScopeFriendWrite, ScopeNotificationWrite, ScopeAdmin}
+
+// APIKey data model, machine credential of backend service calling the API. Only SHA-256 hash of its secret is kept
+type APIKey struct {
+	BaseModel
+	// Tenant the key is bound to, key bound to none acts on tenant named by request header
+	Tenant     string `gorm:"type:varchar(64)"`
+	Name       string `gorm:"type:varchar(100);not null"`
+	SecretHash string `gorm:"type:char(64);not null"`
+	// Scopes space separated list of granted scope
+	Scopes     string `gorm:"type:varchar(255);not null"`
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
+
+// ScopeList get granted scopes
+func (k *APIKey) ScopeList() []string {
+	return strings.Fields(k.Scopes)
+}
+
+// HasScope check whether key is granted given scope, admin key is granted every scope
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.ScopeList() {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Active check whether key is neither revoked nor expired at given time
+func (k *APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
@@ -0,0 +1,39 @@
+package model
+
+// Audit action
+const (
+	AuditFriendConnected        = "friend.connected"
+	AuditFriendRemoved          = "friend.removed"
+	AuditFriendRequestSent      = "friend_request.sent"
+	AuditFriendRequestAccepted  = "friend_request.accepted"
+	AuditFriendRequestRejected  = "friend_request.rejected"
+	AuditFriendRequestCancelled = "friend_request.cancelled"
+	AuditSubscriptionCreated    = "subscription.created"
+	AuditSubscriptionRemoved    = "subscription.removed"
+	AuditBlockCreated           = "block.created"
+	AuditBlockRemoved           = "block.removed"
+	AuditEmailChanged           = "user.email_changed"
+	AuditUserMerged             = "user.merged"
+	AuditAliasAdded             = "alias.added"
+	AuditAliasRemoved           = "alias.removed"
+	AuditUserViewed             = "user.viewed"
+	AuditUserSuspended          = "user.suspended"
+	AuditUserUnsuspended        = "user.unsuspended"
+	AuditStatsViewed            = "stats.viewed"
+	AuditEventsViewed           = "audit.viewed"
+)
+
+// AuditEvent data model, append only record of action done on the social graph of a tenant
+type AuditEvent struct {
+	BaseModel
+	Tenant string `gorm:"type:varchar(64);not null"`
+	// Actor canonical email of user, apikey:<id> of service or empty for anonymous caller
+	Actor  string `gorm:"type:varchar(100);index"`
+	Action string `gorm:"type:varchar(50);not null"`
+	// Subject email of user acted upon, Target email of the other user of the relation
+	Subject   string `gorm:"type:varchar(100);index"`
+	Target    string `gorm:"type:varchar(100);index"`
+	Detail    string `gorm:"type:varchar(255)"`
+	RequestID string `gorm:"type:varchar(64)"`
+	ClientIP  string `gorm:"type:varchar(45)"`
+}
@@ -0,0 +1,27 @@
+package model
+
+import (
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+// Email delivery status
+const (
+	EmailDeliveryPending = "pending"
+	EmailDeliverySent    = "sent"
+	EmailDeliveryFailed  = "failed"
+)
+
+// EmailDelivery data model, state of a message sent by email to single recipient
+type EmailDelivery struct {
+	BaseModel
+	Tenant      string    `gorm:"type:varchar(64);not null"`
+	MessageID   uuid.UUID `gorm:"type:char(36);index;not null"`
+	RecipientID uuid.UUID `gorm:"type:char(36);not null"`
+	Email       string    `gorm:"type:varchar(100);not null"`
+	Status      string    `gorm:"type:varchar(20);index;not null"`
+	Attempts    int
+	LastError   string `gorm:"type:text"`
+	SentAt      *time.Time
+}
@@ -0,0 +1,24 @@
+package model
+
+import (
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+// Friend connection source
+const (
+	FriendSourceAPI     = "api"
+	FriendSourceImport  = "import"
+	FriendSourceRequest = "request"
+)
+
+// Friend data model, one side of mutual friend connection. Both side share the same creation time, source and label
+type Friend struct {
+	Tenant    string    `gorm:"type:varchar(64);not null"`
+	UserID    uuid.UUID `gorm:"type:char(36);primary_key"`
+	FriendID  uuid.UUID `gorm:"type:char(36);primary_key"`
+	CreatedAt time.Time
+	Source    string `gorm:"type:varchar(20);not null"`
+	Label     string `gorm:"type:varchar(100)"`
+}
@@ -0,0 +1,27 @@
+package model
+
+import (
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+// Friend request lifecycle status
+const (
+	FriendRequestPending   = "pending"
+	FriendRequestAccepted  = "accepted"
+	FriendRequestRejected  = "rejected"
+	FriendRequestCancelled = "cancelled"
+)
+
+// FriendRequest data model
+type FriendRequest struct {
+	BaseModel
+	Tenant      string    `gorm:"type:varchar(64);not null"`
+	RequestorID uuid.UUID `gorm:"type:char(36);index;not null"`
+	Requestor   User
+	TargetID    uuid.UUID `gorm:"type:char(36);index;not null"`
+	Target      User
+	Status      string `gorm:"type:varchar(20);index;not null"`
+	RespondedAt *time.Time
+}
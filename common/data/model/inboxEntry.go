@@ -0,0 +1,17 @@
+package model
+
+import (
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+// InboxEntry data model, delivery of a message into single recipient inbox
+type InboxEntry struct {
+	BaseModel
+	Tenant      string    `gorm:"type:varchar(64);not null"`
+	MessageID   uuid.UUID `gorm:"type:char(36);index;not null"`
+	Message     Message
+	RecipientID uuid.UUID `gorm:"type:char(36);index;not null"`
+	ReadAt      *time.Time
+}
@@ -0,0 +1,15 @@
+package model
+
+import "github.com/satori/go.uuid"
+
+// Message data model, a single update posted by sender
+type Message struct {
+	BaseModel
+	Tenant   string    `gorm:"type:varchar(64);not null"`
+	SenderID uuid.UUID `gorm:"type:char(36);index;not null"`
+	Sender   User
+	Text     string `gorm:"type:text"`
+	// Mentions space separated email mentioned in the text that was not a user when the message was posted, it is
+	// listed among recipients though nothing is delivered to it
+	Mentions string `gorm:"type:text"`
+}
@@ -1,10 +1,27 @@
 package model
 
+import "time"
+
 // User data model
 type User struct {
 	BaseModel
-	Email         string  `gorm:"type:varchar(100);unique_index;not null"`
+	// Tenant social graph the user belongs to, the same email is a different user in every tenant
+	Tenant      string `gorm:"type:varchar(64);unique_index:uix_users_tenant_email;not null"`
+	Email       string `gorm:"type:varchar(100);unique_index:uix_users_tenant_email;not null"`
+	DisplayName string `gorm:"type:varchar(100)"`
+	AvatarURL   string `gorm:"type:varchar(2048)"`
+	Locale      string `gorm:"type:varchar(35)"`
+	Timezone    string `gorm:"type:varchar(64)"`
+	Bio         string `gorm:"type:text"`
+	// SuspendedAt time support staff suspended the user, suspended user can not make new relation nor post update
+	SuspendedAt   *time.Time
+	SuspendReason string  `gorm:"type:varchar(255)"`
 	Friends       []*User `gorm:"many2many:friends;association_jointable_foreignkey:friend_id"`
 	Notifications []*User `gorm:"many2many:notifications;association_jointable_foreignkey:target_id"`
 	Blocks        []*User `gorm:"many2many:blocks;association_jointable_foreignkey:target_id"`
 }
+
+// Suspended check whether user is suspended by support staff
+func (u *User) Suspended() bool {
+	return u.SuspendedAt != nil
+}
@@ -0,0 +1,15 @@
+package model
+
+import (
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+// UserAlias data model, additional email address resolving to the same user as its primary email
+type UserAlias struct {
+	Tenant    string    `gorm:"type:varchar(64);primary_key"`
+	Email     string    `gorm:"type:varchar(100);primary_key"`
+	UserID    uuid.UUID `gorm:"type:char(36);index;not null"`
+	CreatedAt time.Time
+}
@@ -0,0 +1,13 @@
+package model
+
+import "github.com/satori/go.uuid"
+
+// Webhook data model, URL that receives every update delivered to its owner
+type Webhook struct {
+	BaseModel
+	Tenant string    `gorm:"type:varchar(64);not null"`
+	UserID uuid.UUID `gorm:"type:char(36);index;not null"`
+	User   User
+	URL    string `gorm:"type:varchar(2048);not null"`
+	Secret string `gorm:"type:varchar(128);not null"`
+}
@@ -0,0 +1,16 @@
+package model
+
+import "github.com/satori/go.uuid"
+
+// WebhookDeadLetter data model, webhook delivery that permanently failed after all attempts
+type WebhookDeadLetter struct {
+	BaseModel
+	Tenant      string    `gorm:"type:varchar(64);not null"`
+	WebhookID   uuid.UUID `gorm:"type:char(36);index;not null"`
+	MessageID   uuid.UUID `gorm:"type:char(36);index;not null"`
+	RecipientID uuid.UUID `gorm:"type:char(36);not null"`
+	URL         string    `gorm:"type:varchar(2048);not null"`
+	Payload     string    `gorm:"type:text"`
+	Attempts    int
+	LastError   string `gorm:"type:text"`
+}
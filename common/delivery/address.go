@@ -0,0 +1,113 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// ErrInternalAddress returned when host is or resolves to address that is not publicly routable
+var ErrInternalAddress = errors.New("address is loopback, link-local or private")
+
+// internalBlocks address ranges of the host itself and of private networks, on top of what net.IP methods cover
+var internalBlocks = parseCIDRs(
+	"0.0.0.0/8",      // this network
+	"10.0.0.0/8",     // private
+	"100.64.0.0/10",  // carrier-grade NAT
+	"172.16.0.0/12",  // private
+	"192.0.0.0/24",   // protocol assignments
+	"192.168.0.0/16", // private
+	"198.18.0.0/15",  // benchmarking
+	"240.0.0.0/4",    // reserved
+	"fc00::/7",       // unique local
+)
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	blocks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, block, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	return blocks
+}
+
+// IsPublicIP check whether ip is publicly routable, i.e. neither loopback, link-local such as cloud metadata
+// 169.254.169.254, multicast, unspecified nor in private range
+func IsPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+
+	for _, block := range internalBlocks {
+		if block.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ResolvePublic resolve host, either name or IP literal, into its addresses. Returns ErrInternalAddress when any of
+// them is not publicly routable, so name that also points inside can not be used to reach internal service
+func ResolvePublic(ctx context.Context, host string) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		if !IsPublicIP(ip) {
+			return nil, ErrInternalAddress
+		}
+		return []net.IP{ip}, nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("host %s has no address", host)
+	}
+
+	ips := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		if !IsPublicIP(addr.IP) {
+			return nil, ErrInternalAddress
+		}
+		ips = append(ips, addr.IP)
+	}
+
+	return ips, nil
+}
+
+// publicDialer dial only publicly routable address. Host is resolved and checked on every dial and connection is
+// made to the checked address itself, so DNS answer changing after the check can not redirect it inside
+func publicDialer(timeout time.Duration) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		ips, err := ResolvePublic(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ip := range ips {
+			var conn net.Conn
+			conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+		}
+
+		return nil, err
+	}
+}
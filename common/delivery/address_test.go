@@ -0,0 +1,53 @@
+package delivery
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip     string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"8.8.8.8", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"127.10.0.1", false},
+		{"::1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"172.31.255.255", false},
+		{"192.168.1.1", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"fd00::1", false},
+		{"::ffff:10.0.0.1", false},
+		{"::ffff:169.254.169.254", false},
+		{"224.0.0.1", false},
+		{"172.32.0.1", true},
+	}
+	for _, test := range tests {
+		if got := IsPublicIP(net.ParseIP(test.ip)); got != test.public {
+			t.Errorf("IsPublicIP(%s) = %v, want %v", test.ip, got, test.public)
+		}
+	}
+}
+
+func TestResolvePublic(t *testing.T) {
+	for _, host := range []string{"127.0.0.1", "169.254.169.254", "10.0.0.1", "::1", "localhost"} {
+		if _, err := ResolvePublic(context.Background(), host); err != ErrInternalAddress {
+			t.Errorf("ResolvePublic(%s) returned %v, want ErrInternalAddress", host, err)
+		}
+	}
+
+	ips, err := ResolvePublic(context.Background(), "93.184.216.34")
+	if err != nil || len(ips) != 1 || ips[0].String() != "93.184.216.34" {
+		t.Fatalf("ResolvePublic of public IP returned %v, %v", ips, err)
+	}
+}
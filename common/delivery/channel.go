@@ -0,0 +1,32 @@
+package delivery
+
+import (
+	"context"
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+// Recipient user that an update is delivered to
+type Recipient struct {
+	ID    uuid.UUID
+	Email string
+}
+
+// Update posted update along with its resolved recipients
+type Update struct {
+	Tenant     string
+	MessageID  uuid.UUID
+	Sender     string
+	Text       string
+	CreatedAt  time.Time
+	Recipients []Recipient
+}
+
+// Channel delivers posted update outside of the app. Deliver must not block the caller,
+// actual delivery happens in background.
+type Channel interface {
+	Deliver(update Update)
+	// Shutdown stop accepting update and wait for queued one to be delivered until ctx is done
+	Shutdown(ctx context.Context) error
+}
@@ -0,0 +1,243 @@
+package delivery
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmgo/common/config"
+	"fmgo/common/data"
+	"fmgo/common/data/model"
+	"fmgo/common/retry"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// SMTP connection security mode
+const (
+	TLSNone     = "none"
+	TLSStartTLS = "starttls"
+	TLSImplicit = "tls"
+)
+
+const (
+	defaultSubjectTemplate = "New update from {{.Sender}}"
+	defaultBodyTemplate    = "{{.Sender}} posted a new update:\n\n{{.Text}}\n"
+)
+
+// EmailTemplateData fields available to subject and body template
+type EmailTemplateData struct {
+	MessageID string
+	Sender    string
+	Recipient string
+	Text      string
+	CreatedAt time.Time
+}
+
+// EmailSender Channel that sends every update by email to each of its recipients
+type EmailSender struct {
+	*queue
+	store    data.GraphStore
+	config   config.SMTPConfiguration
+	envelope string
+	subject  *template.Template
+	body     *template.Template
+	backoff  time.Duration
+}
+
+// NewEmailSender initialize new EmailSender instance and start its workers, it fails when template is invalid
+func NewEmailSender(store data.GraphStore, cfg config.SMTPConfiguration) (*EmailSender, error) {
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 1
+	}
+	if cfg.TLS == "" {
+		cfg.TLS = TLSStartTLS
+	}
+	if cfg.TLS != TLSNone && cfg.TLS != TLSStartTLS && cfg.TLS != TLSImplicit {
+		return nil, fmt.Errorf("unknown smtp tls mode %s", cfg.TLS)
+	}
+	if cfg.SubjectTemplate == "" {
+		cfg.SubjectTemplate = defaultSubjectTemplate
+	}
+	if cfg.BodyTemplate == "" {
+		cfg.BodyTemplate = defaultBodyTemplate
+	}
+
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid smtp from address %s: %s", cfg.From, err)
+	}
+
+	subject, err := template.New("subject").Parse(cfg.SubjectTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := template.New("body").Parse(cfg.BodyTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &EmailSender{store: store, config: cfg, envelope: from.Address, subject: subject, body: body, backoff: time.Second}
+	s.queue = newQueue("Email", cfg.Workers, cfg.QueueSize, s.sendUpdate)
+
+	return s, nil
+}
+
+// sendUpdate record pending delivery for every recipient in tenant of the update then send them one by one
+func (s *EmailSender) sendUpdate(update Update) {
+	store := s.store.WithTenant(update.Tenant)
+	emailDeliveries := make([]model.EmailDelivery, 0)
+	for _, recipient := range update.Recipients {
+		emailDelivery := model.EmailDelivery{
+			MessageID:   update.MessageID,
+			RecipientID: recipient.ID,
+			Email:       recipient.Email,
+			Status:      model.EmailDeliveryPending,
+		}
+		if err := store.CreateEmailDelivery(&emailDelivery); err != nil {
+			glog.Errorf("Failed to create email delivery of message %s to %s: %s", update.MessageID, recipient.Email, err)
+			continue
+		}
+
+		emailDeliveries = append(emailDeliveries, emailDelivery)
+	}
+
+	for i := range emailDeliveries {
+		s.send(store, update, &emailDeliveries[i])
+	}
+}
+
+// send deliver update to single recipient with exponential backoff and save the outcome
+func (s *EmailSender) send(store data.EmailDeliveryRepository, update Update, emailDelivery *model.EmailDelivery) {
+	msg, err := s.compose(update, emailDelivery.Email)
+	if err == nil {
+		err = retry.Do(s.config.MaxAttempts, s.backoff, func() error {
+			emailDelivery.Attempts++
+			return s.sendMail(emailDelivery.Email, msg)
+		})
+	}
+
+	if err != nil {
+		glog.Errorf("Failed to send message %s to %s: %s", update.MessageID, emailDelivery.Email, err)
+		emailDelivery.Status = model.EmailDeliveryFailed
+		emailDelivery.LastError = err.Error()
+	} else {
+		now := time.Now()
+		emailDelivery.Status = model.EmailDeliverySent
+		emailDelivery.LastError = ""
+		emailDelivery.SentAt = &now
+	}
+
+	if err := store.UpdateEmailDelivery(emailDelivery); err != nil {
+		glog.Errorf("Failed to update email delivery %s: %s", emailDelivery.ID, err)
+	}
+}
+
+// compose render templates into complete RFC 5322 message
+func (s *EmailSender) compose(update Update, recipient string) ([]byte, error) {
+	data := EmailTemplateData{
+		MessageID: update.MessageID.String(),
+		Sender:    update.Sender,
+		Recipient: recipient,
+		Text:      update.Text,
+		CreatedAt: update.CreatedAt,
+	}
+
+	var subject, body bytes.Buffer
+	if err := s.subject.Execute(&subject, data); err != nil {
+		return nil, err
+	}
+	if err := s.body.Execute(&body, data); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	msg.WriteString("From: " + s.config.From + "\r\n")
+	msg.WriteString("To: " + recipient + "\r\n")
+	msg.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", strings.TrimSpace(subject.String())) + "\r\n")
+	msg.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+	msg.WriteString("\r\n")
+
+	w := quotedprintable.NewWriter(&msg)
+	if _, err := w.Write([]byte(strings.Replace(body.String(), "\n", "\r\n", -1))); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return msg.Bytes(), nil
+}
+
+// sendMail hand message to configured SMTP server
+func (s *EmailSender) sendMail(recipient string, msg []byte) error {
+	addr := net.JoinHostPort(s.config.Host, strconv.Itoa(s.config.Port))
+	timeout := time.Duration(s.config.Timeout) * time.Second
+	tlsConfig := &tls.Config{ServerName: s.config.Host}
+	dialer := &net.Dialer{Timeout: timeout}
+
+	var conn net.Conn
+	var err error
+	if s.config.TLS == TLSImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	if timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+	}
+
+	c, err := smtp.NewClient(conn, s.config.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if s.config.TLS == TLSStartTLS {
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+
+	if s.config.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(s.envelope); err != nil {
+		return err
+	}
+	if err := c.Rcpt(recipient); err != nil {
+		return err
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
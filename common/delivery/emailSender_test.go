@@ -0,0 +1,288 @@
+package delivery
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmgo/common/config"
+	"fmgo/common/data"
+	"fmgo/common/data/model"
+	"io/ioutil"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+// smtpMessage message accepted by test SMTP server
+type smtpMessage struct {
+	from string
+	to   []string
+	data []byte
+}
+
+// smtpServer minimal SMTP server on loopback, refusing every recipient in rejected with permanent error
+type smtpServer struct {
+	listener net.Listener
+	rejected map[string]bool
+	mu       sync.Mutex
+	rcpts    map[string]int
+	messages []smtpMessage
+	wg       sync.WaitGroup
+}
+
+func newSMTPServer(t *testing.T, rejected ...string) *smtpServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %s", err)
+	}
+
+	s := &smtpServer{listener: listener, rejected: make(map[string]bool), rcpts: make(map[string]int)}
+	for _, rcpt := range rejected {
+		s.rejected[rcpt] = true
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.serve(conn)
+			}()
+		}
+	}()
+
+	return s
+}
+
+// hostPort split listen address for SMTPConfiguration
+func (s *smtpServer) hostPort() (string, int) {
+	addr := s.listener.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+func (s *smtpServer) Close() {
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+// serve handle single SMTP session, just enough of RFC 5321 for net/smtp client
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 localhost ESMTP test")
+
+	var msg smtpMessage
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		arg := strings.TrimSpace(line[len(verb):])
+		switch verb {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250 localhost")
+		case "MAIL":
+			msg = smtpMessage{from: strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")}
+			tp.PrintfLine("250 OK")
+		case "RCPT":
+			rcpt := strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>")
+			s.mu.Lock()
+			s.rcpts[rcpt]++
+			s.mu.Unlock()
+			if s.rejected[rcpt] {
+				tp.PrintfLine("550 5.1.1 mailbox unavailable")
+				continue
+			}
+			msg.to = append(msg.to, rcpt)
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			tp.PrintfLine("354 end data with <CR><LF>.<CR><LF>")
+			// keep CRLF line ending as sent, only undo dot stuffing
+			var data bytes.Buffer
+			for {
+				line, err := tp.R.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(line, "."))
+			}
+			msg.data = data.Bytes()
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			tp.PrintfLine("250 OK")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("502 command not implemented")
+		}
+	}
+}
+
+// send deliver single update to given recipients through EmailSender connected to server and wait until it is done
+func send(t *testing.T, server *smtpServer, cfg config.SMTPConfiguration, text string, emails ...string) (data.GraphStore, Update) {
+	store := data.NewMemoryStore()
+	sender, err := store.FindOrCreateUser("andy@example.com")
+	if err != nil {
+		t.Fatalf("FindOrCreateUser: %s", err)
+	}
+
+	update := Update{Tenant: store.Tenant(), Sender: sender.Email, Text: text}
+	recipientIDs := make([]uuid.UUID, 0)
+	for _, email := range emails {
+		user, err := store.FindOrCreateUser(email)
+		if err != nil {
+			t.Fatalf("FindOrCreateUser: %s", err)
+		}
+		update.Recipients = append(update.Recipients, Recipient{ID: user.ID, Email: user.Email})
+		recipientIDs = append(recipientIDs, user.ID)
+	}
+
+	message := model.Message{SenderID: sender.ID, Text: text}
+	if err := store.CreateMessage(&message, recipientIDs); err != nil {
+		t.Fatalf("CreateMessage: %s", err)
+	}
+	update.MessageID, update.CreatedAt = message.ID, message.CreatedAt
+
+	cfg.Host, cfg.Port = server.hostPort()
+	cfg.TLS, cfg.From, cfg.Workers, cfg.QueueSize, cfg.Timeout = TLSNone, "fmgo <no-reply@fmgo.local>", 1, 1, 5
+	s, err := NewEmailSender(store, cfg)
+	if err != nil {
+		t.Fatalf("NewEmailSender: %s", err)
+	}
+	s.backoff = time.Millisecond
+	s.Deliver(update)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %s", err)
+	}
+
+	return store, update
+}
+
+func TestEmailSenderCompose(t *testing.T) {
+	server := newSMTPServer(t)
+	defer server.Close()
+
+	text := "Héllo = wörld, " + strings.Repeat("long line ", 10)
+	cfg := config.SMTPConfiguration{SubjectTemplate: "Mise à jour de {{.Sender}}", MaxAttempts: 1}
+	send(t, server, cfg, text, "john@example.com")
+
+	if len(server.messages) != 1 {
+		t.Fatalf("server got %d message, want 1", len(server.messages))
+	}
+	sent := server.messages[0]
+	if sent.from != "no-reply@fmgo.local" || len(sent.to) != 1 || sent.to[0] != "john@example.com" {
+		t.Fatalf("envelope is from %s to %v", sent.from, sent.to)
+	}
+
+	msg, err := mail.ReadMessage(bufio.NewReader(bytes.NewReader(sent.data)))
+	if err != nil {
+		t.Fatalf("ReadMessage: %s", err)
+	}
+	headers := map[string]string{
+		"From":                      "fmgo <no-reply@fmgo.local>",
+		"To":                        "john@example.com",
+		"Mime-Version":              "1.0",
+		"Content-Type":              "text/plain; charset=utf-8",
+		"Content-Transfer-Encoding": "quoted-printable",
+	}
+	for key, want := range headers {
+		if got := msg.Header.Get(key); got != want {
+			t.Errorf("header %s is %q, want %q", key, got, want)
+		}
+	}
+	if _, err := msg.Header.Date(); err != nil {
+		t.Errorf("header Date %q is invalid: %s", msg.Header.Get("Date"), err)
+	}
+
+	// non ASCII subject goes out as RFC 2047 encoded word
+	raw := msg.Header.Get("Subject")
+	subject, err := new(mime.WordDecoder).DecodeHeader(raw)
+	if !strings.HasPrefix(raw, "=?utf-8?q?") || err != nil || subject != "Mise à jour de andy@example.com" {
+		t.Errorf("header Subject %q decodes into %q, %v", raw, subject, err)
+	}
+
+	body, err := ioutil.ReadAll(msg.Body)
+	if err != nil {
+		t.Fatalf("ReadAll: %s", err)
+	}
+	if !bytes.Contains(body, []byte("H=C3=A9llo =3D w=C3=B6rld")) {
+		t.Errorf("body %q does not escape non ASCII and equal sign", body)
+	}
+	for _, line := range strings.Split(string(body), "\r\n") {
+		if len(line) > 76 {
+			t.Errorf("body line %q is longer than 76 characters", line)
+		}
+	}
+
+	decoded, err := ioutil.ReadAll(quotedprintable.NewReader(bytes.NewReader(body)))
+	if want := "andy@example.com posted a new update:\r\n\r\n" + text + "\r\n"; err != nil || string(decoded) != want {
+		t.Errorf("body decodes into %q, %v, want %q", decoded, err, want)
+	}
+}
+
+func TestEmailSenderDeliveryStatus(t *testing.T) {
+	server := newSMTPServer(t, "bounce@example.com")
+	defer server.Close()
+
+	cfg := config.SMTPConfiguration{MaxAttempts: 3}
+	store, update := send(t, server, cfg, "Hello World!", "john@example.com", "bounce@example.com", "jane@example.com")
+
+	if len(server.messages) != 2 {
+		t.Fatalf("server got %d message, want 2", len(server.messages))
+	}
+
+	emailDeliveries, err := store.EmailDeliveries(update.MessageID)
+	if err != nil {
+		t.Fatalf("EmailDeliveries: %s", err)
+	}
+	if len(emailDeliveries) != 3 {
+		t.Fatalf("got %d email delivery, want 3", len(emailDeliveries))
+	}
+
+	// rejected recipient is retried until attempts run out without holding back the others
+	for _, emailDelivery := range emailDeliveries {
+		switch emailDelivery.Email {
+		case "bounce@example.com":
+			if emailDelivery.Status != model.EmailDeliveryFailed || emailDelivery.Attempts != 3 || emailDelivery.SentAt != nil ||
+				!strings.Contains(emailDelivery.LastError, "550") {
+				t.Errorf("rejected delivery is %s after %d attempt with error %q", emailDelivery.Status, emailDelivery.Attempts, emailDelivery.LastError)
+			}
+			if server.rcpts[emailDelivery.Email] != 3 {
+				t.Errorf("server got %d RCPT of %s, want 3", server.rcpts[emailDelivery.Email], emailDelivery.Email)
+			}
+		default:
+			if emailDelivery.Status != model.EmailDeliverySent || emailDelivery.Attempts != 1 || emailDelivery.SentAt == nil ||
+				emailDelivery.LastError != "" {
+				t.Errorf("delivery to %s is %s after %d attempt with error %q", emailDelivery.Email, emailDelivery.Status, emailDelivery.Attempts, emailDelivery.LastError)
+			}
+		}
+		if emailDelivery.Tenant != update.Tenant || emailDelivery.MessageID != update.MessageID || emailDelivery.RecipientID == uuid.Nil {
+			t.Errorf("delivery to %s has tenant %q, message %s and recipient %s", emailDelivery.Email, emailDelivery.Tenant, emailDelivery.MessageID,
+				emailDelivery.RecipientID)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/satori/go.uuid"
+)
+
+// ErrHubClosed returned by Subscribe once the hub is shutting down
+var ErrHubClosed = errors.New("hub is closed")
+
+// Hub Channel that publishes every update to live subscriptions of its recipients within this process
+type Hub struct {
+	bufferSize    int
+	subscriptions map[uuid.UUID]map[*Subscription]bool
+	wg            sync.WaitGroup
+	mu            sync.Mutex
+	closed        bool
+}
+
+// Subscription live feed of update received by single user. Updates is closed when the hub shuts down
+type Subscription struct {
+	Updates <-chan Update
+	updates chan Update
+	userID  uuid.UUID
+	hub     *Hub
+	once    sync.Once
+}
+
+// NewHub initialize new Hub instance, bufferSize is the number of update each subscription may hold before newer one is dropped
+func NewHub(bufferSize int) *Hub {
+	return &Hub{bufferSize: bufferSize, subscriptions: make(map[uuid.UUID]map[*Subscription]bool)}
+}
+
+// Subscribe start receiving update addressed to given user, the subscription must be closed once it is no longer read
+func (h *Hub) Subscribe(userID uuid.UUID) (*Subscription, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return nil, ErrHubClosed
+	}
+
+	updates := make(chan Update, h.bufferSize)
+	s := &Subscription{Updates: updates, updates: updates, userID: userID, hub: h}
+	if h.subscriptions[userID] == nil {
+		h.subscriptions[userID] = make(map[*Subscription]bool)
+	}
+	h.subscriptions[userID][s] = true
+	h.wg.Add(1)
+
+	return s, nil
+}
+
+// Deliver publish update to every subscription of its recipients, it is dropped for subscription that is not keeping up
+func (h *Hub) Deliver(update Update) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return
+	}
+
+	for _, recipient := range update.Recipients {
+		for s := range h.subscriptions[recipient.ID] {
+			select {
+			case s.updates <- update:
+			default:
+				glog.Warningf("Stream of %s is full, message %s is not delivered", recipient.Email, update.MessageID)
+			}
+		}
+	}
+}
+
+// Shutdown close every subscription and wait for them to be released until ctx is done
+func (h *Hub) Shutdown(ctx context.Context) error {
+	h.mu.Lock()
+	if !h.closed {
+		h.closed = true
+		for userID, subscriptions := range h.subscriptions {
+			for s := range subscriptions {
+				close(s.updates)
+			}
+			delete(h.subscriptions, userID)
+		}
+	}
+	h.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		h.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stop receiving update and release the subscription, it is safe to call more than once
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		h := s.hub
+		h.mu.Lock()
+		if h.subscriptions[s.userID][s] {
+			delete(h.subscriptions[s.userID], s)
+			if len(h.subscriptions[s.userID]) == 0 {
+				delete(h.subscriptions, s.userID)
+			}
+			close(s.updates)
+		}
+		h.mu.Unlock()
+
+		h.wg.Done()
+	})
+}
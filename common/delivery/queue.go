@@ -0,0 +1,81 @@
+package delivery
+
+import (
+	"context"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+// queue buffers update and hands them to fixed number of background worker
+type queue struct {
+	name    string
+	updates chan Update
+	handle  func(update Update)
+	wg      sync.WaitGroup
+	mu      sync.RWMutex
+	closed  bool
+}
+
+// newQueue create queue and start its workers
+func newQueue(name string, workers, size int, handle func(update Update)) *queue {
+	if workers < 1 {
+		workers = 1
+	}
+
+	q := &queue{name: name, updates: make(chan Update, size), handle: handle}
+	for i := 0; i < workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+
+	return q
+}
+
+// Deliver queue update for delivery, it is dropped when the queue is full
+func (q *queue) Deliver(update Update) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		glog.Warningf("%s queue is shutting down, message %s is not delivered", q.name, update.MessageID)
+		return
+	}
+
+	select {
+	case q.updates <- update:
+	default:
+		glog.Errorf("%s queue is full, message %s is not delivered", q.name, update.MessageID)
+	}
+}
+
+// Shutdown stop accepting update and wait for queued one to be delivered until ctx is done
+func (q *queue) Shutdown(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.updates)
+	}
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (q *queue) work() {
+	defer q.wg.Done()
+
+	for update := range q.updates {
+		q.handle(update)
+	}
+}
@@ -0,0 +1,171 @@
+package delivery
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmgo/common/config"
+	"fmgo/common/data"
+	"fmgo/common/data/model"
+	"fmgo/common/retry"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/satori/go.uuid"
+)
+
+// Webhook request headers
+const (
+	SignatureHeader = "X-Fmgo-Signature"
+	EventHeader     = "X-Fmgo-Event"
+	DeliveryHeader  = "X-Fmgo-Delivery"
+)
+
+// WebhookPayload JSON body posted to webhook URL
+type WebhookPayload struct {
+	Event     string    `json:"event"`
+	MessageID string    `json:"messageId"`
+	Sender    string    `json:"sender"`
+	Recipient string    `json:"recipient"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// WebhookDispatcher Channel that posts every update to webhooks registered by its recipients
+type WebhookDispatcher struct {
+	*queue
+	store   data.GraphStore
+	config  config.WebhookConfiguration
+	client  *http.Client
+	backoff time.Duration
+}
+
+// NewWebhookDispatcher initialize new WebhookDispatcher instance and start its workers
+func NewWebhookDispatcher(store data.GraphStore, cfg config.WebhookConfiguration) *WebhookDispatcher {
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 1
+	}
+
+	timeout := time.Duration(cfg.Timeout) * time.Second
+	d := &WebhookDispatcher{
+		store:   store,
+		config:  cfg,
+		client:  &http.Client{Timeout: timeout},
+		backoff: time.Duration(cfg.InitialBackoff) * time.Second,
+	}
+	if !cfg.AllowPrivateHosts {
+		// webhook host is checked again on every connection, including redirect, as it may resolve differently
+		// than it did on register. Proxy would hide the actual host from the check, so none is used
+		d.client.Transport = &http.Transport{
+			DialContext:         publicDialer(timeout),
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConnsPerHost: cfg.Workers,
+		}
+	}
+	d.queue = newQueue("Webhook", cfg.Workers, cfg.QueueSize, d.dispatch)
+
+	return d
+}
+
+// dispatch post update to every webhook owned by its recipients in tenant of the update
+func (d *WebhookDispatcher) dispatch(update Update) {
+	store := d.store.WithTenant(update.Tenant)
+	recipients := make(map[uuid.UUID]Recipient)
+	ids := make([]uuid.UUID, 0)
+	for _, recipient := range update.Recipients {
+		recipients[recipient.ID] = recipient
+		ids = append(ids, recipient.ID)
+	}
+
+	webhooks, err := store.Webhooks(ids)
+	if err != nil {
+		glog.Errorf("Failed to get webhooks for message %s: %s", update.MessageID, err)
+		return
+	}
+
+	for _, webhook := range webhooks {
+		payload, err := json.Marshal(WebhookPayload{
+			Event:     "notification",
+			MessageID: update.MessageID.String(),
+			Sender:    update.Sender,
+			Recipient: recipients[webhook.UserID].Email,
+			Text:      update.Text,
+			CreatedAt: update.CreatedAt,
+		})
+		if err != nil {
+			glog.Errorf("Failed to encode webhook payload for message %s: %s", update.MessageID, err)
+			continue
+		}
+
+		d.post(store, webhook, update.MessageID, payload)
+	}
+}
+
+// post deliver payload to webhook with exponential backoff, it goes into dead letter once all attempts fail
+func (d *WebhookDispatcher) post(store data.WebhookRepository, webhook model.Webhook, messageID uuid.UUID, payload []byte) {
+	deliveryID := uuid.NewV4().String()
+	signature := Sign(webhook.Secret, payload)
+
+	attempts := 0
+	err := retry.Do(d.config.MaxAttempts, d.backoff, func() error {
+		attempts++
+
+		req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(payload))
+		if err != nil {
+			return retry.Stop(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(EventHeader, "notification")
+		req.Header.Set(DeliveryHeader, deliveryID)
+		req.Header.Set(SignatureHeader, signature)
+
+		resp, err := d.client.Do(req)
+		if err != nil {
+			return err
+		}
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return nil
+		}
+
+		err = fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+		// client error other than rate limiting will not succeed on retry
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return retry.Stop(err)
+		}
+
+		return err
+	})
+	if err == nil {
+		return
+	}
+
+	glog.Errorf("Failed to deliver message %s to webhook %s after %d attempt: %s", messageID, webhook.ID, attempts, err)
+	deadLetter := model.WebhookDeadLetter{
+		WebhookID:   webhook.ID,
+		MessageID:   messageID,
+		RecipientID: webhook.UserID,
+		URL:         webhook.URL,
+		Payload:     string(payload),
+		Attempts:    attempts,
+		LastError:   err.Error(),
+	}
+	if err := store.CreateWebhookDeadLetter(&deadLetter); err != nil {
+		glog.Errorf("Failed to store dead letter of message %s to webhook %s: %s", messageID, webhook.ID, err)
+	}
+}
+
+// Sign compute signature header value of payload, it is hex encoded HMAC-SHA256 using webhook secret as key
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
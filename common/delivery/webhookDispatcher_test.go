@@ -0,0 +1,212 @@
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"fmgo/common/config"
+	"fmgo/common/data"
+	"fmgo/common/data/model"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+const testSecret = "s3cret"
+
+// deadLetterStore memory store keeping dead letters for inspection, shared by store of every tenant
+type deadLetterStore struct {
+	data.GraphStore
+	deadLetters *[]model.WebhookDeadLetter
+}
+
+func (s deadLetterStore) WithTenant(tenant string) data.GraphStore {
+	return deadLetterStore{GraphStore: s.GraphStore.WithTenant(tenant), deadLetters: s.deadLetters}
+}
+
+func (s deadLetterStore) CreateWebhookDeadLetter(deadLetter *model.WebhookDeadLetter) error {
+	if err := s.GraphStore.CreateWebhookDeadLetter(deadLetter); err != nil {
+		return err
+	}
+
+	*s.deadLetters = append(*s.deadLetters, *deadLetter)
+	return nil
+}
+
+// webhookRequest request received by test webhook server
+type webhookRequest struct {
+	at     time.Time
+	header http.Header
+	body   []byte
+}
+
+// webhookServer test webhook responding with given status codes in order, the last one repeated
+type webhookServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	requests []webhookRequest
+}
+
+func newWebhookServer(statuses ...int) *webhookServer {
+	s := &webhookServer{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		s.mu.Lock()
+		status := s.statuses[len(s.statuses)-1]
+		if len(s.requests) < len(s.statuses) {
+			status = s.statuses[len(s.requests)]
+		}
+		s.requests = append(s.requests, webhookRequest{at: time.Now(), header: r.Header, body: body})
+		s.mu.Unlock()
+
+		w.WriteHeader(status)
+	}))
+
+	return s
+}
+
+// deliver register webhook of recipient at url, then deliver single update through dispatcher configured by cfg with
+// given initial backoff and wait until it is done
+func deliver(t *testing.T, cfg config.WebhookConfiguration, backoff time.Duration, url string) ([]model.WebhookDeadLetter, Update) {
+	deadLetters := make([]model.WebhookDeadLetter, 0)
+	store := deadLetterStore{GraphStore: data.NewMemoryStore(), deadLetters: &deadLetters}
+	recipient, err := store.FindOrCreateUser("john@example.com")
+	if err != nil {
+		t.Fatalf("FindOrCreateUser: %s", err)
+	}
+	if err := store.CreateWebhook(&model.Webhook{UserID: recipient.ID, URL: url, Secret: testSecret}); err != nil {
+		t.Fatalf("CreateWebhook: %s", err)
+	}
+
+	cfg.Workers, cfg.QueueSize, cfg.Timeout = 1, 1, 5
+	d := NewWebhookDispatcher(store, cfg)
+	d.backoff = backoff
+
+	update := Update{
+		Tenant:     store.Tenant(),
+		MessageID:  uuid.NewV4(),
+		Sender:     "andy@example.com",
+		Text:       "Hello World!",
+		CreatedAt:  time.Now(),
+		Recipients: []Recipient{{ID: recipient.ID, Email: recipient.Email}},
+	}
+	d.Deliver(update)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := d.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %s", err)
+	}
+
+	return deadLetters, update
+}
+
+func TestWebhookDispatcherSignature(t *testing.T) {
+	server := newWebhookServer(http.StatusOK)
+	defer server.Close()
+
+	deadLetters, update := deliver(t, config.WebhookConfiguration{MaxAttempts: 3, AllowPrivateHosts: true}, 0, server.URL)
+
+	if len(server.requests) != 1 || len(deadLetters) != 0 {
+		t.Fatalf("got %d request and %d dead letter, want 1 and 0", len(server.requests), len(deadLetters))
+	}
+
+	req := server.requests[0]
+	if want := Sign(testSecret, req.body); req.header.Get(SignatureHeader) != want {
+		t.Fatalf("signature header is %q, want %q", req.header.Get(SignatureHeader), want)
+	}
+	if !strings.HasPrefix(req.header.Get(SignatureHeader), "sha256=") || len(req.header.Get(SignatureHeader)) != len("sha256=")+64 {
+		t.Fatalf("signature header %q is not hex encoded sha256 HMAC", req.header.Get(SignatureHeader))
+	}
+	// known answer, so signature stays verifiable by client computing it on its own
+	if got := Sign("key", []byte("The quick brown fox jumps over the lazy dog")); got != "sha256=f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8" {
+		t.Fatalf("Sign of known answer is %s", got)
+	}
+
+	var payload WebhookPayload
+	if err := json.Unmarshal(req.body, &payload); err != nil {
+		t.Fatalf("payload is invalid JSON: %s", err)
+	}
+	if payload.MessageID != update.MessageID.String() || payload.Sender != "andy@example.com" || payload.Recipient != "john@example.com" || payload.Text != "Hello World!" {
+		t.Fatalf("unexpected payload %+v", payload)
+	}
+	if req.header.Get(EventHeader) != "notification" || req.header.Get(DeliveryHeader) == "" {
+		t.Fatalf("unexpected event %q and delivery %q header", req.header.Get(EventHeader), req.header.Get(DeliveryHeader))
+	}
+}
+
+func TestWebhookDispatcherRetry(t *testing.T) {
+	server := newWebhookServer(http.StatusInternalServerError, http.StatusBadGateway, http.StatusOK)
+	defer server.Close()
+
+	backoff := 50 * time.Millisecond
+	deadLetters, _ := deliver(t, config.WebhookConfiguration{MaxAttempts: 5, AllowPrivateHosts: true}, backoff, server.URL)
+
+	if len(server.requests) != 3 || len(deadLetters) != 0 {
+		t.Fatalf("got %d request and %d dead letter, want 3 and 0", len(server.requests), len(deadLetters))
+	}
+
+	// backoff doubles after every failed attempt, and every attempt is the same delivery
+	for i, wait := range []time.Duration{backoff, 2 * backoff} {
+		if gap := server.requests[i+1].at.Sub(server.requests[i].at); gap < wait {
+			t.Errorf("attempt %d came %s after the previous one, want at least %s", i+2, gap, wait)
+		}
+		if server.requests[i+1].header.Get(DeliveryHeader) != server.requests[0].header.Get(DeliveryHeader) {
+			t.Errorf("attempt %d has different delivery id", i+2)
+		}
+	}
+}
+
+func TestWebhookDispatcherDeadLetter(t *testing.T) {
+	tests := []struct {
+		status   int
+		attempts int
+	}{
+		// server error is retried until attempts run out
+		{http.StatusServiceUnavailable, 3},
+		// client error is not retried, except rate limiting
+		{http.StatusNotFound, 1},
+		{http.StatusTooManyRequests, 3},
+	}
+	for _, test := range tests {
+		server := newWebhookServer(test.status)
+		deadLetters, update := deliver(t, config.WebhookConfiguration{MaxAttempts: 3, AllowPrivateHosts: true}, time.Millisecond, server.URL)
+		server.Close()
+
+		if len(server.requests) != test.attempts || len(deadLetters) != 1 {
+			t.Fatalf("status %d: got %d request and %d dead letter, want %d and 1", test.status, len(server.requests), len(deadLetters), test.attempts)
+		}
+
+		deadLetter := deadLetters[0]
+		if deadLetter.Tenant != update.Tenant || deadLetter.MessageID != update.MessageID || deadLetter.RecipientID != update.Recipients[0].ID ||
+			deadLetter.URL != server.URL {
+			t.Errorf("status %d: dead letter %+v does not match update", test.status, deadLetter)
+		}
+		if deadLetter.Attempts != test.attempts || !strings.Contains(deadLetter.LastError, fmt.Sprintf("status %d", test.status)) || deadLetter.Payload != string(server.requests[0].body) {
+			t.Errorf("status %d: dead letter has %d attempt, error %q and payload %q", test.status, deadLetter.Attempts, deadLetter.LastError, deadLetter.Payload)
+		}
+	}
+}
+
+func TestWebhookDispatcherInternalAddress(t *testing.T) {
+	server := newWebhookServer(http.StatusOK)
+	defer server.Close()
+
+	// test server listens on loopback, which is refused at dial time unless private hosts are allowed
+	deadLetters, _ := deliver(t, config.WebhookConfiguration{MaxAttempts: 2}, time.Millisecond, server.URL)
+
+	if len(server.requests) != 0 || len(deadLetters) != 1 {
+		t.Fatalf("got %d request and %d dead letter, want 0 and 1", len(server.requests), len(deadLetters))
+	}
+	if !strings.Contains(deadLetters[0].LastError, ErrInternalAddress.Error()) {
+		t.Fatalf("dead letter error is %q", deadLetters[0].LastError)
+	}
+}
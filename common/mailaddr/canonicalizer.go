@@ -0,0 +1,89 @@
+package mailaddr
+
+import (
+	"fmgo/common/config"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// dotReplacer map full stop used by some script into ASCII dot, they separate domain label just as well
+var dotReplacer = strings.NewReplacer("。", ".", "．", ".", "｡", ".")
+
+type provider struct {
+	domain       string
+	ignoreDots   bool
+	tagSeparator string
+}
+
+// Canonicalizer bring email address into canonical form, so every spelling of the same mailbox ends up as single user
+type Canonicalizer struct {
+	caseFolding bool
+	idn         bool
+	// providers rule keyed by every domain of the provider
+	providers map[string]provider
+}
+
+// NewCanonicalizer initialize new Canonicalizer applying configured rules
+func NewCanonicalizer(cfg config.EmailConfiguration) *Canonicalizer {
+	c := &Canonicalizer{caseFolding: cfg.CaseFolding, idn: cfg.IDN, providers: make(map[string]provider)}
+	for _, p := range cfg.Providers {
+		if len(p.Domains) == 0 {
+			continue
+		}
+
+		rule := provider{domain: c.domain(p.Domains[0]), ignoreDots: p.IgnoreDots, tagSeparator: p.TagSeparator}
+		for _, domain := range p.Domains {
+			c.providers[c.domain(domain)] = rule
+		}
+	}
+
+	return c
+}
+
+// Canonicalize get canonical form of email address. Domain is lowercased and converted into punycode, local part is
+// case folded, then rule of the provider owning the domain drops tag and dots. Address without @ is only trimmed and
+// lowercased, rejecting it is up to request validation
+func (c *Canonicalizer) Canonicalize(email string) string {
+	email = strings.TrimSpace(email)
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return strings.ToLower(email)
+	}
+
+	local, domain := email[:at], c.domain(email[at+1:])
+	if c.caseFolding {
+		local = strings.ToLower(local)
+	}
+
+	if p, ok := c.providers[domain]; ok {
+		// address made only of tag, e.g. +news@gmail.com, is left alone
+		if i := strings.Index(local, p.tagSeparator); p.tagSeparator != "" && i > 0 {
+			local = local[:i]
+		}
+		if p.ignoreDots {
+			local = strings.Replace(local, ".", "", -1)
+		}
+		domain = p.domain
+	}
+
+	return local + "@" + domain
+}
+
+// domain get canonical form of domain name
+func (c *Canonicalizer) domain(domain string) string {
+	if c.idn {
+		domain = norm.NFC.String(dotReplacer.Replace(domain))
+	}
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	if !c.idn {
+		return domain
+	}
+
+	labels := strings.Split(domain, ".")
+	for i, label := range labels {
+		labels[i] = toASCII(label)
+	}
+
+	return strings.Join(labels, ".")
+}
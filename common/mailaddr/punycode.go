@@ -0,0 +1,123 @@
+package mailaddr
+
+import "bytes"
+
+// Bootstring parameter for punycode defined by RFC 3492
+const (
+	base        = 36
+	tmin        = 1
+	tmax        = 26
+	skew        = 38
+	damp        = 700
+	initialBias = 72
+	initialN    = 128
+	acePrefix   = "xn--"
+)
+
+// toASCII convert single domain label into its ASCII form, label that is already ASCII is returned as is
+func toASCII(label string) string {
+	for _, r := range label {
+		if r >= initialN {
+			if encoded, ok := encode(label); ok {
+				return acePrefix + encoded
+			}
+
+			return label
+		}
+	}
+
+	return label
+}
+
+// encode punycode encoding of s, it fails only when s is too long to be a domain label anyway
+func encode(s string) (string, bool) {
+	runes := []rune(s)
+	var output bytes.Buffer
+	for _, r := range runes {
+		if r < initialN {
+			output.WriteRune(r)
+		}
+	}
+
+	basic := output.Len()
+	handled := basic
+	if basic > 0 {
+		output.WriteByte('-')
+	}
+
+	n, delta, bias := rune(initialN), 0, initialBias
+	for handled < len(runes) {
+		m := rune(0x7FFFFFFF)
+		for _, r := range runes {
+			if r >= n && r < m {
+				m = r
+			}
+		}
+
+		if int(m-n) > (1<<31-1-delta)/(handled+1) {
+			return "", false
+		}
+		delta += int(m-n) * (handled + 1)
+		n = m
+
+		for _, r := range runes {
+			if r < n {
+				delta++
+			}
+			if r != n {
+				continue
+			}
+
+			q := delta
+			for k := base; ; k += base {
+				t := k - bias
+				if t < tmin {
+					t = tmin
+				} else if t > tmax {
+					t = tmax
+				}
+				if q < t {
+					break
+				}
+
+				output.WriteByte(digit(t + (q-t)%(base-t)))
+				q = (q - t) / (base - t)
+			}
+
+			output.WriteByte(digit(q))
+			bias = adapt(delta, handled+1, handled == basic)
+			delta = 0
+			handled++
+		}
+
+		delta++
+		n++
+	}
+
+	return output.String(), true
+}
+
+func adapt(delta, numPoints int, first bool) int {
+	if first {
+		delta /= damp
+	} else {
+		delta /= 2
+	}
+	delta += delta / numPoints
+
+	k := 0
+	for delta > ((base-tmin)*tmax)/2 {
+		delta /= base - tmin
+		k += base
+	}
+
+	return k + (base-tmin+1)*delta/(delta+skew)
+}
+
+func digit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+
+	return byte('0' + d - 26)
+}
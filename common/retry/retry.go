@@ -0,0 +1,30 @@
+package retry
+
+import "time"
+
+type stop struct {
+	error
+}
+
+// Stop wrap error so Do gives up immediately instead of trying again
+func Stop(err error) error {
+	return stop{err}
+}
+
+// Do call fn until it succeeds or attempts run out, sleep duration is doubled after every failed attempt
+func Do(attempts int, sleep time.Duration, fn func() error) error {
+	if err := fn(); err != nil {
+		if s, ok := err.(stop); ok {
+			return s.error
+		}
+
+		if attempts--; attempts > 0 {
+			time.Sleep(sleep)
+			return Do(attempts, 2*sleep, fn)
+		}
+
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package tenant
+
+import (
+	"fmgo/common/apierror"
+	"fmgo/common/auth"
+	"fmgo/common/data"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Header names tenant of anonymous request, or of request made by API key bound to no tenant
+const Header = "X-Tenant-ID"
+
+// contextKey context key of tenant of the request
+const contextKey = "fmgo.tenant"
+
+var namePattern = regexp.MustCompile("^[a-z0-9][a-z0-9_-]{0,63}$")
+
+// Valid check whether name is well formed tenant name, lowercase letters, digits, dash and underscore of at most
+// 64 characters
+func Valid(name string) bool {
+	return namePattern.MatchString(name)
+}
+
+// Middleware resolve tenant of the request from the token or API key of the caller, falling back to
+// data.DefaultTenant. It runs after authentication middleware. Tenant header is refused with 403 when it names
+// another tenant than the one the caller is bound to, so it only picks the tenant of anonymous caller and API key
+// bound to no tenant
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := strings.TrimSpace(c.GetHeader(Header))
+		if bound, ok := auth.Tenant(c); ok {
+			if name != "" && name != bound {
+				apierror.Abort(c, apierror.New(apierror.Forbidden, "Caller is not allowed to act on tenant %s", name))
+				return
+			}
+			name = bound
+		}
+
+		if name == "" {
+			name = data.DefaultTenant
+		}
+		if !Valid(name) {
+			apierror.Abort(c, apierror.New(apierror.InvalidRequest, "Tenant %s is invalid", name))
+			return
+		}
+
+		c.Set(contextKey, name)
+	}
+}
+
+// Get tenant of the request
+func Get(c *gin.Context) string {
+	if name := c.GetString(contextKey); name != "" {
+		return name
+	}
+
+	return data.DefaultTenant
+}
+
+// Store get store scoped to tenant of the request
+func Store(c *gin.Context, store data.GraphStore) data.GraphStore {
+	return store.WithTenant(Get(c))
+}
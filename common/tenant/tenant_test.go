@@ -0,0 +1,136 @@
+package tenant
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmgo/common/apierror"
+	"fmgo/common/auth"
+	"fmgo/common/config"
+	"fmgo/common/data"
+	"fmgo/common/data/model"
+	"fmgo/common/mailaddr"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const secret = "tenant-test-secret"
+
+// sign HS256 token of andy@example.com with given extra claims
+func sign(t *testing.T, claims map[string]interface{}) string {
+	payload := map[string]interface{}{"email": "andy@example.com", "exp": time.Now().Add(time.Hour).Unix()}
+	for name, value := range claims {
+		payload[name] = value
+	}
+
+	b, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("Marshal: %s", err)
+	}
+	input := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + base64.RawURLEncoding.EncodeToString(b)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(input))
+	return input + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// newRouter serve endpoint echoing tenant of the request behind authentication and tenant middleware
+func newRouter(t *testing.T, store data.GraphStore, enabled bool) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	cfg := config.AuthConfiguration{Enabled: enabled, Secret: secret}
+	authenticator, err := auth.NewAuthenticator(cfg, mailaddr.NewCanonicalizer(config.EmailConfiguration{CaseFolding: true}), store)
+	if err != nil {
+		t.Fatalf("NewAuthenticator: %s", err)
+	}
+
+	router := gin.New()
+	router.Use(apierror.Handler(), authenticator.Middleware(), Middleware())
+	router.GET("/tenant", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"tenant": Get(c)})
+	})
+	return router
+}
+
+// get request tenant endpoint with given headers, returning status and tenant or error code of the response
+func get(t *testing.T, router *gin.Engine, headers map[string]string) (int, string) {
+	req := httptest.NewRequest(http.MethodGet, "/tenant", nil)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp struct {
+		Tenant string `json:"tenant"`
+		Errors []struct {
+			Code string `json:"code"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("response is invalid JSON %q: %s", w.Body.String(), err)
+	}
+	if len(resp.Errors) > 0 {
+		return w.Code, resp.Errors[0].Code
+	}
+
+	return w.Code, resp.Tenant
+}
+
+func TestMiddleware(t *testing.T) {
+	store := data.NewMemoryStore()
+	router := newRouter(t, store, true)
+
+	bound, boundKey, err := auth.MintAPIKey("acme service", nil, nil)
+	if err != nil {
+		t.Fatalf("MintAPIKey: %s", err)
+	}
+	bound.Tenant = "acme"
+	unbound, unboundKey, err := auth.MintAPIKey("operator", nil, nil)
+	if err != nil {
+		t.Fatalf("MintAPIKey: %s", err)
+	}
+	for _, key := range []*model.APIKey{bound, unbound} {
+		if err := store.CreateAPIKey(key); err != nil {
+			t.Fatalf("CreateAPIKey: %s", err)
+		}
+	}
+
+	acmeToken := "Bearer " + sign(t, map[string]interface{}{"tenant": "acme"})
+	adminToken := "Bearer " + sign(t, map[string]interface{}{"roles": "admin"})
+	tests := []struct {
+		name    string
+		headers map[string]string
+		status  int
+		want    string
+	}{
+		{"token tenant", map[string]string{"Authorization": acmeToken}, http.StatusOK, "acme"},
+		{"token tenant named by header", map[string]string{"Authorization": acmeToken, Header: "acme"}, http.StatusOK, "acme"},
+		{"token tenant mismatch", map[string]string{"Authorization": acmeToken, Header: "beta"}, http.StatusForbidden, string(apierror.Forbidden)},
+		{"token without tenant", map[string]string{"Authorization": adminToken}, http.StatusOK, data.DefaultTenant},
+		{"token without tenant mismatch", map[string]string{"Authorization": adminToken, Header: "acme"}, http.StatusForbidden, string(apierror.Forbidden)},
+		{"bound key", map[string]string{"X-API-Key": boundKey}, http.StatusOK, "acme"},
+		{"bound key mismatch", map[string]string{"X-API-Key": boundKey, Header: "beta"}, http.StatusForbidden, string(apierror.Forbidden)},
+		{"unbound key", map[string]string{"X-API-Key": unboundKey, Header: "beta"}, http.StatusOK, "beta"},
+		{"invalid tenant", map[string]string{"X-API-Key": unboundKey, Header: "Beta!"}, http.StatusBadRequest, string(apierror.InvalidRequest)},
+	}
+	for _, test := range tests {
+		if status, got := get(t, router, test.headers); status != test.status || got != test.want {
+			t.Errorf("%s responded %d %s, want %d %s", test.name, status, got, test.status, test.want)
+		}
+	}
+}
+
+func TestMiddlewareAuthDisabled(t *testing.T) {
+	router := newRouter(t, data.NewMemoryStore(), false)
+
+	if status, got := get(t, router, map[string]string{Header: "beta"}); status != http.StatusOK || got != "beta" {
+		t.Fatalf("anonymous request naming tenant responded %d %s", status, got)
+	}
+	if status, got := get(t, router, nil); status != http.StatusOK || got != data.DefaultTenant {
+		t.Fatalf("anonymous request responded %d %s", status, got)
+	}
+}
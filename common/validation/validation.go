@@ -0,0 +1,150 @@
+package validation
+
+import (
+	"fmgo/common/apierror"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"gopkg.in/go-playground/validator.v8"
+)
+
+// emailPattern email address as accepted in browser email input
+const emailPattern = "[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*"
+
+var (
+	// EmailRegexp find email address mentioned within text
+	EmailRegexp = regexp.MustCompile(emailPattern)
+	emailOnly   = regexp.MustCompile("^" + emailPattern + "$")
+)
+
+// IsEmail check whether s is an email address in its entirety
+func IsEmail(s string) bool {
+	return emailOnly.MatchString(s)
+}
+
+// Bind deserialize request into obj using given binding and validate it. When it fails the request is aborted with
+// VALIDATION_FAILED error for every invalid field, or INVALID_REQUEST when it could not be parsed at all, and false
+// is returned so the handler can just return
+func Bind(c *gin.Context, obj interface{}, b binding.Binding) bool {
+	err := c.ShouldBindWith(obj, b)
+	if err == nil {
+		return true
+	}
+
+	ve, ok := err.(validator.ValidationErrors)
+	if !ok {
+		apierror.Abort(c, apierror.New(apierror.InvalidRequest, "Request could not be parsed: %s", err.Error()))
+		return false
+	}
+
+	errs := make([]*apierror.Error, 0, len(ve))
+	for _, fe := range ve {
+		errs = append(errs, fieldError(reflect.TypeOf(obj), fe))
+	}
+	// validation errors come in a map, keep their order stable for client
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+	apierror.Abort(c, errs...)
+	return false
+}
+
+// fieldError describe failed validation of request field in terms of request as client sent it
+func fieldError(t reflect.Type, fe *validator.FieldError) *apierror.Error {
+	path, field := fieldPath(t, fe)
+	switch fe.Tag {
+	case "required":
+		return apierror.NewField(apierror.ValidationFailed, path, "%s is required", path)
+	case "len", "min", "max":
+		return apierror.NewField(apierror.ValidationFailed, path, sizeFormat(fe.Tag, fe.Kind), path, fe.Param)
+	}
+
+	// alternatives such as eq=asc|eq=desc only report tag names, their values are read from the struct tag
+	if strings.Contains(fe.Tag, "|") && field != nil {
+		for _, rule := range strings.Split(field.Tag.Get("binding"), ",") {
+			if !strings.Contains(rule, "|") {
+				continue
+			}
+
+			var values []string
+			for _, alternative := range strings.Split(rule, "|") {
+				values = append(values, strings.TrimPrefix(alternative, "eq="))
+			}
+			return apierror.NewField(apierror.ValidationFailed, path, "%s should be one of %s", path, strings.Join(values, ", "))
+		}
+	}
+
+	return apierror.NewField(apierror.ValidationFailed, path, "%s is invalid", path)
+}
+
+// sizeFormat message format of len, min or max rule, which limits item count of list or length of string
+func sizeFormat(tag string, kind reflect.Kind) string {
+	switch kind {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return map[string]string{
+			"len": "%s should have exactly %s items",
+			"min": "%s should have at least %s items",
+			"max": "%s should have at most %s items",
+		}[tag]
+	case reflect.String:
+		return map[string]string{
+			"len": "%s should be exactly %s characters",
+			"min": "%s should be at least %s characters",
+			"max": "%s should be at most %s characters",
+		}[tag]
+	}
+
+	return map[string]string{
+		"len": "%s should be %s",
+		"min": "%s should be at least %s",
+		"max": "%s should be at most %s",
+	}[tag]
+}
+
+// fieldPath translate namespace of failed field, e.g. ConnectRequest.Friends[1], into path using json or form name
+// of every field, e.g. friends[1], along with the struct field holding the rule
+func fieldPath(t reflect.Type, fe *validator.FieldError) (string, *reflect.StructField) {
+	segments := strings.Split(fe.FieldNamespace, ".")
+	if len(segments) < 2 {
+		return fe.Field, nil
+	}
+
+	var field *reflect.StructField
+	path := make([]string, 0, len(segments)-1)
+	// first segment is the name of request struct itself
+	for _, segment := range segments[1:] {
+		name, index := segment, ""
+		if i := strings.Index(segment, "["); i >= 0 {
+			name, index = segment[:i], segment[i:]
+		}
+
+		for t != nil && (t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map) {
+			t = t.Elem()
+		}
+		field = nil
+		if t != nil && t.Kind() == reflect.Struct {
+			if f, ok := t.FieldByName(name); ok {
+				field, t, name = &f, f.Type, requestName(f)
+			} else {
+				t = nil
+			}
+		}
+
+		path = append(path, name+index)
+	}
+
+	return strings.Join(path, "."), field
+}
+
+// requestName get name of struct field as client sends it, from json tag or form tag for query string
+func requestName(f reflect.StructField) string {
+	for _, key := range []string{"json", "form"} {
+		if name := strings.Split(f.Tag.Get(key), ",")[0]; name != "" && name != "-" {
+			return name
+		}
+	}
+
+	return f.Name
+}
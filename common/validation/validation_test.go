@@ -0,0 +1,173 @@
+package validation
+
+import (
+	"encoding/json"
+	"fmgo/common/apierror"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"gopkg.in/go-playground/validator.v8"
+)
+
+type address struct {
+	City string `json:"city" binding:"required"`
+	Zip  string `json:"zip" binding:"omitempty,len=5"`
+}
+
+type contact struct {
+	Email     string    `json:"email" binding:"required,email"`
+	Addresses []address `json:"addresses" binding:"dive"`
+}
+
+type bindRequest struct {
+	Name     string    `json:"name" binding:"required,min=2"`
+	Order    string    `json:"order" binding:"omitempty,eq=asc|eq=desc"`
+	Tags     []string  `json:"tags" binding:"max=2"`
+	Contacts []contact `json:"contacts" binding:"required,dive"`
+}
+
+type bindQuery struct {
+	Limit  int    `form:"limit" binding:"max=50"`
+	Cursor string `form:"cursor" binding:"omitempty,len=4"`
+}
+
+type renderedError struct {
+	Code    string `json:"code"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// bind serve request through Bind into obj, returning status and errors of the response
+func bind(t *testing.T, req *http.Request, obj interface{}, b binding.Binding) (int, []renderedError) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(apierror.Handler())
+	router.Any("/bind", func(c *gin.Context) {
+		if !Bind(c, obj, b) {
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"success": true})
+	})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp struct {
+		Errors []renderedError `json:"errors"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("response is invalid JSON %q: %s", w.Body.String(), err)
+	}
+
+	return w.Code, resp.Errors
+}
+
+func TestBind(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []renderedError
+	}{
+		{"valid", `{"name": "andy", "order": "asc", "contacts": [{"email": "andy@example.com", "addresses": [{"city": "Jakarta", "zip": "12345"}]}]}`, nil},
+		{"missing fields", `{}`, []renderedError{
+			{"VALIDATION_FAILED", "contacts", "contacts is required"},
+			{"VALIDATION_FAILED", "name", "name is required"},
+		}},
+		{"size and alternatives", `{"name": "a", "order": "up", "tags": ["a", "b", "c"], "contacts": [{"email": "andy@example.com"}]}`, []renderedError{
+			{"VALIDATION_FAILED", "name", "name should be at least 2 characters"},
+			{"VALIDATION_FAILED", "order", "order should be one of asc, desc"},
+			{"VALIDATION_FAILED", "tags", "tags should have at most 2 items"},
+		}},
+		{"nested slice fields", `{"name": "andy", "contacts": [{"email": "andy@example.com", "addresses": [{"city": "Jakarta"}, {"zip": "123"}]}, {"email": "not an email"}]}`, []renderedError{
+			{"VALIDATION_FAILED", "contacts[0].addresses[1].city", "contacts[0].addresses[1].city is required"},
+			{"VALIDATION_FAILED", "contacts[0].addresses[1].zip", "contacts[0].addresses[1].zip should be exactly 5 characters"},
+			{"VALIDATION_FAILED", "contacts[1].email", "contacts[1].email is invalid"},
+		}},
+		{"unparsable", `{"name": `, []renderedError{{Code: "INVALID_REQUEST"}}},
+		{"wrong type", `{"name": 1}`, []renderedError{{Code: "INVALID_REQUEST"}}},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/bind", strings.NewReader(test.body))
+		req.Header.Set("Content-Type", "application/json")
+		status, errs := bind(t, req, &bindRequest{}, binding.JSON)
+
+		if test.want == nil {
+			if status != http.StatusOK {
+				t.Errorf("%s responded %d %v", test.name, status, errs)
+			}
+			continue
+		}
+		if status != http.StatusBadRequest || len(errs) != len(test.want) {
+			t.Errorf("%s responded %d %v, want %v", test.name, status, errs, test.want)
+			continue
+		}
+		for i, want := range test.want {
+			// message of unparsable request is whatever the decoder says
+			if want.Code == string(apierror.InvalidRequest) {
+				want.Message = errs[i].Message
+			}
+			if errs[i] != want {
+				t.Errorf("%s error %d is %+v, want %+v", test.name, i, errs[i], want)
+			}
+		}
+	}
+}
+
+func TestBindQuery(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/bind?limit=51&cursor=abc", nil)
+	status, errs := bind(t, req, &bindQuery{}, binding.Query)
+
+	want := []renderedError{
+		{"VALIDATION_FAILED", "cursor", "cursor should be exactly 4 characters"},
+		{"VALIDATION_FAILED", "limit", "limit should be at most 50"},
+	}
+	if status != http.StatusBadRequest || !reflect.DeepEqual(errs, want) {
+		t.Fatalf("query responded %d %v, want %v", status, errs, want)
+	}
+}
+
+func TestFieldPath(t *testing.T) {
+	tests := []struct {
+		namespace string
+		field     string
+		path      string
+		rule      string
+	}{
+		{"Limit", "Limit", "Limit", ""},
+		{"bindRequest.Name", "Name", "name", "required,min=2"},
+		{"bindRequest.Contacts[2].Addresses[0].Zip", "Zip", "contacts[2].addresses[0].zip", "omitempty,len=5"},
+		{"bindRequest.Contacts[1]", "Contacts[1]", "contacts[1]", "required,dive"},
+		// field the struct does not have keeps its name, as does everything below it
+		{"bindRequest.Unknown.Name", "Name", "Unknown.Name", ""},
+	}
+	for _, test := range tests {
+		path, field := fieldPath(reflect.TypeOf(&bindRequest{}), &validator.FieldError{FieldNamespace: test.namespace, Field: test.field})
+		rule := ""
+		if field != nil {
+			rule = field.Tag.Get("binding")
+		}
+		if path != test.path || rule != test.rule {
+			t.Errorf("fieldPath(%s) = %s with rule %q, want %s with rule %q", test.namespace, path, rule, test.path, test.rule)
+		}
+	}
+}
+
+func TestIsEmail(t *testing.T) {
+	for email, want := range map[string]bool{
+		"andy@example.com":                 true,
+		"andy.smith+tag@sub.example.co.id": true,
+		"andy":                             false,
+		"andy@":                            false,
+		"say andy@example.com":             false,
+		"andy@example.com today":           false,
+	} {
+		if IsEmail(email) != want {
+			t.Errorf("IsEmail(%q) = %t", email, !want)
+		}
+	}
+}
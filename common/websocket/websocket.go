@@ -0,0 +1,251 @@
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Frame opcode defined by RFC 6455
+const (
+	textFrame  = 0x1
+	closeFrame = 0x8
+	pingFrame  = 0x9
+	pongFrame  = 0xA
+)
+
+// Close status code defined by RFC 6455
+const (
+	CloseNormal        = 1000
+	CloseGoingAway     = 1001
+	CloseProtocolError = 1002
+)
+
+const (
+	acceptGUID        = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	maxControlPayload = 125
+	writeTimeout      = 10 * time.Second
+)
+
+// ErrBadHandshake returned by Upgrade when request is not a valid websocket opening handshake
+var ErrBadHandshake = errors.New("websocket: bad handshake")
+
+// client frame violating RFC 6455, connection is failed with protocol error close frame
+var (
+	errNotMasked       = errors.New("websocket: client frame is not masked")
+	errControlTooLarge = errors.New("websocket: control frame too large")
+)
+
+// Conn server side of websocket connection. Only sending text message is supported,
+// message sent by client is read and discarded apart from control frame.
+type Conn struct {
+	conn   net.Conn
+	rw     *bufio.ReadWriter
+	mu     sync.Mutex
+	done   chan struct{}
+	closed bool
+}
+
+// IsUpgrade check whether request asks to switch protocol to websocket
+func IsUpgrade(r *http.Request) bool {
+	return headerContains(r.Header, "Connection", "upgrade") && headerContains(r.Header, "Upgrade", "websocket")
+}
+
+// Upgrade complete websocket opening handshake and take over the underlying connection
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	key := r.Header.Get("Sec-Websocket-Key")
+	if r.Method != http.MethodGet || !IsUpgrade(r) || r.Header.Get("Sec-Websocket-Version") != "13" || key == "" {
+		return nil, ErrBadHandshake
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, errors.New("websocket: response does not support hijacking")
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	rw.WriteString("Upgrade: websocket\r\n")
+	rw.WriteString("Connection: Upgrade\r\n")
+	rw.WriteString("Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	c := &Conn{conn: conn, rw: rw, done: make(chan struct{})}
+	go c.read()
+
+	return c, nil
+}
+
+// Done closed once client closed the connection or it is broken
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// WriteText send single text message
+func (c *Conn) WriteText(data []byte) error {
+	return c.write(textFrame, data)
+}
+
+// Ping send ping frame to keep idle connection alive
+func (c *Conn) Ping() error {
+	return c.write(pingFrame, nil)
+}
+
+// Close send close frame with given status code and close the connection
+func (c *Conn) Close(code int) error {
+	c.write(closeFrame, closePayload(code))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	return c.conn.Close()
+}
+
+// write send single unmasked frame, server frame must not be masked
+func (c *Conn) write(opcode byte, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return errors.New("websocket: connection is closed")
+	}
+
+	header := []byte{0x80 | opcode, 0}
+	switch n := len(payload); {
+	case n <= 125:
+		header[1] = byte(n)
+	case n <= 0xFFFF:
+		header[1] = 126
+		header = append(header, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(n))
+	default:
+		header[1] = 127
+		header = append(header, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(n))
+	}
+
+	c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := c.rw.Write(header); err != nil {
+		return err
+	}
+	if _, err := c.rw.Write(payload); err != nil {
+		return err
+	}
+
+	return c.rw.Flush()
+}
+
+// read consume frames sent by client, answering ping and close, until the connection is gone or client breaks
+// the protocol
+func (c *Conn) read() {
+	defer close(c.done)
+
+	for {
+		opcode, payload, err := c.readFrame()
+		if err == errNotMasked || err == errControlTooLarge {
+			c.write(closeFrame, closePayload(CloseProtocolError))
+			return
+		}
+		if err != nil {
+			return
+		}
+
+		switch opcode {
+		case pingFrame:
+			c.write(pongFrame, payload)
+		case closeFrame:
+			c.write(closeFrame, payload)
+			return
+		}
+	}
+}
+
+// readFrame read single masked client frame, payload of data frame is discarded
+func (c *Conn) readFrame() (byte, []byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(c.rw, header); err != nil {
+		return 0, nil, err
+	}
+
+	opcode := header[0] & 0x0F
+	if header[1]&0x80 == 0 {
+		return 0, nil, errNotMasked
+	}
+
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		ext := make([]byte, 2)
+		if _, err := io.ReadFull(c.rw, ext); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		if _, err := io.ReadFull(c.rw, ext); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext)
+	}
+
+	mask := make([]byte, 4)
+	if _, err := io.ReadFull(c.rw, mask); err != nil {
+		return 0, nil, err
+	}
+
+	if opcode < closeFrame {
+		_, err := io.CopyN(ioutil.Discard, c.rw, int64(length))
+		return opcode, nil, err
+	}
+
+	if length > maxControlPayload {
+		return 0, nil, errControlTooLarge
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.rw, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return opcode, payload, nil
+}
+
+// closePayload body of close frame carrying status code
+func closePayload(code int) []byte {
+	payload := make([]byte, 2)
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	return payload
+}
+
+func headerContains(header http.Header, name, token string) bool {
+	for _, value := range header[http.CanonicalHeaderKey(name)] {
+		for _, v := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
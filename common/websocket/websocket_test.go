@@ -0,0 +1,252 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// sampleKey and sampleAccept handshake example of RFC 6455 section 1.3
+const (
+	sampleKey    = "dGhlIHNhbXBsZSBub25jZQ=="
+	sampleAccept = "s3pPLMBiTxaQ9kYGzzhZRbK+xOo="
+)
+
+// client raw client side of connection upgraded by server
+type client struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// dial open websocket connection to server upgrading every request, returning both of its side
+func dial(t *testing.T) (*Conn, *client, func()) {
+	conns := make(chan *Conn, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			t.Errorf("Upgrade: %s", err)
+			return
+		}
+		conns <- conn
+	}))
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial: %s", err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	req.Header.Set("Connection", "keep-alive, Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", sampleKey)
+	if err := req.Write(conn); err != nil {
+		t.Fatalf("Write: %s", err)
+	}
+
+	c := &client{conn: conn, r: bufio.NewReader(conn)}
+	resp, err := http.ReadResponse(c.r, req)
+	if err != nil {
+		t.Fatalf("ReadResponse: %s", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != sampleAccept ||
+		resp.Header.Get("Upgrade") != "websocket" || resp.Header.Get("Connection") != "Upgrade" {
+		t.Fatalf("handshake responded %d %v", resp.StatusCode, resp.Header)
+	}
+
+	return <-conns, c, func() {
+		conn.Close()
+		server.Close()
+	}
+}
+
+// send write single frame, masked as client frame must be unless told otherwise
+func (c *client) send(t *testing.T, opcode byte, payload []byte, masked bool) {
+	var frame bytes.Buffer
+	frame.WriteByte(0x80 | opcode)
+	maskBit := byte(0)
+	if masked {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		frame.WriteByte(maskBit | byte(n))
+	case n <= 0xFFFF:
+		frame.WriteByte(maskBit | 126)
+		binary.Write(&frame, binary.BigEndian, uint16(n))
+	default:
+		frame.WriteByte(maskBit | 127)
+		binary.Write(&frame, binary.BigEndian, uint64(n))
+	}
+
+	if masked {
+		mask := []byte{0x12, 0x34, 0x56, 0x78}
+		frame.Write(mask)
+		for i, b := range payload {
+			frame.WriteByte(b ^ mask[i%4])
+		}
+	} else {
+		frame.Write(payload)
+	}
+
+	if _, err := c.conn.Write(frame.Bytes()); err != nil {
+		t.Fatalf("Write: %s", err)
+	}
+}
+
+// receive read single server frame, which must be final and unmasked
+func (c *client) receive(t *testing.T) (byte, []byte) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(c.r, header); err != nil {
+		t.Fatalf("ReadFull: %s", err)
+	}
+	if header[0]&0x80 == 0 || header[1]&0x80 != 0 {
+		t.Fatalf("server frame header %x is not final or is masked", header)
+	}
+
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var n uint16
+		binary.Read(c.r, binary.BigEndian, &n)
+		length = uint64(n)
+	case 127:
+		binary.Read(c.r, binary.BigEndian, &length)
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		t.Fatalf("ReadFull: %s", err)
+	}
+
+	return header[0] & 0x0F, payload
+}
+
+// receiveClose read close frame and expect connection to end right after
+func (c *client) receiveClose(t *testing.T, code int) {
+	opcode, payload := c.receive(t)
+	if opcode != closeFrame || len(payload) != 2 || int(binary.BigEndian.Uint16(payload)) != code {
+		t.Fatalf("got frame %x %v, want close %d", opcode, payload, code)
+	}
+}
+
+// waitDone expect server side to notice connection is over
+func waitDone(t *testing.T, conn *Conn) {
+	select {
+	case <-conn.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection is not done")
+	}
+}
+
+func TestUpgradeBadHandshake(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+	}{
+		{"not GET", http.MethodPost, map[string]string{"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "13", "Sec-WebSocket-Key": sampleKey}},
+		{"no upgrade", http.MethodGet, map[string]string{"Connection": "keep-alive", "Upgrade": "websocket", "Sec-WebSocket-Version": "13", "Sec-WebSocket-Key": sampleKey}},
+		{"other protocol", http.MethodGet, map[string]string{"Connection": "Upgrade", "Upgrade": "h2c", "Sec-WebSocket-Version": "13", "Sec-WebSocket-Key": sampleKey}},
+		{"old version", http.MethodGet, map[string]string{"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "8", "Sec-WebSocket-Key": sampleKey}},
+		{"no key", http.MethodGet, map[string]string{"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "13"}},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, "/stream", nil)
+		for name, value := range test.headers {
+			req.Header.Set(name, value)
+		}
+		if _, err := Upgrade(httptest.NewRecorder(), req); err != ErrBadHandshake {
+			t.Errorf("%s: Upgrade returned %v, want ErrBadHandshake", test.name, err)
+		}
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	conn, c, done := dial(t)
+	defer done()
+
+	// every payload length encoding
+	for _, size := range []int{0, 125, 126, 0xFFFF, 0x10000} {
+		message := bytes.Repeat([]byte("a"), size)
+		if err := conn.WriteText(message); err != nil {
+			t.Fatalf("WriteText: %s", err)
+		}
+		if opcode, payload := c.receive(t); opcode != textFrame || !bytes.Equal(payload, message) {
+			t.Fatalf("got frame %x of %d bytes, want text of %d", opcode, len(payload), size)
+		}
+	}
+}
+
+func TestPingPong(t *testing.T) {
+	conn, c, done := dial(t)
+	defer done()
+
+	// data frame of client is discarded, ping is answered with the same payload
+	c.send(t, textFrame, []byte("ignored"), true)
+	c.send(t, pingFrame, []byte("hello"), true)
+	if opcode, payload := c.receive(t); opcode != pongFrame || string(payload) != "hello" {
+		t.Fatalf("got frame %x %q, want pong hello", opcode, payload)
+	}
+
+	if err := conn.Ping(); err != nil {
+		t.Fatalf("Ping: %s", err)
+	}
+	if opcode, payload := c.receive(t); opcode != pingFrame || len(payload) != 0 {
+		t.Fatalf("got frame %x %q, want empty ping", opcode, payload)
+	}
+}
+
+func TestClientClose(t *testing.T) {
+	conn, c, done := dial(t)
+	defer done()
+
+	c.send(t, closeFrame, closePayload(CloseNormal), true)
+	c.receiveClose(t, CloseNormal)
+	waitDone(t, conn)
+}
+
+func TestServerClose(t *testing.T) {
+	conn, c, done := dial(t)
+	defer done()
+
+	if err := conn.Close(CloseGoingAway); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+	c.receiveClose(t, CloseGoingAway)
+	if _, err := c.r.ReadByte(); err != io.EOF {
+		t.Fatalf("read after close returned %v, want EOF", err)
+	}
+	waitDone(t, conn)
+
+	if err := conn.WriteText([]byte("late")); err == nil {
+		t.Fatal("WriteText on closed connection succeeded")
+	}
+}
+
+func TestProtocolError(t *testing.T) {
+	tests := []struct {
+		name    string
+		opcode  byte
+		payload []byte
+		masked  bool
+	}{
+		{"unmasked data frame", textFrame, []byte("hello"), false},
+		{"unmasked control frame", pingFrame, []byte("hello"), false},
+		{"oversized ping", pingFrame, bytes.Repeat([]byte("a"), maxControlPayload+1), true},
+		{"oversized close", closeFrame, bytes.Repeat([]byte("a"), 0x10000), true},
+	}
+	for _, test := range tests {
+		conn, c, done := dial(t)
+		c.send(t, test.opcode, test.payload, test.masked)
+		c.receiveClose(t, CloseProtocolError)
+		waitDone(t, conn)
+		done()
+	}
+}
@@ -3,11 +3,21 @@ package main
 import (
 	"context"
 	"flag"
+	"fmgo/common/apierror"
+	"fmgo/common/audit"
+	"fmgo/common/auth"
 	"fmgo/common/config"
 	"fmgo/common/data"
 	"fmgo/common/data/model"
+	"fmgo/common/delivery"
+	"fmgo/common/mailaddr"
+	"fmgo/common/tenant"
+	"fmgo/module/admin"
+	"fmgo/module/apikey"
 	"fmgo/module/friend"
 	"fmgo/module/notification"
+	"fmgo/module/user"
+	"fmgo/module/webhook"
 	"fmt"
 	"net/http"
 	"os"
@@ -28,13 +38,21 @@ var (
 	runMigration           bool
 	configuration          config.Configuration
 	dbFactory              *data.DBFactory
+	graphStore             data.GraphStore
 	friendController       *friend.Controller
 	notificationController *notification.Controller
+	webhookController      *webhook.Controller
+	userController         *user.Controller
+	apiKeyController       *apikey.Controller
+	adminController        *admin.Controller
+	authenticator          *auth.Authenticator
+	deliveryChannels       []delivery.Channel
+	streamHub              *delivery.Hub
 )
 
 func init() {
 	flag.BoolVar(&showVersion, "version", false, "print version information")
-	flag.BoolVar(&runMigration, "migrate", false, "run db migration before starting app")
+	flag.BoolVar(&runMigration, "migrate", false, "run pending db migration before starting app, same as migrate up")
 	flag.Parse()
 
 	if showVersion {
@@ -51,35 +69,58 @@ func init() {
 	configuration = *cfg
 	dbFactory = data.NewDbFactory(cfg.Database)
 
-	if runMigration {
+	if flag.Arg(0) == "migrate" {
+		code := runMigrateCommand(flag.Args()[1:])
+		dbFactory.Close()
+		glog.Flush()
+		os.Exit(code)
+	}
+
+	if runMigration && cfg.Database.DbType != data.MemoryDbType {
 		glog.Info("Running db migration")
-		err := retry(5, 2*time.Second, func() error {
-			db, err := dbFactory.DBConnection()
-			if err != nil {
-				return err
-			}
-			defer db.Close()
+		if err := migrateUp(); err != nil {
+			glog.Fatalf("Failed to run db migration: %s", err)
+		}
 
-			db.AutoMigrate(&model.User{})
-			return nil
-		})
+		glog.Info("Done running db migration")
+	}
+
+	graphStore = data.NewGraphStore(dbFactory)
+	if flag.Arg(0) == "apikey" {
+		code := runAPIKeyCommand(flag.Args()[1:])
+		dbFactory.Close()
+		glog.Flush()
+		os.Exit(code)
+	}
 
+	canonicalizer := mailaddr.NewCanonicalizer(cfg.Email)
+	friendController = friend.NewController(graphStore, cfg.Graph, canonicalizer)
+	deliveryChannels = append(deliveryChannels, delivery.NewWebhookDispatcher(graphStore, cfg.Webhook))
+	if cfg.SMTP.Enabled {
+		emailSender, err := delivery.NewEmailSender(graphStore, cfg.SMTP)
 		if err != nil {
-			glog.Fatalf("Failed to open database connection after 5 retries: %s", err)
+			glog.Fatalf("Failed to setup email delivery: %s", err)
 		}
-
-		glog.Info("Done running db migration")
+		deliveryChannels = append(deliveryChannels, emailSender)
 	}
 
-	friendController = friend.NewController(dbFactory)
-	notificationController = notification.NewController(dbFactory)
+	streamHub = delivery.NewHub(cfg.Stream.BufferSize)
+	notificationController = notification.NewController(graphStore, streamHub, cfg.Stream, canonicalizer, deliveryChannels...)
+	webhookController = webhook.NewController(graphStore, cfg.Webhook, canonicalizer)
+	userController = user.NewController(graphStore, canonicalizer)
+	apiKeyController = apikey.NewController(graphStore)
+	adminController = admin.NewController(graphStore, canonicalizer)
+	authenticator, err = auth.NewAuthenticator(cfg.Auth, canonicalizer, graphStore)
+	if err != nil {
+		glog.Fatalf("Failed to setup authentication: %s", err)
+	}
 }
 
 func setupRouter() *gin.Engine {
 	router := gin.New()
 	logDuration := time.Duration(configuration.Server.LogDuration) * time.Second
 
-	router.Use(ginglog.Logger(logDuration), gin.Recovery())
+	router.Use(audit.Middleware(), ginglog.Logger(logDuration), gin.Recovery(), apierror.Handler())
 	router.Use(static.Serve("/", static.LocalFile("./public", true)))
 
 	router.GET("/ping", func(c *gin.Context) {
@@ -89,15 +130,73 @@ func setupRouter() *gin.Engine {
 		})
 	})
 
+	// every route states the scope API key needs to call it, endpoint reading or changing what only the user itself
+	// should is left to admin key
+	friendRead := auth.RequireScope(model.ScopeFriendRead)
+	friendWrite := auth.RequireScope(model.ScopeFriendWrite)
+	notificationWrite := auth.RequireScope(model.ScopeNotificationWrite)
+	admin := auth.RequireScope(model.ScopeAdmin)
+
 	api := router.Group("/api")
+	api.Use(authenticator.Middleware(), tenant.Middleware())
+	{
+		api.POST("/friend/connect", friendWrite, friendController.Connect)
+		api.POST("/friend/disconnect", friendWrite, friendController.Disconnect)
+		api.POST("/friend/list", friendRead, friendController.GetFriends)
+		api.POST("/friend/common", friendRead, friendController.GetCommons)
+		api.POST("/friend/suggestions", friendRead, friendController.GetSuggestions)
+		api.POST("/friend/path", friendRead, friendController.GetPath)
+		api.POST("/friend/request/send", friendWrite, friendController.SendRequest)
+		api.POST("/friend/request/list", friendRead, friendController.GetRequests)
+		api.POST("/friend/request/accept", friendWrite, friendController.AcceptRequest)
+		api.POST("/friend/request/reject", friendWrite, friendController.RejectRequest)
+		api.POST("/friend/request/cancel", friendWrite, friendController.CancelRequest)
+
+		api.POST("/notification/subscribe", notificationWrite, notificationController.Subscribe)
+		api.POST("/notification/unsubscribe", notificationWrite, notificationController.Unsubscribe)
+		api.POST("/notification/block", notificationWrite, notificationController.Block)
+		api.POST("/notification/unblock", notificationWrite, notificationController.Unblock)
+		api.POST("/notification/list", notificationWrite, notificationController.GetNotificationList)
+		api.POST("/notification/inbox", admin, notificationController.GetInbox)
+		api.POST("/notification/inbox/read", admin, notificationController.MarkRead)
+		api.POST("/notification/delivery", notificationWrite, notificationController.GetDeliveries)
+		api.GET("/notification/stream", admin, notificationController.Stream)
+
+		api.POST("/webhook/register", notificationWrite, webhookController.Register)
+		api.POST("/webhook/list", notificationWrite, webhookController.GetWebhooks)
+		api.POST("/webhook/remove", notificationWrite, webhookController.Remove)
+
+		api.GET("/user/profile", friendRead, userController.GetProfile)
+		api.PUT("/user/profile", admin, userController.UpdateProfile)
+		api.POST("/user/email", admin, userController.ChangeEmail)
+		api.POST("/user/merge", admin, userController.Merge)
+		api.POST("/user/alias/add", admin, userController.AddAlias)
+		api.POST("/user/alias/list", friendRead, userController.GetAliases)
+		api.POST("/user/alias/remove", admin, userController.RemoveAlias)
+	}
+
+	keyAdmin := api.Group("/admin/apikey", auth.RequireKeyScope(model.ScopeAdmin))
 	{
-		api.POST("/friend/connect", friendController.Connect)
-		api.POST("/friend/list", friendController.GetFriends)
-		api.POST("/friend/common", friendController.GetCommons)
+		keyAdmin.POST("/create", apiKeyController.Create)
+		keyAdmin.GET("/list", apiKeyController.GetAPIKeys)
+		keyAdmin.POST("/revoke", apiKeyController.Revoke)
+	}
 
-		api.POST("/notification/subscribe", notificationController.Subscribe)
-		api.POST("/notification/block", notificationController.Block)
-		api.POST("/notification/list", notificationController.GetNotificationList)
+	// support staff inspecting and fixing the graph, every action is written to audit trail
+	staff := api.Group("/admin", auth.RequireRole(auth.RoleAdmin))
+	{
+		staff.GET("/user", adminController.GetUser)
+		staff.POST("/edge/remove", adminController.RemoveEdge)
+		staff.POST("/user/suspend", adminController.Suspend)
+		staff.POST("/user/unsuspend", adminController.Unsuspend)
+		staff.GET("/stats", adminController.GetStats)
+		staff.GET("/audit", adminController.GetAuditEvents)
+		staff.GET("/diagnostics/db", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{
+				"dbType": configuration.Database.DbType,
+				"stats":  dbFactory.Stats(),
+			})
+		})
 	}
 
 	return router
@@ -134,30 +233,26 @@ func main() {
 	defer cancel()
 
 	glog.Info("Shutting down server...")
+
+	// open stream never becomes idle, close them first so server shutdown does not wait for them until timeout.
+	// It also covers websocket stream which is hijacked and no longer tracked by server
+	if err := streamHub.Shutdown(ctx); err != nil {
+		glog.Errorf("Failed to close all notification stream: %s", err)
+	}
+
 	if err := srv.Shutdown(ctx); err != nil {
 		glog.Errorf("Failed to shutdown server gracefully: %s", err)
 	}
 
-	glog.Info("Server shutted down")
-}
-
-type stop struct {
-	error
-}
-
-func retry(attempts int, sleep time.Duration, fn func() error) error {
-	if err := fn(); err != nil {
-		if s, ok := err.(stop); ok {
-			return s.error
-		}
-
-		if attempts--; attempts > 0 {
-			time.Sleep(sleep)
-			return retry(attempts, 2*sleep, fn)
+	for _, channel := range deliveryChannels {
+		if err := channel.Shutdown(ctx); err != nil {
+			glog.Errorf("Failed to deliver all queued update: %s", err)
 		}
+	}
 
-		return err
+	if err := dbFactory.Close(); err != nil {
+		glog.Errorf("Failed to close database connection: %s", err)
 	}
 
-	return nil
+	glog.Info("Server shutted down")
 }
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmgo/common/data"
+	"fmgo/common/data/migration"
+	"fmgo/common/mailaddr"
+	"fmgo/common/retry"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const migrateUsage = "usage: fmgo migrate up | down N | status"
+
+// runMigrateCommand execute migrate sub command with its arguments, returns process exit code
+func runMigrateCommand(args []string) int {
+	if configuration.Database.DbType == data.MemoryDbType {
+		fmt.Fprintln(os.Stderr, "memory database does not need migration")
+		return 1
+	}
+
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	switch args[0] {
+	case "up":
+		if err := migrateUp(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to run migration: %s\n", err)
+			return 1
+		}
+	case "down":
+		n := 1
+		if len(args) > 1 {
+			var err error
+			if n, err = strconv.Atoi(args[1]); err != nil || n < 1 {
+				fmt.Fprintln(os.Stderr, migrateUsage)
+				return 2
+			}
+		}
+
+		migrator, err := newMigrator()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open database connection: %s\n", err)
+			return 1
+		}
+
+		count, err := migrator.Down(n)
+		fmt.Printf("Reverted %d migration\n", count)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to revert migration: %s\n", err)
+			return 1
+		}
+	case "status":
+		migrator, err := newMigrator()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open database connection: %s\n", err)
+			return 1
+		}
+
+		statuses, err := migrator.Status()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read migration status: %s\n", err)
+			return 1
+		}
+
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d  %-30s  %s\n", status.Version, status.Name, appliedAt)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	return 0
+}
+
+// migrateUp apply all pending migration, waiting for database to be reachable first
+func migrateUp() error {
+	var migrator *migration.Migrator
+	err := retry.Do(5, 2*time.Second, func() error {
+		var err error
+		migrator, err = newMigrator()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	count, err := migrator.Up()
+	glog.Infof("Applied %d migration", count)
+	return err
+}
+
+func newMigrator() (*migration.Migrator, error) {
+	db, err := dbFactory.DBConnection()
+	if err != nil {
+		return nil, err
+	}
+
+	return migration.New(db, mailaddr.NewCanonicalizer(configuration.Email).Canonicalize), nil
+}
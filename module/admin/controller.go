@@ -0,0 +1,416 @@
+package admin
+
+import (
+	"fmgo/common/apierror"
+	"fmgo/common/audit"
+	"fmgo/common/data"
+	"fmgo/common/data/model"
+	"fmgo/common/mailaddr"
+	"fmgo/common/tenant"
+	"fmgo/common/validation"
+	"fmgo/module/admin/request"
+	"fmgo/module/admin/response"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/golang/glog"
+	"github.com/satori/go.uuid"
+)
+
+// forcedDetail tells relation removed by support staff apart from the one removed by its user
+const forcedDetail = "forced by support staff"
+
+const (
+	defaultAuditLimit = 100
+	// auditTimeLayout time of audit query string, e.g. 2006-01-02T15:04:05Z or with offset
+	auditTimeLayout = time.RFC3339
+)
+
+// edgeType how relation of RemoveEdgeRequest type is removed and audited
+type edgeType struct {
+	action  string
+	failure string
+	remove  func(store data.GraphStore, userID, targetID uuid.UUID) (bool, error)
+}
+
+var edgeTypes = map[string]edgeType{
+	"friend":       {model.AuditFriendRemoved, "Failed to remove friend connection", data.GraphStore.RemoveFriend},
+	"subscription": {model.AuditSubscriptionRemoved, "Failed to remove subscription", data.GraphStore.Unsubscribe},
+	"block":        {model.AuditBlockRemoved, "Failed to remove block", data.GraphStore.Unblock},
+}
+
+// Controller struct, every action is done by support staff on behalf of no user and is recorded to audit trail in the
+// same transaction
+type Controller struct {
+	store         data.GraphStore
+	canonicalizer *mailaddr.Canonicalizer
+}
+
+// NewController initialize new Admin Controller instance
+func NewController(store data.GraphStore, canonicalizer *mailaddr.Canonicalizer) *Controller {
+	return &Controller{store: store, canonicalizer: canonicalizer}
+}
+
+// GetUser action to look up user along with its alias and all of its relation
+func (ctrl *Controller) GetUser(c *gin.Context) {
+	var req request.GetUserRequest
+	if !validation.Bind(c, &req, binding.Form) {
+		return
+	}
+
+	tx, ok := ctrl.begin(c)
+	if !ok {
+		return
+	}
+
+	user, apiErr := ctrl.findUser(tx, req.Email)
+	if apiErr != nil {
+		tx.Rollback()
+		apierror.Abort(c, apiErr)
+		return
+	}
+
+	aliases, err := tx.Aliases(user.ID)
+	if err != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to get aliases of %s: %s", user.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get alias list"))
+		return
+	}
+
+	detail := response.UserDetail{
+		ID:            user.ID.String(),
+		Email:         user.Email,
+		DisplayName:   user.DisplayName,
+		Aliases:       make([]string, 0, len(aliases)),
+		SuspendedAt:   user.SuspendedAt,
+		SuspendReason: user.SuspendReason,
+		CreatedAt:     user.CreatedAt,
+	}
+	for _, alias := range aliases {
+		detail.Aliases = append(detail.Aliases, alias.Email)
+	}
+
+	relations := []struct {
+		emails  *[]string
+		get     func(userID uuid.UUID) ([]model.User, error)
+		failure string
+	}{
+		{&detail.Friends, tx.Friends, "Failed to get friend list"},
+		{&detail.Subscriptions, tx.Subscriptions, "Failed to get subscription list"},
+		{&detail.Blocks, tx.Blocks, "Failed to get block list"},
+		{&detail.BlockedBy, tx.Blockers, "Failed to get block list"},
+	}
+	for _, relation := range relations {
+		users, err := relation.get(user.ID)
+		if err != nil {
+			tx.Rollback()
+			glog.Errorf("%s of %s: %s", relation.failure, user.Email, err)
+			apierror.Abort(c, apierror.New(apierror.Internal, relation.failure))
+			return
+		}
+
+		*relation.emails = emails(users)
+	}
+
+	audit.Record(c, model.AuditUserViewed, user.Email, "", "")
+	if !audit.Commit(c, tx) {
+		return
+	}
+
+	c.JSON(http.StatusOK, response.UserResponse{Success: true, User: detail})
+}
+
+// RemoveEdge action to force remove friend connection, subscription or block regardless of who made it
+func (ctrl *Controller) RemoveEdge(c *gin.Context) {
+	var req request.RemoveEdgeRequest
+	if !validation.Bind(c, &req, binding.JSON) {
+		return
+	}
+
+	tx, ok := ctrl.begin(c)
+	if !ok {
+		return
+	}
+
+	user, apiErr := ctrl.findUser(tx, req.Email)
+	if apiErr != nil {
+		tx.Rollback()
+		apierror.Abort(c, apiErr)
+		return
+	}
+	target, apiErr := ctrl.findUser(tx, req.Target)
+	if apiErr != nil {
+		tx.Rollback()
+		apierror.Abort(c, apiErr)
+		return
+	}
+
+	edge := edgeTypes[req.Type]
+	removed, err := edge.remove(tx, user.ID, target.ID)
+	if err != nil {
+		tx.Rollback()
+		glog.Errorf("%s %s - %s: %s", edge.failure, user.Email, target.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, edge.failure))
+		return
+	}
+
+	audit.Record(c, edge.action, user.Email, target.Email, forcedDetail)
+	if !audit.Commit(c, tx) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "removed": removed})
+}
+
+// Suspend action to suspend user, who then can not make new relation nor post update until the suspension is lifted
+func (ctrl *Controller) Suspend(c *gin.Context) {
+	var req request.SuspendRequest
+	if !validation.Bind(c, &req, binding.JSON) {
+		return
+	}
+
+	tx, ok := ctrl.begin(c)
+	if !ok {
+		return
+	}
+
+	user, apiErr := ctrl.findUser(tx, req.Email)
+	if apiErr != nil {
+		tx.Rollback()
+		apierror.Abort(c, apiErr)
+		return
+	}
+	if user.Suspended() {
+		tx.Rollback()
+		apierror.Abort(c, apierror.New(apierror.Conflict, "User %s is suspended", user.Email))
+		return
+	}
+
+	now := time.Now()
+	user.SuspendedAt = &now
+	user.SuspendReason = strings.TrimSpace(req.Reason)
+	if !ctrl.updateSuspension(c, tx, user) {
+		return
+	}
+
+	audit.Record(c, model.AuditUserSuspended, user.Email, "", user.SuspendReason)
+	if !audit.Commit(c, tx) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "suspendedAt": user.SuspendedAt})
+}
+
+// Unsuspend action to lift suspension of user
+func (ctrl *Controller) Unsuspend(c *gin.Context) {
+	var req request.UnsuspendRequest
+	if !validation.Bind(c, &req, binding.JSON) {
+		return
+	}
+
+	tx, ok := ctrl.begin(c)
+	if !ok {
+		return
+	}
+
+	user, apiErr := ctrl.findUser(tx, req.Email)
+	if apiErr != nil {
+		tx.Rollback()
+		apierror.Abort(c, apiErr)
+		return
+	}
+	if !user.Suspended() {
+		tx.Rollback()
+		apierror.Abort(c, apierror.New(apierror.Conflict, "User %s is not suspended", user.Email))
+		return
+	}
+
+	user.SuspendedAt = nil
+	user.SuspendReason = ""
+	if !ctrl.updateSuspension(c, tx, user) {
+		return
+	}
+
+	audit.Record(c, model.AuditUserUnsuspended, user.Email, "", "")
+	if !audit.Commit(c, tx) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// GetStats action to get number of user, relation, pending friend request and message of the tenant
+func (ctrl *Controller) GetStats(c *gin.Context) {
+	tx, ok := ctrl.begin(c)
+	if !ok {
+		return
+	}
+
+	counts, err := tx.Counts()
+	if err != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to get graph counts: %s", err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get graph counts"))
+		return
+	}
+
+	audit.Record(c, model.AuditStatsViewed, "", "", "")
+	if !audit.Commit(c, tx) {
+		return
+	}
+
+	resp := response.StatsResponse{
+		Success: true,
+		Counts: response.CountsItem{
+			Users:                 counts.Users,
+			SuspendedUsers:        counts.SuspendedUsers,
+			Friendships:           counts.Friendships,
+			Subscriptions:         counts.Subscriptions,
+			Blocks:                counts.Blocks,
+			PendingFriendRequests: counts.PendingFriendRequests,
+			Messages:              counts.Messages,
+		},
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetAuditEvents action to get page of audit trail newest first, optionally only event given user took part in and
+// within time range
+func (ctrl *Controller) GetAuditEvents(c *gin.Context) {
+	var req request.GetAuditEventsRequest
+	if !validation.Bind(c, &req, binding.Form) {
+		return
+	}
+
+	query := data.AuditQuery{Offset: req.Offset, Limit: req.Limit}
+	if query.Limit == 0 {
+		query.Limit = defaultAuditLimit
+	}
+
+	var errs []*apierror.Error
+	for _, bound := range []struct {
+		field string
+		value string
+		time  *time.Time
+	}{{"from", req.From, &query.From}, {"to", req.To, &query.To}} {
+		if bound.value == "" {
+			continue
+		}
+
+		t, err := time.Parse(auditTimeLayout, bound.value)
+		if err != nil {
+			errs = append(errs, apierror.NewField(apierror.ValidationFailed, bound.field, "%s is invalid", bound.field))
+			continue
+		}
+		*bound.time = t
+	}
+	if len(errs) > 0 {
+		apierror.Abort(c, errs...)
+		return
+	}
+
+	tx, ok := ctrl.begin(c)
+	if !ok {
+		return
+	}
+
+	// event keeps primary email of the time, alias given in request is resolved to the one of its user
+	if req.Email != "" {
+		query.Email = ctrl.canonicalizer.Canonicalize(req.Email)
+		user, err := tx.FindUser(query.Email)
+		if err != nil && err != data.ErrNotFound {
+			tx.Rollback()
+			glog.Errorf("Failed to get user %s: %s", req.Email, err)
+			apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get user"))
+			return
+		}
+		if err == nil {
+			query.Email = user.Email
+		}
+	}
+
+	events, total, err := tx.AuditEvents(query)
+	if err != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to get audit events of %s: %s", query.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get audit events"))
+		return
+	}
+
+	audit.Record(c, model.AuditEventsViewed, query.Email, "", "")
+	if !audit.Commit(c, tx) {
+		return
+	}
+
+	items := make([]response.AuditEventItem, 0)
+	for _, event := range events {
+		items = append(items, response.AuditEventItem{
+			ID:        event.ID.String(),
+			Actor:     event.Actor,
+			Action:    event.Action,
+			Subject:   event.Subject,
+			Target:    event.Target,
+			Detail:    event.Detail,
+			RequestID: event.RequestID,
+			ClientIP:  event.ClientIP,
+			CreatedAt: event.CreatedAt,
+		})
+	}
+
+	resp := response.AuditEventListResponse{
+		Success: true,
+		Events:  items,
+		Count:   len(items),
+		Total:   total,
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// begin start transaction on store of request tenant, request is aborted and false is returned when it fails
+func (ctrl *Controller) begin(c *gin.Context) (data.GraphStore, bool) {
+	tx, err := tenant.Store(c, ctrl.store).Begin()
+	if err != nil {
+		glog.Errorf("Failed to create new db transaction: %s", err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to start new db transaction"))
+		return nil, false
+	}
+
+	return tx, true
+}
+
+func (ctrl *Controller) findUser(store data.GraphStore, email string) (*model.User, *apierror.Error) {
+	user, err := store.FindUser(ctrl.canonicalizer.Canonicalize(email))
+	if err == data.ErrNotFound {
+		return nil, apierror.New(apierror.UserNotFound, "User with email %s does not exist", email)
+	}
+	if err != nil {
+		glog.Errorf("Failed to get user %s: %s", email, err)
+		return nil, apierror.New(apierror.Internal, "Failed to get user")
+	}
+
+	return user, nil
+}
+
+func (ctrl *Controller) updateSuspension(c *gin.Context, tx data.GraphStore, user *model.User) bool {
+	if err := tx.UpdateSuspension(user); err != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to update suspension of %s: %s", user.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to update suspension"))
+		return false
+	}
+
+	return true
+}
+
+func emails(users []model.User) []string {
+	emails := make([]string, 0, len(users))
+	for _, user := range users {
+		emails = append(emails, user.Email)
+	}
+
+	return emails
+}
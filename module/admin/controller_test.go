@@ -0,0 +1,217 @@
+package admin
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmgo/common/apierror"
+	"fmgo/common/audit"
+	"fmgo/common/auth"
+	"fmgo/common/config"
+	"fmgo/common/data"
+	"fmgo/common/data/model"
+	"fmgo/common/mailaddr"
+	"fmgo/common/tenant"
+	"fmgo/module/friend"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const secret = "admin-test-secret"
+
+// newRouter serve admin endpoints behind role gate, along with friend endpoints suspension applies to, the way main does
+func newRouter(t *testing.T, store data.GraphStore) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	canonicalizer := mailaddr.NewCanonicalizer(config.EmailConfiguration{CaseFolding: true})
+	authenticator, err := auth.NewAuthenticator(config.AuthConfiguration{Enabled: true, Secret: secret}, canonicalizer, store)
+	if err != nil {
+		t.Fatalf("NewAuthenticator: %s", err)
+	}
+	ctrl := NewController(store, canonicalizer)
+	friendController := friend.NewController(store, config.GraphConfiguration{}, canonicalizer)
+
+	router := gin.New()
+	router.Use(audit.Middleware(), apierror.Handler())
+	api := router.Group("/api", authenticator.Middleware(), tenant.Middleware())
+	api.POST("/friend/connect", friendController.Connect)
+	api.POST("/friend/request/send", friendController.SendRequest)
+	staff := api.Group("/admin", auth.RequireRole(auth.RoleAdmin))
+	staff.GET("/user", ctrl.GetUser)
+	staff.POST("/user/suspend", ctrl.Suspend)
+	staff.POST("/user/unsuspend", ctrl.Unsuspend)
+	staff.GET("/stats", ctrl.GetStats)
+	staff.GET("/audit", ctrl.GetAuditEvents)
+	return router
+}
+
+// bearer sign HS256 bearer token of given email and roles
+func bearer(t *testing.T, email, roles string) string {
+	payload, err := json.Marshal(map[string]interface{}{"email": email, "roles": roles, "exp": time.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatalf("Marshal: %s", err)
+	}
+	input := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(input))
+	return "Bearer " + input + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// call send request with given header, returning status and decoded response body
+func call(t *testing.T, router *gin.Engine, method, path, header, value, body string) (int, map[string]interface{}) {
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	if header != "" {
+		req.Header.Set(header, value)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%s responded with invalid JSON %q: %s", path, w.Body.String(), err)
+	}
+
+	return w.Code, resp
+}
+
+// errorCode get code of the first error in failed response
+func errorCode(resp map[string]interface{}) string {
+	errs, _ := resp["errors"].([]interface{})
+	if len(errs) == 0 {
+		return ""
+	}
+
+	code, _ := errs[0].(map[string]interface{})["code"].(string)
+	return code
+}
+
+func TestRequireRole(t *testing.T) {
+	store := data.NewMemoryStore()
+	router := newRouter(t, store)
+
+	keys := make(map[string]string)
+	for _, scope := range []string{model.ScopeAdmin, model.ScopeFriendWrite} {
+		key, s, err := auth.MintAPIKey(scope, []string{scope}, nil)
+		if err != nil {
+			t.Fatalf("MintAPIKey: %s", err)
+		}
+		if err := store.CreateAPIKey(key); err != nil {
+			t.Fatalf("CreateAPIKey: %s", err)
+		}
+		keys[scope] = s
+	}
+
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		status int
+		code   string
+	}{
+		{"staff", "Authorization", bearer(t, "staff@example.com", "support admin"), http.StatusOK, ""},
+		{"user", "Authorization", bearer(t, "andy@example.com", ""), http.StatusForbidden, string(apierror.Forbidden)},
+		{"user of another role", "Authorization", bearer(t, "andy@example.com", "support"), http.StatusForbidden, string(apierror.Forbidden)},
+		{"admin key", "X-API-Key", keys[model.ScopeAdmin], http.StatusOK, ""},
+		{"key without admin scope", "X-API-Key", keys[model.ScopeFriendWrite], http.StatusForbidden, string(apierror.Forbidden)},
+		{"anonymous", "", "", http.StatusUnauthorized, string(apierror.Unauthenticated)},
+	}
+	for _, test := range tests {
+		status, resp := call(t, router, http.MethodGet, "/api/admin/stats", test.header, test.value, "")
+		if status != test.status || errorCode(resp) != test.code {
+			t.Errorf("stats by %s responded %d %v, want %d %s", test.name, status, resp, test.status, test.code)
+		}
+	}
+
+	// refused request leaves no trace in audit trail, only the allowed lookups do
+	events, _, err := store.AuditEvents(data.AuditQuery{Limit: 10})
+	if err != nil {
+		t.Fatalf("AuditEvents: %s", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d audit events, want one per allowed stats lookup", len(events))
+	}
+}
+
+func TestSuspend(t *testing.T) {
+	store := data.NewMemoryStore()
+	router := newRouter(t, store)
+	staff := bearer(t, "staff@example.com", "admin")
+	andy := bearer(t, "andy@example.com", "")
+	john := bearer(t, "john@example.com", "")
+	for _, email := range []string{"andy@example.com", "john@example.com"} {
+		if _, err := store.FindOrCreateUser(email); err != nil {
+			t.Fatalf("FindOrCreateUser: %s", err)
+		}
+	}
+
+	if status, resp := call(t, router, http.MethodPost, "/api/admin/user/suspend", "Authorization", andy, `{"email": "john@example.com", "reason": "spam"}`); status != http.StatusForbidden {
+		t.Fatalf("suspend by user responded %d %v", status, resp)
+	}
+	status, resp := call(t, router, http.MethodPost, "/api/admin/user/suspend", "Authorization", staff, `{"email": "John@Example.com", "reason": " spam "}`)
+	if status != http.StatusOK || resp["suspendedAt"] == nil {
+		t.Fatalf("suspend responded %d %v", status, resp)
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		token  string
+		body   string
+		status int
+		code   string
+	}{
+		{http.MethodPost, "/api/admin/user/suspend", staff, `{"email": "john@example.com", "reason": "again"}`, http.StatusConflict, string(apierror.Conflict)},
+		{http.MethodPost, "/api/admin/user/suspend", staff, `{"email": "nobody@example.com", "reason": "spam"}`, http.StatusNotFound, string(apierror.UserNotFound)},
+		{http.MethodPost, "/api/admin/user/unsuspend", staff, `{"email": "andy@example.com"}`, http.StatusConflict, string(apierror.Conflict)},
+		{http.MethodPost, "/api/friend/connect", andy, `{"friends": ["andy@example.com", "john@example.com"]}`, http.StatusForbidden, string(apierror.Suspended)},
+		{http.MethodPost, "/api/friend/connect", john, `{"friends": ["john@example.com", "andy@example.com"]}`, http.StatusForbidden, string(apierror.Suspended)},
+		{http.MethodPost, "/api/friend/request/send", andy, `{"requestor": "andy@example.com", "target": "john@example.com"}`, http.StatusForbidden, string(apierror.Suspended)},
+		{http.MethodPost, "/api/friend/request/send", john, `{"requestor": "john@example.com", "target": "andy@example.com"}`, http.StatusForbidden, string(apierror.Suspended)},
+	}
+	for _, test := range tests {
+		status, resp := call(t, router, test.method, test.path, "Authorization", test.token, test.body)
+		if status != test.status || errorCode(resp) != test.code {
+			t.Errorf("%s %s responded %d %v, want %d %s", test.path, test.body, status, resp, test.status, test.code)
+		}
+	}
+
+	status, resp = call(t, router, http.MethodGet, "/api/admin/user?email=john@example.com", "Authorization", staff, "")
+	if detail, _ := resp["user"].(map[string]interface{}); status != http.StatusOK || detail["suspendReason"] != "spam" || detail["suspendedAt"] == nil {
+		t.Fatalf("user lookup responded %d %v", status, resp)
+	}
+
+	// lifting suspension lets the user relate again
+	if status, resp := call(t, router, http.MethodPost, "/api/admin/user/unsuspend", "Authorization", staff, `{"email": "john@example.com"}`); status != http.StatusOK {
+		t.Fatalf("unsuspend responded %d %v", status, resp)
+	}
+	if status, resp := call(t, router, http.MethodPost, "/api/friend/request/send", "Authorization", john, `{"requestor": "john@example.com", "target": "andy@example.com"}`); status != http.StatusOK {
+		t.Fatalf("send after unsuspend responded %d %v", status, resp)
+	}
+
+	status, resp = call(t, router, http.MethodGet, "/api/admin/audit?email=john@example.com", "Authorization", staff, "")
+	if status != http.StatusOK {
+		t.Fatalf("audit responded %d %v", status, resp)
+	}
+	actions := make(map[string]string)
+	events, _ := resp["events"].([]interface{})
+	for _, event := range events {
+		e := event.(map[string]interface{})
+		action, _ := e["action"].(string)
+		actor, _ := e["actor"].(string)
+		actions[action] = actor
+	}
+	for _, action := range []string{model.AuditUserSuspended, model.AuditUserUnsuspended, model.AuditFriendRequestSent} {
+		if _, ok := actions[action]; !ok {
+			t.Errorf("audit trail of john %v misses %s", actions, action)
+		}
+	}
+	if actions[model.AuditUserSuspended] != "staff@example.com" {
+		t.Errorf("suspension was recorded as done by %q", actions[model.AuditUserSuspended])
+	}
+}
@@ -0,0 +1,10 @@
+package request
+
+// GetAuditEventsRequest model, From and To are RFC 3339 time bounding the range, From inclusive and To exclusive
+type GetAuditEventsRequest struct {
+	Email  string `form:"email" binding:"omitempty,email"`
+	From   string `form:"from"`
+	To     string `form:"to"`
+	Offset int    `form:"offset" binding:"omitempty,min=0"`
+	Limit  int    `form:"limit" binding:"omitempty,min=1,max=1000"`
+}
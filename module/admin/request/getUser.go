@@ -0,0 +1,6 @@
+package request
+
+// GetUserRequest model
+type GetUserRequest struct {
+	Email string `form:"email" binding:"required,email"`
+}
@@ -0,0 +1,9 @@
+package request
+
+// RemoveEdgeRequest model, friend connection is removed on both side while subscription and block only from Email to
+// Target
+type RemoveEdgeRequest struct {
+	Email  string `json:"email" binding:"required,email"`
+	Target string `json:"target" binding:"required,email"`
+	Type   string `json:"type" binding:"required,eq=friend|eq=subscription|eq=block"`
+}
@@ -0,0 +1,12 @@
+package request
+
+// SuspendRequest model
+type SuspendRequest struct {
+	Email  string `json:"email" binding:"required,email"`
+	Reason string `json:"reason" binding:"required,max=255"`
+}
+
+// UnsuspendRequest model
+type UnsuspendRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
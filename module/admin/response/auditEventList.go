@@ -0,0 +1,24 @@
+package response
+
+import "time"
+
+// AuditEventListResponse model
+type AuditEventListResponse struct {
+	Success bool             `json:"success"`
+	Events  []AuditEventItem `json:"events"`
+	Count   int              `json:"count"`
+	Total   int              `json:"total"`
+}
+
+// AuditEventItem model
+type AuditEventItem struct {
+	ID        string    `json:"id"`
+	Actor     string    `json:"actor"`
+	Action    string    `json:"action"`
+	Subject   string    `json:"subject,omitempty"`
+	Target    string    `json:"target,omitempty"`
+	Detail    string    `json:"detail,omitempty"`
+	RequestID string    `json:"requestId"`
+	ClientIP  string    `json:"clientIp"`
+	CreatedAt time.Time `json:"createdAt"`
+}
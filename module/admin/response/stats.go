@@ -0,0 +1,18 @@
+package response
+
+// StatsResponse model
+type StatsResponse struct {
+	Success bool       `json:"success"`
+	Counts  CountsItem `json:"counts"`
+}
+
+// CountsItem model
+type CountsItem struct {
+	Users                 int `json:"users"`
+	SuspendedUsers        int `json:"suspendedUsers"`
+	Friendships           int `json:"friendships"`
+	Subscriptions         int `json:"subscriptions"`
+	Blocks                int `json:"blocks"`
+	PendingFriendRequests int `json:"pendingFriendRequests"`
+	Messages              int `json:"messages"`
+}
@@ -0,0 +1,24 @@
+package response
+
+import "time"
+
+// UserResponse model
+type UserResponse struct {
+	Success bool       `json:"success"`
+	User    UserDetail `json:"user"`
+}
+
+// UserDetail model, every relation of the user in either direction listed by email
+type UserDetail struct {
+	ID            string     `json:"id"`
+	Email         string     `json:"email"`
+	DisplayName   string     `json:"displayName"`
+	Aliases       []string   `json:"aliases"`
+	SuspendedAt   *time.Time `json:"suspendedAt"`
+	SuspendReason string     `json:"suspendReason,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	Friends       []string   `json:"friends"`
+	Subscriptions []string   `json:"subscriptions"`
+	Blocks        []string   `json:"blocks"`
+	BlockedBy     []string   `json:"blockedBy"`
+}
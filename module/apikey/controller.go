@@ -0,0 +1,157 @@
+package apikey
+
+import (
+	"fmgo/common/apierror"
+	"fmgo/common/auth"
+	"fmgo/common/data"
+	"fmgo/common/tenant"
+	"fmgo/common/validation"
+	"fmgo/module/apikey/request"
+	"fmgo/module/apikey/response"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/golang/glog"
+	"github.com/satori/go.uuid"
+)
+
+// Controller struct
+type Controller struct {
+	store data.GraphStore
+}
+
+// NewController initialize new API key Controller instance
+func NewController(store data.GraphStore) *Controller {
+	return &Controller{store: store}
+}
+
+// Create action to mint new API key for backend service, the key is only returned once
+func (ctrl *Controller) Create(c *gin.Context) {
+	var req request.CreateAPIKeyRequest
+	if !validation.Bind(c, &req, binding.JSON) {
+		return
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		apierror.Abort(c, apierror.NewField(apierror.ValidationFailed, "expiresAt", "%s must be in the future", "expiresAt"))
+		return
+	}
+	if req.Tenant != "" && !tenant.Valid(req.Tenant) {
+		apierror.Abort(c, apierror.NewField(apierror.ValidationFailed, "tenant", "%s is invalid", "tenant"))
+		return
+	}
+
+	// key bound to tenant only mints key of the same tenant
+	keyTenant := req.Tenant
+	if bound := callerTenant(c); bound != "" {
+		if keyTenant != "" && keyTenant != bound {
+			apierror.Abort(c, apierror.New(apierror.Forbidden, "API key is not allowed to act on tenant %s", keyTenant))
+			return
+		}
+		keyTenant = bound
+	}
+
+	key, secret, err := auth.MintAPIKey(req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		glog.Errorf("Failed to generate API key: %s", err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to generate API key"))
+		return
+	}
+	key.Tenant = keyTenant
+
+	if err := ctrl.store.CreateAPIKey(key); err != nil {
+		glog.Errorf("Failed to create API key %s: %s", req.Name, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to create API key"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "id": key.ID.String(), "key": secret, "tenant": key.Tenant, "scopes": key.ScopeList(), "expiresAt": key.ExpiresAt})
+}
+
+// GetAPIKeys action to get every API key, revoked and expired one included. Key bound to tenant only sees key of
+// the same tenant
+func (ctrl *Controller) GetAPIKeys(c *gin.Context) {
+	keys, err := ctrl.store.APIKeys()
+	if err != nil {
+		glog.Errorf("Failed to get API keys: %s", err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get API key list"))
+		return
+	}
+
+	bound := callerTenant(c)
+	items := make([]response.APIKeyItem, 0)
+	for _, key := range keys {
+		if bound != "" && key.Tenant != bound {
+			continue
+		}
+
+		items = append(items, response.APIKeyItem{
+			ID:         key.ID.String(),
+			Name:       key.Name,
+			Tenant:     key.Tenant,
+			Scopes:     key.ScopeList(),
+			ExpiresAt:  key.ExpiresAt,
+			LastUsedAt: key.LastUsedAt,
+			RevokedAt:  key.RevokedAt,
+			CreatedAt:  key.CreatedAt,
+		})
+	}
+
+	resp := response.APIKeyListResponse{
+		Success: true,
+		APIKeys: items,
+		Count:   len(items),
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// Revoke action to revoke API key, it is refused from then on. Key bound to tenant only revokes key of the same tenant
+func (ctrl *Controller) Revoke(c *gin.Context) {
+	var req request.RevokeAPIKeyRequest
+	if !validation.Bind(c, &req, binding.JSON) {
+		return
+	}
+
+	keyID, err := uuid.FromString(req.ID)
+	if err != nil {
+		apierror.Abort(c, apierror.NewField(apierror.ValidationFailed, "id", "%s is invalid", "id"))
+		return
+	}
+
+	if bound := callerTenant(c); bound != "" {
+		key, err := ctrl.store.FindAPIKey(keyID)
+		if err == data.ErrNotFound || (err == nil && key.Tenant != bound) {
+			apierror.Abort(c, apierror.New(apierror.NotFound, "API key does not exist"))
+			return
+		}
+		if err != nil {
+			glog.Errorf("Failed to get API key %s: %s", keyID, err)
+			apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get API key"))
+			return
+		}
+	}
+
+	revoked, err := ctrl.store.RevokeAPIKey(keyID)
+	if err != nil {
+		glog.Errorf("Failed to revoke API key %s: %s", keyID, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to revoke API key"))
+		return
+	}
+	if !revoked {
+		apierror.Abort(c, apierror.New(apierror.NotFound, "API key does not exist"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// callerTenant get tenant API key of the caller is bound to, empty when it manages key of every tenant
+func callerTenant(c *gin.Context) string {
+	if key := auth.APIKey(c); key != nil {
+		return key.Tenant
+	}
+
+	return ""
+}
@@ -0,0 +1,205 @@
+package apikey
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmgo/common/apierror"
+	"fmgo/common/auth"
+	"fmgo/common/config"
+	"fmgo/common/data"
+	"fmgo/common/data/model"
+	"fmgo/common/mailaddr"
+	"fmgo/common/tenant"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newRouter serve API key endpoints the way main does, behind API key authentication
+func newRouter(t *testing.T, store data.GraphStore) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	authenticator, err := auth.NewAuthenticator(config.AuthConfiguration{}, mailaddr.NewCanonicalizer(config.EmailConfiguration{}), store)
+	if err != nil {
+		t.Fatalf("NewAuthenticator: %s", err)
+	}
+	ctrl := NewController(store)
+
+	router := gin.New()
+	router.Use(apierror.Handler(), authenticator.Middleware(), tenant.Middleware())
+	keyAdmin := router.Group("/admin/apikey", auth.RequireKeyScope(model.ScopeAdmin))
+	keyAdmin.POST("/create", ctrl.Create)
+	keyAdmin.GET("/list", ctrl.GetAPIKeys)
+	keyAdmin.POST("/revoke", ctrl.Revoke)
+	return router
+}
+
+// mint store API key of given tenant and scopes directly, the way the command line does
+func mint(t *testing.T, store data.GraphStore, tenantName string, scopes ...string) (*model.APIKey, string) {
+	key, s, err := auth.MintAPIKey("service", scopes, nil)
+	if err != nil {
+		t.Fatalf("MintAPIKey: %s", err)
+	}
+	key.Tenant = tenantName
+	if err := store.CreateAPIKey(key); err != nil {
+		t.Fatalf("CreateAPIKey: %s", err)
+	}
+
+	return key, s
+}
+
+// call send request authenticated by API key, returning status and decoded response body
+func call(t *testing.T, router *gin.Engine, method, path, key string, body interface{}) (int, map[string]interface{}) {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatalf("Encode: %s", err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", key)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%s responded with invalid JSON %q: %s", path, w.Body.String(), err)
+	}
+
+	return w.Code, resp
+}
+
+// errorCode get code of the first error in failed response
+func errorCode(resp map[string]interface{}) string {
+	errs, _ := resp["errors"].([]interface{})
+	if len(errs) == 0 {
+		return ""
+	}
+
+	code, _ := errs[0].(map[string]interface{})["code"].(string)
+	return code
+}
+
+// listed get id of every key listed by the caller
+func listed(t *testing.T, router *gin.Engine, key string) []string {
+	status, resp := call(t, router, http.MethodGet, "/admin/apikey/list", key, nil)
+	if status != http.StatusOK {
+		t.Fatalf("list responded %d %v", status, resp)
+	}
+
+	ids := make([]string, 0)
+	items, _ := resp["apiKeys"].([]interface{})
+	for _, item := range items {
+		ids = append(ids, item.(map[string]interface{})["id"].(string))
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestCreate(t *testing.T) {
+	store := data.NewMemoryStore()
+	router := newRouter(t, store)
+	_, operator := mint(t, store, "", model.ScopeAdmin)
+
+	status, resp := call(t, router, http.MethodPost, "/admin/apikey/create", operator,
+		map[string]interface{}{"name": "acme admin", "tenant": "acme", "scopes": []string{model.ScopeAdmin}})
+	if status != http.StatusOK || resp["tenant"] != "acme" {
+		t.Fatalf("create responded %d %v", status, resp)
+	}
+
+	// minted key works right away, only within its tenant
+	minted, _ := resp["key"].(string)
+	if status, resp := call(t, router, http.MethodGet, "/admin/apikey/list", minted, nil); status != http.StatusOK {
+		t.Fatalf("list by minted key responded %d %v", status, resp)
+	}
+
+	past := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name   string
+		key    string
+		body   map[string]interface{}
+		status int
+		code   string
+	}{
+		{"expiry in the past", operator, map[string]interface{}{"name": "old", "scopes": []string{model.ScopeFriendRead}, "expiresAt": past}, http.StatusBadRequest, string(apierror.ValidationFailed)},
+		{"invalid tenant", operator, map[string]interface{}{"name": "bad", "tenant": "Acme!", "scopes": []string{model.ScopeFriendRead}}, http.StatusBadRequest, string(apierror.ValidationFailed)},
+		{"unknown scope", operator, map[string]interface{}{"name": "bad", "scopes": []string{"root"}}, http.StatusBadRequest, string(apierror.ValidationFailed)},
+		{"bound key minting for another tenant", minted, map[string]interface{}{"name": "beta", "tenant": "beta", "scopes": []string{model.ScopeFriendRead}}, http.StatusForbidden, string(apierror.Forbidden)},
+	}
+	for _, test := range tests {
+		status, resp := call(t, router, http.MethodPost, "/admin/apikey/create", test.key, test.body)
+		if status != test.status || errorCode(resp) != test.code {
+			t.Errorf("%s responded %d %v, want %d %s", test.name, status, resp, test.status, test.code)
+		}
+	}
+
+	// key minted by bound key is bound to the same tenant
+	status, resp = call(t, router, http.MethodPost, "/admin/apikey/create", minted,
+		map[string]interface{}{"name": "acme reader", "scopes": []string{model.ScopeFriendRead}})
+	if status != http.StatusOK || resp["tenant"] != "acme" {
+		t.Fatalf("create by bound key responded %d %v", status, resp)
+	}
+}
+
+func TestRequireAdminKey(t *testing.T) {
+	store := data.NewMemoryStore()
+	router := newRouter(t, store)
+	_, reader := mint(t, store, "", model.ScopeFriendRead)
+
+	if status, resp := call(t, router, http.MethodGet, "/admin/apikey/list", reader, nil); status != http.StatusForbidden {
+		t.Fatalf("list by key without admin scope responded %d %v", status, resp)
+	}
+	if status, resp := call(t, router, http.MethodGet, "/admin/apikey/list", "", nil); status != http.StatusUnauthorized {
+		t.Fatalf("list without key responded %d %v", status, resp)
+	}
+}
+
+func TestListAndRevoke(t *testing.T) {
+	store := data.NewMemoryStore()
+	router := newRouter(t, store)
+	operatorKey, operator := mint(t, store, "", model.ScopeAdmin)
+	acmeKey, acme := mint(t, store, "acme", model.ScopeAdmin)
+	acmeReaderKey, acmeReader := mint(t, store, "acme", model.ScopeFriendRead)
+	betaKey, _ := mint(t, store, "beta", model.ScopeFriendRead)
+
+	all := []string{operatorKey.ID.String(), acmeKey.ID.String(), acmeReaderKey.ID.String(), betaKey.ID.String()}
+	sort.Strings(all)
+	if ids := listed(t, router, operator); len(ids) != 4 || ids[0] != all[0] || ids[3] != all[3] {
+		t.Fatalf("unbound key listed %v, want %v", ids, all)
+	}
+	acmeIDs := []string{acmeKey.ID.String(), acmeReaderKey.ID.String()}
+	sort.Strings(acmeIDs)
+	if ids := listed(t, router, acme); len(ids) != 2 || ids[0] != acmeIDs[0] || ids[1] != acmeIDs[1] {
+		t.Fatalf("acme key listed %v, want %v", ids, acmeIDs)
+	}
+
+	// key of another tenant does not exist as far as bound key is concerned
+	for _, id := range []string{betaKey.ID.String(), operatorKey.ID.String()} {
+		status, resp := call(t, router, http.MethodPost, "/admin/apikey/revoke", acme, map[string]string{"id": id})
+		if status != http.StatusNotFound || errorCode(resp) != string(apierror.NotFound) {
+			t.Errorf("revoke of key %s by acme key responded %d %v", id, status, resp)
+		}
+	}
+	if revoked, _ := store.FindAPIKey(betaKey.ID); revoked.RevokedAt != nil {
+		t.Fatal("key of another tenant was revoked")
+	}
+
+	status, resp := call(t, router, http.MethodPost, "/admin/apikey/revoke", acme, map[string]string{"id": acmeReaderKey.ID.String()})
+	if status != http.StatusOK {
+		t.Fatalf("revoke responded %d %v", status, resp)
+	}
+	status, resp = call(t, router, http.MethodPost, "/admin/apikey/revoke", operator, map[string]string{"id": acmeReaderKey.ID.String()})
+	if status != http.StatusNotFound {
+		t.Fatalf("revoke of revoked key responded %d %v", status, resp)
+	}
+
+	// revoked key is refused from then on
+	status, resp = call(t, router, http.MethodGet, "/admin/apikey/list", acmeReader, nil)
+	if status != http.StatusUnauthorized || errorCode(resp) != string(apierror.Unauthenticated) {
+		t.Fatalf("request by revoked key responded %d %v", status, resp)
+	}
+}
@@ -0,0 +1,11 @@
+package request
+
+import "time"
+
+// CreateAPIKeyRequest model, key without ExpiresAt never expires and key without Tenant is bound to none
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" binding:"required,max=100"`
+	Tenant    string     `json:"tenant" binding:"omitempty,max=64"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1,dive,eq=friend:read|eq=friend:write|eq=notification:write|eq=admin"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
@@ -0,0 +1,6 @@
+package request
+
+// RevokeAPIKeyRequest model
+type RevokeAPIKeyRequest struct {
+	ID string `json:"id" binding:"required,uuid"`
+}
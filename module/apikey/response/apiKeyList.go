@@ -0,0 +1,22 @@
+package response
+
+import "time"
+
+// APIKeyListResponse model
+type APIKeyListResponse struct {
+	Success bool         `json:"success"`
+	APIKeys []APIKeyItem `json:"apiKeys"`
+	Count   int          `json:"count"`
+}
+
+// APIKeyItem model, the key itself is only revealed once when it is created
+type APIKeyItem struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Tenant     string     `json:"tenant,omitempty"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
@@ -1,176 +1,256 @@
 package friend
 
 import (
+	"fmgo/common/apierror"
+	"fmgo/common/audit"
+	"fmgo/common/auth"
+	"fmgo/common/config"
 	"fmgo/common/data"
 	"fmgo/common/data/model"
+	"fmgo/common/mailaddr"
+	"fmgo/common/tenant"
+	"fmgo/common/validation"
 	"fmgo/module/friend/request"
 	"fmgo/module/friend/response"
 	"fmt"
 	"net/http"
-	"regexp"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
 	"github.com/golang/glog"
-	"gopkg.in/go-playground/validator.v8"
+	"github.com/satori/go.uuid"
 )
 
+const defaultListLimit = 100
+
 // Controller struct
 type Controller struct {
-	dbFactory *data.DBFactory
+	store         data.GraphStore
+	graphConfig   config.GraphConfiguration
+	canonicalizer *mailaddr.Canonicalizer
 }
 
 // NewController initialize new Friend Controller instance
-func NewController(dbFactory *data.DBFactory) *Controller {
-	return &Controller{dbFactory: dbFactory}
+func NewController(store data.GraphStore, graphConfig config.GraphConfiguration, canonicalizer *mailaddr.Canonicalizer) *Controller {
+	return &Controller{store: store, graphConfig: graphConfig, canonicalizer: canonicalizer}
 }
 
 // Connect action to create friend connection between two user
 func (ctrl *Controller) Connect(c *gin.Context) {
 	// deserialize and validate POST data
 	var req request.ConnectRequest
-	var errors []string
-	if err := c.ShouldBindWith(&req, binding.JSON); err != nil {
-		ve, ok := err.(validator.ValidationErrors)
-		if ok {
-			for _, v := range ve {
-				msg := fmt.Sprintf("%s is %s", v.Field, v.Tag)
-				if v.Tag == "len" {
-					msg = fmt.Sprintf("%s %s should be %s", v.Field, v.Tag, v.Param)
-				}
-				errors = append(errors, msg)
-			}
-		} else {
-			errors = append(errors, err.Error())
-		}
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"success": false, "errors": errors})
+	if !validation.Bind(c, &req, binding.JSON) {
 		return
 	}
 
-	if strings.ToLower(strings.TrimSpace(req.Friends[0])) == strings.ToLower(strings.TrimSpace(req.Friends[1])) {
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"success": false, "errors": []string{"Could not connect same email"}})
+	if !auth.Authorize(c, ctrl.canonicalizer.Canonicalize(req.Friends[0]), ctrl.canonicalizer.Canonicalize(req.Friends[1])) {
+		return
+	}
+
+	if ctrl.canonicalizer.Canonicalize(req.Friends[0]) == ctrl.canonicalizer.Canonicalize(req.Friends[1]) {
+		apierror.Abort(c, apierror.New(apierror.SelfReference, "Could not connect same email"))
 		return
 	}
 
 	// validate email format
-	re := regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
-	for _, email := range req.Friends {
-		if !re.MatchString(email) {
-			errors = append(errors, fmt.Sprintf("%s is an invalid email format", email))
-		}
+	if errs := ctrl.invalidFriends(req.Friends); len(errs) > 0 {
+		apierror.Abort(c, errs...)
+		return
 	}
-	if len(errors) > 0 {
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"success": false, "errors": errors})
+
+	store := tenant.Store(c, ctrl.store)
+	tx, err := store.Begin()
+	if err != nil {
+		glog.Errorf("Failed to create new db transaction: %s", err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to start new db transaction"))
 		return
 	}
 
-	db, err := ctrl.dbFactory.DBConnection()
+	// create user if email does not exist yet
+	normalizeEmail1 := ctrl.canonicalizer.Canonicalize(req.Friends[0])
+	user1, err := tx.FindOrCreateUser(normalizeEmail1)
 	if err != nil {
-		glog.Errorf("Failed to open db connection: %s", err)
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"success": false, "errors": []string{"Failed to open db connection"}})
+		tx.Rollback()
+		glog.Errorf("Failed to create user %s: %s", normalizeEmail1, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to create new user"))
 		return
 	}
-	defer db.Close()
 
-	tx := db.Begin()
-	if tx.Error != nil {
-		glog.Errorf("Failed to create new db transaction: %s", tx.Error)
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"success": false, "errors": []string{"Failed to start new db transaction"}})
+	normalizeEmail2 := ctrl.canonicalizer.Canonicalize(req.Friends[1])
+	user2, err := tx.FindOrCreateUser(normalizeEmail2)
+	if err != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to create user %s: %s", normalizeEmail2, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to create new user"))
 		return
 	}
 
-	// create user if email does not exist yet
-	var user1, user2 model.User
-	normalizeEmail1 := strings.ToLower(req.Friends[0])
-	if tx.First(&user1, "email = ?", normalizeEmail1).RecordNotFound() {
-		user1 = model.User{Email: normalizeEmail1}
-		if err := tx.Create(&user1).Error; err != nil {
+	// both email may be alias of the same user
+	if user1.ID == user2.ID {
+		tx.Rollback()
+		apierror.Abort(c, apierror.New(apierror.SelfReference, "Could not connect same user"))
+		return
+	}
+
+	if err := suspended(user1, user2); err != nil {
+		tx.Rollback()
+		apierror.Abort(c, err)
+		return
+	}
+
+	connected, err := tx.IsFriend(user1.ID, user2.ID)
+	if err != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to check friend connection %s - %s: %s", user1.Email, user2.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to check friend connection"))
+		return
+	}
+
+	if !connected {
+		// If one of them or both blocked each other, then friend connection will fail
+		blocked, err := isBlockedEitherWay(tx, user1.ID, user2.ID)
+		if err != nil {
 			tx.Rollback()
-			glog.Errorf("Failed to create user %s: %s", normalizeEmail1, err)
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"success": false, "errors": []string{"Failed to create new user"}})
+			glog.Errorf("Failed to check block %s - %s: %s", user1.Email, user2.Email, err)
+			apierror.Abort(c, apierror.New(apierror.Internal, "Failed to check block"))
 			return
 		}
-	}
-
-	normalizeEmail2 := strings.ToLower(req.Friends[1])
-	if tx.First(&user2, "email = ?", normalizeEmail2).RecordNotFound() {
-		user2 = model.User{Email: normalizeEmail2}
-		if err := tx.Create(&user2).Error; err != nil {
+		if blocked {
 			tx.Rollback()
-			glog.Errorf("Failed to create user %s: %s", normalizeEmail2, err)
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"success": false, "errors": []string{"Failed to create new user"}})
+			apierror.Abort(c, apierror.New(apierror.Blocked, "Friend connection are being blocked"))
 			return
 		}
-	}
 
-	if err := tx.Model(&user1).Association("Friends").Find(&user2).Error; err != nil && err.Error() == "record not found" {
-		// If one of them or both blocked each other, then friend connection will fail
-		if tx.Model(&user1).Association("Blocks").Find(&user2).Error == nil || tx.Model(&user2).Association("Blocks").Find(&user1).Error == nil {
+		source := req.Source
+		if source == "" {
+			source = model.FriendSourceAPI
+		}
+
+		friend := model.Friend{UserID: user1.ID, FriendID: user2.ID, Source: source, Label: strings.TrimSpace(req.Label)}
+		if err := tx.AddFriend(&friend); err != nil {
 			tx.Rollback()
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"success": false, "errors": []string{"Friend connection are being blocked"}})
+			glog.Errorf("Failed to create friend connection %s - %s: %s", user1.Email, user2.Email, err)
+			apierror.Abort(c, apierror.New(apierror.Internal, "Failed to create friend connection"))
 			return
 		}
 
-		tx.Model(&user1).Association("Friends").Append(&user2)
-		tx.Model(&user2).Association("Friends").Append(&user1)
+		audit.Record(c, model.AuditFriendConnected, user1.Email, user2.Email, source)
 	}
 
-	if err := tx.Commit().Error; err != nil {
-		glog.Errorf("Failed to commit db transaction: %s", err)
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"success": false, "errors": []string{"Failed to commit db transaction"}})
+	if !audit.Commit(c, tx) {
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"success": true})
 }
 
-// GetFriends action to get friend list for given email address
-func (ctrl *Controller) GetFriends(c *gin.Context) {
+// Disconnect action to remove friend connection between two user
+func (ctrl *Controller) Disconnect(c *gin.Context) {
 	// deserialize and validate POST data
-	var req request.GetFriendRequests
-	var errors []string
-	if err := c.ShouldBindWith(&req, binding.JSON); err != nil {
-		ve, ok := err.(validator.ValidationErrors)
-		if ok {
-			for _, v := range ve {
-				msg := fmt.Sprintf("%s is %s", v.Field, v.Tag)
-				if v.Tag == "email" {
-					msg = fmt.Sprintf("%s is invalid", v.Field)
-				}
-				errors = append(errors, msg)
+	var req request.DisconnectRequest
+	if !validation.Bind(c, &req, binding.JSON) {
+		return
+	}
+
+	if !auth.Authorize(c, ctrl.canonicalizer.Canonicalize(req.Friends[0]), ctrl.canonicalizer.Canonicalize(req.Friends[1])) {
+		return
+	}
+
+	if ctrl.canonicalizer.Canonicalize(req.Friends[0]) == ctrl.canonicalizer.Canonicalize(req.Friends[1]) {
+		apierror.Abort(c, apierror.New(apierror.SelfReference, "Could not disconnect same email"))
+		return
+	}
+
+	// validate email format
+	if errs := ctrl.invalidFriends(req.Friends); len(errs) > 0 {
+		apierror.Abort(c, errs...)
+		return
+	}
+
+	store := tenant.Store(c, ctrl.store)
+	tx, err := store.Begin()
+	if err != nil {
+		glog.Errorf("Failed to create new db transaction: %s", err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to start new db transaction"))
+		return
+	}
+
+	// unknown user can not have any connection, so there is nothing to remove
+	user1, err1 := tx.FindUser(ctrl.canonicalizer.Canonicalize(req.Friends[0]))
+	user2, err2 := tx.FindUser(ctrl.canonicalizer.Canonicalize(req.Friends[1]))
+	if err1 == data.ErrNotFound || err2 == data.ErrNotFound {
+		tx.Rollback()
+		c.JSON(http.StatusOK, gin.H{"success": true, "disconnected": false})
+		return
+	}
+	if err1 != nil || err2 != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to get user %v: %s %s", req.Friends, err1, err2)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get user"))
+		return
+	}
+
+	// friend connection is stored on both side, they are removed together
+	disconnected, err := tx.RemoveFriend(user1.ID, user2.ID)
+	if err != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to remove friend connection %s - %s: %s", user1.Email, user2.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to remove friend connection"))
+		return
+	}
+	if disconnected {
+		audit.Record(c, model.AuditFriendRemoved, user1.Email, user2.Email, "")
+	}
+
+	if req.RemoveSubscriptions {
+		for _, pair := range [][2]*model.User{{user1, user2}, {user2, user1}} {
+			unsubscribed, err := tx.Unsubscribe(pair[0].ID, pair[1].ID)
+			if err != nil {
+				tx.Rollback()
+				glog.Errorf("Failed to remove subscription %s - %s: %s", pair[0].Email, pair[1].Email, err)
+				apierror.Abort(c, apierror.New(apierror.Internal, "Failed to remove subscription"))
+				return
 			}
-		} else {
-			errors = append(errors, err.Error())
+			if !unsubscribed {
+				continue
+			}
+
+			audit.Record(c, model.AuditSubscriptionRemoved, pair[0].Email, pair[1].Email, "removed by disconnect")
 		}
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"success": false, "errors": errors})
+	}
+
+	if !audit.Commit(c, tx) {
 		return
 	}
 
-	db, err := ctrl.dbFactory.DBConnection()
-	if err != nil {
-		glog.Errorf("Failed to open db connection: %s", err)
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"success": false, "errors": []string{"Failed to open db connection"}})
+	c.JSON(http.StatusOK, gin.H{"success": true, "disconnected": disconnected})
+}
+
+// GetFriends action to get friend list for given email address
+func (ctrl *Controller) GetFriends(c *gin.Context) {
+	// deserialize and validate POST data
+	var req request.GetFriendRequests
+	if !validation.Bind(c, &req, binding.JSON) {
 		return
 	}
-	defer db.Close()
 
-	var user model.User
-	if db.Preload("Friends").First(&user, "email = ?", strings.ToLower(req.Email)).RecordNotFound() {
-		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"success": false, "errors": []string{fmt.Sprintf("User with email %s does not exist", req.Email)}})
+	if !auth.Authorize(c, ctrl.canonicalizer.Canonicalize(req.Email)) {
 		return
 	}
 
-	friends := make([]string, 0)
-	for _, friend := range user.Friends {
-		friends = append(friends, friend.Email)
+	query, err := data.NewListQuery(req.Sort, req.Order, req.Prefix, req.Cursor, listLimit(req.Limit))
+	if err != nil {
+		apierror.Abort(c, apierror.NewField(apierror.ValidationFailed, "cursor", "%s is invalid", "cursor"))
+		return
 	}
 
-	resp := response.FriendListResponse{
-		Success: true,
-		Friends: friends,
-		Count:   len(friends),
+	resp, apiErr := ctrl.friendPage(tenant.Store(c, ctrl.store), ctrl.canonicalizer.Canonicalize(req.Email), "", query, req.IncludeProfiles)
+	if apiErr != nil {
+		apierror.Abort(c, apiErr)
+		return
 	}
+
 	c.JSON(http.StatusOK, resp)
 }
 
@@ -178,115 +258,143 @@ func (ctrl *Controller) GetFriends(c *gin.Context) {
 func (ctrl *Controller) GetCommons(c *gin.Context) {
 	// deserialize and validate POST data
 	var req request.GetCommonsRequest
-	var errors []string
-	if err := c.ShouldBindWith(&req, binding.JSON); err != nil {
-		ve, ok := err.(validator.ValidationErrors)
-		if ok {
-			for _, v := range ve {
-				msg := fmt.Sprintf("%s is %s", v.Field, v.Tag)
-				if v.Tag == "len" {
-					msg = fmt.Sprintf("%s %s should be %s", v.Field, v.Tag, v.Param)
-				}
-				errors = append(errors, msg)
-			}
-		} else {
-			errors = append(errors, err.Error())
-		}
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"success": false, "errors": errors})
+	if !validation.Bind(c, &req, binding.JSON) {
 		return
 	}
 
-	if strings.ToLower(strings.TrimSpace(req.Friends[0])) == strings.ToLower(strings.TrimSpace(req.Friends[1])) {
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"success": false, "errors": []string{"Could not get common friend list from same email address"}})
+	if !auth.Authorize(c, ctrl.canonicalizer.Canonicalize(req.Friends[0]), ctrl.canonicalizer.Canonicalize(req.Friends[1])) {
 		return
 	}
 
-	// validate email format
-	re := regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
-	for _, email := range req.Friends {
-		if !re.MatchString(email) {
-			errors = append(errors, fmt.Sprintf("%s is an invalid email format", email))
-		}
+	if ctrl.canonicalizer.Canonicalize(req.Friends[0]) == ctrl.canonicalizer.Canonicalize(req.Friends[1]) {
+		apierror.Abort(c, apierror.New(apierror.SelfReference, "Could not get common friend list from same email address"))
+		return
 	}
-	if len(errors) > 0 {
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"success": false, "errors": errors})
+
+	// validate email format
+	if errs := ctrl.invalidFriends(req.Friends); len(errs) > 0 {
+		apierror.Abort(c, errs...)
 		return
 	}
 
-	db, err := ctrl.dbFactory.DBConnection()
+	query, err := data.NewListQuery(req.Sort, req.Order, req.Prefix, req.Cursor, listLimit(req.Limit))
 	if err != nil {
-		glog.Errorf("Failed to open db connection: %s", err)
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"success": false, "errors": []string{"Failed to open db connection"}})
+		apierror.Abort(c, apierror.NewField(apierror.ValidationFailed, "cursor", "%s is invalid", "cursor"))
 		return
 	}
-	defer db.Close()
 
-	var user1, user2 model.User
-	normalizeEmail1 := strings.ToLower(req.Friends[0])
-	if db.Preload("Friends").First(&user1, "email = ?", normalizeEmail1).RecordNotFound() {
-		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"success": false, "errors": []string{fmt.Sprintf("User with email %s does not exist", normalizeEmail1)}})
+	// connection time of common friend is the one of first user
+	resp, apiErr := ctrl.friendPage(tenant.Store(c, ctrl.store), ctrl.canonicalizer.Canonicalize(req.Friends[0]), ctrl.canonicalizer.Canonicalize(req.Friends[1]), query, req.IncludeProfiles)
+	if apiErr != nil {
+		apierror.Abort(c, apiErr)
 		return
 	}
 
-	normalizeEmail2 := strings.ToLower(req.Friends[1])
-	if db.Preload("Friends").First(&user2, "email = ?", normalizeEmail2).RecordNotFound() {
-		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"success": false, "errors": []string{fmt.Sprintf("User with email %s does not exist", normalizeEmail2)}})
-		return
+	c.JSON(http.StatusOK, resp)
+}
+
+// friendPage get page of friend of user with given email, only those shared with mutualEmail unless it is empty,
+// or error to respond with when it fails. Profile summary of every friend is added when includeProfiles is set
+func (ctrl *Controller) friendPage(store data.GraphStore, email, mutualEmail string, query data.ListQuery, includeProfiles bool) (*response.FriendListResponse, *apierror.Error) {
+	user, err := store.FindUser(email)
+	if err == data.ErrNotFound {
+		return nil, apierror.New(apierror.UserNotFound, "User with email %s does not exist", email)
+	}
+	if err != nil {
+		glog.Errorf("Failed to get user %s: %s", email, err)
+		return nil, apierror.New(apierror.Internal, "Failed to get user")
 	}
 
-	friends1 := make([]string, 0)
-	for _, friend := range user1.Friends {
-		friends1 = append(friends1, friend.Email)
+	mutualID := uuid.Nil
+	if mutualEmail != "" {
+		mutual, err := store.FindUser(mutualEmail)
+		if err == data.ErrNotFound {
+			return nil, apierror.New(apierror.UserNotFound, "User with email %s does not exist", mutualEmail)
+		}
+		if err != nil {
+			glog.Errorf("Failed to get user %s: %s", mutualEmail, err)
+			return nil, apierror.New(apierror.Internal, "Failed to get user")
+		}
+
+		mutualID = mutual.ID
 	}
 
-	friends2 := make([]string, 0)
-	for _, friend := range user2.Friends {
-		friends2 = append(friends2, friend.Email)
+	// ask for one more friend to know whether there is next page
+	limit := query.Limit
+	query.Limit++
+	connections, total, err := store.FriendPage(user.ID, mutualID, query)
+	if err != nil {
+		glog.Errorf("Failed to get friends of %s: %s", email, err)
+		return nil, apierror.New(apierror.Internal, "Failed to get friend list")
 	}
 
-	intersect := intersection(friends1, friends2)
-	resp := response.FriendListResponse{
-		Success: true,
-		Friends: intersect,
-		Count:   len(intersect),
+	resp := &response.FriendListResponse{
+		Success:     true,
+		Friends:     make([]string, 0),
+		Connections: make([]response.ConnectionItem, 0),
+		Total:       total,
 	}
-	c.JSON(http.StatusOK, resp)
+	if len(connections) > limit {
+		connections = connections[:limit]
+		resp.NextCursor = query.CursorOf(connections[limit-1]).Encode()
+	}
+	for _, connection := range connections {
+		resp.Friends = append(resp.Friends, connection.Email)
+		item := response.ConnectionItem{
+			Email:       connection.Email,
+			ConnectedAt: connection.ConnectedAt,
+			Source:      connection.Source,
+			Label:       connection.Label,
+		}
+		if includeProfiles {
+			item.Profile = &response.ProfileSummary{DisplayName: connection.DisplayName, AvatarURL: connection.AvatarURL}
+		}
+		resp.Connections = append(resp.Connections, item)
+	}
+	resp.Count = len(resp.Friends)
+
+	return resp, nil
 }
 
-func intersection(a []string, b []string) []string {
-	result := make([]string, 0)
-
-	// interacting on the smallest list first can potentailly be faster...but not by much, worse case is the same
-	low, high := a, b
-	if len(a) > len(b) {
-		low = b
-		high = a
-	}
-
-	done := false
-	for i, l := range low {
-		for j, h := range high {
-			// get future index values
-			f1 := i + 1
-			f2 := j + 1
-			if l == h {
-				result = append(result, h)
-				if f1 < len(low) && f2 < len(high) {
-					// if the future values aren't the same then that's the end of the intersection
-					if low[f1] != high[f2] {
-						done = true
-					}
-				}
-				// we don't want to interate on the entire list everytime, so remove the parts we already looped on will make it faster each pass
-				high = high[:j+copy(high[j:], high[j+1:])]
-				break
-			}
+// invalidFriends check format of every email in friends field, getting error of each invalid one
+func (ctrl *Controller) invalidFriends(friends []string) []*apierror.Error {
+	var errs []*apierror.Error
+	for i, email := range friends {
+		if !validation.IsEmail(ctrl.canonicalizer.Canonicalize(email)) {
+			field := fmt.Sprintf("friends[%d]", i)
+			errs = append(errs, apierror.NewField(apierror.ValidationFailed, field, "%s is an invalid email format", email))
 		}
-		// nothing in the future so we are done
-		if done {
-			break
+	}
+
+	return errs
+}
+
+// listLimit get page size of friend list, falling back to default when client does not ask for any
+func listLimit(limit int) int {
+	if limit == 0 {
+		return defaultListLimit
+	}
+
+	return limit
+}
+
+// suspended get error about the first of given users who is suspended, nil when none is
+func suspended(users ...*model.User) *apierror.Error {
+	for _, user := range users {
+		if user.Suspended() {
+			return apierror.New(apierror.Suspended, "User %s is suspended", user.Email)
 		}
 	}
 
-	return result
+	return nil
+}
+
+// isBlockedEitherWay check whether one of the user or both blocked each other
+func isBlockedEitherWay(store data.BlockRepository, userID, targetID uuid.UUID) (bool, error) {
+	blocked, err := store.IsBlocked(userID, targetID)
+	if err != nil || blocked {
+		return blocked, err
+	}
+
+	return store.IsBlocked(targetID, userID)
 }
@@ -0,0 +1,222 @@
+package friend
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmgo/common/apierror"
+	"fmgo/common/audit"
+	"fmgo/common/config"
+	"fmgo/common/data"
+	"fmgo/common/data/model"
+	"fmgo/common/mailaddr"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newRouter serve friend endpoints backed by given memory store, without authentication unless its middleware is given
+func newRouter(store data.GraphStore, middleware ...gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	ctrl := NewController(store, config.GraphConfiguration{MaxPathDepth: 3}, mailaddr.NewCanonicalizer(config.EmailConfiguration{CaseFolding: true}))
+
+	router := gin.New()
+	router.Use(audit.Middleware(), apierror.Handler())
+	router.Use(middleware...)
+	router.POST("/friend/connect", ctrl.Connect)
+	router.POST("/friend/disconnect", ctrl.Disconnect)
+	router.POST("/friend/list", ctrl.GetFriends)
+	router.POST("/friend/common", ctrl.GetCommons)
+	router.POST("/friend/path", ctrl.GetPath)
+	router.POST("/friend/suggestions", ctrl.GetSuggestions)
+	router.POST("/friend/request/send", ctrl.SendRequest)
+	router.POST("/friend/request/list", ctrl.GetRequests)
+	router.POST("/friend/request/accept", ctrl.AcceptRequest)
+	router.POST("/friend/request/reject", ctrl.RejectRequest)
+	router.POST("/friend/request/cancel", ctrl.CancelRequest)
+	return router
+}
+
+// failingAudit store whose transaction fails to record any audit event
+type failingAudit struct {
+	data.GraphStore
+}
+
+func (s failingAudit) WithTenant(tenant string) data.GraphStore {
+	return failingAudit{s.GraphStore.WithTenant(tenant)}
+}
+
+func (s failingAudit) Begin() (data.GraphStore, error) {
+	tx, err := s.GraphStore.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	return failingAudit{tx}, nil
+}
+
+func (s failingAudit) CreateAuditEvent(event *model.AuditEvent) error {
+	return errors.New("audit event table is gone")
+}
+
+// post send JSON body to path, returning status and decoded response body
+func post(t *testing.T, router *gin.Engine, path, body string) (int, map[string]interface{}) {
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%s responded with invalid JSON %q: %s", path, w.Body.String(), err)
+	}
+
+	return w.Code, resp
+}
+
+// errorCode get code of the first error in failed response
+func errorCode(resp map[string]interface{}) string {
+	errs, _ := resp["errors"].([]interface{})
+	if len(errs) == 0 {
+		return ""
+	}
+
+	code, _ := errs[0].(map[string]interface{})["code"].(string)
+	return code
+}
+
+func assertFriends(t *testing.T, resp map[string]interface{}, want ...string) {
+	friends, _ := resp["friends"].([]interface{})
+	if len(friends) != len(want) {
+		t.Fatalf("got friends %v, want %v", friends, want)
+	}
+	for i := range want {
+		if friends[i] != want[i] {
+			t.Fatalf("got friends %v, want %v", friends, want)
+		}
+	}
+}
+
+func TestConnect(t *testing.T) {
+	router := newRouter(data.NewMemoryStore())
+
+	for _, body := range []string{
+		`{"friends": ["andy@example.com", "john@example.com"]}`,
+		`{"friends": ["andy@example.com", "kate@example.com"]}`,
+		`{"friends": ["John@Example.com", "kate@example.com"]}`,
+	} {
+		if status, resp := post(t, router, "/friend/connect", body); status != http.StatusOK || resp["success"] != true {
+			t.Fatalf("connect %s responded %d %v", body, status, resp)
+		}
+	}
+
+	status, resp := post(t, router, "/friend/list", `{"email": "andy@example.com"}`)
+	if status != http.StatusOK {
+		t.Fatalf("friend list responded %d %v", status, resp)
+	}
+	assertFriends(t, resp, "john@example.com", "kate@example.com")
+	if resp["count"] != float64(2) {
+		t.Fatalf("friend list count is %v, want 2", resp["count"])
+	}
+
+	status, resp = post(t, router, "/friend/common", `{"friends": ["andy@example.com", "john@example.com"]}`)
+	if status != http.StatusOK {
+		t.Fatalf("common friend list responded %d %v", status, resp)
+	}
+	assertFriends(t, resp, "kate@example.com")
+}
+
+func TestConnectRejected(t *testing.T) {
+	store := data.NewMemoryStore()
+	router := newRouter(store)
+
+	andy, _ := store.FindOrCreateUser("andy@example.com")
+	john, _ := store.FindOrCreateUser("john@example.com")
+	if err := store.Block(john.ID, andy.ID); err != nil {
+		t.Fatalf("Block: %s", err)
+	}
+
+	tests := []struct {
+		body   string
+		status int
+		code   string
+	}{
+		{`{"friends": ["andy@example.com", "ANDY@example.com"]}`, http.StatusBadRequest, string(apierror.SelfReference)},
+		{`{"friends": ["andy@example.com", "not an email"]}`, http.StatusBadRequest, string(apierror.ValidationFailed)},
+		{`{"friends": ["andy@example.com", "john@example.com"]}`, http.StatusForbidden, string(apierror.Blocked)},
+	}
+	for _, test := range tests {
+		status, resp := post(t, router, "/friend/connect", test.body)
+		if status != test.status || errorCode(resp) != test.code {
+			t.Errorf("connect %s responded %d %v, want %d %s", test.body, status, resp, test.status, test.code)
+		}
+	}
+
+	if connected, _ := store.IsFriend(andy.ID, john.ID); connected {
+		t.Fatal("blocked users got connected")
+	}
+}
+
+func TestDisconnect(t *testing.T) {
+	router := newRouter(data.NewMemoryStore())
+
+	if status, resp := post(t, router, "/friend/connect", `{"friends": ["andy@example.com", "john@example.com"]}`); status != http.StatusOK {
+		t.Fatalf("connect responded %d %v", status, resp)
+	}
+
+	for _, disconnected := range []bool{true, false} {
+		status, resp := post(t, router, "/friend/disconnect", `{"friends": ["john@example.com", "andy@example.com"]}`)
+		if status != http.StatusOK || resp["disconnected"] != disconnected {
+			t.Fatalf("disconnect responded %d %v, want disconnected %v", status, resp, disconnected)
+		}
+	}
+
+	status, resp := post(t, router, "/friend/list", `{"email": "andy@example.com"}`)
+	if status != http.StatusOK {
+		t.Fatalf("friend list responded %d %v", status, resp)
+	}
+	assertFriends(t, resp)
+
+	status, resp = post(t, router, "/friend/list", `{"email": "kate@example.com"}`)
+	if status != http.StatusNotFound || errorCode(resp) != string(apierror.UserNotFound) {
+		t.Fatalf("friend list of unknown user responded %d %v", status, resp)
+	}
+}
+
+func TestAuditFailureRollsBack(t *testing.T) {
+	store := data.NewMemoryStore()
+	router := newRouter(failingAudit{store})
+
+	andy, _ := store.FindOrCreateUser("andy@example.com")
+	john, _ := store.FindOrCreateUser("john@example.com")
+	kate, _ := store.FindOrCreateUser("kate@example.com")
+	if err := store.AddFriend(&model.Friend{UserID: andy.ID, FriendID: john.ID, Source: model.FriendSourceAPI}); err != nil {
+		t.Fatalf("AddFriend: %s", err)
+	}
+	if err := store.Subscribe(john.ID, andy.ID); err != nil {
+		t.Fatalf("Subscribe: %s", err)
+	}
+
+	status, resp := post(t, router, "/friend/connect", `{"friends": ["andy@example.com", "kate@example.com"]}`)
+	if status != http.StatusInternalServerError || errorCode(resp) != string(apierror.Internal) {
+		t.Fatalf("connect responded %d %v", status, resp)
+	}
+
+	status, resp = post(t, router, "/friend/disconnect", `{"friends": ["andy@example.com", "john@example.com"], "removeSubscriptions": true}`)
+	if status != http.StatusInternalServerError || errorCode(resp) != string(apierror.Internal) {
+		t.Fatalf("disconnect responded %d %v", status, resp)
+	}
+
+	// neither the new connection nor the removal of the old one outlives its failed audit event
+	if connected, _ := store.IsFriend(andy.ID, kate.ID); connected {
+		t.Error("connection was kept without its audit event")
+	}
+	if connected, _ := store.IsFriend(andy.ID, john.ID); !connected {
+		t.Error("connection was removed without its audit event")
+	}
+	if subscribed, _ := store.IsSubscribed(john.ID, andy.ID); !subscribed {
+		t.Error("subscription was removed without its audit event")
+	}
+}
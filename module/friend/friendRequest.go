@@ -0,0 +1,316 @@
+package friend
+
+import (
+	"fmgo/common/apierror"
+	"fmgo/common/audit"
+	"fmgo/common/auth"
+	"fmgo/common/data"
+	"fmgo/common/data/model"
+	"fmgo/common/tenant"
+	"fmgo/common/validation"
+	"fmgo/module/friend/request"
+	"fmgo/module/friend/response"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/golang/glog"
+)
+
+// SendRequest action to send friend request that need to be accepted by target
+func (ctrl *Controller) SendRequest(c *gin.Context) {
+	// deserialize and validate POST data
+	var req request.FriendRequestRequest
+	if !validation.Bind(c, &req, binding.JSON) {
+		return
+	}
+
+	if !auth.Authorize(c, ctrl.canonicalizer.Canonicalize(req.Requestor)) {
+		return
+	}
+
+	if ctrl.canonicalizer.Canonicalize(req.Requestor) == ctrl.canonicalizer.Canonicalize(req.Target) {
+		apierror.Abort(c, apierror.New(apierror.SelfReference, "Could not send friend request to self"))
+		return
+	}
+
+	store := tenant.Store(c, ctrl.store)
+	tx, err := store.Begin()
+	if err != nil {
+		glog.Errorf("Failed to create new db transaction: %s", err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to start new db transaction"))
+		return
+	}
+
+	normalizeRequestorEmail := ctrl.canonicalizer.Canonicalize(req.Requestor)
+	requestor, err := tx.FindOrCreateUser(normalizeRequestorEmail)
+	if err != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to create user %s: %s", normalizeRequestorEmail, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to create new user"))
+		return
+	}
+
+	normalizeTargetEmail := ctrl.canonicalizer.Canonicalize(req.Target)
+	target, err := tx.FindOrCreateUser(normalizeTargetEmail)
+	if err != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to create user %s: %s", normalizeTargetEmail, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to create new user"))
+		return
+	}
+
+	// both email may be alias of the same user
+	if requestor.ID == target.ID {
+		tx.Rollback()
+		apierror.Abort(c, apierror.New(apierror.SelfReference, "Could not send friend request to self"))
+		return
+	}
+
+	if err := suspended(requestor, target); err != nil {
+		tx.Rollback()
+		apierror.Abort(c, err)
+		return
+	}
+
+	connected, err := tx.IsFriend(requestor.ID, target.ID)
+	if err != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to check friend connection %s - %s: %s", requestor.Email, target.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to check friend connection"))
+		return
+	}
+	if connected {
+		tx.Rollback()
+		apierror.Abort(c, apierror.New(apierror.AlreadyExists, "Requestor and target are already friends"))
+		return
+	}
+
+	// If one of them or both blocked each other, then friend request will fail
+	blocked, err := isBlockedEitherWay(tx, requestor.ID, target.ID)
+	if err != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to check block %s - %s: %s", requestor.Email, target.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to check block"))
+		return
+	}
+	if blocked {
+		tx.Rollback()
+		apierror.Abort(c, apierror.New(apierror.Blocked, "Friend request are being blocked"))
+		return
+	}
+
+	// Only one pending request is allowed between two user regardless of its direction
+	_, err1 := tx.FindFriendRequest(requestor.ID, target.ID, model.FriendRequestPending)
+	_, err2 := tx.FindFriendRequest(target.ID, requestor.ID, model.FriendRequestPending)
+	if (err1 != nil && err1 != data.ErrNotFound) || (err2 != nil && err2 != data.ErrNotFound) {
+		tx.Rollback()
+		glog.Errorf("Failed to get pending friend request %s - %s: %s %s", requestor.Email, target.Email, err1, err2)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get friend request"))
+		return
+	}
+	if err1 == nil || err2 == nil {
+		tx.Rollback()
+		apierror.Abort(c, apierror.New(apierror.AlreadyExists, "Pending friend request between requestor and target already exist"))
+		return
+	}
+
+	friendRequest := model.FriendRequest{
+		RequestorID: requestor.ID,
+		TargetID:    target.ID,
+		Status:      model.FriendRequestPending,
+	}
+	if err := tx.CreateFriendRequest(&friendRequest); err != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to create friend request %s - %s: %s", requestor.Email, target.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to create friend request"))
+		return
+	}
+
+	audit.Record(c, model.AuditFriendRequestSent, requestor.Email, target.Email, "")
+	if !audit.Commit(c, tx) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "id": friendRequest.ID.String()})
+}
+
+// GetRequests action to get incoming or outgoing friend request for given email address
+func (ctrl *Controller) GetRequests(c *gin.Context) {
+	// deserialize and validate POST data
+	var req request.GetFriendRequestsRequest
+	if !validation.Bind(c, &req, binding.JSON) {
+		return
+	}
+
+	if !auth.Authorize(c, ctrl.canonicalizer.Canonicalize(req.Email)) {
+		return
+	}
+
+	store := tenant.Store(c, ctrl.store)
+	user, err := store.FindUser(ctrl.canonicalizer.Canonicalize(req.Email))
+	if err == data.ErrNotFound {
+		apierror.Abort(c, apierror.New(apierror.UserNotFound, "User with email %s does not exist", req.Email))
+		return
+	}
+	if err != nil {
+		glog.Errorf("Failed to get user %s: %s", req.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get user"))
+		return
+	}
+
+	status := req.Status
+	if status == "" {
+		status = model.FriendRequestPending
+	}
+
+	friendRequests, err := store.FriendRequests(user.ID, req.Direction == "outgoing", status)
+	if err != nil {
+		glog.Errorf("Failed to get friend request for %s: %s", user.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get friend request"))
+		return
+	}
+
+	items := make([]response.FriendRequestItem, 0)
+	for _, friendRequest := range friendRequests {
+		items = append(items, response.FriendRequestItem{
+			ID:          friendRequest.ID.String(),
+			Requestor:   friendRequest.Requestor.Email,
+			Target:      friendRequest.Target.Email,
+			Status:      friendRequest.Status,
+			CreatedAt:   friendRequest.CreatedAt,
+			RespondedAt: friendRequest.RespondedAt,
+		})
+	}
+
+	resp := response.FriendRequestListResponse{
+		Success:  true,
+		Requests: items,
+		Count:    len(items),
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// AcceptRequest action to accept pending friend request and create friend connection
+func (ctrl *Controller) AcceptRequest(c *gin.Context) {
+	ctrl.respondRequest(c, model.FriendRequestAccepted)
+}
+
+// RejectRequest action to reject pending friend request
+func (ctrl *Controller) RejectRequest(c *gin.Context) {
+	ctrl.respondRequest(c, model.FriendRequestRejected)
+}
+
+// CancelRequest action to cancel pending friend request by its requestor
+func (ctrl *Controller) CancelRequest(c *gin.Context) {
+	ctrl.respondRequest(c, model.FriendRequestCancelled)
+}
+
+// requestActions audit action of friend request answered with given status
+var requestActions = map[string]string{
+	model.FriendRequestAccepted:  model.AuditFriendRequestAccepted,
+	model.FriendRequestRejected:  model.AuditFriendRequestRejected,
+	model.FriendRequestCancelled: model.AuditFriendRequestCancelled,
+}
+
+func (ctrl *Controller) respondRequest(c *gin.Context, status string) {
+	// deserialize and validate POST data
+	var req request.FriendRequestRequest
+	if !validation.Bind(c, &req, binding.JSON) {
+		return
+	}
+
+	// pending request is cancelled by its requestor, accepting or rejecting it is up to its target
+	party := req.Target
+	if status == model.FriendRequestCancelled {
+		party = req.Requestor
+	}
+	if !auth.Authorize(c, ctrl.canonicalizer.Canonicalize(party)) {
+		return
+	}
+
+	store := tenant.Store(c, ctrl.store)
+	tx, err := store.Begin()
+	if err != nil {
+		glog.Errorf("Failed to create new db transaction: %s", err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to start new db transaction"))
+		return
+	}
+
+	requestor, err1 := tx.FindUser(ctrl.canonicalizer.Canonicalize(req.Requestor))
+	target, err2 := tx.FindUser(ctrl.canonicalizer.Canonicalize(req.Target))
+	if err1 == data.ErrNotFound || err2 == data.ErrNotFound {
+		tx.Rollback()
+		email := req.Requestor
+		if err2 == data.ErrNotFound {
+			email = req.Target
+		}
+		apierror.Abort(c, apierror.New(apierror.UserNotFound, "User with email %s does not exist", ctrl.canonicalizer.Canonicalize(email)))
+		return
+	}
+	if err1 != nil || err2 != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to get user %s - %s: %s %s", req.Requestor, req.Target, err1, err2)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get user"))
+		return
+	}
+
+	friendRequest, err := tx.FindFriendRequest(requestor.ID, target.ID, model.FriendRequestPending)
+	if err == data.ErrNotFound {
+		tx.Rollback()
+		apierror.Abort(c, apierror.New(apierror.NotFound, "Pending friend request does not exist"))
+		return
+	}
+	if err != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to get pending friend request %s - %s: %s", requestor.Email, target.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get friend request"))
+		return
+	}
+
+	if status == model.FriendRequestAccepted {
+		if err := suspended(requestor, target); err != nil {
+			tx.Rollback()
+			apierror.Abort(c, err)
+			return
+		}
+
+		// Block that happens after request was sent still veto the friend connection
+		blocked, err := isBlockedEitherWay(tx, requestor.ID, target.ID)
+		if err != nil {
+			tx.Rollback()
+			glog.Errorf("Failed to check block %s - %s: %s", requestor.Email, target.Email, err)
+			apierror.Abort(c, apierror.New(apierror.Internal, "Failed to check block"))
+			return
+		}
+		if blocked {
+			tx.Rollback()
+			apierror.Abort(c, apierror.New(apierror.Blocked, "Friend connection are being blocked"))
+			return
+		}
+
+		friend := model.Friend{UserID: requestor.ID, FriendID: target.ID, Source: model.FriendSourceRequest}
+		if err := tx.AddFriend(&friend); err != nil {
+			tx.Rollback()
+			glog.Errorf("Failed to create friend connection %s - %s: %s", requestor.Email, target.Email, err)
+			apierror.Abort(c, apierror.New(apierror.Internal, "Failed to create friend connection"))
+			return
+		}
+
+		audit.Record(c, model.AuditFriendConnected, requestor.Email, target.Email, friend.Source)
+	}
+
+	if err := tx.UpdateFriendRequestStatus(friendRequest, status); err != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to update friend request %s: %s", friendRequest.ID, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to update friend request"))
+		return
+	}
+
+	audit.Record(c, requestActions[status], requestor.Email, target.Email, "")
+	if !audit.Commit(c, tx) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "status": status})
+}
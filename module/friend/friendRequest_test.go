@@ -0,0 +1,229 @@
+package friend
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmgo/common/apierror"
+	"fmgo/common/auth"
+	"fmgo/common/config"
+	"fmgo/common/data"
+	"fmgo/common/data/model"
+	"fmgo/common/mailaddr"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const secret = "friend-test-secret"
+
+// token sign HS256 bearer token of given email
+func token(t *testing.T, email string) string {
+	payload, err := json.Marshal(map[string]interface{}{"email": email, "exp": time.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatalf("Marshal: %s", err)
+	}
+	input := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(input))
+	return input + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// postAs send JSON body to path on behalf of given email, returning status and decoded response body
+func postAs(t *testing.T, router *gin.Engine, email, path, body string) (int, map[string]interface{}) {
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token(t, email))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%s responded with invalid JSON %q: %s", path, w.Body.String(), err)
+	}
+
+	return w.Code, resp
+}
+
+// requestStatus get status of the only friend request between requestor and target
+func requestStatus(t *testing.T, store data.GraphStore, requestor, target string) string {
+	user, err := store.FindUser(requestor)
+	if err != nil {
+		t.Fatalf("FindUser: %s", err)
+	}
+
+	for _, status := range []string{model.FriendRequestPending, model.FriendRequestAccepted, model.FriendRequestRejected, model.FriendRequestCancelled} {
+		requests, err := store.FriendRequests(user.ID, true, status)
+		if err != nil {
+			t.Fatalf("FriendRequests: %s", err)
+		}
+		for _, r := range requests {
+			if r.Target.Email == target {
+				return status
+			}
+		}
+	}
+
+	return ""
+}
+
+func TestSendRequest(t *testing.T) {
+	store := data.NewMemoryStore()
+	users := connectAll(t, store, "andy-kate", "john")
+	if err := store.Block(users["john"].ID, users["andy"].ID); err != nil {
+		t.Fatalf("Block: %s", err)
+	}
+	router := newRouter(store)
+
+	status, resp := post(t, router, "/friend/request/send", `{"requestor": "mike@example.com", "target": "Andy@Example.com"}`)
+	if status != http.StatusOK || resp["id"] == nil {
+		t.Fatalf("send responded %d %v", status, resp)
+	}
+
+	tests := []struct {
+		body   string
+		status int
+		code   string
+	}{
+		{`{"requestor": "mike@example.com", "target": "andy@example.com"}`, http.StatusConflict, string(apierror.AlreadyExists)},
+		{`{"requestor": "andy@example.com", "target": "mike@example.com"}`, http.StatusConflict, string(apierror.AlreadyExists)},
+		{`{"requestor": "andy@example.com", "target": "kate@example.com"}`, http.StatusConflict, string(apierror.AlreadyExists)},
+		{`{"requestor": "andy@example.com", "target": "john@example.com"}`, http.StatusForbidden, string(apierror.Blocked)},
+		{`{"requestor": "john@example.com", "target": "andy@example.com"}`, http.StatusForbidden, string(apierror.Blocked)},
+		{`{"requestor": "andy@example.com", "target": "ANDY@example.com"}`, http.StatusBadRequest, string(apierror.SelfReference)},
+		{`{"requestor": "andy@example.com"}`, http.StatusBadRequest, string(apierror.ValidationFailed)},
+	}
+	for _, test := range tests {
+		status, resp := post(t, router, "/friend/request/send", test.body)
+		if status != test.status || errorCode(resp) != test.code {
+			t.Errorf("send %s responded %d %v, want %d %s", test.body, status, resp, test.status, test.code)
+		}
+	}
+
+	status, resp = post(t, router, "/friend/request/list", `{"email": "andy@example.com"}`)
+	if requests, _ := resp["requests"].([]interface{}); status != http.StatusOK || len(requests) != 1 {
+		t.Fatalf("incoming request list responded %d %v, want the one from mike", status, resp)
+	}
+}
+
+func TestRespondRequest(t *testing.T) {
+	store := data.NewMemoryStore()
+	router := newRouter(store)
+	for _, body := range []string{
+		`{"requestor": "andy@example.com", "target": "john@example.com"}`,
+		`{"requestor": "andy@example.com", "target": "kate@example.com"}`,
+		`{"requestor": "mike@example.com", "target": "andy@example.com"}`,
+	} {
+		if status, resp := post(t, router, "/friend/request/send", body); status != http.StatusOK {
+			t.Fatalf("send %s responded %d %v", body, status, resp)
+		}
+	}
+
+	// accepting creates friendship
+	status, resp := post(t, router, "/friend/request/accept", `{"requestor": "andy@example.com", "target": "John@Example.com"}`)
+	if status != http.StatusOK || resp["status"] != model.FriendRequestAccepted {
+		t.Fatalf("accept responded %d %v", status, resp)
+	}
+	andy, _ := store.FindUser("andy@example.com")
+	john, _ := store.FindUser("john@example.com")
+	if connected, _ := store.IsFriend(andy.ID, john.ID); !connected {
+		t.Fatal("accepted request did not connect requestor and target")
+	}
+
+	// block made after request was sent vetoes it, leaving it pending
+	kate, _ := store.FindUser("kate@example.com")
+	if err := store.Block(kate.ID, andy.ID); err != nil {
+		t.Fatalf("Block: %s", err)
+	}
+	status, resp = post(t, router, "/friend/request/accept", `{"requestor": "andy@example.com", "target": "kate@example.com"}`)
+	if status != http.StatusForbidden || errorCode(resp) != string(apierror.Blocked) {
+		t.Fatalf("accept of blocked request responded %d %v", status, resp)
+	}
+	if connected, _ := store.IsFriend(andy.ID, kate.ID); connected || requestStatus(t, store, "andy@example.com", "kate@example.com") != model.FriendRequestPending {
+		t.Fatal("blocked request was accepted")
+	}
+
+	status, resp = post(t, router, "/friend/request/reject", `{"requestor": "mike@example.com", "target": "andy@example.com"}`)
+	if status != http.StatusOK || resp["status"] != model.FriendRequestRejected {
+		t.Fatalf("reject responded %d %v", status, resp)
+	}
+
+	// answered request is no longer pending, whatever the answer
+	tests := []struct {
+		path string
+		body string
+	}{
+		{"/friend/request/accept", `{"requestor": "andy@example.com", "target": "john@example.com"}`},
+		{"/friend/request/reject", `{"requestor": "andy@example.com", "target": "john@example.com"}`},
+		{"/friend/request/cancel", `{"requestor": "andy@example.com", "target": "john@example.com"}`},
+		{"/friend/request/accept", `{"requestor": "mike@example.com", "target": "andy@example.com"}`},
+		{"/friend/request/cancel", `{"requestor": "mike@example.com", "target": "andy@example.com"}`},
+		// request runs from requestor to target only
+		{"/friend/request/accept", `{"requestor": "kate@example.com", "target": "andy@example.com"}`},
+	}
+	for _, test := range tests {
+		status, resp := post(t, router, test.path, test.body)
+		if status != http.StatusNotFound || errorCode(resp) != string(apierror.NotFound) {
+			t.Errorf("%s %s responded %d %v, want 404", test.path, test.body, status, resp)
+		}
+	}
+
+	status, resp = post(t, router, "/friend/request/accept", `{"requestor": "andy@example.com", "target": "nobody@example.com"}`)
+	if status != http.StatusNotFound || errorCode(resp) != string(apierror.UserNotFound) {
+		t.Fatalf("accept from unknown user responded %d %v", status, resp)
+	}
+}
+
+func TestCancelRequest(t *testing.T) {
+	store := data.NewMemoryStore()
+	authenticator, err := auth.NewAuthenticator(config.AuthConfiguration{Enabled: true, Secret: secret}, mailaddr.NewCanonicalizer(config.EmailConfiguration{CaseFolding: true}), store)
+	if err != nil {
+		t.Fatalf("NewAuthenticator: %s", err)
+	}
+	router := newRouter(store, authenticator.Middleware())
+
+	body := `{"requestor": "andy@example.com", "target": "john@example.com"}`
+	if status, resp := postAs(t, router, "john@example.com", "/friend/request/send", body); status != http.StatusForbidden {
+		t.Fatalf("send on behalf of requestor by target responded %d %v", status, resp)
+	}
+	if status, resp := postAs(t, router, "andy@example.com", "/friend/request/send", body); status != http.StatusOK {
+		t.Fatalf("send responded %d %v", status, resp)
+	}
+
+	// target may only accept or reject, requestor may only cancel
+	for _, test := range []struct {
+		caller string
+		path   string
+	}{
+		{"john@example.com", "/friend/request/cancel"},
+		{"andy@example.com", "/friend/request/accept"},
+		{"andy@example.com", "/friend/request/reject"},
+		{"kate@example.com", "/friend/request/cancel"},
+	} {
+		status, resp := postAs(t, router, test.caller, test.path, body)
+		if status != http.StatusForbidden || errorCode(resp) != string(apierror.Forbidden) {
+			t.Errorf("%s by %s responded %d %v, want 403", test.path, test.caller, status, resp)
+		}
+	}
+	if got := requestStatus(t, store, "andy@example.com", "john@example.com"); got != model.FriendRequestPending {
+		t.Fatalf("request is %s after refused answers", got)
+	}
+
+	status, resp := postAs(t, router, "andy@example.com", "/friend/request/cancel", body)
+	if status != http.StatusOK || resp["status"] != model.FriendRequestCancelled {
+		t.Fatalf("cancel by requestor responded %d %v", status, resp)
+	}
+	if got := requestStatus(t, store, "andy@example.com", "john@example.com"); got != model.FriendRequestCancelled {
+		t.Fatalf("request is %s after cancel", got)
+	}
+
+	// cancelled request no longer stands in the way of a new one
+	if status, resp := postAs(t, router, "john@example.com", "/friend/request/send", `{"requestor": "john@example.com", "target": "andy@example.com"}`); status != http.StatusOK {
+		t.Fatalf("send after cancel responded %d %v", status, resp)
+	}
+}
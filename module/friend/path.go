@@ -0,0 +1,216 @@
+package friend
+
+import (
+	"fmgo/common/apierror"
+	"fmgo/common/auth"
+	"fmgo/common/data"
+	"fmgo/common/tenant"
+	"fmgo/common/validation"
+	"fmgo/module/friend/request"
+	"fmgo/module/friend/response"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/golang/glog"
+	"github.com/satori/go.uuid"
+)
+
+const defaultMaxPathDepth = 6
+
+// GetPath action to get shortest friend connection chain between two user
+func (ctrl *Controller) GetPath(c *gin.Context) {
+	// deserialize and validate POST data
+	var req request.GetPathRequest
+	if !validation.Bind(c, &req, binding.JSON) {
+		return
+	}
+
+	if !auth.Authorize(c, ctrl.canonicalizer.Canonicalize(req.Source)) {
+		return
+	}
+
+	if ctrl.canonicalizer.Canonicalize(req.Source) == ctrl.canonicalizer.Canonicalize(req.Target) {
+		apierror.Abort(c, apierror.New(apierror.SelfReference, "Could not find path to self"))
+		return
+	}
+
+	// requested depth can only narrow down the configured one
+	maxDepth := ctrl.graphConfig.MaxPathDepth
+	if maxDepth <= 0 {
+		maxDepth = defaultMaxPathDepth
+	}
+	if req.MaxDepth > 0 && req.MaxDepth < maxDepth {
+		maxDepth = req.MaxDepth
+	}
+
+	store := tenant.Store(c, ctrl.store)
+	source, err1 := store.FindUser(ctrl.canonicalizer.Canonicalize(req.Source))
+	target, err2 := store.FindUser(ctrl.canonicalizer.Canonicalize(req.Target))
+	if err1 == data.ErrNotFound || err2 == data.ErrNotFound {
+		email := req.Source
+		if err2 == data.ErrNotFound {
+			email = req.Target
+		}
+		apierror.Abort(c, apierror.New(apierror.UserNotFound, "User with email %s does not exist", ctrl.canonicalizer.Canonicalize(email)))
+		return
+	}
+	if err1 != nil || err2 != nil {
+		glog.Errorf("Failed to get user %s - %s: %s %s", req.Source, req.Target, err1, err2)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get user"))
+		return
+	}
+
+	ids, err := shortestPath(store, source.ID, target.ID, maxDepth)
+	if err != nil {
+		glog.Errorf("Failed to find path between %s and %s: %s", source.Email, target.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to find connection path"))
+		return
+	}
+
+	path := make([]string, 0)
+	if len(ids) > 0 {
+		users, err := store.FindUsers(ids)
+		if err != nil {
+			glog.Errorf("Failed to get users on path between %s and %s: %s", source.Email, target.Email, err)
+			apierror.Abort(c, apierror.New(apierror.Internal, "Failed to find connection path"))
+			return
+		}
+
+		emails := make(map[uuid.UUID]string)
+		for _, u := range users {
+			emails[u.ID] = u.Email
+		}
+		for _, id := range ids {
+			path = append(path, emails[id])
+		}
+	}
+
+	resp := response.PathResponse{
+		Success: true,
+		Found:   len(path) > 0,
+		Path:    path,
+	}
+	if resp.Found {
+		resp.Degree = len(path) - 1
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// shortestPath run bidirectional breadth first search over friend connection, expanding the smaller frontier
+// on each step. Connection where either side blocked the other is never traversed, nor is suspended user other than
+// source and target passed through. It returns user ids from source to target, or empty slice when there is no path
+// within maxDepth.
+func shortestPath(store data.GraphStore, sourceID, targetID uuid.UUID, maxDepth int) ([]uuid.UUID, error) {
+	forward := map[uuid.UUID]uuid.UUID{sourceID: uuid.Nil}
+	backward := map[uuid.UUID]uuid.UUID{targetID: uuid.Nil}
+	forwardDist := map[uuid.UUID]int{sourceID: 0}
+	backwardDist := map[uuid.UUID]int{targetID: 0}
+	forwardFrontier := []uuid.UUID{sourceID}
+	backwardFrontier := []uuid.UUID{targetID}
+
+	for depth := 0; depth < maxDepth; depth++ {
+		if len(forwardFrontier) == 0 || len(backwardFrontier) == 0 {
+			return nil, nil
+		}
+
+		frontier, visited, dist, otherDist := &forwardFrontier, forward, forwardDist, backwardDist
+		if len(backwardFrontier) < len(forwardFrontier) {
+			frontier, visited, dist, otherDist = &backwardFrontier, backward, backwardDist, forwardDist
+		}
+
+		edges, err := store.FriendEdges(*frontier)
+		if err != nil {
+			return nil, err
+		}
+
+		blocks, err := store.BlockEdges(*frontier)
+		if err != nil {
+			return nil, err
+		}
+
+		blocked := make(map[data.Edge]bool)
+		for _, b := range blocks {
+			blocked[b] = true
+			blocked[data.Edge{UserID: b.TargetID, TargetID: b.UserID}] = true
+		}
+
+		suspended, err := suspendedUsers(store, edges, visited, sourceID, targetID)
+		if err != nil {
+			return nil, err
+		}
+
+		// expand the whole level before picking meeting point so the shortest one wins
+		meet, best := uuid.Nil, -1
+		next := make([]uuid.UUID, 0)
+		for _, e := range edges {
+			if blocked[e] || suspended[e.TargetID] {
+				continue
+			}
+			if _, ok := visited[e.TargetID]; ok {
+				continue
+			}
+
+			visited[e.TargetID] = e.UserID
+			dist[e.TargetID] = dist[e.UserID] + 1
+			next = append(next, e.TargetID)
+
+			if d, ok := otherDist[e.TargetID]; ok {
+				if total := dist[e.TargetID] + d; best < 0 || total < best {
+					meet, best = e.TargetID, total
+				}
+			}
+		}
+		*frontier = next
+
+		if best >= 0 {
+			return joinPath(forward, backward, meet), nil
+		}
+	}
+
+	return nil, nil
+}
+
+// suspendedUsers find suspended user among those reached by edges for the first time, source and target excluded
+func suspendedUsers(store data.GraphStore, edges []data.Edge, visited map[uuid.UUID]uuid.UUID, sourceID, targetID uuid.UUID) (map[uuid.UUID]bool, error) {
+	ids := make([]uuid.UUID, 0)
+	seen := make(map[uuid.UUID]bool)
+	for _, e := range edges {
+		if _, ok := visited[e.TargetID]; ok || seen[e.TargetID] || e.TargetID == sourceID || e.TargetID == targetID {
+			continue
+		}
+
+		seen[e.TargetID] = true
+		ids = append(ids, e.TargetID)
+	}
+
+	suspended := make(map[uuid.UUID]bool)
+	if len(ids) == 0 {
+		return suspended, nil
+	}
+
+	users, err := store.FindUsers(ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		if u.Suspended() {
+			suspended[u.ID] = true
+		}
+	}
+
+	return suspended, nil
+}
+
+// joinPath combine both half of bidirectional search at meeting point
+func joinPath(forward, backward map[uuid.UUID]uuid.UUID, meet uuid.UUID) []uuid.UUID {
+	path := make([]uuid.UUID, 0)
+	for id := meet; id != uuid.Nil; id = forward[id] {
+		path = append([]uuid.UUID{id}, path...)
+	}
+	for id := backward[meet]; id != uuid.Nil; id = backward[id] {
+		path = append(path, id)
+	}
+
+	return path
+}
@@ -0,0 +1,192 @@
+package friend
+
+import (
+	"fmgo/common/apierror"
+	"fmgo/common/data"
+	"fmgo/common/data/model"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+// connectAll create user of every email in pairs and connect each pair, returning users by the part of email before @
+func connectAll(t *testing.T, store data.GraphStore, pairs ...string) map[string]*model.User {
+	users := make(map[string]*model.User)
+	for _, pair := range pairs {
+		var ids []uuid.UUID
+		for _, name := range strings.Split(pair, "-") {
+			user, err := store.FindOrCreateUser(name + "@example.com")
+			if err != nil {
+				t.Fatalf("FindOrCreateUser: %s", err)
+			}
+			users[name] = user
+			ids = append(ids, user.ID)
+		}
+		if len(ids) == 2 {
+			if err := store.AddFriend(&model.Friend{UserID: ids[0], FriendID: ids[1], Source: model.FriendSourceAPI}); err != nil {
+				t.Fatalf("AddFriend: %s", err)
+			}
+		}
+	}
+
+	return users
+}
+
+// suspend mark user as suspended by support staff
+func suspend(t *testing.T, store data.GraphStore, user *model.User) {
+	now := time.Now()
+	user.SuspendedAt = &now
+	user.SuspendReason = "spam"
+	if err := store.UpdateSuspension(user); err != nil {
+		t.Fatalf("UpdateSuspension: %s", err)
+	}
+}
+
+// names get the part before @ of email of every user on path
+func names(t *testing.T, store data.GraphStore, ids []uuid.UUID) string {
+	parts := make([]string, 0, len(ids))
+	for _, id := range ids {
+		users, err := store.FindUsers([]uuid.UUID{id})
+		if err != nil || len(users) != 1 {
+			t.Fatalf("FindUsers(%s) got %v, %v", id, users, err)
+		}
+		parts = append(parts, strings.Split(users[0].Email, "@")[0])
+	}
+
+	return strings.Join(parts, "-")
+}
+
+func TestShortestPath(t *testing.T) {
+	store := data.NewMemoryStore()
+	// a-b-c-d-e chain with shortcut a-f-d, and g alone
+	users := connectAll(t, store, "a-b", "b-c", "c-d", "d-e", "a-f", "f-d", "g")
+
+	tests := []struct {
+		source   string
+		target   string
+		maxDepth int
+		want     string
+	}{
+		{"a", "b", 1, "a-b"},
+		{"b", "a", 6, "b-a"},
+		{"a", "c", 6, "a-b-c"},
+		{"a", "d", 6, "a-f-d"},
+		{"a", "e", 6, "a-f-d-e"},
+		{"e", "a", 6, "e-d-f-a"},
+		{"a", "e", 3, "a-f-d-e"},
+		{"a", "e", 2, ""},
+		{"b", "e", 2, ""},
+		{"a", "g", 6, ""},
+		{"g", "a", 6, ""},
+	}
+	for _, test := range tests {
+		ids, err := shortestPath(store, users[test.source].ID, users[test.target].ID, test.maxDepth)
+		if err != nil {
+			t.Fatalf("shortestPath: %s", err)
+		}
+		if got := names(t, store, ids); got != test.want {
+			t.Errorf("path %s to %s within %d is %q, want %q", test.source, test.target, test.maxDepth, got, test.want)
+		}
+	}
+}
+
+func TestShortestPathAvoids(t *testing.T) {
+	tests := []struct {
+		name   string
+		setup  func(store data.GraphStore, users map[string]*model.User) error
+		source string
+		target string
+		want   string
+	}{
+		{"nothing", func(data.GraphStore, map[string]*model.User) error { return nil }, "a", "d", "a-b-d"},
+		{"intermediate blocking next one", func(store data.GraphStore, users map[string]*model.User) error {
+			return store.Block(users["b"].ID, users["d"].ID)
+		}, "a", "d", "a-c-e-d"},
+		{"source blocking intermediate", func(store data.GraphStore, users map[string]*model.User) error {
+			return store.Block(users["a"].ID, users["b"].ID)
+		}, "a", "d", "a-c-e-d"},
+		{"block elsewhere on graph", func(store data.GraphStore, users map[string]*model.User) error {
+			return store.Block(users["a"].ID, users["d"].ID)
+		}, "a", "d", "a-b-d"},
+		{"suspended intermediate", func(store data.GraphStore, users map[string]*model.User) error {
+			suspend(t, store, users["b"])
+			return nil
+		}, "a", "d", "a-c-e-d"},
+		{"every route cut", func(store data.GraphStore, users map[string]*model.User) error {
+			suspend(t, store, users["b"])
+			return store.Block(users["e"].ID, users["c"].ID)
+		}, "a", "d", ""},
+		{"suspended source and target", func(store data.GraphStore, users map[string]*model.User) error {
+			suspend(t, store, users["a"])
+			suspend(t, store, users["d"])
+			return nil
+		}, "a", "d", "a-b-d"},
+	}
+	for _, test := range tests {
+		store := data.NewMemoryStore()
+		// a-b-d is the short way, a-c-e-d the long one
+		users := connectAll(t, store, "a-b", "b-d", "a-c", "c-e", "e-d")
+		if err := test.setup(store, users); err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		ids, err := shortestPath(store, users[test.source].ID, users[test.target].ID, 6)
+		if err != nil {
+			t.Fatalf("shortestPath: %s", err)
+		}
+		if got := names(t, store, ids); got != test.want {
+			t.Errorf("%s: path is %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestGetPath(t *testing.T) {
+	store := data.NewMemoryStore()
+	// router caps depth at 3
+	connectAll(t, store, "a-b", "b-c", "c-d", "d-e")
+	router := newRouter(store)
+
+	tests := []struct {
+		body   string
+		status int
+		code   string
+		path   []string
+	}{
+		{`{"source": "a@example.com", "target": "b@example.com"}`, http.StatusOK, "", []string{"a@example.com", "b@example.com"}},
+		{`{"source": "a@example.com", "target": "d@example.com"}`, http.StatusOK, "", []string{"a@example.com", "b@example.com", "c@example.com", "d@example.com"}},
+		{`{"source": "a@example.com", "target": "d@example.com", "maxDepth": 2}`, http.StatusOK, "", []string{}},
+		{`{"source": "a@example.com", "target": "e@example.com"}`, http.StatusOK, "", []string{}},
+		{`{"source": "a@example.com", "target": "e@example.com", "maxDepth": 10}`, http.StatusOK, "", []string{}},
+		{`{"source": "a@example.com", "target": "A@Example.com"}`, http.StatusBadRequest, string(apierror.SelfReference), nil},
+		{`{"source": "a@example.com", "target": "z@example.com"}`, http.StatusNotFound, string(apierror.UserNotFound), nil},
+		{`{"source": "a@example.com", "target": "b@example.com", "maxDepth": -1}`, http.StatusBadRequest, string(apierror.ValidationFailed), nil},
+	}
+	for _, test := range tests {
+		status, resp := post(t, router, "/friend/path", test.body)
+		if status != test.status || errorCode(resp) != test.code {
+			t.Errorf("path %s responded %d %v, want %d %s", test.body, status, resp, test.status, test.code)
+			continue
+		}
+		if test.path == nil {
+			continue
+		}
+
+		path, _ := resp["path"].([]interface{})
+		if len(path) != len(test.path) || resp["found"] != (len(test.path) > 0) {
+			t.Errorf("path %s responded %v, want %v", test.body, resp, test.path)
+			continue
+		}
+		for i := range test.path {
+			if path[i] != test.path[i] {
+				t.Errorf("path %s responded %v, want %v", test.body, path, test.path)
+				break
+			}
+		}
+		if len(test.path) > 0 && resp["degree"] != float64(len(test.path)-1) {
+			t.Errorf("path %s responded degree %v, want %d", test.body, resp["degree"], len(test.path)-1)
+		}
+	}
+}
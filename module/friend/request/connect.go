@@ -3,4 +3,6 @@ package request
 // ConnectRequest model
 type ConnectRequest struct {
 	Friends []string `json:"friends" binding:"required,len=2"`
+	Source  string   `json:"source" binding:"omitempty,eq=api|eq=import"`
+	Label   string   `json:"label" binding:"omitempty,max=100"`
 }
@@ -0,0 +1,7 @@
+package request
+
+// DisconnectRequest model
+type DisconnectRequest struct {
+	Friends             []string `json:"friends" binding:"required,len=2"`
+	RemoveSubscriptions bool     `json:"removeSubscriptions"`
+}
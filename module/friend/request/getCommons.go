@@ -3,4 +3,11 @@ package request
 // GetCommonsRequest model
 type GetCommonsRequest struct {
 	Friends []string `json:"friends" binding:"required,len=2"`
+	Limit   int      `json:"limit" binding:"omitempty,min=1,max=1000"`
+	Cursor  string   `json:"cursor"`
+	Sort    string   `json:"sort" binding:"omitempty,eq=email|eq=connectedAt"`
+	Order   string   `json:"order" binding:"omitempty,eq=asc|eq=desc"`
+	Prefix  string   `json:"prefix"`
+	// IncludeProfiles add profile summary of every common friend in connections
+	IncludeProfiles bool `json:"includeProfiles"`
 }
@@ -0,0 +1,8 @@
+package request
+
+// GetFriendRequestsRequest model
+type GetFriendRequestsRequest struct {
+	Email     string `json:"email" binding:"required,email"`
+	Direction string `json:"direction" binding:"omitempty,eq=incoming|eq=outgoing"`
+	Status    string `json:"status" binding:"omitempty,eq=pending|eq=accepted|eq=rejected|eq=cancelled"`
+}
@@ -2,5 +2,12 @@ package request
 
 // GetFriendRequests model
 type GetFriendRequests struct {
-	Email string `json:"email" binding:"required,email"`
+	Email  string `json:"email" binding:"required,email"`
+	Limit  int    `json:"limit" binding:"omitempty,min=1,max=1000"`
+	Cursor string `json:"cursor"`
+	Sort   string `json:"sort" binding:"omitempty,eq=email|eq=connectedAt"`
+	Order  string `json:"order" binding:"omitempty,eq=asc|eq=desc"`
+	Prefix string `json:"prefix"`
+	// IncludeProfiles add profile summary of every friend in connections
+	IncludeProfiles bool `json:"includeProfiles"`
 }
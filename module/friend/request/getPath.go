@@ -0,0 +1,8 @@
+package request
+
+// GetPathRequest model
+type GetPathRequest struct {
+	Source   string `json:"source" binding:"required,email"`
+	Target   string `json:"target" binding:"required,email"`
+	MaxDepth int    `json:"maxDepth" binding:"omitempty,min=1"`
+}
@@ -0,0 +1,7 @@
+package request
+
+// GetSuggestionsRequest model
+type GetSuggestionsRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Limit int    `json:"limit" binding:"omitempty,min=1,max=100"`
+}
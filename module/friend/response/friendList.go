@@ -1,8 +1,29 @@
 package response
 
+import "time"
+
 // FriendListResponse model
 type FriendListResponse struct {
-	Success bool     `json:"success"`
-	Friends []string `json:"friends"`
-	Count   int      `json:"count"`
+	Success     bool             `json:"success"`
+	Friends     []string         `json:"friends"`
+	Connections []ConnectionItem `json:"connections"`
+	Count       int              `json:"count"`
+	Total       int              `json:"total"`
+	NextCursor  string           `json:"nextCursor,omitempty"`
+}
+
+// ConnectionItem model
+type ConnectionItem struct {
+	Email       string    `json:"email"`
+	ConnectedAt time.Time `json:"connectedAt"`
+	Source      string    `json:"source"`
+	Label       string    `json:"label,omitempty"`
+	// Profile only set when client asks for it
+	Profile *ProfileSummary `json:"profile,omitempty"`
+}
+
+// ProfileSummary model
+type ProfileSummary struct {
+	DisplayName string `json:"displayName"`
+	AvatarURL   string `json:"avatarUrl"`
 }
@@ -0,0 +1,20 @@
+package response
+
+import "time"
+
+// FriendRequestListResponse model
+type FriendRequestListResponse struct {
+	Success  bool                `json:"success"`
+	Requests []FriendRequestItem `json:"requests"`
+	Count    int                 `json:"count"`
+}
+
+// FriendRequestItem model
+type FriendRequestItem struct {
+	ID          string     `json:"id"`
+	Requestor   string     `json:"requestor"`
+	Target      string     `json:"target"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	RespondedAt *time.Time `json:"respondedAt,omitempty"`
+}
@@ -0,0 +1,9 @@
+package response
+
+// PathResponse model
+type PathResponse struct {
+	Success bool     `json:"success"`
+	Found   bool     `json:"found"`
+	Degree  int      `json:"degree"`
+	Path    []string `json:"path"`
+}
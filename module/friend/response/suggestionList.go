@@ -0,0 +1,15 @@
+package response
+
+// SuggestionListResponse model
+type SuggestionListResponse struct {
+	Success     bool             `json:"success"`
+	Suggestions []SuggestionItem `json:"suggestions"`
+	Count       int              `json:"count"`
+}
+
+// SuggestionItem model
+type SuggestionItem struct {
+	Email         string   `json:"email"`
+	MutualCount   int      `json:"mutualCount"`
+	MutualFriends []string `json:"mutualFriends"`
+}
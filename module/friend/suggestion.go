@@ -0,0 +1,153 @@
+package friend
+
+import (
+	"fmgo/common/apierror"
+	"fmgo/common/auth"
+	"fmgo/common/data"
+	"fmgo/common/tenant"
+	"fmgo/common/validation"
+	"fmgo/module/friend/request"
+	"fmgo/module/friend/response"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/golang/glog"
+	"github.com/satori/go.uuid"
+)
+
+const (
+	defaultSuggestionLimit = 10
+	mutualFriendSampleSize = 3
+)
+
+// GetSuggestions action to get friend of friend suggestion ranked by number of mutual friend
+func (ctrl *Controller) GetSuggestions(c *gin.Context) {
+	// deserialize and validate POST data
+	var req request.GetSuggestionsRequest
+	if !validation.Bind(c, &req, binding.JSON) {
+		return
+	}
+
+	if !auth.Authorize(c, ctrl.canonicalizer.Canonicalize(req.Email)) {
+		return
+	}
+
+	limit := req.Limit
+	if limit == 0 {
+		limit = defaultSuggestionLimit
+	}
+
+	store := tenant.Store(c, ctrl.store)
+	user, err := store.FindUser(ctrl.canonicalizer.Canonicalize(req.Email))
+	if err == data.ErrNotFound {
+		apierror.Abort(c, apierror.New(apierror.UserNotFound, "User with email %s does not exist", req.Email))
+		return
+	}
+	if err != nil {
+		glog.Errorf("Failed to get user %s: %s", req.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get user"))
+		return
+	}
+
+	// first degree friends
+	direct, err := store.FriendEdges([]uuid.UUID{user.ID})
+	if err != nil {
+		glog.Errorf("Failed to get friends of %s: %s", user.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get friend list"))
+		return
+	}
+
+	excluded := map[uuid.UUID]bool{user.ID: true}
+	friendIDs := make([]uuid.UUID, 0)
+	for _, e := range direct {
+		excluded[e.TargetID] = true
+		friendIDs = append(friendIDs, e.TargetID)
+	}
+
+	// anyone blocking or being blocked by user should never be suggested
+	blocks, err := store.BlockEdges([]uuid.UUID{user.ID})
+	if err != nil {
+		glog.Errorf("Failed to get blocks of %s: %s", user.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get block list"))
+		return
+	}
+	for _, e := range blocks {
+		excluded[e.UserID] = true
+		excluded[e.TargetID] = true
+	}
+
+	// second degree friends grouped by candidate, the value is the mutual friends
+	second, err := store.FriendEdges(friendIDs)
+	if err != nil {
+		glog.Errorf("Failed to get friends of friends of %s: %s", user.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get friend list"))
+		return
+	}
+
+	mutuals := make(map[uuid.UUID][]uuid.UUID)
+	for _, e := range second {
+		if excluded[e.TargetID] {
+			continue
+		}
+
+		mutuals[e.TargetID] = append(mutuals[e.TargetID], e.UserID)
+	}
+
+	userIDs := make([]uuid.UUID, 0)
+	for id := range mutuals {
+		userIDs = append(userIDs, id)
+	}
+	userIDs = append(userIDs, friendIDs...)
+
+	emails := make(map[uuid.UUID]string)
+	if len(mutuals) > 0 {
+		users, err := store.FindUsers(userIDs)
+		if err != nil {
+			glog.Errorf("Failed to get suggested users for %s: %s", user.Email, err)
+			apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get suggested users"))
+			return
+		}
+
+		for _, u := range users {
+			emails[u.ID] = u.Email
+		}
+	}
+
+	suggestions := make([]response.SuggestionItem, 0)
+	for id, mutualIDs := range mutuals {
+		mutualFriends := make([]string, 0)
+		for _, mutualID := range mutualIDs {
+			mutualFriends = append(mutualFriends, emails[mutualID])
+		}
+		sort.Strings(mutualFriends)
+		if len(mutualFriends) > mutualFriendSampleSize {
+			mutualFriends = mutualFriends[:mutualFriendSampleSize]
+		}
+
+		suggestions = append(suggestions, response.SuggestionItem{
+			Email:         emails[id],
+			MutualCount:   len(mutualIDs),
+			MutualFriends: mutualFriends,
+		})
+	}
+
+	// most mutual friend first, then alphabetically to keep the result stable
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].MutualCount != suggestions[j].MutualCount {
+			return suggestions[i].MutualCount > suggestions[j].MutualCount
+		}
+		return suggestions[i].Email < suggestions[j].Email
+	})
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+
+	resp := response.SuggestionListResponse{
+		Success:     true,
+		Suggestions: suggestions,
+		Count:       len(suggestions),
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,78 @@
+package friend
+
+import (
+	"fmgo/common/apierror"
+	"fmgo/common/data"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// suggested get email, mutual count and mutual friends of every suggestion in response
+func suggested(resp map[string]interface{}) [][]interface{} {
+	items, _ := resp["suggestions"].([]interface{})
+	got := make([][]interface{}, 0, len(items))
+	for _, item := range items {
+		s := item.(map[string]interface{})
+		got = append(got, []interface{}{s["email"], s["mutualCount"], s["mutualFriends"]})
+	}
+
+	return got
+}
+
+func TestGetSuggestions(t *testing.T) {
+	store := data.NewMemoryStore()
+	users := connectAll(t, store,
+		// friends of andy, who are friends among themselves as well
+		"andy-b", "andy-c", "andy-d", "andy-e", "b-c",
+		// x shares four friends with andy, v and w one each
+		"b-x", "c-x", "d-x", "e-x", "d-v", "b-w",
+		// y and z would be suggested if not for their blocks
+		"b-y", "c-y", "d-z",
+		// k is friend of friend of friend only
+		"x-k")
+	if err := store.Block(users["andy"].ID, users["y"].ID); err != nil {
+		t.Fatalf("Block: %s", err)
+	}
+	if err := store.Block(users["z"].ID, users["andy"].ID); err != nil {
+		t.Fatalf("Block: %s", err)
+	}
+	router := newRouter(store)
+
+	x := []interface{}{"x@example.com", float64(4), []interface{}{"b@example.com", "c@example.com", "d@example.com"}}
+	v := []interface{}{"v@example.com", float64(1), []interface{}{"d@example.com"}}
+	w := []interface{}{"w@example.com", float64(1), []interface{}{"b@example.com"}}
+	tests := []struct {
+		body string
+		want [][]interface{}
+	}{
+		{`{"email": "andy@example.com"}`, [][]interface{}{x, v, w}},
+		{`{"email": "Andy@Example.com", "limit": 2}`, [][]interface{}{x, v}},
+		{`{"email": "k@example.com"}`, [][]interface{}{
+			{"b@example.com", float64(1), []interface{}{"x@example.com"}},
+			{"c@example.com", float64(1), []interface{}{"x@example.com"}},
+			{"d@example.com", float64(1), []interface{}{"x@example.com"}},
+			{"e@example.com", float64(1), []interface{}{"x@example.com"}},
+		}},
+		// andy blocking y is never suggested to y either
+		{`{"email": "y@example.com"}`, [][]interface{}{
+			{"x@example.com", float64(2), []interface{}{"b@example.com", "c@example.com"}},
+			{"w@example.com", float64(1), []interface{}{"b@example.com"}},
+		}},
+	}
+	for _, test := range tests {
+		status, resp := post(t, router, "/friend/suggestions", test.body)
+		if status != http.StatusOK {
+			t.Errorf("suggestions %s responded %d %v", test.body, status, resp)
+			continue
+		}
+		if got := suggested(resp); !reflect.DeepEqual(got, test.want) || resp["count"] != float64(len(test.want)) {
+			t.Errorf("suggestions %s got %v, want %v", test.body, got, test.want)
+		}
+	}
+
+	status, resp := post(t, router, "/friend/suggestions", `{"email": "nobody@example.com"}`)
+	if status != http.StatusNotFound || errorCode(resp) != string(apierror.UserNotFound) {
+		t.Fatalf("suggestions of unknown user responded %d %v", status, resp)
+	}
+}
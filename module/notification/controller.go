@@ -1,110 +1,134 @@
 package notification
 
 import (
+	"fmgo/common/apierror"
+	"fmgo/common/audit"
+	"fmgo/common/auth"
+	"fmgo/common/config"
 	"fmgo/common/data"
 	"fmgo/common/data/model"
+	"fmgo/common/delivery"
+	"fmgo/common/mailaddr"
+	"fmgo/common/tenant"
+	"fmgo/common/validation"
 	"fmgo/module/notification/request"
-	"fmt"
+	"fmgo/module/notification/response"
 	"net/http"
-	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
 	"github.com/golang/glog"
-	"gopkg.in/go-playground/validator.v8"
+	"github.com/satori/go.uuid"
 )
 
+const defaultRecipientLimit = 100
+
 // Controller struct
 type Controller struct {
-	dbFactory *data.DBFactory
+	store         data.GraphStore
+	hub           *delivery.Hub
+	config        config.StreamConfiguration
+	canonicalizer *mailaddr.Canonicalizer
+	channels      []delivery.Channel
 }
 
-// NewController initialize new Friend Controller instance
-func NewController(dbFactory *data.DBFactory) *Controller {
-	return &Controller{dbFactory: dbFactory}
+// NewController initialize new Notification Controller instance, posted update is published to stream hub
+// and handed to every given delivery channel
+func NewController(store data.GraphStore, hub *delivery.Hub, cfg config.StreamConfiguration, canonicalizer *mailaddr.Canonicalizer,
+	channels ...delivery.Channel) *Controller {
+	return &Controller{store: store, hub: hub, config: cfg, canonicalizer: canonicalizer, channels: channels}
 }
 
 // Subscribe action to get notification
 func (ctrl *Controller) Subscribe(c *gin.Context) {
 	var req request.SubscribeRequest
-	var errors []string
-	if err := c.ShouldBindWith(&req, binding.JSON); err != nil {
-		ve, ok := err.(validator.ValidationErrors)
-		if ok {
-			for _, v := range ve {
-				msg := fmt.Sprintf("%s is %s", v.Field, v.Tag)
-				if v.Tag == "email" {
-					msg = fmt.Sprintf("%s is invalid", v.Field)
-				}
-				errors = append(errors, msg)
-			}
-		} else {
-			errors = append(errors, err.Error())
-		}
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"success": false, "errors": errors})
+	if !validation.Bind(c, &req, binding.JSON) {
+		return
+	}
+
+	if !auth.Authorize(c, ctrl.canonicalizer.Canonicalize(req.Requestor)) {
 		return
 	}
 
-	if strings.ToLower(req.Requestor) == strings.ToLower(req.Target) {
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"success": false, "errors": []string{"Could not subscribe to self"}})
+	if ctrl.canonicalizer.Canonicalize(req.Requestor) == ctrl.canonicalizer.Canonicalize(req.Target) {
+		apierror.Abort(c, apierror.New(apierror.SelfReference, "Could not subscribe to self"))
 		return
 	}
 
-	db, err := ctrl.dbFactory.DBConnection()
+	store := tenant.Store(c, ctrl.store)
+	tx, err := store.Begin()
 	if err != nil {
-		glog.Errorf("Failed to open db connection: %s", err)
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"success": false, "errors": []string{"Failed to open db connection"}})
+		glog.Errorf("Failed to create new db transaction: %s", err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to start new db transaction"))
 		return
 	}
-	defer db.Close()
 
-	tx := db.Begin()
-	if tx.Error != nil {
-		glog.Errorf("Failed to create new db transaction: %s", tx.Error)
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"success": false, "errors": []string{"Failed to start new db transaction"}})
+	normalizeRequestorEmail := ctrl.canonicalizer.Canonicalize(req.Requestor)
+	requestor, err := tx.FindOrCreateUser(normalizeRequestorEmail)
+	if err != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to create user %s: %s", normalizeRequestorEmail, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to create new user"))
 		return
 	}
 
-	var requestor, target model.User
-	normalizeRequestorEmail := strings.ToLower(req.Requestor)
-	if tx.First(&requestor, "email = ?", normalizeRequestorEmail).RecordNotFound() {
-		requestor = model.User{Email: normalizeRequestorEmail}
-		if err := tx.Create(&requestor).Error; err != nil {
-			tx.Rollback()
-			glog.Errorf("Failed to create user %s: %s", normalizeRequestorEmail, err)
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"success": false, "errors": []string{"Failed to create new user"}})
-			return
-		}
+	normalizeTargetEmail := ctrl.canonicalizer.Canonicalize(req.Target)
+	target, err := tx.FindOrCreateUser(normalizeTargetEmail)
+	if err != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to create user %s: %s", normalizeTargetEmail, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to create new user"))
+		return
 	}
 
-	normalizeTargetEmail := strings.ToLower(req.Target)
-	if tx.First(&target, "email = ?", normalizeTargetEmail).RecordNotFound() {
-		target = model.User{Email: normalizeTargetEmail}
-		if err := tx.Create(&target).Error; err != nil {
-			tx.Rollback()
-			glog.Errorf("Failed to create user %s: %s", normalizeTargetEmail, err)
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"success": false, "errors": []string{"Failed to create new user"}})
-			return
-		}
+	// both email may be alias of the same user
+	if requestor.ID == target.ID {
+		tx.Rollback()
+		apierror.Abort(c, apierror.New(apierror.SelfReference, "Could not subscribe to self"))
+		return
+	}
+
+	if requestor.Suspended() {
+		tx.Rollback()
+		apierror.Abort(c, apierror.New(apierror.Suspended, "User %s is suspended", requestor.Email))
+		return
 	}
 
 	// If requestor and target are friends and target blocked requestor then subscription will fail
-	if err := tx.Model(&requestor).Association("Friends").Find(&target).Error; err == nil {
-		if err := tx.Model(&target).Association("Blocks").Find(&requestor).Error; err == nil {
+	connected, err := tx.IsFriend(requestor.ID, target.ID)
+	if err != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to check friend connection %s - %s: %s", requestor.Email, target.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to check friend connection"))
+		return
+	}
+
+	if connected {
+		blocked, err := tx.IsBlocked(target.ID, requestor.ID)
+		if err != nil {
 			tx.Rollback()
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"success": false, "errors": []string{"Requestor is being blocked by target"}})
+			glog.Errorf("Failed to check block %s - %s: %s", target.Email, requestor.Email, err)
+			apierror.Abort(c, apierror.New(apierror.Internal, "Failed to check block"))
+			return
+		}
+		if blocked {
+			tx.Rollback()
+			apierror.Abort(c, apierror.New(apierror.Blocked, "Requestor is being blocked by target"))
 			return
 		}
 	}
 
-	if err := tx.Model(&requestor).Association("Notifications").Find(&target).Error; err != nil && err.Error() == "record not found" {
-		tx.Model(&requestor).Association("Notifications").Append(&target)
+	if err := tx.Subscribe(requestor.ID, target.ID); err != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to create subscription %s - %s: %s", requestor.Email, target.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to create subscription"))
+		return
 	}
 
-	if err := tx.Commit().Error; err != nil {
-		glog.Errorf("Failed to commit db transaction: %s", err)
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"success": false, "errors": []string{"Failed to commit db transaction"}})
+	audit.Record(c, model.AuditSubscriptionCreated, requestor.Email, target.Email, "")
+	if !audit.Commit(c, tx) {
 		return
 	}
 
@@ -114,196 +138,438 @@ func (ctrl *Controller) Subscribe(c *gin.Context) {
 // Block action to block notification and prevent further friend connection
 func (ctrl *Controller) Block(c *gin.Context) {
 	var req request.BlockRequest
-	var errors []string
-	if err := c.ShouldBindWith(&req, binding.JSON); err != nil {
-		ve, ok := err.(validator.ValidationErrors)
-		if ok {
-			for _, v := range ve {
-				msg := fmt.Sprintf("%s is %s", v.Field, v.Tag)
-				if v.Tag == "email" {
-					msg = fmt.Sprintf("%s is invalid", v.Field)
-				}
-				errors = append(errors, msg)
-			}
-		} else {
-			errors = append(errors, err.Error())
-		}
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"success": false, "errors": errors})
+	if !validation.Bind(c, &req, binding.JSON) {
+		return
+	}
+
+	if !auth.Authorize(c, ctrl.canonicalizer.Canonicalize(req.Requestor)) {
+		return
+	}
+
+	if ctrl.canonicalizer.Canonicalize(req.Requestor) == ctrl.canonicalizer.Canonicalize(req.Target) {
+		apierror.Abort(c, apierror.New(apierror.SelfReference, "Could not block self"))
 		return
 	}
 
-	if strings.ToLower(req.Requestor) == strings.ToLower(req.Target) {
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"success": false, "errors": []string{"Could not block self"}})
+	store := tenant.Store(c, ctrl.store)
+	tx, err := store.Begin()
+	if err != nil {
+		glog.Errorf("Failed to create new db transaction: %s", err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to start new db transaction"))
 		return
 	}
 
-	db, err := ctrl.dbFactory.DBConnection()
+	normalizeRequestorEmail := ctrl.canonicalizer.Canonicalize(req.Requestor)
+	requestor, err := tx.FindOrCreateUser(normalizeRequestorEmail)
 	if err != nil {
-		glog.Errorf("Failed to open db connection: %s", err)
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"success": false, "errors": []string{"Failed to open db connection"}})
+		tx.Rollback()
+		glog.Errorf("Failed to create user %s: %s", normalizeRequestorEmail, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to create new user"))
 		return
 	}
-	defer db.Close()
 
-	tx := db.Begin()
-	if tx.Error != nil {
-		glog.Errorf("Failed to create new db transaction: %s", tx.Error)
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"success": false, "errors": []string{"Failed to start new db transaction"}})
+	normalizeTargetEmail := ctrl.canonicalizer.Canonicalize(req.Target)
+	target, err := tx.FindOrCreateUser(normalizeTargetEmail)
+	if err != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to create user %s: %s", normalizeTargetEmail, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to create new user"))
 		return
 	}
 
-	var requestor, target model.User
-	normalizeRequestorEmail := strings.ToLower(req.Requestor)
-	if tx.First(&requestor, "email = ?", normalizeRequestorEmail).RecordNotFound() {
-		requestor = model.User{Email: normalizeRequestorEmail}
-		if err := tx.Create(&requestor).Error; err != nil {
-			tx.Rollback()
-			glog.Errorf("Failed to create user %s: %s", normalizeRequestorEmail, err)
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"success": false, "errors": []string{"Failed to create new user"}})
-			return
-		}
+	// both email may be alias of the same user
+	if requestor.ID == target.ID {
+		tx.Rollback()
+		apierror.Abort(c, apierror.New(apierror.SelfReference, "Could not block self"))
+		return
+	}
+
+	if err := tx.Block(requestor.ID, target.ID); err != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to create block %s - %s: %s", requestor.Email, target.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to create block"))
+		return
 	}
+	audit.Record(c, model.AuditBlockCreated, requestor.Email, target.Email, "")
 
-	normalizeTargetEmail := strings.ToLower(req.Target)
-	if tx.First(&target, "email = ?", normalizeTargetEmail).RecordNotFound() {
-		target = model.User{Email: normalizeTargetEmail}
-		if err := tx.Create(&target).Error; err != nil {
+	// If requestor and target are friend, remove notification from target to requestor if any
+	connected, err := tx.IsFriend(requestor.ID, target.ID)
+	if err != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to check friend connection %s - %s: %s", requestor.Email, target.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to check friend connection"))
+		return
+	}
+
+	if connected {
+		unsubscribed, err := tx.Unsubscribe(target.ID, requestor.ID)
+		if err != nil {
 			tx.Rollback()
-			glog.Errorf("Failed to create user %s: %s", normalizeTargetEmail, err)
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"success": false, "errors": []string{"Failed to create new user"}})
+			glog.Errorf("Failed to remove subscription %s - %s: %s", target.Email, requestor.Email, err)
+			apierror.Abort(c, apierror.New(apierror.Internal, "Failed to remove subscription"))
 			return
 		}
+
+		if unsubscribed {
+			audit.Record(c, model.AuditSubscriptionRemoved, target.Email, requestor.Email, "removed by block")
+		}
 	}
 
-	if err := tx.Model(&requestor).Association("Blocks").Find(&target).Error; err != nil && err.Error() == "record not found" {
-		tx.Model(&requestor).Association("Blocks").Append(&target)
+	if !audit.Commit(c, tx) {
+		return
 	}
 
-	// If requestor and target are friend, remove notification from target to requestor if any
-	if err := tx.Model(&requestor).Association("Friends").Find(&target).Error; err == nil {
-		tx.Model(&target).Association("Notifications").Delete(&requestor)
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// Unsubscribe action to stop getting notification from target
+func (ctrl *Controller) Unsubscribe(c *gin.Context) {
+	var req request.UnsubscribeRequest
+	if !validation.Bind(c, &req, binding.JSON) {
+		return
 	}
 
-	if err := tx.Commit().Error; err != nil {
-		glog.Errorf("Failed to commit db transaction: %s", err)
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"success": false, "errors": []string{"Failed to commit db transaction"}})
+	if !auth.Authorize(c, ctrl.canonicalizer.Canonicalize(req.Requestor)) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"success": true})
+	if ctrl.canonicalizer.Canonicalize(req.Requestor) == ctrl.canonicalizer.Canonicalize(req.Target) {
+		apierror.Abort(c, apierror.New(apierror.SelfReference, "Could not unsubscribe from self"))
+		return
+	}
+
+	store := tenant.Store(c, ctrl.store)
+	tx, err := store.Begin()
+	if err != nil {
+		glog.Errorf("Failed to create new db transaction: %s", err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to start new db transaction"))
+		return
+	}
+
+	// unknown user can not have any subscription, so there is nothing to change
+	requestor, err1 := tx.FindUser(ctrl.canonicalizer.Canonicalize(req.Requestor))
+	target, err2 := tx.FindUser(ctrl.canonicalizer.Canonicalize(req.Target))
+	if err1 == data.ErrNotFound || err2 == data.ErrNotFound {
+		tx.Rollback()
+		c.JSON(http.StatusOK, gin.H{"success": true, "changed": false})
+		return
+	}
+	if err1 != nil || err2 != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to get user %s - %s: %s %s", req.Requestor, req.Target, err1, err2)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get user"))
+		return
+	}
+
+	changed, err := tx.Unsubscribe(requestor.ID, target.ID)
+	if err != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to remove subscription %s - %s: %s", requestor.Email, target.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to remove subscription"))
+		return
+	}
+	if changed {
+		audit.Record(c, model.AuditSubscriptionRemoved, requestor.Email, target.Email, "")
+	}
+
+	if !audit.Commit(c, tx) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "changed": changed})
+}
+
+// Unblock action to lift previous block so notification and friend connection are allowed again
+func (ctrl *Controller) Unblock(c *gin.Context) {
+	var req request.UnblockRequest
+	if !validation.Bind(c, &req, binding.JSON) {
+		return
+	}
+
+	if !auth.Authorize(c, ctrl.canonicalizer.Canonicalize(req.Requestor)) {
+		return
+	}
+
+	if ctrl.canonicalizer.Canonicalize(req.Requestor) == ctrl.canonicalizer.Canonicalize(req.Target) {
+		apierror.Abort(c, apierror.New(apierror.SelfReference, "Could not unblock self"))
+		return
+	}
+
+	store := tenant.Store(c, ctrl.store)
+	tx, err := store.Begin()
+	if err != nil {
+		glog.Errorf("Failed to create new db transaction: %s", err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to start new db transaction"))
+		return
+	}
+
+	// unknown user can not have any block, so there is nothing to change
+	requestor, err1 := tx.FindUser(ctrl.canonicalizer.Canonicalize(req.Requestor))
+	target, err2 := tx.FindUser(ctrl.canonicalizer.Canonicalize(req.Target))
+	if err1 == data.ErrNotFound || err2 == data.ErrNotFound {
+		tx.Rollback()
+		c.JSON(http.StatusOK, gin.H{"success": true, "changed": false})
+		return
+	}
+	if err1 != nil || err2 != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to get user %s - %s: %s %s", req.Requestor, req.Target, err1, err2)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get user"))
+		return
+	}
+
+	changed, err := tx.Unblock(requestor.ID, target.ID)
+	if err != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to remove block %s - %s: %s", requestor.Email, target.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to remove block"))
+		return
+	}
+	if changed {
+		audit.Record(c, model.AuditBlockRemoved, requestor.Email, target.Email, "")
+	}
+
+	if !audit.Commit(c, tx) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "changed": changed})
 }
 
 // GetNotificationList action to get list of email that eligible to receive notification from given sender
 func (ctrl *Controller) GetNotificationList(c *gin.Context) {
 	var req request.GetNotificationRequest
-	var errors []string
-	if err := c.ShouldBindWith(&req, binding.JSON); err != nil {
-		ve, ok := err.(validator.ValidationErrors)
-		if ok {
-			for _, v := range ve {
-				msg := fmt.Sprintf("%s is %s", v.Field, v.Tag)
-				if v.Tag == "email" {
-					msg = fmt.Sprintf("%s is invalid", v.Field)
-				}
-				errors = append(errors, msg)
-			}
-		} else {
-			errors = append(errors, err.Error())
-		}
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"success": false, "errors": errors})
+	if !validation.Bind(c, &req, binding.JSON) {
 		return
 	}
 
-	db, err := ctrl.dbFactory.DBConnection()
-	if err != nil {
-		glog.Errorf("Failed to open db connection: %s", err)
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"success": false, "errors": []string{"Failed to open db connection"}})
+	if !auth.Authorize(c, ctrl.canonicalizer.Canonicalize(req.Sender)) {
 		return
 	}
-	defer db.Close()
 
-	tx := db.Begin()
-	if tx.Error != nil {
-		glog.Errorf("Failed to create new db transaction: %s", tx.Error)
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"success": false, "errors": []string{"Failed to start new db transaction"}})
+	limit := req.Limit
+	if limit == 0 {
+		limit = defaultRecipientLimit
+	}
+
+	query, err := data.NewListQuery(data.SortByEmail, "", req.Prefix, req.Cursor, limit)
+	if err != nil || (query.After != nil && query.After.MessageID == uuid.Nil) {
+		apierror.Abort(c, apierror.NewField(apierror.ValidationFailed, "cursor", "%s is invalid", "cursor"))
 		return
 	}
 
-	var user model.User
-	normalizeEmail := strings.ToLower(req.Sender)
-	if tx.Preload("Friends").Preload("Notifications").First(&user, "email = ?", normalizeEmail).RecordNotFound() {
-		user = model.User{Email: normalizeEmail}
-		if err := tx.Create(&user).Error; err != nil {
-			tx.Rollback()
-			glog.Errorf("Failed to create user %s: %s", normalizeEmail, err)
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"success": false, "errors": []string{"Failed to create new user"}})
-			return
-		}
+	normalizeEmail := ctrl.canonicalizer.Canonicalize(req.Sender)
+	if query.After != nil {
+		ctrl.getNextRecipients(c, normalizeEmail, query, req.IncludeProfiles)
+		return
 	}
 
-	// Get all user that has been blocking this sender
-	var blockingUsers []model.User
-	tx.Table("users").Select("users.*").Joins("left join blocks on blocks.user_id = users.id").Where("blocks.target_id = ?", user.ID).Scan(&blockingUsers)
+	store := tenant.Store(c, ctrl.store)
+	tx, err := store.Begin()
+	if err != nil {
+		glog.Errorf("Failed to create new db transaction: %s", err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to start new db transaction"))
+		return
+	}
 
-	// Get all mentioned user
-	re := regexp.MustCompile("[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*")
-	mentionedEmails := re.FindAllString(req.Text, -1)
+	user, err := tx.FindOrCreateUser(normalizeEmail)
+	if err != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to create user %s: %s", normalizeEmail, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to create new user"))
+		return
+	}
 
-	recipients := make([]string, 0)
+	if user.Suspended() {
+		tx.Rollback()
+		apierror.Abort(c, apierror.New(apierror.Suspended, "User %s is suspended", user.Email))
+		return
+	}
 
-	// Include all friends
-	for _, friend := range user.Friends {
-		if contains(recipients, friend.Email) {
-			continue
-		}
+	friends, err := tx.Friends(user.ID)
+	if err != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to get friends of %s: %s", user.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get friend list"))
+		return
+	}
 
-		recipients = append(recipients, friend.Email)
+	subscribers, err := tx.Subscriptions(user.ID)
+	if err != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to get subscribers of %s: %s", user.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get subscriber list"))
+		return
 	}
 
-	// Include all subscriber
-	for _, subscriber := range user.Notifications {
-		if contains(recipients, subscriber.Email) {
+	// Get all user that has been blocking this sender
+	blockingUsers, err := tx.Blockers(user.ID)
+	if err != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to get blocking users of %s: %s", user.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get block list"))
+		return
+	}
+
+	// Resolve every candidate into user first, so alias and primary email of the same user are included once and
+	// block applies whichever address is mentioned. Mentioned email that is not a user is only kept on the message
+	// and listed among recipients, any text would otherwise create users
+	candidates := make([]model.User, 0, len(friends)+len(subscribers))
+	candidates = append(candidates, friends...)
+	candidates = append(candidates, subscribers...)
+	mentions := make([]string, 0)
+	mentioned := make(map[string]bool)
+	for _, mention := range validation.EmailRegexp.FindAllString(req.Text, -1) {
+		normalizeMention := ctrl.canonicalizer.Canonicalize(mention)
+		mentionedUser, err := tx.FindUser(normalizeMention)
+		if err == data.ErrNotFound {
+			if !mentioned[normalizeMention] {
+				mentioned[normalizeMention] = true
+				mentions = append(mentions, normalizeMention)
+			}
 			continue
 		}
+		if err != nil {
+			tx.Rollback()
+			glog.Errorf("Failed to get user %s: %s", normalizeMention, err)
+			apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get user"))
+			return
+		}
 
-		recipients = append(recipients, subscriber.Email)
+		candidates = append(candidates, *mentionedUser)
+	}
+
+	// exclude blocking user and user already included
+	excluded := make(map[uuid.UUID]bool)
+	for _, blockingUser := range blockingUsers {
+		excluded[blockingUser.ID] = true
 	}
 
-	// Include all mentioned email
-	for _, mention := range mentionedEmails {
-		normalizeMention := strings.ToLower(strings.TrimSpace(mention))
-		if contains(recipients, normalizeMention) {
+	// Persist the update and deliver it into every recipient inbox
+	recipientIDs := make([]uuid.UUID, 0)
+	deliveryRecipients := make([]delivery.Recipient, 0)
+	for _, candidate := range candidates {
+		if excluded[candidate.ID] {
 			continue
 		}
+		excluded[candidate.ID] = true
 
-		recipients = append(recipients, normalizeMention)
+		recipientIDs = append(recipientIDs, candidate.ID)
+		deliveryRecipients = append(deliveryRecipients, delivery.Recipient{ID: candidate.ID, Email: candidate.Email})
 	}
 
-	// exclude blocking user
-	for _, blockingUser := range blockingUsers {
-		for idx, recipient := range recipients {
-			if recipient == blockingUser.Email {
-				recipients = append(recipients[:idx], recipients[idx+1:]...)
-				break
-			}
-		}
+	message := model.Message{SenderID: user.ID, Text: req.Text, Mentions: strings.Join(mentions, " ")}
+	if err := tx.CreateMessage(&message, recipientIDs); err != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to create message from %s: %s", user.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to create message"))
+		return
 	}
 
-	if err := tx.Commit().Error; err != nil {
+	page, err := recipientPage(tx, &message, query, req.IncludeProfiles)
+	if err != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to get recipients of message %s: %s", message.ID, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get recipient list"))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
 		glog.Errorf("Failed to commit db transaction: %s", err)
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"success": false, "errors": []string{"Failed to commit db transaction"}})
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to commit db transaction"))
+		return
+	}
+
+	update := delivery.Update{
+		Tenant:     message.Tenant,
+		MessageID:  message.ID,
+		Sender:     user.Email,
+		Text:       message.Text,
+		CreatedAt:  message.CreatedAt,
+		Recipients: deliveryRecipients,
+	}
+	ctrl.hub.Deliver(update)
+	for _, channel := range ctrl.channels {
+		channel.Deliver(update)
+	}
+
+	page["success"] = true
+	page["messageId"] = message.ID.String()
+	c.JSON(http.StatusOK, page)
+}
+
+// getNextRecipients continue listing recipients of update previously posted by sender from the cursor position
+func (ctrl *Controller) getNextRecipients(c *gin.Context, sender string, query data.ListQuery, includeProfiles bool) {
+	messageID := query.After.MessageID
+	store := tenant.Store(c, ctrl.store)
+	message, err := store.FindMessage(messageID)
+	if err != nil && err != data.ErrNotFound {
+		glog.Errorf("Failed to get message %s: %s", messageID, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get message"))
+		return
+	}
+	if err == data.ErrNotFound || message.Sender.Email != sender {
+		apierror.Abort(c, apierror.NewField(apierror.ValidationFailed, "cursor", "%s is invalid", "cursor"))
+		return
+	}
+
+	page, err := recipientPage(store, message, query, includeProfiles)
+	if err != nil {
+		glog.Errorf("Failed to get recipients of message %s: %s", messageID, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get recipient list"))
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"success": true, "recipients": recipients})
+	page["success"] = true
+	page["messageId"] = messageID.String()
+	c.JSON(http.StatusOK, page)
 }
 
-func contains(s []string, e string) bool {
-	for _, a := range s {
-		if a == e {
-			return true
+// recipientPage get page of message recipient email along with count, total and cursor of next page if any,
+// profile summary of recipients is listed as well when includeProfiles is set
+func recipientPage(store data.MessageRepository, message *model.Message, query data.ListQuery, includeProfiles bool) (gin.H, error) {
+	// ask for one more recipient to know whether there is next page
+	limit := query.Limit
+	query.Limit++
+	users, total, err := store.MessageRecipients(message.ID, query)
+	if err != nil {
+		return nil, err
+	}
+
+	profiles := make([]response.RecipientProfile, 0, len(users))
+	for _, user := range users {
+		profiles = append(profiles, response.RecipientProfile{Email: user.Email, DisplayName: user.DisplayName, AvatarURL: user.AvatarURL})
+	}
+
+	// mentioned email nobody owns has no inbox entry, it is merged into the page of users by email
+	for _, email := range strings.Fields(message.Mentions) {
+		if !strings.HasPrefix(email, query.EmailPrefix) {
+			continue
 		}
+		total++
+		if query.After == nil || email > query.After.Email {
+			profiles = append(profiles, response.RecipientProfile{Email: email})
+		}
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Email < profiles[j].Email })
+
+	page := gin.H{"total": total}
+	if len(profiles) > limit {
+		profiles = profiles[:limit]
+		cursor := query.CursorOf(data.Connection{User: model.User{Email: profiles[limit-1].Email}})
+		cursor.MessageID = message.ID
+		page["nextCursor"] = cursor.Encode()
+	}
+
+	recipients := make([]string, 0, len(profiles))
+	for _, profile := range profiles {
+		recipients = append(recipients, profile.Email)
+	}
+	page["recipients"] = recipients
+	if includeProfiles {
+		page["profiles"] = profiles
 	}
+	page["count"] = len(recipients)
 
-	return false
+	return page, nil
 }
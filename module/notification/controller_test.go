@@ -0,0 +1,299 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmgo/common/apierror"
+	"fmgo/common/audit"
+	"fmgo/common/config"
+	"fmgo/common/data"
+	"fmgo/common/data/model"
+	"fmgo/common/delivery"
+	"fmgo/common/mailaddr"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recorder delivery channel keeping every update handed to it
+type recorder struct {
+	updates []delivery.Update
+}
+
+func (r *recorder) Deliver(update delivery.Update) {
+	r.updates = append(r.updates, update)
+}
+
+func (r *recorder) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// newRouter serve notification endpoints without authentication, backed by given memory store
+func newRouter(store data.GraphStore, channel delivery.Channel) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	canonicalizer := mailaddr.NewCanonicalizer(config.EmailConfiguration{CaseFolding: true})
+	ctrl := NewController(store, delivery.NewHub(16), config.StreamConfiguration{}, canonicalizer, channel)
+
+	router := gin.New()
+	router.Use(audit.Middleware(), apierror.Handler())
+	router.POST("/notification/subscribe", ctrl.Subscribe)
+	router.POST("/notification/unsubscribe", ctrl.Unsubscribe)
+	router.POST("/notification/block", ctrl.Block)
+	router.POST("/notification/unblock", ctrl.Unblock)
+	router.POST("/notification/list", ctrl.GetNotificationList)
+	return router
+}
+
+// post send JSON body to path, returning status and decoded response body
+func post(t *testing.T, router *gin.Engine, path, body string) (int, map[string]interface{}) {
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%s responded with invalid JSON %q: %s", path, w.Body.String(), err)
+	}
+
+	return w.Code, resp
+}
+
+// errorCode get code of the first error in failed response
+func errorCode(resp map[string]interface{}) string {
+	errs, _ := resp["errors"].([]interface{})
+	if len(errs) == 0 {
+		return ""
+	}
+
+	code, _ := errs[0].(map[string]interface{})["code"].(string)
+	return code
+}
+
+func assertRecipients(t *testing.T, resp map[string]interface{}, want ...string) {
+	recipients, _ := resp["recipients"].([]interface{})
+	if len(recipients) != len(want) {
+		t.Fatalf("got recipients %v, want %v", recipients, want)
+	}
+	for i := range want {
+		if recipients[i] != want[i] {
+			t.Fatalf("got recipients %v, want %v", recipients, want)
+		}
+	}
+}
+
+// graph create users of given emails, connect the first to the second and subscribe the first to the third
+func graph(t *testing.T, store data.GraphStore, emails ...string) []*model.User {
+	users := make([]*model.User, 0, len(emails))
+	for _, email := range emails {
+		user, err := store.FindOrCreateUser(email)
+		if err != nil {
+			t.Fatalf("FindOrCreateUser: %s", err)
+		}
+		users = append(users, user)
+	}
+
+	if err := store.AddFriend(&model.Friend{UserID: users[0].ID, FriendID: users[1].ID, Source: model.FriendSourceAPI}); err != nil {
+		t.Fatalf("AddFriend: %s", err)
+	}
+	if err := store.Subscribe(users[0].ID, users[2].ID); err != nil {
+		t.Fatalf("Subscribe: %s", err)
+	}
+
+	return users
+}
+
+func TestSubscribe(t *testing.T) {
+	store := data.NewMemoryStore()
+	router := newRouter(store, &recorder{})
+
+	for i := 0; i < 2; i++ {
+		status, resp := post(t, router, "/notification/subscribe", `{"requestor": "lisa@example.com", "target": "andy@example.com"}`)
+		if status != http.StatusOK || resp["success"] != true {
+			t.Fatalf("subscribe responded %d %v", status, resp)
+		}
+	}
+
+	for _, changed := range []bool{true, false} {
+		status, resp := post(t, router, "/notification/unsubscribe", `{"requestor": "lisa@example.com", "target": "andy@example.com"}`)
+		if status != http.StatusOK || resp["changed"] != changed {
+			t.Fatalf("unsubscribe responded %d %v, want changed %v", status, resp, changed)
+		}
+	}
+
+	status, resp := post(t, router, "/notification/subscribe", `{"requestor": "andy@example.com", "target": "Andy@example.com"}`)
+	if status != http.StatusBadRequest || errorCode(resp) != string(apierror.SelfReference) {
+		t.Fatalf("subscribe to self responded %d %v", status, resp)
+	}
+}
+
+func TestBlock(t *testing.T) {
+	store := data.NewMemoryStore()
+	router := newRouter(store, &recorder{})
+	users := graph(t, store, "andy@example.com", "john@example.com", "lisa@example.com")
+
+	if err := store.Subscribe(users[1].ID, users[0].ID); err != nil {
+		t.Fatalf("Subscribe: %s", err)
+	}
+
+	// blocking a friend drops subscription of the blocked friend
+	status, resp := post(t, router, "/notification/block", `{"requestor": "andy@example.com", "target": "john@example.com"}`)
+	if status != http.StatusOK {
+		t.Fatalf("block responded %d %v", status, resp)
+	}
+	if subscribed, _ := store.IsSubscribed(users[1].ID, users[0].ID); subscribed {
+		t.Fatal("subscription of blocked friend was kept")
+	}
+
+	status, resp = post(t, router, "/notification/subscribe", `{"requestor": "john@example.com", "target": "andy@example.com"}`)
+	if status != http.StatusForbidden || errorCode(resp) != string(apierror.Blocked) {
+		t.Fatalf("subscribe of blocked friend responded %d %v", status, resp)
+	}
+
+	for _, changed := range []bool{true, false} {
+		status, resp := post(t, router, "/notification/unblock", `{"requestor": "andy@example.com", "target": "john@example.com"}`)
+		if status != http.StatusOK || resp["changed"] != changed {
+			t.Fatalf("unblock responded %d %v, want changed %v", status, resp, changed)
+		}
+	}
+
+	status, resp = post(t, router, "/notification/subscribe", `{"requestor": "john@example.com", "target": "andy@example.com"}`)
+	if status != http.StatusOK {
+		t.Fatalf("subscribe after unblock responded %d %v", status, resp)
+	}
+}
+
+func TestGetNotificationList(t *testing.T) {
+	store := data.NewMemoryStore()
+	channel := &recorder{}
+	router := newRouter(store, channel)
+	users := graph(t, store, "andy@example.com", "john@example.com", "lisa@example.com", "kate@example.com", "mike@example.com")
+
+	// kate blocks andy, so mentioning her does not get her the update
+	if err := store.Block(users[3].ID, users[0].ID); err != nil {
+		t.Fatalf("Block: %s", err)
+	}
+
+	status, resp := post(t, router, "/notification/list", `{"sender": "andy@example.com", "text": "Hello World! kate@example.com MIKE@example.com"}`)
+	if status != http.StatusOK || resp["success"] != true {
+		t.Fatalf("notification list responded %d %v", status, resp)
+	}
+	assertRecipients(t, resp, "john@example.com", "lisa@example.com", "mike@example.com")
+	if resp["total"] != float64(3) {
+		t.Fatalf("recipient total is %v, want 3", resp["total"])
+	}
+
+	if len(channel.updates) != 1 {
+		t.Fatalf("channel got %d update, want 1", len(channel.updates))
+	}
+	var delivered []string
+	for _, recipient := range channel.updates[0].Recipients {
+		delivered = append(delivered, recipient.Email)
+	}
+	sort.Strings(delivered)
+	if len(delivered) != 3 || delivered[0] != "john@example.com" || delivered[2] != "mike@example.com" {
+		t.Fatalf("update delivered to %v", delivered)
+	}
+
+	entries, _, err := store.InboxEntries(users[4].ID, true, 0, 10)
+	if err != nil || len(entries) != 1 || entries[0].Message.Text != "Hello World! kate@example.com MIKE@example.com" {
+		t.Fatalf("inbox of mentioned user: %v %+v", err, entries)
+	}
+}
+
+func TestGetNotificationListUnknownMention(t *testing.T) {
+	store := data.NewMemoryStore()
+	channel := &recorder{}
+	router := newRouter(store, channel)
+	graph(t, store, "andy@example.com", "john@example.com", "lisa@example.com")
+
+	// mentioned email nobody owns is still a recipient, once however often it is mentioned
+	status, resp := post(t, router, "/notification/list", `{"sender": "andy@example.com", "text": "Hello nobody@example.com and Nobody@example.com", "limit": 2}`)
+	if status != http.StatusOK {
+		t.Fatalf("notification list responded %d %v", status, resp)
+	}
+	assertRecipients(t, resp, "john@example.com", "lisa@example.com")
+	if resp["total"] != float64(3) {
+		t.Fatalf("recipient total is %v, want 3", resp["total"])
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{"sender": "andy@example.com", "cursor": resp["nextCursor"]})
+	status, resp = post(t, router, "/notification/list", string(body))
+	if status != http.StatusOK {
+		t.Fatalf("next recipient page responded %d %v", status, resp)
+	}
+	assertRecipients(t, resp, "nobody@example.com")
+
+	// but it is neither turned into user nor delivered to
+	if _, err := store.FindUser("nobody@example.com"); err != data.ErrNotFound {
+		t.Fatalf("mentioned email became user: %v", err)
+	}
+	if len(channel.updates) != 1 || len(channel.updates[0].Recipients) != 2 {
+		t.Fatalf("delivered updates %+v, want one update to 2 recipients", channel.updates)
+	}
+}
+
+func TestGetNotificationListMentionAlias(t *testing.T) {
+	store := data.NewMemoryStore()
+	channel := &recorder{}
+	router := newRouter(store, channel)
+	users := graph(t, store, "andy@example.com", "john@example.com", "lisa@example.com", "kate@example.com")
+
+	// mention by alias is the same user as friend john, and kate blocks andy whichever of her address is mentioned
+	for _, alias := range []model.UserAlias{{Email: "johnny@example.com", UserID: users[1].ID}, {Email: "kate.work@example.com", UserID: users[3].ID}} {
+		if err := store.AddAlias(&alias); err != nil {
+			t.Fatalf("AddAlias: %s", err)
+		}
+	}
+	if err := store.Block(users[3].ID, users[0].ID); err != nil {
+		t.Fatalf("Block: %s", err)
+	}
+
+	status, resp := post(t, router, "/notification/list", `{"sender": "andy@example.com", "text": "Hi johnny@example.com, John@example.com and kate.work@example.com"}`)
+	if status != http.StatusOK {
+		t.Fatalf("notification list responded %d %v", status, resp)
+	}
+	assertRecipients(t, resp, "john@example.com", "lisa@example.com")
+
+	if len(channel.updates) != 1 || len(channel.updates[0].Recipients) != 2 {
+		t.Fatalf("delivered updates %+v, want one update to 2 recipients", channel.updates)
+	}
+}
+
+func TestGetNotificationListPage(t *testing.T) {
+	store := data.NewMemoryStore()
+	router := newRouter(store, &recorder{})
+	graph(t, store, "andy@example.com", "john@example.com", "lisa@example.com")
+
+	status, resp := post(t, router, "/notification/list", `{"sender": "andy@example.com", "text": "Hello", "limit": 1}`)
+	if status != http.StatusOK {
+		t.Fatalf("notification list responded %d %v", status, resp)
+	}
+	assertRecipients(t, resp, "john@example.com")
+
+	cursor, _ := resp["nextCursor"].(string)
+	if cursor == "" {
+		t.Fatalf("first page has no next cursor: %v", resp)
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{"sender": "andy@example.com", "limit": 1, "cursor": cursor})
+	status, resp = post(t, router, "/notification/list", string(body))
+	if status != http.StatusOK {
+		t.Fatalf("next recipient page responded %d %v", status, resp)
+	}
+	assertRecipients(t, resp, "lisa@example.com")
+	if _, ok := resp["nextCursor"]; ok {
+		t.Fatalf("last page has next cursor: %v", resp)
+	}
+
+	// cursor is only valid for the sender of the update
+	body, _ = json.Marshal(map[string]interface{}{"sender": "john@example.com", "cursor": cursor})
+	status, resp = post(t, router, "/notification/list", string(body))
+	if status != http.StatusBadRequest || errorCode(resp) != string(apierror.ValidationFailed) {
+		t.Fatalf("cursor of another sender responded %d %v", status, resp)
+	}
+}
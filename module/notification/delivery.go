@@ -0,0 +1,75 @@
+package notification
+
+import (
+	"fmgo/common/apierror"
+	"fmgo/common/auth"
+	"fmgo/common/data"
+	"fmgo/common/tenant"
+	"fmgo/common/validation"
+	"fmgo/module/notification/request"
+	"fmgo/module/notification/response"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/golang/glog"
+	"github.com/satori/go.uuid"
+)
+
+// GetDeliveries action to get email delivery status of posted update for each of its recipient
+func (ctrl *Controller) GetDeliveries(c *gin.Context) {
+	var req request.GetDeliveriesRequest
+	if !validation.Bind(c, &req, binding.JSON) {
+		return
+	}
+
+	messageID, err := uuid.FromString(req.MessageID)
+	if err != nil {
+		apierror.Abort(c, apierror.NewField(apierror.ValidationFailed, "messageId", "%s is invalid", "messageId"))
+		return
+	}
+
+	store := tenant.Store(c, ctrl.store)
+
+	// only sender of the update may see to whom it was delivered
+	if auth.Caller(c) != "" {
+		message, err := store.FindMessage(messageID)
+		if err == data.ErrNotFound {
+			apierror.Abort(c, apierror.New(apierror.NotFound, "Message does not exist"))
+			return
+		}
+		if err != nil {
+			glog.Errorf("Failed to get message %s: %s", messageID, err)
+			apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get message"))
+			return
+		}
+		if !auth.Authorize(c, message.Sender.Email) {
+			return
+		}
+	}
+
+	emailDeliveries, err := store.EmailDeliveries(messageID)
+	if err != nil {
+		glog.Errorf("Failed to get email deliveries of message %s: %s", messageID, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get delivery list"))
+		return
+	}
+
+	items := make([]response.DeliveryItem, 0)
+	for _, emailDelivery := range emailDeliveries {
+		items = append(items, response.DeliveryItem{
+			Recipient: emailDelivery.Email,
+			Status:    emailDelivery.Status,
+			Attempts:  emailDelivery.Attempts,
+			LastError: emailDelivery.LastError,
+			SentAt:    emailDelivery.SentAt,
+		})
+	}
+
+	resp := response.DeliveryListResponse{
+		Success:    true,
+		Deliveries: items,
+		Count:      len(items),
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,152 @@
+package notification
+
+import (
+	"fmgo/common/apierror"
+	"fmgo/common/auth"
+	"fmgo/common/data"
+	"fmgo/common/tenant"
+	"fmgo/common/validation"
+	"fmgo/module/notification/request"
+	"fmgo/module/notification/response"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/golang/glog"
+	"github.com/satori/go.uuid"
+)
+
+const defaultInboxLimit = 20
+
+// GetInbox action to page through updates received by given email address, newest first
+func (ctrl *Controller) GetInbox(c *gin.Context) {
+	var req request.GetInboxRequest
+	if !validation.Bind(c, &req, binding.JSON) {
+		return
+	}
+
+	if !auth.Authorize(c, ctrl.canonicalizer.Canonicalize(req.Email)) {
+		return
+	}
+
+	store := tenant.Store(c, ctrl.store)
+	user, err := store.FindUser(ctrl.canonicalizer.Canonicalize(req.Email))
+	if err == data.ErrNotFound {
+		apierror.Abort(c, apierror.New(apierror.UserNotFound, "User with email %s does not exist", req.Email))
+		return
+	}
+	if err != nil {
+		glog.Errorf("Failed to get user %s: %s", req.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get user"))
+		return
+	}
+
+	limit := req.Limit
+	if limit == 0 {
+		limit = defaultInboxLimit
+	}
+
+	entries, total, err := store.InboxEntries(user.ID, req.UnreadOnly, req.Offset, limit)
+	if err != nil {
+		glog.Errorf("Failed to get inbox of %s: %s", user.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get inbox"))
+		return
+	}
+
+	unreadCount, err := store.UnreadCount(user.ID)
+	if err != nil {
+		glog.Errorf("Failed to count unread inbox of %s: %s", user.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get inbox"))
+		return
+	}
+
+	items := make([]response.InboxItem, 0)
+	for _, entry := range entries {
+		items = append(items, response.InboxItem{
+			ID:        entry.ID.String(),
+			MessageID: entry.MessageID.String(),
+			Sender:    entry.Message.Sender.Email,
+			Text:      entry.Message.Text,
+			CreatedAt: entry.CreatedAt,
+			ReadAt:    entry.ReadAt,
+		})
+	}
+
+	resp := response.InboxResponse{
+		Success:     true,
+		Entries:     items,
+		Count:       len(items),
+		Total:       total,
+		UnreadCount: unreadCount,
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// MarkRead action to mark inbox entries of given email address as read, all of them when no id is given
+func (ctrl *Controller) MarkRead(c *gin.Context) {
+	var req request.MarkReadRequest
+	if !validation.Bind(c, &req, binding.JSON) {
+		return
+	}
+
+	if !auth.Authorize(c, ctrl.canonicalizer.Canonicalize(req.Email)) {
+		return
+	}
+
+	entryIDs := make([]uuid.UUID, 0)
+	for i, id := range req.IDs {
+		entryID, err := uuid.FromString(id)
+		if err != nil {
+			apierror.Abort(c, apierror.NewField(apierror.ValidationFailed, fmt.Sprintf("ids[%d]", i), "%s is invalid inbox entry id", id))
+			return
+		}
+
+		entryIDs = append(entryIDs, entryID)
+	}
+
+	store := tenant.Store(c, ctrl.store)
+	tx, err := store.Begin()
+	if err != nil {
+		glog.Errorf("Failed to create new db transaction: %s", err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to start new db transaction"))
+		return
+	}
+
+	user, err := tx.FindUser(ctrl.canonicalizer.Canonicalize(req.Email))
+	if err == data.ErrNotFound {
+		tx.Rollback()
+		apierror.Abort(c, apierror.New(apierror.UserNotFound, "User with email %s does not exist", req.Email))
+		return
+	}
+	if err != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to get user %s: %s", req.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get user"))
+		return
+	}
+
+	changed, err := tx.MarkRead(user.ID, entryIDs)
+	if err != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to mark inbox of %s as read: %s", user.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to mark inbox as read"))
+		return
+	}
+
+	unreadCount, err := tx.UnreadCount(user.ID)
+	if err != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to count unread inbox of %s: %s", user.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get inbox"))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		glog.Errorf("Failed to commit db transaction: %s", err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to commit db transaction"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "changed": changed, "unreadCount": unreadCount})
+}
@@ -0,0 +1,6 @@
+package request
+
+// GetDeliveriesRequest model
+type GetDeliveriesRequest struct {
+	MessageID string `json:"messageId" binding:"required,uuid"`
+}
@@ -0,0 +1,9 @@
+package request
+
+// GetInboxRequest model
+type GetInboxRequest struct {
+	Email      string `json:"email" binding:"required,email"`
+	UnreadOnly bool   `json:"unreadOnly"`
+	Offset     int    `json:"offset" binding:"omitempty,min=0"`
+	Limit      int    `json:"limit" binding:"omitempty,min=1,max=100"`
+}
@@ -1,7 +1,12 @@
 package request
 
-// GetNotificationRequest model
+// GetNotificationRequest model. Cursor continues listing recipients of previously posted update instead of posting new one
 type GetNotificationRequest struct {
 	Sender string `json:"sender" binding:"required,email"`
 	Text   string `json:"text"`
+	Limit  int    `json:"limit" binding:"omitempty,min=1,max=1000"`
+	Cursor string `json:"cursor"`
+	Prefix string `json:"prefix"`
+	// IncludeProfiles list profile summary of every recipient as well
+	IncludeProfiles bool `json:"includeProfiles"`
 }
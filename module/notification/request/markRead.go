@@ -0,0 +1,7 @@
+package request
+
+// MarkReadRequest model, all unread entry are marked when IDs is empty
+type MarkReadRequest struct {
+	Email string   `json:"email" binding:"required,email"`
+	IDs   []string `json:"ids" binding:"omitempty,dive,uuid"`
+}
@@ -0,0 +1,7 @@
+package request
+
+// StreamRequest model, read from query string since browser EventSource can not send body
+type StreamRequest struct {
+	Email       string `form:"email" binding:"required,email"`
+	LastEventID string `form:"lastEventId" binding:"omitempty,uuid"`
+}
@@ -0,0 +1,7 @@
+package request
+
+// UnblockRequest model
+type UnblockRequest struct {
+	Requestor string `json:"requestor" binding:"required,email"`
+	Target    string `json:"target" binding:"required,email"`
+}
@@ -0,0 +1,7 @@
+package request
+
+// UnsubscribeRequest model
+type UnsubscribeRequest struct {
+	Requestor string `json:"requestor" binding:"required,email"`
+	Target    string `json:"target" binding:"required,email"`
+}
@@ -0,0 +1,19 @@
+package response
+
+import "time"
+
+// DeliveryListResponse model
+type DeliveryListResponse struct {
+	Success    bool           `json:"success"`
+	Deliveries []DeliveryItem `json:"deliveries"`
+	Count      int            `json:"count"`
+}
+
+// DeliveryItem model
+type DeliveryItem struct {
+	Recipient string     `json:"recipient"`
+	Status    string     `json:"status"`
+	Attempts  int        `json:"attempts"`
+	LastError string     `json:"lastError,omitempty"`
+	SentAt    *time.Time `json:"sentAt,omitempty"`
+}
@@ -0,0 +1,22 @@
+package response
+
+import "time"
+
+// InboxResponse model
+type InboxResponse struct {
+	Success     bool        `json:"success"`
+	Entries     []InboxItem `json:"entries"`
+	Count       int         `json:"count"`
+	Total       int         `json:"total"`
+	UnreadCount int         `json:"unreadCount"`
+}
+
+// InboxItem model
+type InboxItem struct {
+	ID        string     `json:"id"`
+	MessageID string     `json:"messageId"`
+	Sender    string     `json:"sender"`
+	Text      string     `json:"text"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ReadAt    *time.Time `json:"readAt,omitempty"`
+}
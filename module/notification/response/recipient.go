@@ -0,0 +1,8 @@
+package response
+
+// RecipientProfile model
+type RecipientProfile struct {
+	Email       string `json:"email"`
+	DisplayName string `json:"displayName"`
+	AvatarURL   string `json:"avatarUrl"`
+}
@@ -0,0 +1,12 @@
+package response
+
+import "time"
+
+// StreamEvent model, a single update pushed to notification stream
+type StreamEvent struct {
+	Event     string    `json:"event"`
+	MessageID string    `json:"messageId"`
+	Sender    string    `json:"sender"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"createdAt"`
+}
@@ -0,0 +1,266 @@
+package notification
+
+import (
+	"encoding/json"
+	"fmgo/common/apierror"
+	"fmgo/common/auth"
+	"fmgo/common/data"
+	"fmgo/common/delivery"
+	"fmgo/common/tenant"
+	"fmgo/common/validation"
+	"fmgo/common/websocket"
+	"fmgo/module/notification/request"
+	"fmgo/module/notification/response"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/golang/glog"
+	"github.com/satori/go.uuid"
+)
+
+const (
+	streamEvent        = "update"
+	defaultHeartbeat   = 15
+	defaultReplayLimit = 100
+	lastEventIDHeader  = "Last-Event-ID"
+)
+
+// streamWriter transport used to push event to connected client
+type streamWriter interface {
+	event(event response.StreamEvent) error
+	heartbeat() error
+	// done closed once client went away
+	done() <-chan struct{}
+	// close end the stream, hub shutting down tells client to reconnect later
+	close(shutdown bool)
+}
+
+// Stream action to keep connection open and push every update received by given email address as it is posted,
+// using WebSocket when client asks for protocol upgrade or Server-Sent Events otherwise
+func (ctrl *Controller) Stream(c *gin.Context) {
+	var req request.StreamRequest
+	if !validation.Bind(c, &req, binding.Form) {
+		return
+	}
+
+	if !auth.Authorize(c, ctrl.canonicalizer.Canonicalize(req.Email)) {
+		return
+	}
+
+	// EventSource sends the last seen event id in header on reconnect, query string is kept for websocket client
+	lastEventID := req.LastEventID
+	if header := c.GetHeader(lastEventIDHeader); header != "" {
+		lastEventID = header
+	}
+
+	var lastMessageID uuid.UUID
+	if lastEventID != "" {
+		id, err := uuid.FromString(lastEventID)
+		if err != nil {
+			apierror.Abort(c, apierror.NewField(apierror.ValidationFailed, "lastEventId", "%s is invalid", "lastEventId"))
+			return
+		}
+
+		lastMessageID = id
+	}
+
+	store := tenant.Store(c, ctrl.store)
+	user, err := store.FindUser(ctrl.canonicalizer.Canonicalize(req.Email))
+	if err == data.ErrNotFound {
+		apierror.Abort(c, apierror.New(apierror.UserNotFound, "User with email %s does not exist", req.Email))
+		return
+	}
+	if err != nil {
+		glog.Errorf("Failed to get user %s: %s", req.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get user"))
+		return
+	}
+
+	// Subscribe before looking up missed update so nothing posted in between is lost
+	subscription, err := ctrl.hub.Subscribe(user.ID)
+	if err != nil {
+		apierror.Abort(c, apierror.New(apierror.Unavailable, "Server is shutting down"))
+		return
+	}
+	defer subscription.Close()
+
+	replay := make([]response.StreamEvent, 0)
+	if lastMessageID != uuid.Nil {
+		replayLimit := ctrl.config.ReplayLimit
+		if replayLimit < 1 {
+			replayLimit = defaultReplayLimit
+		}
+
+		entries, err := store.InboxEntriesSince(user.ID, lastMessageID, replayLimit)
+		if err != nil && err != data.ErrNotFound {
+			glog.Errorf("Failed to get missed update of %s since %s: %s", user.Email, lastMessageID, err)
+			apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get inbox"))
+			return
+		}
+
+		for _, entry := range entries {
+			replay = append(replay, response.StreamEvent{
+				Event:     streamEvent,
+				MessageID: entry.MessageID.String(),
+				Sender:    entry.Message.Sender.Email,
+				Text:      entry.Message.Text,
+				CreatedAt: entry.Message.CreatedAt,
+			})
+		}
+	}
+
+	var w streamWriter
+	if websocket.IsUpgrade(c.Request) {
+		conn, err := websocket.Upgrade(c.Writer, c.Request)
+		if err != nil {
+			apierror.Abort(c, apierror.New(apierror.InvalidRequest, "WebSocket upgrade failed: %s", err.Error()))
+			return
+		}
+
+		w = &websocketWriter{conn: conn}
+	} else {
+		w = newSSEWriter(c, ctrl.config.Retry)
+	}
+
+	ctrl.stream(w, subscription, replay)
+}
+
+// stream write missed update followed by live one until client goes away or hub shuts down
+func (ctrl *Controller) stream(w streamWriter, subscription *delivery.Subscription, replay []response.StreamEvent) {
+	heartbeat := ctrl.config.Heartbeat
+	if heartbeat < 1 {
+		heartbeat = defaultHeartbeat
+	}
+	ticker := time.NewTicker(time.Duration(heartbeat) * time.Second)
+	defer ticker.Stop()
+
+	replayed := make(map[string]bool)
+	for _, event := range replay {
+		if err := w.event(event); err != nil {
+			w.close(false)
+			return
+		}
+
+		replayed[event.MessageID] = true
+	}
+
+	for {
+		select {
+		case update, ok := <-subscription.Updates:
+			if !ok {
+				w.close(true)
+				return
+			}
+
+			// update posted while replaying is both in inbox and in subscription
+			if replayed[update.MessageID.String()] {
+				continue
+			}
+
+			err := w.event(response.StreamEvent{
+				Event:     streamEvent,
+				MessageID: update.MessageID.String(),
+				Sender:    update.Sender,
+				Text:      update.Text,
+				CreatedAt: update.CreatedAt,
+			})
+			if err != nil {
+				w.close(false)
+				return
+			}
+		case <-ticker.C:
+			if err := w.heartbeat(); err != nil {
+				w.close(false)
+				return
+			}
+		case <-w.done():
+			w.close(false)
+			return
+		}
+	}
+}
+
+// sseWriter streamWriter speaking Server-Sent Events over plain HTTP response
+type sseWriter struct {
+	c *gin.Context
+}
+
+func newSSEWriter(c *gin.Context, retry int) *sseWriter {
+	header := c.Writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	if retry > 0 {
+		fmt.Fprintf(c.Writer, "retry: %d\n\n", retry*1000)
+	}
+	c.Writer.Flush()
+
+	return &sseWriter{c: c}
+}
+
+func (w *sseWriter) event(event response.StreamEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(w.c.Writer, "id: %s\nevent: %s\ndata: %s\n\n", event.MessageID, event.Event, payload); err != nil {
+		return err
+	}
+
+	w.c.Writer.Flush()
+	return nil
+}
+
+func (w *sseWriter) heartbeat() error {
+	if _, err := fmt.Fprint(w.c.Writer, ": heartbeat\n\n"); err != nil {
+		return err
+	}
+
+	w.c.Writer.Flush()
+	return nil
+}
+
+func (w *sseWriter) done() <-chan struct{} {
+	return w.c.Request.Context().Done()
+}
+
+// close has nothing to do, the response ends when handler returns and client reconnects by itself
+func (w *sseWriter) close(shutdown bool) {}
+
+// websocketWriter streamWriter sending every event as JSON text message over WebSocket
+type websocketWriter struct {
+	conn *websocket.Conn
+}
+
+func (w *websocketWriter) event(event response.StreamEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return w.conn.WriteText(payload)
+}
+
+func (w *websocketWriter) heartbeat() error {
+	return w.conn.Ping()
+}
+
+func (w *websocketWriter) done() <-chan struct{} {
+	return w.conn.Done()
+}
+
+func (w *websocketWriter) close(shutdown bool) {
+	code := websocket.CloseNormal
+	if shutdown {
+		code = websocket.CloseGoingAway
+	}
+
+	w.conn.Close(code)
+}
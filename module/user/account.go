@@ -0,0 +1,177 @@
+package user
+
+import (
+	"fmgo/common/apierror"
+	"fmgo/common/audit"
+	"fmgo/common/auth"
+	"fmgo/common/data"
+	"fmgo/common/data/model"
+	"fmgo/common/tenant"
+	"fmgo/common/validation"
+	"fmgo/module/user/request"
+	"fmgo/module/user/response"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/golang/glog"
+)
+
+// ChangeEmail action to change primary email of user, keeping all of its friends, subscriptions and blocks
+func (ctrl *Controller) ChangeEmail(c *gin.Context) {
+	var req request.ChangeEmailRequest
+	if !validation.Bind(c, &req, binding.JSON) {
+		return
+	}
+
+	if !auth.Authorize(c, ctrl.canonicalizer.Canonicalize(req.Email)) {
+		return
+	}
+
+	email, newEmail := ctrl.canonicalizer.Canonicalize(req.Email), ctrl.canonicalizer.Canonicalize(req.NewEmail)
+	if email == newEmail {
+		apierror.Abort(c, apierror.NewField(apierror.ValidationFailed, "newEmail", "New email is the same as current email"))
+		return
+	}
+
+	store := tenant.Store(c, ctrl.store)
+	tx, err := store.Begin()
+	if err != nil {
+		glog.Errorf("Failed to create new db transaction: %s", err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to start new db transaction"))
+		return
+	}
+
+	user, err := tx.FindUser(email)
+	if err == data.ErrNotFound {
+		tx.Rollback()
+		apierror.Abort(c, apierror.New(apierror.UserNotFound, "User with email %s does not exist", email))
+		return
+	}
+	if err != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to get user %s: %s", email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get user"))
+		return
+	}
+
+	previousEmail := user.Email
+	if err := tx.ChangeEmail(user, newEmail); err != nil {
+		tx.Rollback()
+		if err == data.ErrEmailTaken {
+			apierror.Abort(c, apierror.NewField(apierror.AlreadyExists, "newEmail", "Email %s is already used by another user, merge both users instead", newEmail))
+			return
+		}
+
+		glog.Errorf("Failed to change email of %s to %s: %s", email, newEmail, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to change email"))
+		return
+	}
+
+	audit.Record(c, model.AuditEmailChanged, previousEmail, user.Email, "")
+	if !audit.Commit(c, tx) {
+		return
+	}
+
+	c.JSON(http.StatusOK, response.ProfileResponse{Success: true, Profile: profileItem(user)})
+}
+
+// Merge action to merge two user who turn out to be the same person. Everything of source user is moved to target
+// user, then source user is removed
+func (ctrl *Controller) Merge(c *gin.Context) {
+	var req request.MergeRequest
+	if !validation.Bind(c, &req, binding.JSON) {
+		return
+	}
+
+	sourceEmail, targetEmail := ctrl.canonicalizer.Canonicalize(req.Source), ctrl.canonicalizer.Canonicalize(req.Target)
+	// caller merges other user into itself, which must be consented by the owner of source user as well
+	if !auth.Authorize(c, targetEmail) || !auth.Prove(c, "sourceToken", req.SourceToken, sourceEmail) {
+		return
+	}
+
+	if sourceEmail == targetEmail {
+		apierror.Abort(c, apierror.New(apierror.SelfReference, "Could not merge user into itself"))
+		return
+	}
+
+	store := tenant.Store(c, ctrl.store)
+	tx, err := store.Begin()
+	if err != nil {
+		glog.Errorf("Failed to create new db transaction: %s", err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to start new db transaction"))
+		return
+	}
+
+	var users []*model.User
+	for _, email := range []string{sourceEmail, targetEmail} {
+		user, err := tx.FindUser(email)
+		if err == data.ErrNotFound {
+			tx.Rollback()
+			apierror.Abort(c, apierror.New(apierror.UserNotFound, "User with email %s does not exist", email))
+			return
+		}
+		if err != nil {
+			tx.Rollback()
+			glog.Errorf("Failed to get user %s: %s", email, err)
+			apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get user"))
+			return
+		}
+
+		users = append(users, user)
+	}
+	source, target := users[0], users[1]
+	if source.ID == target.ID {
+		tx.Rollback()
+		apierror.Abort(c, apierror.New(apierror.SelfReference, "Could not merge user into itself"))
+		return
+	}
+
+	if err := tx.MergeUsers(source.ID, target.ID); err != nil {
+		tx.Rollback()
+		if err == data.ErrSelfEdge {
+			apierror.Abort(c, apierror.New(apierror.Conflict, "Could not merge users who are friends, subscribed to or blocking each other, or have pending friend request between them"))
+			return
+		}
+
+		glog.Errorf("Failed to merge user %s into %s: %s", sourceEmail, targetEmail, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to merge users"))
+		return
+	}
+
+	// profile of target user wins, source only fills what target left empty
+	if mergeProfile(target, source) {
+		if err := tx.UpdateProfile(target); err != nil {
+			tx.Rollback()
+			glog.Errorf("Failed to update profile of %s: %s", targetEmail, err)
+			apierror.Abort(c, apierror.New(apierror.Internal, "Failed to update profile"))
+			return
+		}
+	}
+
+	audit.Record(c, model.AuditUserMerged, source.Email, target.Email, "")
+	if !audit.Commit(c, tx) {
+		return
+	}
+
+	c.JSON(http.StatusOK, response.ProfileResponse{Success: true, Profile: profileItem(target)})
+}
+
+// mergeProfile copy profile field of source into the one left empty in target, returns whether target changed
+func mergeProfile(target, source *model.User) bool {
+	changed := false
+	for _, field := range []struct{ target, source *string }{
+		{&target.DisplayName, &source.DisplayName},
+		{&target.AvatarURL, &source.AvatarURL},
+		{&target.Locale, &source.Locale},
+		{&target.Timezone, &source.Timezone},
+		{&target.Bio, &source.Bio},
+	} {
+		if *field.target == "" && *field.source != "" {
+			*field.target = *field.source
+			changed = true
+		}
+	}
+
+	return changed
+}
@@ -0,0 +1,176 @@
+package user
+
+import (
+	"fmgo/common/apierror"
+	"fmgo/common/audit"
+	"fmgo/common/auth"
+	"fmgo/common/data"
+	"fmgo/common/data/model"
+	"fmgo/common/tenant"
+	"fmgo/common/validation"
+	"fmgo/module/user/request"
+	"fmgo/module/user/response"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/golang/glog"
+)
+
+// AddAlias action to make another email address resolve to the user of given email address
+func (ctrl *Controller) AddAlias(c *gin.Context) {
+	var req request.AliasRequest
+	if !validation.Bind(c, &req, binding.JSON) {
+		return
+	}
+
+	if !auth.Authorize(c, ctrl.canonicalizer.Canonicalize(req.Email)) {
+		return
+	}
+
+	email, aliasEmail := ctrl.canonicalizer.Canonicalize(req.Email), ctrl.canonicalizer.Canonicalize(req.Alias)
+	store := tenant.Store(c, ctrl.store)
+	tx, err := store.Begin()
+	if err != nil {
+		glog.Errorf("Failed to create new db transaction: %s", err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to start new db transaction"))
+		return
+	}
+
+	user, err := tx.FindUser(email)
+	if err == data.ErrNotFound {
+		tx.Rollback()
+		apierror.Abort(c, apierror.New(apierror.UserNotFound, "User with email %s does not exist", email))
+		return
+	}
+	if err != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to get user %s: %s", email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get user"))
+		return
+	}
+
+	if aliasEmail == user.Email {
+		tx.Rollback()
+		apierror.Abort(c, apierror.NewField(apierror.AlreadyExists, "alias", "Alias is the primary email of the user"))
+		return
+	}
+
+	alias := model.UserAlias{Email: aliasEmail, UserID: user.ID}
+	if err := tx.AddAlias(&alias); err != nil {
+		tx.Rollback()
+		if err == data.ErrEmailTaken {
+			apierror.Abort(c, apierror.NewField(apierror.AlreadyExists, "alias", "Email %s is already used by another user, merge both users instead", aliasEmail))
+			return
+		}
+
+		glog.Errorf("Failed to add alias %s of %s: %s", aliasEmail, user.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to add alias"))
+		return
+	}
+
+	audit.Record(c, model.AuditAliasAdded, user.Email, alias.Email, "")
+	if !audit.Commit(c, tx) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "email": user.Email, "alias": alias.Email})
+}
+
+// GetAliases action to get all alias of given email address
+func (ctrl *Controller) GetAliases(c *gin.Context) {
+	var req request.GetAliasesRequest
+	if !validation.Bind(c, &req, binding.JSON) {
+		return
+	}
+
+	if !auth.Authorize(c, ctrl.canonicalizer.Canonicalize(req.Email)) {
+		return
+	}
+
+	store := tenant.Store(c, ctrl.store)
+	user, err := store.FindUser(ctrl.canonicalizer.Canonicalize(req.Email))
+	if err == data.ErrNotFound {
+		apierror.Abort(c, apierror.New(apierror.UserNotFound, "User with email %s does not exist", req.Email))
+		return
+	}
+	if err != nil {
+		glog.Errorf("Failed to get user %s: %s", req.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get user"))
+		return
+	}
+
+	aliases, err := store.Aliases(user.ID)
+	if err != nil {
+		glog.Errorf("Failed to get aliases of %s: %s", user.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get alias list"))
+		return
+	}
+
+	items := make([]response.AliasItem, 0)
+	for _, alias := range aliases {
+		items = append(items, response.AliasItem{Email: alias.Email, CreatedAt: alias.CreatedAt})
+	}
+
+	resp := response.AliasListResponse{
+		Success: true,
+		Email:   user.Email,
+		Aliases: items,
+		Count:   len(items),
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// RemoveAlias action to stop alias from resolving to the user of given email address
+func (ctrl *Controller) RemoveAlias(c *gin.Context) {
+	var req request.AliasRequest
+	if !validation.Bind(c, &req, binding.JSON) {
+		return
+	}
+
+	if !auth.Authorize(c, ctrl.canonicalizer.Canonicalize(req.Email)) {
+		return
+	}
+
+	store := tenant.Store(c, ctrl.store)
+	tx, err := store.Begin()
+	if err != nil {
+		glog.Errorf("Failed to create new db transaction: %s", err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to start new db transaction"))
+		return
+	}
+
+	user, err := tx.FindUser(ctrl.canonicalizer.Canonicalize(req.Email))
+	if err == data.ErrNotFound {
+		tx.Rollback()
+		apierror.Abort(c, apierror.New(apierror.NotFound, "Alias does not exist"))
+		return
+	}
+	if err != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to get user %s: %s", req.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get user"))
+		return
+	}
+
+	aliasEmail := ctrl.canonicalizer.Canonicalize(req.Alias)
+	removed, err := tx.RemoveAlias(user.ID, aliasEmail)
+	if err != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to remove alias %s of %s: %s", aliasEmail, user.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to remove alias"))
+		return
+	}
+	if !removed {
+		tx.Rollback()
+		apierror.Abort(c, apierror.New(apierror.NotFound, "Alias does not exist"))
+		return
+	}
+
+	audit.Record(c, model.AuditAliasRemoved, user.Email, aliasEmail, "")
+	if !audit.Commit(c, tx) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
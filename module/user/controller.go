@@ -0,0 +1,139 @@
+package user
+
+import (
+	"fmgo/common/apierror"
+	"fmgo/common/auth"
+	"fmgo/common/data"
+	"fmgo/common/data/model"
+	"fmgo/common/mailaddr"
+	"fmgo/common/tenant"
+	"fmgo/common/validation"
+	"fmgo/module/user/request"
+	"fmgo/module/user/response"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/golang/glog"
+)
+
+// localePattern BCP 47 language tag such as en, en-US or zh-Hant-TW
+var localePattern = regexp.MustCompile("^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$")
+
+// Controller struct
+type Controller struct {
+	store         data.GraphStore
+	canonicalizer *mailaddr.Canonicalizer
+}
+
+// NewController initialize new User Controller instance
+func NewController(store data.GraphStore, canonicalizer *mailaddr.Canonicalizer) *Controller {
+	return &Controller{store: store, canonicalizer: canonicalizer}
+}
+
+// GetProfile action to get profile of given email address
+func (ctrl *Controller) GetProfile(c *gin.Context) {
+	var req request.GetProfileRequest
+	if !validation.Bind(c, &req, binding.Form) {
+		return
+	}
+
+	store := tenant.Store(c, ctrl.store)
+	user, err := store.FindUser(ctrl.canonicalizer.Canonicalize(req.Email))
+	if err == data.ErrNotFound {
+		apierror.Abort(c, apierror.New(apierror.UserNotFound, "User with email %s does not exist", req.Email))
+		return
+	}
+	if err != nil {
+		glog.Errorf("Failed to get user %s: %s", req.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get user"))
+		return
+	}
+
+	c.JSON(http.StatusOK, response.ProfileResponse{Success: true, Profile: profileItem(user)})
+}
+
+// UpdateProfile action to replace profile of given email address
+func (ctrl *Controller) UpdateProfile(c *gin.Context) {
+	var req request.UpdateProfileRequest
+	if !validation.Bind(c, &req, binding.JSON) {
+		return
+	}
+
+	if !auth.Authorize(c, ctrl.canonicalizer.Canonicalize(req.Email)) {
+		return
+	}
+
+	var errs []*apierror.Error
+	if req.AvatarURL != "" {
+		if u, err := url.Parse(req.AvatarURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			errs = append(errs, apierror.NewField(apierror.ValidationFailed, "avatarUrl", "%s must use http or https scheme", "avatarUrl"))
+		}
+	}
+	if req.Locale != "" && !localePattern.MatchString(req.Locale) {
+		errs = append(errs, apierror.NewField(apierror.ValidationFailed, "locale", "%s is invalid", "locale"))
+	}
+	if req.Timezone != "" {
+		// Local depends on server setting, it is not a timezone client can mean
+		if _, err := time.LoadLocation(req.Timezone); err != nil || req.Timezone == "Local" {
+			errs = append(errs, apierror.NewField(apierror.ValidationFailed, "timezone", "%s is invalid", "timezone"))
+		}
+	}
+	if len(errs) > 0 {
+		apierror.Abort(c, errs...)
+		return
+	}
+
+	store := tenant.Store(c, ctrl.store)
+	tx, err := store.Begin()
+	if err != nil {
+		glog.Errorf("Failed to create new db transaction: %s", err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to start new db transaction"))
+		return
+	}
+
+	normalizeEmail := ctrl.canonicalizer.Canonicalize(req.Email)
+	user, err := tx.FindOrCreateUser(normalizeEmail)
+	if err != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to create user %s: %s", normalizeEmail, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to create new user"))
+		return
+	}
+
+	user.DisplayName = strings.TrimSpace(req.DisplayName)
+	user.AvatarURL = req.AvatarURL
+	user.Locale = req.Locale
+	user.Timezone = req.Timezone
+	user.Bio = strings.TrimSpace(req.Bio)
+	if err := tx.UpdateProfile(user); err != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to update profile of %s: %s", user.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to update profile"))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		glog.Errorf("Failed to commit db transaction: %s", err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to commit db transaction"))
+		return
+	}
+
+	c.JSON(http.StatusOK, response.ProfileResponse{Success: true, Profile: profileItem(user)})
+}
+
+func profileItem(user *model.User) response.ProfileItem {
+	return response.ProfileItem{
+		Email:       user.Email,
+		DisplayName: user.DisplayName,
+		AvatarURL:   user.AvatarURL,
+		Locale:      user.Locale,
+		Timezone:    user.Timezone,
+		Bio:         user.Bio,
+		UpdatedAt:   user.UpdatedAt,
+	}
+}
@@ -0,0 +1,12 @@
+package request
+
+// AliasRequest model
+type AliasRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Alias string `json:"alias" binding:"required,email"`
+}
+
+// GetAliasesRequest model
+type GetAliasesRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
@@ -0,0 +1,7 @@
+package request
+
+// ChangeEmailRequest model
+type ChangeEmailRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	NewEmail string `json:"newEmail" binding:"required,email"`
+}
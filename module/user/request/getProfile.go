@@ -0,0 +1,6 @@
+package request
+
+// GetProfileRequest model
+type GetProfileRequest struct {
+	Email string `form:"email" binding:"required,email"`
+}
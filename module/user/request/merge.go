@@ -0,0 +1,9 @@
+package request
+
+// MergeRequest model, source user is merged into target user and removed
+type MergeRequest struct {
+	Source string `json:"source" binding:"required,email"`
+	Target string `json:"target" binding:"required,email"`
+	// SourceToken bearer token of source user proving its consent, only required when authentication is enabled
+	SourceToken string `json:"sourceToken"`
+}
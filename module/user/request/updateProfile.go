@@ -0,0 +1,11 @@
+package request
+
+// UpdateProfileRequest model, every profile field is replaced so omitted field is cleared
+type UpdateProfileRequest struct {
+	Email       string `json:"email" binding:"required,email"`
+	DisplayName string `json:"displayName" binding:"omitempty,max=100"`
+	AvatarURL   string `json:"avatarUrl" binding:"omitempty,url,max=2048"`
+	Locale      string `json:"locale" binding:"omitempty,max=35"`
+	Timezone    string `json:"timezone" binding:"omitempty,max=64"`
+	Bio         string `json:"bio" binding:"omitempty,max=1000"`
+}
@@ -0,0 +1,17 @@
+package response
+
+import "time"
+
+// AliasListResponse model
+type AliasListResponse struct {
+	Success bool        `json:"success"`
+	Email   string      `json:"email"`
+	Aliases []AliasItem `json:"aliases"`
+	Count   int         `json:"count"`
+}
+
+// AliasItem model
+type AliasItem struct {
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"createdAt"`
+}
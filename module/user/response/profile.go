@@ -0,0 +1,20 @@
+package response
+
+import "time"
+
+// ProfileResponse model
+type ProfileResponse struct {
+	Success bool        `json:"success"`
+	Profile ProfileItem `json:"profile"`
+}
+
+// ProfileItem model
+type ProfileItem struct {
+	Email       string    `json:"email"`
+	DisplayName string    `json:"displayName"`
+	AvatarURL   string    `json:"avatarUrl"`
+	Locale      string    `json:"locale"`
+	Timezone    string    `json:"timezone"`
+	Bio         string    `json:"bio"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
@@ -0,0 +1,216 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmgo/common/apierror"
+	"fmgo/common/auth"
+	"fmgo/common/config"
+	"fmgo/common/data"
+	"fmgo/common/data/model"
+	"fmgo/common/delivery"
+	"fmgo/common/mailaddr"
+	"fmgo/common/tenant"
+	"fmgo/common/validation"
+	"fmgo/module/webhook/request"
+	"fmgo/module/webhook/response"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/golang/glog"
+	"github.com/satori/go.uuid"
+)
+
+// Controller struct
+type Controller struct {
+	store         data.GraphStore
+	webhookConfig config.WebhookConfiguration
+	canonicalizer *mailaddr.Canonicalizer
+}
+
+// NewController initialize new Webhook Controller instance
+func NewController(store data.GraphStore, webhookConfig config.WebhookConfiguration, canonicalizer *mailaddr.Canonicalizer) *Controller {
+	return &Controller{store: store, webhookConfig: webhookConfig, canonicalizer: canonicalizer}
+}
+
+// Register action to register URL that receives every update delivered to given email address
+func (ctrl *Controller) Register(c *gin.Context) {
+	var req request.RegisterWebhookRequest
+	if !validation.Bind(c, &req, binding.JSON) {
+		return
+	}
+
+	if !auth.Authorize(c, ctrl.canonicalizer.Canonicalize(req.Email)) {
+		return
+	}
+
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		apierror.Abort(c, apierror.NewField(apierror.ValidationFailed, "url", "%s must use http or https scheme", "url"))
+		return
+	}
+
+	// webhook is posted from inside the network, so it must not be aimed at internal service such as cloud metadata
+	if !ctrl.webhookConfig.AllowPrivateHosts {
+		if _, err := delivery.ResolvePublic(c.Request.Context(), u.Hostname()); err == delivery.ErrInternalAddress {
+			apierror.Abort(c, apierror.NewField(apierror.ValidationFailed, "url", "%s must be a public address", "url"))
+			return
+		} else if err != nil {
+			apierror.Abort(c, apierror.NewField(apierror.ValidationFailed, "url", "%s host could not be resolved", "url"))
+			return
+		}
+	}
+
+	secret := req.Secret
+	if secret == "" {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			glog.Errorf("Failed to generate webhook secret: %s", err)
+			apierror.Abort(c, apierror.New(apierror.Internal, "Failed to generate webhook secret"))
+			return
+		}
+		secret = hex.EncodeToString(buf)
+	}
+
+	store := tenant.Store(c, ctrl.store)
+	tx, err := store.Begin()
+	if err != nil {
+		glog.Errorf("Failed to create new db transaction: %s", err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to start new db transaction"))
+		return
+	}
+
+	normalizeEmail := ctrl.canonicalizer.Canonicalize(req.Email)
+	user, err := tx.FindOrCreateUser(normalizeEmail)
+	if err != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to create user %s: %s", normalizeEmail, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to create new user"))
+		return
+	}
+
+	webhook := model.Webhook{UserID: user.ID, URL: req.URL, Secret: secret}
+	if err := tx.CreateWebhook(&webhook); err != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to create webhook for %s: %s", user.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to create webhook"))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		glog.Errorf("Failed to commit db transaction: %s", err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to commit db transaction"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "id": webhook.ID.String(), "secret": secret})
+}
+
+// GetWebhooks action to get all webhook registered by given email address
+func (ctrl *Controller) GetWebhooks(c *gin.Context) {
+	var req request.GetWebhooksRequest
+	if !validation.Bind(c, &req, binding.JSON) {
+		return
+	}
+
+	if !auth.Authorize(c, ctrl.canonicalizer.Canonicalize(req.Email)) {
+		return
+	}
+
+	store := tenant.Store(c, ctrl.store)
+	user, err := store.FindUser(ctrl.canonicalizer.Canonicalize(req.Email))
+	if err == data.ErrNotFound {
+		apierror.Abort(c, apierror.New(apierror.UserNotFound, "User with email %s does not exist", req.Email))
+		return
+	}
+	if err != nil {
+		glog.Errorf("Failed to get user %s: %s", req.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get user"))
+		return
+	}
+
+	webhooks, err := store.Webhooks([]uuid.UUID{user.ID})
+	if err != nil {
+		glog.Errorf("Failed to get webhooks of %s: %s", user.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get webhook list"))
+		return
+	}
+
+	items := make([]response.WebhookItem, 0)
+	for _, webhook := range webhooks {
+		items = append(items, response.WebhookItem{
+			ID:        webhook.ID.String(),
+			URL:       webhook.URL,
+			CreatedAt: webhook.CreatedAt,
+		})
+	}
+
+	resp := response.WebhookListResponse{
+		Success:  true,
+		Webhooks: items,
+		Count:    len(items),
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// Remove action to remove webhook registered by given email address
+func (ctrl *Controller) Remove(c *gin.Context) {
+	var req request.RemoveWebhookRequest
+	if !validation.Bind(c, &req, binding.JSON) {
+		return
+	}
+
+	if !auth.Authorize(c, ctrl.canonicalizer.Canonicalize(req.Email)) {
+		return
+	}
+
+	webhookID, err := uuid.FromString(req.ID)
+	if err != nil {
+		apierror.Abort(c, apierror.NewField(apierror.ValidationFailed, "id", "%s is invalid", "id"))
+		return
+	}
+
+	store := tenant.Store(c, ctrl.store)
+	tx, err := store.Begin()
+	if err != nil {
+		glog.Errorf("Failed to create new db transaction: %s", err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to start new db transaction"))
+		return
+	}
+
+	user, err := tx.FindUser(ctrl.canonicalizer.Canonicalize(req.Email))
+	if err == data.ErrNotFound {
+		tx.Rollback()
+		apierror.Abort(c, apierror.New(apierror.NotFound, "Webhook does not exist"))
+		return
+	}
+	if err != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to get user %s: %s", req.Email, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to get user"))
+		return
+	}
+
+	removed, err := tx.DeleteWebhook(user.ID, webhookID)
+	if err != nil {
+		tx.Rollback()
+		glog.Errorf("Failed to remove webhook %s: %s", webhookID, err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to remove webhook"))
+		return
+	}
+	if !removed {
+		tx.Rollback()
+		apierror.Abort(c, apierror.New(apierror.NotFound, "Webhook does not exist"))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		glog.Errorf("Failed to commit db transaction: %s", err)
+		apierror.Abort(c, apierror.New(apierror.Internal, "Failed to commit db transaction"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
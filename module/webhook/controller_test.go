@@ -0,0 +1,72 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmgo/common/apierror"
+	"fmgo/common/config"
+	"fmgo/common/data"
+	"fmgo/common/mailaddr"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// register post webhook register request of andy with given URL, returning status and decoded response body
+func register(t *testing.T, cfg config.WebhookConfiguration, url string) (int, map[string]interface{}) {
+	gin.SetMode(gin.TestMode)
+	ctrl := NewController(data.NewMemoryStore(), cfg, mailaddr.NewCanonicalizer(config.EmailConfiguration{CaseFolding: true}))
+	router := gin.New()
+	router.Use(apierror.Handler())
+	router.POST("/webhook/register", ctrl.Register)
+
+	body, _ := json.Marshal(map[string]string{"email": "andy@example.com", "url": url})
+	req := httptest.NewRequest(http.MethodPost, "/webhook/register", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("register responded with invalid JSON %q: %s", w.Body.String(), err)
+	}
+
+	return w.Code, resp
+}
+
+func TestRegisterInternalAddress(t *testing.T) {
+	for _, url := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://localhost/hook",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://10.0.0.5/hook",
+		"http://192.168.1.10/hook",
+		"https://[::1]/hook",
+		"http://[fd00::1]/hook",
+	} {
+		status, resp := register(t, config.WebhookConfiguration{}, url)
+		errs, _ := resp["errors"].([]interface{})
+		if status != http.StatusBadRequest || len(errs) == 0 {
+			t.Errorf("register %s responded %d %v", url, status, resp)
+			continue
+		}
+		if e := errs[0].(map[string]interface{}); e["code"] != string(apierror.ValidationFailed) || e["field"] != "url" {
+			t.Errorf("register %s responded %v", url, resp)
+		}
+	}
+}
+
+func TestRegisterPublicAddress(t *testing.T) {
+	status, resp := register(t, config.WebhookConfiguration{}, "https://93.184.216.34/hook")
+	if status != http.StatusOK || resp["secret"] == "" {
+		t.Fatalf("register of public address responded %d %v", status, resp)
+	}
+
+	// private host is only allowed when configured so
+	status, resp = register(t, config.WebhookConfiguration{AllowPrivateHosts: true}, "http://127.0.0.1:8080/hook")
+	if status != http.StatusOK {
+		t.Fatalf("register of loopback address with private hosts allowed responded %d %v", status, resp)
+	}
+}
@@ -0,0 +1,6 @@
+package request
+
+// GetWebhooksRequest model
+type GetWebhooksRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
@@ -0,0 +1,8 @@
+package request
+
+// RegisterWebhookRequest model, random secret is generated when Secret is empty
+type RegisterWebhookRequest struct {
+	Email  string `json:"email" binding:"required,email"`
+	URL    string `json:"url" binding:"required,url,max=2048"`
+	Secret string `json:"secret" binding:"omitempty,min=16,max=128"`
+}
@@ -0,0 +1,7 @@
+package request
+
+// RemoveWebhookRequest model
+type RemoveWebhookRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	ID    string `json:"id" binding:"required,uuid"`
+}
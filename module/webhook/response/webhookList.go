@@ -0,0 +1,17 @@
+package response
+
+import "time"
+
+// WebhookListResponse model
+type WebhookListResponse struct {
+	Success  bool          `json:"success"`
+	Webhooks []WebhookItem `json:"webhooks"`
+	Count    int           `json:"count"`
+}
+
+// WebhookItem model, secret is only revealed once when webhook is registered
+type WebhookItem struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"createdAt"`
+}